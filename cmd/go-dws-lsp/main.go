@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/CWBudde/go-dws-lsp/internal/lsp"
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/transport"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
-	glspserver "github.com/tliron/glsp/server"
 )
 
 const (
@@ -43,6 +45,11 @@ func usage() {
 }
 
 func main() {
+	// The server starts itself to run scripts, see lsp.ScriptRunnerEnv
+	if os.Getenv(lsp.ScriptRunnerEnv) != "" {
+		os.Exit(lsp.RunScriptProcess(os.Stdin, os.Stdout))
+	}
+
 	flag.Parse()
 
 	// Print version if requested
@@ -59,15 +66,24 @@ func main() {
 	// Set up logging
 	setupLogging()
 
-	// Create GLSP handler and server
+	// Create GLSP handler and the JSON-RPC handler that dispatches to it.
+	// Heavy requests run concurrently so that $/cancelRequest can reach them.
 	handler := createHandler()
-	glspServer := glspserver.NewServer(&handler, "go-dws-lsp", false)
+	rpcHandler := transport.NewHandler(&handler, srv.Requests(),
+		string(protocol.MethodTextDocumentReferences),
+		string(protocol.MethodTextDocumentRename),
+		string(protocol.MethodWorkspaceSymbol),
+		string(protocol.MethodCallHierarchyIncomingCalls),
+		string(protocol.MethodCodeLensResolve),
+		string(protocol317.MethodWorkspaceDiagnostic),
+		string(protocol.MethodWorkspaceExecuteCommand),
+	)
 
 	// Store our server instance for handler access
 	lsp.SetServer(srv)
 
 	// Start server with appropriate transport
-	runServer(glspServer)
+	runServer(context.Background(), rpcHandler)
 }
 
 // printStartupInfo prints server startup information to stderr.
@@ -84,70 +100,122 @@ func printStartupInfo() {
 	fmt.Fprintf(os.Stderr, "Log level: %s\n", logLevel)
 }
 
-// createHandler creates and configures the GLSP protocol handler.
-func createHandler() protocol.Handler {
-	return protocol.Handler{
-		Initialize:  lsp.Initialize,
-		Initialized: lsp.Initialized,
-		Shutdown:    lsp.Shutdown,
-		SetTrace:    func(context *glsp.Context, params *protocol.SetTraceParams) error { return nil },
+// createHandler creates and configures the protocol handler.
+func createHandler() protocol317.Handler {
+	return protocol317.Handler{
+		Handler: protocol.Handler{
+			Initialize:  lsp.Initialize,
+			Initialized: lsp.Initialized,
+			Shutdown:    lsp.Shutdown,
+			SetTrace:    func(context *glsp.Context, params *protocol.SetTraceParams) error { return nil },
+
+			// Workspace notifications
+			WorkspaceDidChangeConfiguration:    lsp.DidChangeConfiguration,
+			WorkspaceDidChangeWorkspaceFolders: lsp.DidChangeWorkspaceFolders,
+			WorkspaceDidChangeWatchedFiles:     lsp.DidChangeWatchedFiles,
+
+			// Text document notifications (Phase 1: Document Synchronization)
+			TextDocumentDidOpen:   lsp.DidOpen,
+			TextDocumentDidClose:  lsp.DidClose,
+			TextDocumentDidChange: lsp.DidChange,
+
+			// Text document requests (Phase 4: Hover Support)
+			TextDocumentHover: lsp.Hover,
+
+			// Text document requests (Phase 5: Go-to Definition)
+			TextDocumentDefinition: lsp.Definition,
+
+			// Text document requests (Go to Declaration and Type Definition)
+			TextDocumentDeclaration:    lsp.Declaration,
+			TextDocumentTypeDefinition: lsp.TypeDefinition,
+
+			// Text document requests (Go to Implementation)
+			TextDocumentImplementation: lsp.Implementation,
+
+			// Text document requests (Phase 6: Find References)
+			TextDocumentReferences: lsp.References,
+
+			// Text document requests (Phase 7: Document Symbols)
+			TextDocumentDocumentSymbol: lsp.DocumentSymbol,
+
+			// Workspace requests (Phase 8: Workspace Symbols)
+			WorkspaceSymbol: lsp.WorkspaceSymbol,
+
+			// Workspace requests (Server Commands)
+			WorkspaceExecuteCommand: lsp.ExecuteCommand,
+
+			// Text document requests (Phase 9: Code Completion)
+			TextDocumentCompletion: lsp.Completion,
+
+			// Text document requests (Phase 10: Signature Help)
+			TextDocumentSignatureHelp: lsp.SignatureHelp,
+
+			// Text document requests (Phase 11: Rename Support)
+			TextDocumentRename:        lsp.Rename,
+			TextDocumentPrepareRename: lsp.PrepareRename,
 
-		// Workspace notifications
-		WorkspaceDidChangeConfiguration:    lsp.DidChangeConfiguration,
-		WorkspaceDidChangeWorkspaceFolders: lsp.DidChangeWorkspaceFolders,
+			// Text document requests (Phase 12: Semantic Tokens)
+			TextDocumentSemanticTokensFull:      lsp.SemanticTokensFull,
+			TextDocumentSemanticTokensFullDelta: lsp.SemanticTokensFullDelta,
 
-		// Text document notifications (Phase 1: Document Synchronization)
-		TextDocumentDidOpen:   lsp.DidOpen,
-		TextDocumentDidClose:  lsp.DidClose,
-		TextDocumentDidChange: lsp.DidChange,
+			// Text document requests (Phase 13: Code Actions)
+			TextDocumentCodeAction: lsp.CodeAction,
 
-		// Text document requests (Phase 4: Hover Support)
-		TextDocumentHover: lsp.Hover,
+			// Text document requests (Formatting)
+			TextDocumentFormatting:       lsp.DocumentFormatting,
+			TextDocumentRangeFormatting:  lsp.DocumentRangeFormatting,
+			TextDocumentOnTypeFormatting: lsp.OnTypeFormatting,
 
-		// Text document requests (Phase 5: Go-to Definition)
-		TextDocumentDefinition: lsp.Definition,
+			// Text document requests (Document Highlight)
+			TextDocumentDocumentHighlight: lsp.DocumentHighlight,
 
-		// Text document requests (Phase 6: Find References)
-		TextDocumentReferences: lsp.References,
+			// Text document requests (Folding Ranges)
+			TextDocumentFoldingRange: lsp.FoldingRange,
 
-		// Text document requests (Phase 7: Document Symbols)
-		TextDocumentDocumentSymbol: lsp.DocumentSymbol,
+			// Text document requests (Selection Ranges)
+			TextDocumentSelectionRange: lsp.SelectionRange,
 
-		// Workspace requests (Phase 8: Workspace Symbols)
-		WorkspaceSymbol: lsp.WorkspaceSymbol,
+			// Text document requests (Call Hierarchy)
+			TextDocumentPrepareCallHierarchy: lsp.PrepareCallHierarchy,
+			CallHierarchyIncomingCalls:       lsp.CallHierarchyIncomingCalls,
+			CallHierarchyOutgoingCalls:       lsp.CallHierarchyOutgoingCalls,
 
-		// Text document requests (Phase 9: Code Completion)
-		TextDocumentCompletion: lsp.Completion,
+			// Text document requests (Code Lens)
+			TextDocumentCodeLens: lsp.CodeLens,
+			CodeLensResolve:      lsp.CodeLensResolve,
 
-		// Text document requests (Phase 10: Signature Help)
-		TextDocumentSignatureHelp: lsp.SignatureHelp,
+			// Text document requests (Document Links)
+			TextDocumentDocumentLink: lsp.DocumentLink,
+			DocumentLinkResolve:      lsp.DocumentLinkResolve,
+		},
 
-		// Text document requests (Phase 11: Rename Support)
-		TextDocumentRename:        lsp.Rename,
-		TextDocumentPrepareRename: lsp.PrepareRename,
+		// Text document requests (Inlay Hints)
+		TextDocumentInlayHint: lsp.InlayHint,
 
-		// Text document requests (Phase 12: Semantic Tokens)
-		TextDocumentSemanticTokensFull:      lsp.SemanticTokensFull,
-		TextDocumentSemanticTokensFullDelta: lsp.SemanticTokensFullDelta,
+		// Text document requests (Type Hierarchy)
+		TextDocumentPrepareTypeHierarchy: lsp.PrepareTypeHierarchy,
+		TypeHierarchySupertypes:          lsp.TypeHierarchySupertypes,
+		TypeHierarchySubtypes:            lsp.TypeHierarchySubtypes,
 
-		// Text document requests (Phase 13: Code Actions)
-		TextDocumentCodeAction: lsp.CodeAction,
+		// Pull diagnostics
+		TextDocumentDiagnostic: lsp.DocumentDiagnostic,
+		WorkspaceDiagnostic:    lsp.WorkspaceDiagnostic,
 	}
 }
 
-// runServer starts the GLSP server with the appropriate transport.
-func runServer(glspServer *glspserver.Server) {
+// runServer starts the server with the appropriate transport.
+func runServer(ctx context.Context, handler *transport.Handler) {
 	if tcpMode {
 		fmt.Fprintf(os.Stderr, "Starting TCP server on port %d...\n", tcpPort)
 
-		err := glspServer.RunTCP(fmt.Sprintf("127.0.0.1:%d", tcpPort))
+		err := transport.RunTCP(ctx, fmt.Sprintf("127.0.0.1:%d", tcpPort), handler)
 		if err != nil {
 			log.Fatalf("TCP server error: %v", err)
 		}
 	} else {
 		fmt.Fprintf(os.Stderr, "Starting STDIO server...\n")
 
-		err := glspServer.RunStdio()
+		err := transport.RunStdio(ctx, handler)
 		if err != nil {
 			log.Fatalf("STDIO server error: %v", err)
 		}
@@ -4,6 +4,7 @@ go 1.24
 
 require (
 	github.com/cwbudde/go-dws v0.3.1-0.20251108175356-790bc43db6be
+	github.com/sourcegraph/jsonrpc2 v0.2.0
 	github.com/stretchr/testify v1.11.1
 	github.com/tliron/glsp v0.2.2
 )
@@ -23,7 +24,6 @@ require (
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/sasha-s/go-deadlock v0.3.1 // indirect
 	github.com/segmentio/ksuid v1.0.4 // indirect
-	github.com/sourcegraph/jsonrpc2 v0.2.0 // indirect
 	github.com/tliron/commonlog v0.2.17 // indirect
 	github.com/tliron/kutil v0.3.25 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
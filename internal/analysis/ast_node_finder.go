@@ -118,3 +118,128 @@ func GetSymbolName(node ast.Node) string {
 
 	return ""
 }
+
+// nodeSpan is the source range covered by a node and all its descendants.
+type nodeSpan struct {
+	start, end token.Position
+}
+
+// FindNodePathAtPosition returns the chain of nodes containing the given
+// position, from the program down to the most specific (deepest) node.
+// Returns nil if no node is found.
+//
+// Unlike FindNodeAtPosition, a node is taken to cover its descendants too,
+// since some nodes start at their operator, such as an assignment at its :=.
+// The position parameters (line, col) are 1-based, as for FindNodeAtPosition.
+func FindNodePathAtPosition(program *ast.Program, line, col int) []ast.Node {
+	path, _ := nodePathAtPosition(program, token.Position{Line: line, Column: col})
+	return path
+}
+
+// nodePathAtPosition returns the path of nodes containing target, together
+// with the spans computed for them.
+func nodePathAtPosition(program *ast.Program, target token.Position) ([]ast.Node, map[ast.Node]nodeSpan) {
+	if program == nil {
+		return nil, nil
+	}
+
+	spans := make(map[ast.Node]nodeSpan)
+
+	var path []ast.Node
+
+	for node := ast.Node(program); node != nil; {
+		span, ok := subtreeSpan(node, spans)
+		if !ok || !positionInRange(target, span.start, span.end) {
+			break
+		}
+
+		path = append(path, node)
+
+		// Descend into the last child containing the position
+		var next ast.Node
+
+		for _, child := range childNodes(node) {
+			if span, ok := subtreeSpan(child, spans); ok && positionInRange(target, span.start, span.end) {
+				next = child
+			}
+		}
+
+		node = next
+	}
+
+	return path, spans
+}
+
+// subtreeSpan returns the span of node and its descendants, caching the
+// spans of every node visited. The second result is false if no node in the
+// subtree has a valid position.
+func subtreeSpan(node ast.Node, spans map[ast.Node]nodeSpan) (nodeSpan, bool) {
+	if span, ok := spans[node]; ok {
+		return span, true
+	}
+
+	var (
+		span  nodeSpan
+		found bool
+	)
+
+	if start, end := node.Pos(), node.End(); start.Line > 0 && start.Column > 0 && !positionLess(end, start) {
+		span = nodeSpan{start: lineColumn(start), end: lineColumn(end)}
+		found = true
+	}
+
+	for _, child := range childNodes(node) {
+		childSpan, ok := subtreeSpan(child, spans)
+		if !ok {
+			continue
+		}
+
+		if !found {
+			span, found = childSpan, true
+			continue
+		}
+
+		if positionLess(childSpan.start, span.start) {
+			span.start = childSpan.start
+		}
+
+		if positionLess(span.end, childSpan.end) {
+			span.end = childSpan.end
+		}
+	}
+
+	if found {
+		spans[node] = span
+	}
+
+	return span, found
+}
+
+// childNodes returns the direct children of node.
+func childNodes(node ast.Node) []ast.Node {
+	var children []ast.Node
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+
+		if n != nil {
+			children = append(children, n)
+		}
+
+		// Don't descend into grandchildren
+		return false
+	})
+
+	return children
+}
+
+// positionLess reports whether a comes before b, ignoring byte offsets.
+func positionLess(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+
+	return a.Column < b.Column
+}
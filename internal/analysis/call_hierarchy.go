@@ -0,0 +1,659 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+	"github.com/cwbudde/go-dws/pkg/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// maxClassDepth bounds the walk up a class hierarchy, in case of cycles.
+const maxClassDepth = 32
+
+// CallSite is a call of a routine in a routine body or in the main code of a
+// program.
+type CallSite struct {
+	// Name is the identifier naming the called routine
+	Name *ast.Identifier
+
+	// Object is the expression the routine is called on, such as o in o.Run,
+	// or nil for a plain call
+	Object ast.Expression
+}
+
+// CallSites returns the calls made by node, a routine or a whole program, in
+// the order of the syntax tree. Calls inside nested routines are left out, as
+// they belong to those routines; for a program this leaves the calls of the
+// main code. A statement consisting of just a name, like "Helper;" or
+// "o.Run;", calls a routine without arguments, and so does a constructor
+// reference like TFoo.Create.
+func CallSites(node ast.Node) []CallSite {
+	var sites []CallSite
+
+	add := func(name *ast.Identifier, object ast.Expression) {
+		if name != nil {
+			sites = append(sites, CallSite{Name: name, Object: object})
+		}
+	}
+
+	// Member accesses already recorded as calls by their parent
+	called := make(map[*ast.MemberAccessExpression]bool)
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionDecl:
+			return n == node
+
+		case *ast.CallExpression:
+			switch function := n.Function.(type) {
+			case *ast.Identifier:
+				add(function, nil)
+			case *ast.MemberAccessExpression:
+				add(function.Member, function.Object)
+				called[function] = true
+			}
+
+		case *ast.MethodCallExpression:
+			add(n.Method, n.Object)
+
+		case *ast.ExpressionStatement:
+			switch expression := n.Expression.(type) {
+			case *ast.Identifier:
+				add(expression, nil)
+			case *ast.MemberAccessExpression:
+				add(expression.Member, expression.Object)
+				called[expression] = true
+			}
+
+		case *ast.MemberAccessExpression:
+			// A constructor call without arguments, as in "o := TFoo.Create"
+			if !called[n] && n.Member != nil && strings.EqualFold(n.Member.Value, "Create") {
+				add(n.Member, n.Object)
+			}
+		}
+
+		return true
+	})
+
+	return sites
+}
+
+// Routines returns the routines of program that have a body, including
+// methods and nested routines, in source order.
+func Routines(program *ast.Program) []*ast.FunctionDecl {
+	var routines []*ast.FunctionDecl
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if decl, ok := n.(*ast.FunctionDecl); ok && decl.Name != nil && decl.Body != nil {
+			routines = append(routines, decl)
+		}
+
+		return true
+	})
+
+	return routines
+}
+
+// Routine identifies a routine declaration in a document. A nil Decl stands
+// for the main code of the document.
+type Routine struct {
+	URI  string
+	Decl *ast.FunctionDecl
+}
+
+// Call lists the call sites of one routine in another: the callee's name in
+// each call made by the caller.
+type Call struct {
+	Routine Routine
+	Sites   []*ast.Identifier
+}
+
+// CallResolver resolves calls to the routines they call. It looks at the open
+// documents and at the files of the workspace index, which are parsed from
+// disk on demand and cached for the lifetime of the resolver.
+type CallResolver struct {
+	docs     *server.DocumentStore
+	index    *workspace.SymbolIndex
+	programs map[string]*dwscript.Program
+}
+
+// NewCallResolver creates a call resolver. Either argument may be nil.
+func NewCallResolver(docs *server.DocumentStore, index *workspace.SymbolIndex) *CallResolver {
+	return &CallResolver{
+		docs:     docs,
+		index:    index,
+		programs: make(map[string]*dwscript.Program),
+	}
+}
+
+// SetProgram makes the resolver use program for uri, such as the last good
+// program of an open document whose current text doesn't compile.
+func (r *CallResolver) SetProgram(uri string, program *dwscript.Program) {
+	r.programs[uri] = program
+}
+
+// Program returns the syntax tree of uri, or nil if it can't be parsed.
+func (r *CallResolver) Program(uri string) *ast.Program {
+	program := programForURI(uri, r.docs, r.programs)
+	if program == nil {
+		return nil
+	}
+
+	return program.AST()
+}
+
+// RoutineAt returns the routine declared or called at pos in uri, or nil if
+// there is none. Methods declared in a class body and forward declarations
+// are mapped to their implementation.
+func (r *CallResolver) RoutineAt(uri string, pos token.Position) *Routine {
+	program := r.Program(uri)
+	if program == nil {
+		return nil
+	}
+
+	path := FindNodePathAtPosition(program, pos.Line, pos.Column)
+	if len(path) == 0 {
+		return nil
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		if decl, ok := path[i].(*ast.FunctionDecl); ok && decl.Name != nil && path[len(path)-1] == decl.Name {
+			return implementation(uri, program, decl)
+		}
+	}
+
+	ident, ok := path[len(path)-1].(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+
+	return r.Callee(uri, CallSite{Name: ident, Object: callObject(path)})
+}
+
+// CalledMember returns the name of the class or interface in which the method
+// called at pos in uri is looked up, and the method's name. That is the type
+// of the object the method is called on, or the class of the enclosing method
+// for a plain call of one of its methods. It returns empty names if there is
+// no method call at pos.
+func (r *CallResolver) CalledMember(uri string, pos token.Position) (string, string) {
+	program := r.Program(uri)
+	if program == nil {
+		return "", ""
+	}
+
+	path := FindNodePathAtPosition(program, pos.Line, pos.Column)
+	if len(path) == 0 {
+		return "", ""
+	}
+
+	ident, ok := path[len(path)-1].(*ast.Identifier)
+	if !ok {
+		return "", ""
+	}
+
+	if object := callObject(path); object != nil {
+		if typeName := r.objectClass(uri, program, object, 0); typeName != "" {
+			return typeName, ident.Value
+		}
+
+		return "", ""
+	}
+
+	if routine := r.Callee(uri, CallSite{Name: ident}); routine != nil {
+		if className := r.ClassName(*routine); className != "" {
+			return className, ident.Value
+		}
+	}
+
+	return "", ""
+}
+
+// Callee returns the routine called at site in uri, or nil if it can't be
+// resolved. Calls on an object go to the method of the object's class or its
+// nearest ancestor declaring it; other calls are resolved like identifiers.
+func (r *CallResolver) Callee(uri string, site CallSite) *Routine {
+	program := r.Program(uri)
+	if program == nil || site.Name == nil {
+		return nil
+	}
+
+	if site.Object != nil {
+		if className := r.objectClass(uri, program, site.Object, 0); className != "" {
+			return r.method(uri, program, className, site.Name.Value, 0)
+		}
+	} else if className := r.selfClass(uri, program, site.Name.Pos()); className != "" {
+		// In a method, a plain call may go to another method of the class
+		if routine := r.method(uri, program, className, site.Name.Value, 0); routine != nil {
+			return routine
+		}
+	}
+
+	resolver := NewSymbolResolverWithIndex(uri, program, site.Name.Pos(), r.index)
+	for _, loc := range resolver.ResolveSymbol(site.Name.Value) {
+		routine := r.routineDeclaredAt(loc)
+
+		// Only calls on an object, or on Self within the class, go to a method
+		if routine != nil && (r.ClassName(*routine) == "") == (site.Object == nil) {
+			return routine
+		}
+	}
+
+	return nil
+}
+
+// ClassName returns the name of the class routine is a method of, or "".
+func (r *CallResolver) ClassName(routine Routine) string {
+	if routine.Decl == nil {
+		return ""
+	}
+
+	if routine.Decl.ClassName != nil {
+		return routine.Decl.ClassName.Value
+	}
+
+	if class := declaringClass(r.Program(routine.URI), routine.Decl); class != nil && class.Name != nil {
+		return class.Name.Value
+	}
+
+	return ""
+}
+
+// IncomingCalls returns the routines of the documents uris that call target,
+// with the call sites of each. The main code of a document that calls target
+// is reported as a routine with a nil Decl. The search stops early when ctx
+// is cancelled.
+func (r *CallResolver) IncomingCalls(ctx context.Context, target Routine, uris []string) []Call {
+	if target.Decl == nil || target.Decl.Name == nil {
+		return nil
+	}
+
+	var calls []Call
+
+	for _, uri := range uris {
+		if ctx.Err() != nil {
+			return calls
+		}
+
+		program := r.Program(uri)
+		if program == nil {
+			continue
+		}
+
+		callers := []Routine{{URI: uri}}
+		for _, decl := range Routines(program) {
+			callers = append(callers, Routine{URI: uri, Decl: decl})
+		}
+
+		for _, caller := range callers {
+			var node ast.Node = program
+			if caller.Decl != nil {
+				node = caller.Decl
+			}
+
+			var sites []*ast.Identifier
+
+			for _, site := range CallSites(node) {
+				if !strings.EqualFold(site.Name.Value, target.Decl.Name.Value) {
+					continue
+				}
+
+				if callee := r.Callee(uri, site); callee != nil && *callee == target {
+					sites = append(sites, site.Name)
+				}
+			}
+
+			if len(sites) > 0 {
+				calls = append(calls, Call{Routine: caller, Sites: sites})
+			}
+		}
+	}
+
+	return calls
+}
+
+// OutgoingCalls returns the routines called by caller, in the order of their
+// first call, with the call sites of each. Calls that can't be resolved, such
+// as calls of built-in functions, are left out.
+func (r *CallResolver) OutgoingCalls(caller Routine) []Call {
+	var node ast.Node = caller.Decl
+	if caller.Decl == nil {
+		program := r.Program(caller.URI)
+		if program == nil {
+			return nil
+		}
+
+		node = program
+	}
+
+	var calls []Call
+
+	for _, site := range CallSites(node) {
+		callee := r.Callee(caller.URI, site)
+		if callee == nil {
+			continue
+		}
+
+		found := false
+
+		for i := range calls {
+			if calls[i].Routine == *callee {
+				calls[i].Sites = append(calls[i].Sites, site.Name)
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			calls = append(calls, Call{Routine: *callee, Sites: []*ast.Identifier{site.Name}})
+		}
+	}
+
+	return calls
+}
+
+// routineDeclaredAt returns the routine whose declaration starts or whose
+// name is at loc.
+func (r *CallResolver) routineDeclaredAt(loc protocol.Location) *Routine {
+	program := r.Program(loc.URI)
+	if program == nil {
+		return nil
+	}
+
+	found := FunctionDeclAt(program, loc.Range.Start)
+	if found == nil {
+		return nil
+	}
+
+	return implementation(loc.URI, program, found)
+}
+
+// implementation returns the routine implementing decl: for a method declared
+// in a class body the TClass.Name routine, for a forward declaration the
+// routine with the body. Declarations without an implementation, such as
+// abstract or external methods, stand for themselves.
+func implementation(uri string, program *ast.Program, decl *ast.FunctionDecl) *Routine {
+	if decl.Body != nil {
+		return &Routine{URI: uri, Decl: decl}
+	}
+
+	var className string
+	if class := declaringClass(program, decl); class != nil && class.Name != nil {
+		className = class.Name.Value
+	} else if decl.ClassName != nil {
+		className = decl.ClassName.Value
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		impl, ok := stmt.(*ast.FunctionDecl)
+		if !ok || impl.Body == nil || impl.Name == nil || !strings.EqualFold(impl.Name.Value, decl.Name.Value) {
+			continue
+		}
+
+		if impl.ClassName == nil && className == "" ||
+			impl.ClassName != nil && strings.EqualFold(impl.ClassName.Value, className) {
+			return &Routine{URI: uri, Decl: impl}
+		}
+	}
+
+	return &Routine{URI: uri, Decl: decl}
+}
+
+// method returns the method name of the class className or of its nearest
+// ancestor declaring it.
+func (r *CallResolver) method(uri string, program *ast.Program, className, name string, depth int) *Routine {
+	class, classURI, classProgram := r.findClass(uri, program, className)
+	if class == nil || depth > maxClassDepth {
+		return nil
+	}
+
+	if decl := declaredMethod(class, name); decl != nil {
+		return implementation(classURI, classProgram, decl)
+	}
+
+	if class.Parent == nil {
+		return nil
+	}
+
+	return r.method(classURI, classProgram, class.Parent.Value, name, depth+1)
+}
+
+// findClass looks up the class name, first in program and then in the
+// workspace index, and returns it with the document declaring it.
+func (r *CallResolver) findClass(uri string, program *ast.Program, name string) (*ast.ClassDecl, string, *ast.Program) {
+	if class := classDecl(program, name); class != nil {
+		return class, uri, program
+	}
+
+	if r.index == nil {
+		return nil, "", nil
+	}
+
+	for _, symbol := range r.index.FindSymbol(name) {
+		if symbol.Kind != protocol.SymbolKindClass || symbol.Location.URI == uri {
+			continue
+		}
+
+		other := r.Program(symbol.Location.URI)
+		if class := classDecl(other, name); class != nil {
+			return class, symbol.Location.URI, other
+		}
+	}
+
+	return nil, "", nil
+}
+
+// objectClass returns the name of the class of object, the expression a
+// method is called on, or "" if it can't be determined. For a class name,
+// as in TFoo.Create, that is the class itself.
+func (r *CallResolver) objectClass(uri string, program *ast.Program, object ast.Expression, depth int) string {
+	if depth > maxClassDepth {
+		return ""
+	}
+
+	switch object := object.(type) {
+	case *ast.Identifier:
+		if strings.EqualFold(object.Value, "Self") {
+			return r.selfClass(uri, program, object.Pos())
+		}
+
+		resolver := NewSymbolResolverWithIndex(uri, program, object.Pos(), r.index)
+		for _, loc := range resolver.ResolveSymbol(object.Value) {
+			if className := r.declaredClass(loc, depth); className != "" {
+				return className
+			}
+		}
+
+	case *ast.NewExpression:
+		if object.ClassName != nil {
+			return object.ClassName.Value
+		}
+
+	case *ast.GroupedExpression:
+		return r.objectClass(uri, program, object.Expression, depth+1)
+
+	case *ast.MemberAccessExpression:
+		return r.memberClass(uri, program, object.Object, object.Member, depth)
+
+	case *ast.MethodCallExpression:
+		return r.memberClass(uri, program, object.Object, object.Method, depth)
+	}
+
+	return ""
+}
+
+// memberClass returns the class of object.member: the constructed class for
+// a constructor call like TFoo.Create, or the class of a field's type.
+func (r *CallResolver) memberClass(uri string, program *ast.Program, object ast.Expression, member *ast.Identifier, depth int) string {
+	className := r.objectClass(uri, program, object, depth+1)
+	if className == "" || member == nil {
+		return ""
+	}
+
+	if strings.EqualFold(member.Value, "Create") {
+		return className
+	}
+
+	for i := 0; i <= maxClassDepth; i++ {
+		class, _, _ := r.findClass(uri, program, className)
+		if class == nil {
+			return ""
+		}
+
+		for _, field := range class.Fields {
+			if field.Name != nil && strings.EqualFold(field.Name.Value, member.Value) {
+				if info := typeExpressionToTypeInfo(field.Type); info != nil {
+					return info.TypeName
+				}
+
+				return ""
+			}
+		}
+
+		if class.Parent == nil {
+			return ""
+		}
+
+		className = class.Parent.Value
+	}
+
+	return ""
+}
+
+// selfClass returns the class of the method enclosing pos.
+func (r *CallResolver) selfClass(uri string, program *ast.Program, pos token.Position) string {
+	path := FindNodePathAtPosition(program, pos.Line, pos.Column)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		switch node := path[i].(type) {
+		case *ast.FunctionDecl:
+			if className := r.ClassName(Routine{URI: uri, Decl: node}); className != "" {
+				return className
+			}
+		case *ast.ClassDecl:
+			if node.Name != nil {
+				return node.Name.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+// declaredClass returns the class of the symbol declared at loc: the class
+// itself, or the type of a variable, field or parameter.
+func (r *CallResolver) declaredClass(loc protocol.Location, depth int) string {
+	program := r.Program(loc.URI)
+	if program == nil {
+		return ""
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	path := FindNodePathAtPosition(program, int(loc.Range.Start.Line)+1, int(loc.Range.Start.Character)+1)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		switch node := path[i].(type) {
+		case *ast.ClassDecl:
+			if node.Name != nil && atPosition(node.Name.Pos(), loc.Range.Start) {
+				return node.Name.Value
+			}
+
+		case *ast.FieldDecl:
+			if info := typeExpressionToTypeInfo(node.Type); info != nil {
+				return info.TypeName
+			}
+
+		case *ast.VarDeclStatement:
+			if node.Type != nil {
+				return node.Type.Name
+			}
+
+			if node.Value != nil {
+				return r.objectClass(loc.URI, program, node.Value, depth+1)
+			}
+
+		case *ast.FunctionDecl:
+			for _, param := range node.Parameters {
+				if param.Name != nil && param.Type != nil && atPosition(param.Name.Pos(), loc.Range.Start) {
+					return param.Type.Name
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// callObject returns the object a method is called on when the path to a node
+// ends at the method's name: the left side of the member access.
+func callObject(path []ast.Node) ast.Expression {
+	if len(path) < 2 {
+		return nil
+	}
+
+	ident := path[len(path)-1]
+
+	switch parent := path[len(path)-2].(type) {
+	case *ast.MethodCallExpression:
+		if parent.Method == ident {
+			return parent.Object
+		}
+	case *ast.MemberAccessExpression:
+		if parent.Member == ident {
+			return parent.Object
+		}
+	}
+
+	return nil
+}
+
+// classDecl returns the top-level class name of program.
+func classDecl(program *ast.Program, name string) *ast.ClassDecl {
+	if program == nil {
+		return nil
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		if class, ok := stmt.(*ast.ClassDecl); ok && class.Name != nil && strings.EqualFold(class.Name.Value, name) {
+			return class
+		}
+	}
+
+	return nil
+}
+
+// declaringClass returns the class of program whose body declares decl.
+func declaringClass(program *ast.Program, decl *ast.FunctionDecl) *ast.ClassDecl {
+	if program == nil {
+		return nil
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		class, ok := stmt.(*ast.ClassDecl)
+		if !ok {
+			continue
+		}
+
+		if class.Constructor == decl || class.Destructor == decl {
+			return class
+		}
+
+		for _, method := range class.Methods {
+			if method == decl {
+				return class
+			}
+		}
+	}
+
+	return nil
+}
+
+// atPosition reports whether the AST position pos is the LSP position lsp.
+func atPosition(pos token.Position, lsp protocol.Position) bool {
+	return pos.Line-1 == int(lsp.Line) && pos.Column-1 == int(lsp.Character)
+}
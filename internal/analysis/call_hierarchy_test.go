@@ -0,0 +1,187 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+const callHierarchyCode = `type TBase = class
+  procedure Run; virtual;
+end;
+
+type TFoo = class(TBase)
+  procedure Go(x: Integer);
+end;
+
+procedure TBase.Run;
+begin
+end;
+
+procedure TFoo.Go(x: Integer);
+begin
+  Self.Run;
+  Helper;
+end;
+
+procedure Helper;
+begin
+  PrintLn('helper');
+end;
+
+procedure Run;
+begin
+  Helper();
+end;
+
+var o := TFoo.Create;
+o.Go(1);
+o.Run;
+Run;`
+
+// newTestCallResolver returns a call resolver that knows code as test.dws.
+func newTestCallResolver(t *testing.T, code string) *CallResolver {
+	t.Helper()
+
+	program, _, err := ParseDocument(code, "test.dws")
+	if err != nil || program == nil {
+		t.Fatalf("Failed to parse test code: %v", err)
+	}
+
+	resolver := NewCallResolver(nil, nil)
+	resolver.SetProgram("file:///test.dws", program)
+
+	return resolver
+}
+
+// routineName returns the qualified name of routine for test messages.
+func routineName(resolver *CallResolver, routine *Routine) string {
+	switch {
+	case routine == nil:
+		return "<nil>"
+	case routine.Decl == nil:
+		return "<main>"
+	case resolver.ClassName(*routine) != "":
+		return resolver.ClassName(*routine) + "." + routine.Decl.Name.Value
+	default:
+		return routine.Decl.Name.Value
+	}
+}
+
+func TestCallSites(t *testing.T) {
+	program := parseCode(t, callHierarchyCode)
+
+	// The main code calls Create, Go, Run (on o) and Run (the procedure)
+	sites := CallSites(program)
+
+	expected := []string{"Create", "Go", "Run", "Run"}
+	if len(sites) != len(expected) {
+		t.Fatalf("Expected %d call sites, got %d", len(expected), len(sites))
+	}
+
+	for i, site := range sites {
+		if site.Name.Value != expected[i] {
+			t.Errorf("Call site %d: expected %s, got %s", i, expected[i], site.Name.Value)
+		}
+	}
+
+	if sites[3].Object != nil {
+		t.Errorf("Expected the plain call of Run to have no object")
+	}
+
+	if len(Routines(program)) != 4 {
+		t.Errorf("Expected 4 routines with a body, got %d", len(Routines(program)))
+	}
+}
+
+func TestCallResolver_RoutineAt(t *testing.T) {
+	resolver := newTestCallResolver(t, callHierarchyCode)
+
+	tests := []struct {
+		name     string
+		pos      token.Position
+		expected string
+	}{
+		{"declaration in class body", token.Position{Line: 2, Column: 13}, "TBase.Run"},
+		{"method implementation", token.Position{Line: 9, Column: 17}, "TBase.Run"},
+		{"inherited method called on Self", token.Position{Line: 15, Column: 8}, "TBase.Run"},
+		{"procedure called without parentheses", token.Position{Line: 16, Column: 3}, "Helper"},
+		{"method called on a variable", token.Position{Line: 30, Column: 3}, "TFoo.Go"},
+		{"inherited method called on a variable", token.Position{Line: 31, Column: 3}, "TBase.Run"},
+		{"procedure with the name of a method", token.Position{Line: 32, Column: 1}, "Run"},
+		{"built-in function", token.Position{Line: 21, Column: 3}, "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routine := resolver.RoutineAt("file:///test.dws", tt.pos)
+			if name := routineName(resolver, routine); name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestCallResolver_IncomingCalls(t *testing.T) {
+	resolver := newTestCallResolver(t, callHierarchyCode)
+
+	// Helper is called by TFoo.Go and Run
+	helper := resolver.RoutineAt("file:///test.dws", token.Position{Line: 19, Column: 11})
+	if helper == nil {
+		t.Fatal("Expected to find Helper")
+	}
+
+	calls := resolver.IncomingCalls(context.Background(), *helper, []string{"file:///test.dws"})
+
+	var callers []string
+
+	for _, call := range calls {
+		callers = append(callers, routineName(resolver, &call.Routine))
+
+		if len(call.Sites) != 1 {
+			t.Errorf("Expected one call site in %s, got %d", routineName(resolver, &call.Routine), len(call.Sites))
+		}
+	}
+
+	if len(callers) != 2 || callers[0] != "TFoo.Go" || callers[1] != "Run" {
+		t.Errorf("Expected callers [TFoo.Go Run], got %v", callers)
+	}
+
+	// TBase.Run is called by TFoo.Go and the main code, but not by "Run;"
+	run := resolver.RoutineAt("file:///test.dws", token.Position{Line: 9, Column: 17})
+	calls = resolver.IncomingCalls(context.Background(), *run, []string{"file:///test.dws"})
+
+	callers = nil
+	for _, call := range calls {
+		callers = append(callers, routineName(resolver, &call.Routine))
+	}
+
+	if len(callers) != 2 || callers[0] != "<main>" || callers[1] != "TFoo.Go" {
+		t.Errorf("Expected callers [<main> TFoo.Go], got %v", callers)
+	}
+}
+
+func TestCallResolver_OutgoingCalls(t *testing.T) {
+	resolver := newTestCallResolver(t, callHierarchyCode)
+
+	calls := resolver.OutgoingCalls(Routine{URI: "file:///test.dws"})
+
+	var callees []string
+	for _, call := range calls {
+		callees = append(callees, routineName(resolver, &call.Routine))
+	}
+
+	// TFoo.Create is the implicit default constructor and can't be resolved
+	expected := []string{"TFoo.Go", "TBase.Run", "Run"}
+	if len(callees) != len(expected) {
+		t.Fatalf("Expected callees %v, got %v", expected, callees)
+	}
+
+	for i := range expected {
+		if callees[i] != expected[i] {
+			t.Errorf("Expected callees %v, got %v", expected, callees)
+			break
+		}
+	}
+}
@@ -85,11 +85,11 @@ func DetermineContext(doc *server.Document, line, character int) (*CompletionCon
 	}
 
 	// Determine current scope from AST
-	if doc.Program != nil && doc.Program.AST() != nil {
+	if doc.AST() != nil {
 		// Convert LSP position (0-based) to AST position (1-based)
 		astLine := line + 1
 		astColumn := character + 1
-		ctx.Scope = findScopeAtPosition(doc.Program.AST(), astLine, astColumn)
+		ctx.Scope = findScopeAtPosition(doc.AST(), astLine, astColumn)
 	}
 
 	return ctx, nil
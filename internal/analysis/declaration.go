@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// RoutineDeclaration returns the declaration of the routine decl implements:
+// for a method implementation like TFoo.Run the method declared in the class
+// body, for a routine with a forward declaration, or one declared in the
+// interface section of a unit, that declaration. Other routines are their own
+// declaration.
+func RoutineDeclaration(program *ast.Program, decl *ast.FunctionDecl) *ast.FunctionDecl {
+	if decl.Body == nil || decl.Name == nil {
+		return decl
+	}
+
+	if decl.ClassName != nil {
+		if class := classDecl(program, decl.ClassName.Value); class != nil {
+			if method := declaredMethod(class, decl.Name.Value); method != nil {
+				return method
+			}
+		}
+
+		return decl
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		forward, ok := stmt.(*ast.FunctionDecl)
+		if ok && forward.Body == nil && forward.ClassName == nil && forward.Name != nil &&
+			strings.EqualFold(forward.Name.Value, decl.Name.Value) {
+			return forward
+		}
+	}
+
+	return decl
+}
+
+// RoutineDefinition returns the routine with the body implementing decl, the
+// reverse of RoutineDeclaration. Declarations without an implementation, such
+// as abstract or external methods, are their own definition.
+func RoutineDefinition(program *ast.Program, decl *ast.FunctionDecl) *ast.FunctionDecl {
+	return implementation("", program, decl).Decl
+}
+
+// FunctionDeclAt returns the routine of program whose declaration starts or
+// whose name is at the LSP position pos, or nil if there is none.
+func FunctionDeclAt(program *ast.Program, pos protocol.Position) *ast.FunctionDecl {
+	var found *ast.FunctionDecl
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+
+		if decl, ok := n.(*ast.FunctionDecl); ok && decl.Name != nil &&
+			(atPosition(decl.Pos(), pos) || atPosition(decl.Name.Pos(), pos)) {
+			found = decl
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// topLevelStatements returns the statements of program outside of routines,
+// including those of the interface and implementation sections of a unit.
+func topLevelStatements(program *ast.Program) []ast.Statement {
+	if program == nil {
+		return nil
+	}
+
+	statements := make([]ast.Statement, 0, len(program.Statements))
+
+	for _, stmt := range program.Statements {
+		unit, ok := stmt.(*ast.UnitDeclaration)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		for _, section := range []*ast.BlockStatement{unit.InterfaceSection, unit.ImplementationSection} {
+			if section != nil {
+				statements = append(statements, section.Statements...)
+			}
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const declarationUnitCode = `unit Shapes;
+
+interface
+
+type TSquare = class
+  function Area: Float;
+end;
+
+function DefaultSize: Float;
+
+implementation
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;
+
+function DefaultSize: Float;
+begin
+  Result := 1;
+end;
+
+end.`
+
+func TestRoutineDeclarationAndDefinition(t *testing.T) {
+	program := ParsePartialAST(declarationUnitCode, "shapes.dws")
+	if program == nil {
+		t.Fatal("Failed to parse test code")
+	}
+
+	tests := []struct {
+		name        string
+		pos         protocol.Position
+		declaration int
+		definition  int
+	}{
+		{"method in the class body", protocol.Position{Line: 5, Character: 11}, 6, 13},
+		{"method implementation", protocol.Position{Line: 12, Character: 17}, 6, 13},
+		{"routine in the interface section", protocol.Position{Line: 8, Character: 9}, 9, 18},
+		{"routine in the implementation section", protocol.Position{Line: 17, Character: 9}, 9, 18},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decl := FunctionDeclAt(program, tt.pos)
+			if decl == nil {
+				t.Fatalf("Expected a routine at %+v", tt.pos)
+			}
+
+			if line := RoutineDeclaration(program, decl).Pos().Line; line != tt.declaration {
+				t.Errorf("Expected the declaration at line %d, got %d", tt.declaration, line)
+			}
+
+			if line := RoutineDefinition(program, decl).Pos().Line; line != tt.definition {
+				t.Errorf("Expected the definition at line %d, got %d", tt.definition, line)
+			}
+		})
+	}
+}
+
+func TestTopLevelStatements(t *testing.T) {
+	program := ParsePartialAST(declarationUnitCode, "shapes.dws")
+	if program == nil {
+		t.Fatal("Failed to parse test code")
+	}
+
+	var routines, classes int
+
+	for _, stmt := range topLevelStatements(program) {
+		switch stmt.(type) {
+		case *ast.FunctionDecl:
+			routines++
+		case *ast.ClassDecl:
+			classes++
+		}
+	}
+
+	if routines != 3 || classes != 1 {
+		t.Errorf("Expected 3 routines and 1 class in the unit sections, got %d and %d", routines, classes)
+	}
+}
@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+)
+
+// TextLinkKind classifies the links found by TextLinks.
+type TextLinkKind int
+
+const (
+	UnitLink    TextLinkKind = iota // a unit name in a uses clause
+	IncludeLink                     // the file name of an include directive
+	URLLink                         // a URL in a comment
+)
+
+// TextLink is a link found in source text.
+type TextLink struct {
+	Kind TextLinkKind
+
+	// Target is the unit name, the included file name as written, or the URL
+	Target string
+
+	// Start and End are the byte offsets of the linked text
+	Start int
+	End   int
+}
+
+// includeDirectives are the directives naming a file to include.
+var includeDirectives = map[string]bool{
+	"i": true, "include": true, "include_once": true,
+}
+
+// commentURL matches URLs in comments. Trailing punctuation is trimmed separately.
+var commentURL = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s'"<>{}()]+`)
+
+// TextLinks returns the links found by scanning text, which needn't compile:
+// the unit names of uses clauses, the file names of {$I file} and
+// {$INCLUDE file} directives, and URLs in comments. The links are ordered by
+// their position in the text.
+func TextLinks(text string) []TextLink {
+	tokens := lexer.Scan(text)
+
+	var links []TextLink
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+
+		switch tok.Kind {
+		case lexer.Ident:
+			if tok.Keyword() == "uses" && !afterMemberAccess(tokens, i) {
+				var units []TextLink
+
+				units, i = usesClauseLinks(tokens, i)
+				links = append(links, units...)
+			}
+
+		case lexer.Directive:
+			if link, ok := includeLink(tok); ok {
+				links = append(links, link)
+			}
+
+		case lexer.Comment:
+			for _, match := range commentURL.FindAllStringIndex(tok.Text, -1) {
+				url := strings.TrimRight(tok.Text[match[0]:match[1]], ".,;:!?*")
+				links = append(links, TextLink{
+					Kind:   URLLink,
+					Target: url,
+					Start:  tok.Offset + match[0],
+					End:    tok.Offset + match[0] + len(url),
+				})
+			}
+		}
+	}
+
+	return links
+}
+
+// usesClauseLinks returns the links of the unit names in the uses clause
+// starting at tokens[i], and the index of the token ending the clause. Dotted
+// names such as System.Classes form a single link.
+func usesClauseLinks(tokens []lexer.Token, i int) ([]TextLink, int) {
+	var links []TextLink
+
+	// The index of the link of the unit name being read, -1 after a comma
+	unit := -1
+
+	for j := nextCode(tokens, i); j >= 0; j = nextCode(tokens, j) {
+		tok := tokens[j]
+
+		switch {
+		case tok.Kind == lexer.Ident && tok.Keyword() == "":
+			if unit >= 0 && tokens[previousCode(tokens, j)].Is(".") {
+				links[unit].Target += "." + tok.Text
+				links[unit].End = tok.Offset + len(tok.Text)
+
+				continue
+			}
+
+			links = append(links, TextLink{Kind: UnitLink, Target: tok.Text, Start: tok.Offset, End: tok.Offset + len(tok.Text)})
+			unit = len(links) - 1
+
+		case tok.Is(".") && unit >= 0, tok.Is("in"), tok.Kind == lexer.String:
+			// Continues a dotted unit name, or names its file as in "Utils in 'utils.pas'"
+
+		case tok.Is(","):
+			unit = -1
+
+		default:
+			// The semicolon, or code that doesn't belong to an unfinished clause
+			return links, j
+		}
+	}
+
+	return links, len(tokens)
+}
+
+// includeLink returns the link of the file name of an include directive such
+// as {$I 'utils.inc'} or {$INCLUDE utils.inc}.
+func includeLink(directive lexer.Token) (TextLink, bool) {
+	if !includeDirectives[directiveName(directive.Text)] {
+		return TextLink{}, false
+	}
+
+	// The argument follows the name and ends before the closing brace
+	body := strings.TrimSuffix(directive.Text, "}")
+
+	start := strings.IndexAny(body, " \t\r\n")
+	if start < 0 {
+		return TextLink{}, false
+	}
+
+	arg := strings.TrimSpace(body[start:])
+	if unquoted := strings.Trim(arg, "'\""); len(unquoted) < len(arg) {
+		arg = unquoted
+	}
+
+	if arg == "" {
+		return TextLink{}, false
+	}
+
+	offset := directive.Offset + start + strings.Index(body[start:], arg)
+
+	return TextLink{Kind: IncludeLink, Target: arg, Start: offset, End: offset + len(arg)}, true
+}
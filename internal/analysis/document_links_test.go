@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"testing"
+)
+
+func TestTextLinks(t *testing.T) {
+	text := `unit Shapes;
+{ See https://www.example.com/dwscript/. }
+interface
+
+uses
+  System.Classes, Utils, // the helpers
+  Geometry in 'lib/geometry.pas';
+
+{$I 'shapes.inc'}
+{$INCLUDE common.inc}
+{$IFDEF DEBUG}{$ENDIF}
+var s := 'http://not.a.comment';
+
+implementation
+
+uses Drawing;
+
+// Docs: http://example.com/a?b=1, and more
+end.`
+
+	expected := []struct {
+		kind   TextLinkKind
+		target string
+		text   string
+	}{
+		{URLLink, "https://www.example.com/dwscript/", "https://www.example.com/dwscript/"},
+		{UnitLink, "System.Classes", "System.Classes"},
+		{UnitLink, "Utils", "Utils"},
+		{UnitLink, "Geometry", "Geometry"},
+		{IncludeLink, "shapes.inc", "shapes.inc"},
+		{IncludeLink, "common.inc", "common.inc"},
+		{UnitLink, "Drawing", "Drawing"},
+		{URLLink, "http://example.com/a?b=1", "http://example.com/a?b=1"},
+	}
+
+	links := TextLinks(text)
+	if len(links) != len(expected) {
+		t.Fatalf("Expected %d links, got %d: %+v", len(expected), len(links), links)
+	}
+
+	for i, link := range links {
+		want := expected[i]
+
+		if link.Kind != want.kind || link.Target != want.target {
+			t.Errorf("Link %d: expected %q of kind %d, got %q of kind %d", i, want.target, want.kind, link.Target, link.Kind)
+		}
+
+		if got := text[link.Start:link.End]; got != want.text {
+			t.Errorf("Link %d: expected the range to cover %q, got %q", i, want.text, got)
+		}
+	}
+}
+
+func TestTextLinks_UnfinishedUsesClause(t *testing.T) {
+	// A uses clause being typed ends at the next keyword
+	links := TextLinks("uses Utils,\n\nbegin\nend.")
+
+	if len(links) != 1 || links[0].Target != "Utils" {
+		t.Errorf("Expected a link to Utils, got %+v", links)
+	}
+}
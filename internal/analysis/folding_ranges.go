@@ -0,0 +1,253 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// sectionKeywords start the declaration sections folded by TextFoldingRanges.
+var sectionKeywords = map[string]bool{
+	"uses": true, "var": true, "const": true, "resourcestring": true,
+}
+
+// BlockFoldingRanges returns folding ranges for the multi-line declarations
+// and blocks of program: routines, class, record, interface and helper
+// declarations, begin..end, case, try and repeat. A range starts on the line
+// of the construct and ends on the line before its closing keyword, so the
+// end stays visible when the range is folded.
+func BlockFoldingRanges(program *ast.Program) []protocol.FoldingRange {
+	if program == nil {
+		return nil
+	}
+
+	var ranges []protocol.FoldingRange
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.FunctionDecl, *ast.ClassDecl, *ast.RecordDecl, *ast.InterfaceDecl, *ast.HelperDecl,
+			*ast.EnumDecl, *ast.BlockStatement, *ast.CaseStatement, *ast.TryStatement, *ast.RepeatStatement:
+		default:
+			return true
+		}
+
+		// Convert AST (1-based) lines to LSP (0-based); the range ends before the closing line
+		start := node.Pos().Line - 1
+		end := node.End().Line - 2
+
+		if start >= 0 && end > start {
+			ranges = append(ranges, protocol.FoldingRange{
+				StartLine: protocol.UInteger(start),
+				EndLine:   protocol.UInteger(end),
+			})
+		}
+
+		return true
+	})
+
+	return ranges
+}
+
+// TextFoldingRanges returns the folding ranges found by scanning text, which
+// needn't compile: multi-line comments, runs of line comments,
+// {$region}..{$endregion} directives, multi-line uses clauses and runs of
+// var, const and resourcestring declarations.
+func TextFoldingRanges(text string) []protocol.FoldingRange {
+	tokens := lexer.Scan(text)
+
+	var (
+		ranges  []protocol.FoldingRange
+		regions []int
+
+		// The lines of the current run of line comments
+		commentStart, commentEnd = -1, -1
+
+		// The last line of the current declaration section
+		sectionLast = -1
+	)
+
+	addRange := func(start, end int, kind protocol.FoldingRangeKind) {
+		if end <= start {
+			return
+		}
+
+		foldingRange := protocol.FoldingRange{StartLine: protocol.UInteger(start), EndLine: protocol.UInteger(end)}
+		if kind != "" {
+			k := string(kind)
+			foldingRange.Kind = &k
+		}
+
+		ranges = append(ranges, foldingRange)
+	}
+
+	endCommentRun := func() {
+		addRange(commentStart, commentEnd, protocol.FoldingRangeKindComment)
+		commentStart, commentEnd = -1, -1
+	}
+
+	for i, tok := range tokens {
+		if tok.Kind == lexer.Comment && strings.HasPrefix(tok.Text, "//") && firstOnLine(tokens, i) {
+			if commentEnd >= 0 && tok.Line == commentEnd+1 {
+				commentEnd = tok.Line
+			} else {
+				endCommentRun()
+				commentStart, commentEnd = tok.Line, tok.Line
+			}
+
+			continue
+		}
+
+		if commentEnd >= 0 && tok.Line > commentEnd {
+			endCommentRun()
+		}
+
+		switch tok.Kind {
+		case lexer.Comment:
+			addRange(tok.Line, tok.EndLine, protocol.FoldingRangeKindComment)
+
+		case lexer.Directive:
+			switch directiveName(tok.Text) {
+			case "region":
+				regions = append(regions, tok.Line)
+			case "endregion":
+				if len(regions) > 0 {
+					addRange(regions[len(regions)-1], tok.Line, protocol.FoldingRangeKindRegion)
+					regions = regions[:len(regions)-1]
+				}
+			}
+
+		case lexer.Ident:
+			if keyword := tok.Keyword(); sectionKeywords[keyword] && tok.Line > sectionLast &&
+				firstOnLine(tokens, i) && !afterMemberAccess(tokens, i) {
+				end := sectionEnd(tokens, i, keyword)
+				sectionLast = end
+
+				kind := protocol.FoldingRangeKind("")
+				if keyword == "uses" {
+					kind = protocol.FoldingRangeKindImports
+				}
+
+				addRange(tok.Line, end, kind)
+			}
+		}
+	}
+
+	endCommentRun()
+
+	return ranges
+}
+
+// sectionEnd returns the last line of the section starting with the keyword
+// at tokens[i]. A uses clause ends at its semicolon. A var, const or
+// resourcestring section extends over the declarations that follow it,
+// including further sections of the same kind, such as consecutive var
+// statements.
+func sectionEnd(tokens []lexer.Token, i int, keyword string) int {
+	last := tokens[i].Line
+
+	if keyword == "uses" {
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j].Is(";") {
+				return tokens[j].Line
+			}
+		}
+
+		return last
+	}
+
+	for j := i + 1; j < len(tokens); j++ {
+		tok := tokens[j]
+
+		if !tok.IsCode() {
+			// Comments inside the section belong to it, but not trailing ones
+			continue
+		}
+
+		// A line after a complete declaration must continue the section
+		if prev := previousCode(tokens, j); tok.Line > last && firstOnLine(tokens, j) &&
+			(tokens[prev].Is(";") || prev == i) && tok.Keyword() != keyword && !startsDeclaration(tokens, j) {
+			break
+		}
+
+		last = tok.EndLine
+	}
+
+	return last
+}
+
+// startsDeclaration reports whether the code at tokens[i] starts a declaration
+// such as "a, b: Integer" or "Max = 10", or a continuation of the previous one.
+func startsDeclaration(tokens []lexer.Token, i int) bool {
+	for j := i; j >= 0 && j < len(tokens); j = nextCode(tokens, j) {
+		tok := tokens[j]
+		if tok.Kind != lexer.Ident || tok.Keyword() != "" {
+			return false
+		}
+
+		j = nextCode(tokens, j)
+		if j < 0 {
+			return false
+		}
+
+		switch {
+		case tokens[j].Is(","):
+			continue
+		case tokens[j].Is(":"), tokens[j].Is("="):
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// firstOnLine reports whether tokens[i] is the first token on its line.
+func firstOnLine(tokens []lexer.Token, i int) bool {
+	return i == 0 || tokens[i-1].EndLine < tokens[i].Line
+}
+
+// afterMemberAccess reports whether tokens[i] follows a dot, as in x.Var.
+func afterMemberAccess(tokens []lexer.Token, i int) bool {
+	prev := previousCode(tokens, i)
+	return prev >= 0 && (tokens[prev].Is(".") || tokens[prev].Is("?."))
+}
+
+// directiveName returns the lower-case name of a compiler directive such as
+// {$REGION 'Helpers'}.
+func directiveName(directive string) string {
+	name := strings.TrimPrefix(directive, "{$")
+	if end := strings.IndexAny(name, " \t\r\n}"); end >= 0 {
+		name = name[:end]
+	}
+
+	return strings.ToLower(name)
+}
+
+// MergeFoldingRanges combines folding ranges, keeping the longest range for
+// each start line, and sorts them by start line.
+func MergeFoldingRanges(ranges ...[]protocol.FoldingRange) []protocol.FoldingRange {
+	byStart := make(map[protocol.UInteger]protocol.FoldingRange)
+
+	for _, list := range ranges {
+		for _, foldingRange := range list {
+			if existing, ok := byStart[foldingRange.StartLine]; !ok || foldingRange.EndLine > existing.EndLine {
+				byStart[foldingRange.StartLine] = foldingRange
+			}
+		}
+	}
+
+	merged := make([]protocol.FoldingRange, 0, len(byStart))
+	for _, foldingRange := range byStart {
+		merged = append(merged, foldingRange)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].StartLine < merged[j].StartLine
+	})
+
+	return merged
+}
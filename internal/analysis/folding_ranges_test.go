@@ -0,0 +1,94 @@
+package analysis
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+type foldingLines struct {
+	start, end uint32
+	kind       string
+}
+
+func checkFoldingRanges(t *testing.T, ranges []protocol.FoldingRange, expected []foldingLines) {
+	t.Helper()
+
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %d ranges, got %d: %+v", len(expected), len(ranges), ranges)
+	}
+
+	for i, foldingRange := range ranges {
+		kind := ""
+		if foldingRange.Kind != nil {
+			kind = *foldingRange.Kind
+		}
+
+		got := foldingLines{foldingRange.StartLine, foldingRange.EndLine, kind}
+		if got != expected[i] {
+			t.Errorf("Range %d: got %+v, expected %+v", i, got, expected[i])
+		}
+	}
+}
+
+func TestBlockFoldingRanges(t *testing.T) {
+	code := `type
+  TFoo = class
+    FX: Integer;
+    procedure Bar;
+  end;
+
+procedure TFoo.Bar;
+begin
+  case FX of
+    1: PrintLn(1);
+  end;
+  try
+    PrintLn(2);
+  finally
+    PrintLn(3);
+  end;
+end;`
+
+	program := compileCode(t, code)
+	ranges := MergeFoldingRanges(BlockFoldingRanges(program.AST()))
+
+	checkFoldingRanges(t, ranges, []foldingLines{
+		{1, 3, ""},   // class
+		{6, 15, ""},  // procedure
+		{7, 15, ""},  // begin
+		{8, 9, ""},   // case
+		{11, 14, ""}, // try
+	})
+}
+
+func TestTextFoldingRanges(t *testing.T) {
+	text := `uses
+  System,
+  Classes;
+
+// first
+// second
+var a: Integer;
+var b: Integer;
+var
+  c, d: Integer;
+
+{$REGION 'Helpers'}
+{ a
+  block comment }
+const Max = 10;
+{$ENDREGION}
+
+begin
+  x.var := 1;
+end;`
+
+	checkFoldingRanges(t, MergeFoldingRanges(TextFoldingRanges(text)), []foldingLines{
+		{0, 2, "imports"},
+		{4, 5, "comment"},
+		{6, 9, ""},
+		{11, 15, "region"},
+		{12, 13, "comment"},
+	})
+}
@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"context"
 	"log"
 
 	"github.com/CWBudde/go-dws-lsp/internal/server"
@@ -12,7 +13,10 @@ import (
 // This best-effort implementation traverses each document's AST and collects locations
 // of identifiers that match the target name. Future tasks (6.8+, 6.9) will refine scope
 // filtering and semantic resolution to avoid false positives.
-func FindGlobalReferences(symbolName string, docStore *server.DocumentStore) []protocol.Location {
+// Documents that don't currently compile are scanned using their last good program,
+// and only identifiers whose text hasn't been edited since are reported.
+// The scan stops early when ctx is cancelled.
+func FindGlobalReferences(ctx context.Context, symbolName string, docStore *server.DocumentStore) []protocol.Location {
 	if symbolName == "" || docStore == nil {
 		return nil
 	}
@@ -21,8 +25,17 @@ func FindGlobalReferences(symbolName string, docStore *server.DocumentStore) []p
 	var locations []protocol.Location
 
 	for _, uri := range uris {
+		if ctx.Err() != nil {
+			return locations
+		}
+
 		doc, ok := docStore.Get(uri)
-		if !ok || doc == nil || doc.Program == nil {
+		if !ok || doc == nil {
+			continue
+		}
+
+		doc, positions := doc.AnalysisView()
+		if doc.Program == nil {
 			continue
 		}
 
@@ -46,21 +59,24 @@ func FindGlobalReferences(symbolName string, docStore *server.DocumentStore) []p
 			start := ident.Pos()
 			end := ident.End()
 
-			loc := protocol.Location{
-				URI: uri,
-				Range: protocol.Range{
-					Start: protocol.Position{
-						Line:      uint32(max(0, start.Line-1)),
-						Character: uint32(max(0, start.Column-1)),
-					},
-					End: protocol.Position{
-						Line:      uint32(max(0, end.Line-1)),
-						Character: uint32(max(0, end.Column-1)),
-					},
+			identRange := protocol.Range{
+				Start: protocol.Position{
+					Line:      uint32(max(0, start.Line-1)),
+					Character: uint32(max(0, start.Column-1)),
 				},
+				End: protocol.Position{
+					Line:      uint32(max(0, end.Line-1)),
+					Character: uint32(max(0, end.Column-1)),
+				},
+			}
+
+			// Translate ranges from the last good program to the current text
+			identRange, ok = positions.RangeToCurrentExact(identRange)
+			if !ok {
+				return true
 			}
 
-			locations = append(locations, loc)
+			locations = append(locations, protocol.Location{URI: uri, Range: identRange})
 
 			return true
 		})
@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+// Member is a method of a class or interface.
+type Member struct {
+	Type TypeDecl
+	Name string
+}
+
+// MemberAt returns the method declared at pos in uri: a method declared in a
+// class or interface body, or the implementation of a class method. It
+// returns nil if there is no method declaration at pos.
+func (h *TypeHierarchy) MemberAt(uri string, pos token.Position) *Member {
+	program := h.Program(uri)
+	if program == nil {
+		return nil
+	}
+
+	path := FindNodePathAtPosition(program, pos.Line, pos.Column)
+	if len(path) < 2 {
+		return nil
+	}
+
+	ident, ok := path[len(path)-1].(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+
+	switch parent := path[len(path)-2].(type) {
+	case *ast.FunctionDecl:
+		if parent.Name != ident {
+			return nil
+		}
+
+		if parent.ClassName != nil {
+			if class := h.FindType(uri, parent.ClassName.Value); class != nil {
+				return &Member{Type: *class, Name: ident.Value}
+			}
+
+			return nil
+		}
+
+		if class := declaringClass(program, parent); class != nil {
+			return &Member{Type: TypeDecl{URI: uri, Decl: class}, Name: ident.Value}
+		}
+
+	case *ast.InterfaceDecl:
+		// Interface methods aren't nodes, so their names are children of the interface
+		for _, method := range parent.Methods {
+			if method != nil && method.Name == ident {
+				return &Member{Type: TypeDecl{URI: uri, Decl: parent}, Name: ident.Value}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Implementations returns the routines implementing m. For a class method
+// these are its own implementation, or the one inherited from the nearest
+// ancestor, and its overrides. For an interface method they are the methods
+// of all classes implementing the interface. Methods declared in a class body
+// are mapped to their implementation, and abstract methods, which have none,
+// are left out.
+func (h *TypeHierarchy) Implementations(m Member) []Routine {
+	var routines []Routine
+
+	if _, isInterface := m.Type.Decl.(*ast.InterfaceDecl); !isInterface {
+		if own := h.method(m.Type, m.Name); own != nil && own.Decl.Body != nil {
+			routines = append(routines, *own)
+		}
+	}
+
+	for _, routine := range h.Overrides(m) {
+		if !slices.Contains(routines, routine) {
+			routines = append(routines, routine)
+		}
+	}
+
+	return routines
+}
+
+// Overrides returns the routines overriding m: for a class method the
+// overriding methods of all descendant classes, for an interface method the
+// methods of all classes implementing the interface, directly or through a
+// derived interface or class. Like Implementations, it returns the
+// implementations of the methods.
+func (h *TypeHierarchy) Overrides(m Member) []Routine {
+	var routines []Routine
+
+	seen := make(map[Routine]bool)
+
+	add := func(routine *Routine) {
+		if routine != nil && routine.Decl.Body != nil && !seen[*routine] {
+			seen[*routine] = true
+			routines = append(routines, *routine)
+		}
+	}
+
+	_, isInterface := m.Type.Decl.(*ast.InterfaceDecl)
+
+	for _, descendant := range h.Descendants(m.Type) {
+		class, ok := descendant.Decl.(*ast.ClassDecl)
+		if !ok {
+			continue
+		}
+
+		if isInterface {
+			add(h.method(descendant, m.Name))
+		} else if decl := declaredMethod(class, m.Name); decl != nil && decl.IsOverride {
+			add(implementation(descendant.URI, h.Program(descendant.URI), decl))
+		}
+	}
+
+	return routines
+}
+
+// method returns the implementation of the method name of the class t or of
+// its nearest ancestor declaring it.
+func (h *TypeHierarchy) method(t TypeDecl, name string) *Routine {
+	for depth := 0; depth <= maxClassDepth; depth++ {
+		class, ok := t.Decl.(*ast.ClassDecl)
+		if !ok {
+			return nil
+		}
+
+		if decl := declaredMethod(class, name); decl != nil {
+			return implementation(t.URI, h.Program(t.URI), decl)
+		}
+
+		if class.Parent == nil {
+			return nil
+		}
+
+		parent := h.FindType(t.URI, class.Parent.Value)
+		if parent == nil {
+			return nil
+		}
+
+		t = *parent
+	}
+
+	return nil
+}
+
+// Descendants returns the classes and interfaces deriving from t, directly
+// or indirectly, nearest first.
+func (h *TypeHierarchy) Descendants(t TypeDecl) []TypeDecl {
+	var descendants []TypeDecl
+
+	seen := map[ast.Statement]bool{t.Decl: true}
+
+	for queue := []TypeDecl{t}; len(queue) > 0; queue = queue[1:] {
+		for _, subtype := range h.Subtypes(queue[0]) {
+			if seen[subtype.Decl] {
+				continue
+			}
+
+			seen[subtype.Decl] = true
+			descendants = append(descendants, subtype)
+			queue = append(queue, subtype)
+		}
+	}
+
+	return descendants
+}
+
+// declaredMethod returns the method name declared in the body of class.
+func declaredMethod(class *ast.ClassDecl, name string) *ast.FunctionDecl {
+	methods := append([]*ast.FunctionDecl{class.Constructor, class.Destructor}, class.Methods...)
+	for _, decl := range methods {
+		if decl != nil && decl.Name != nil && strings.EqualFold(decl.Name.Value, name) {
+			return decl
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+const implementationCode = `type IShape = interface
+  function Area: Float;
+end;
+
+type TShape = class abstract(IShape)
+  function Area: Float; virtual; abstract;
+end;
+
+type TSquare = class(TShape)
+  function Area: Float; override;
+end;
+
+type TBigSquare = class(TSquare)
+  function Area: Float; override;
+end;
+
+type TCube = class(TSquare)
+end;
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;
+
+function TBigSquare.Area: Float;
+begin
+  Result := 4;
+end;
+
+var s: IShape := TCube.Create;
+var c := TCube.Create;
+PrintLn(s.Area());
+PrintLn(c.Area);`
+
+// routineLines returns the 1-based lines of the names of routines for test
+// messages and comparisons.
+func routineLines(routines []Routine) []int {
+	lines := make([]int, len(routines))
+	for i, routine := range routines {
+		lines[i] = routine.Decl.Name.Pos().Line
+	}
+
+	return lines
+}
+
+func TestTypeHierarchy_MemberAt(t *testing.T) {
+	hierarchy := newTestTypeHierarchy(t, implementationCode)
+
+	tests := []struct {
+		name         string
+		pos          token.Position
+		expectedType string
+	}{
+		{"interface method", token.Position{Line: 2, Column: 12}, "IShape"},
+		{"abstract method", token.Position{Line: 6, Column: 12}, "TShape"},
+		{"method implementation", token.Position{Line: 20, Column: 18}, "TSquare"},
+		{"class name of implementation", token.Position{Line: 20, Column: 11}, ""},
+		{"class declaration", token.Position{Line: 9, Column: 6}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var typeName string
+			if member := hierarchy.MemberAt("file:///test.dws", tt.pos); member != nil {
+				typeName = member.Type.Name().Value
+
+				if member.Name != "Area" {
+					t.Errorf("Expected member Area, got %q", member.Name)
+				}
+			}
+
+			if typeName != tt.expectedType {
+				t.Errorf("Expected type %q, got %q", tt.expectedType, typeName)
+			}
+		})
+	}
+}
+
+func TestTypeHierarchy_Implementations(t *testing.T) {
+	hierarchy := newTestTypeHierarchy(t, implementationCode)
+
+	tests := []struct {
+		name     string
+		typeName string
+		expected []int
+	}{
+		// The abstract method itself has no implementation
+		{"interface method", "IShape", []int{20, 25}},
+		{"abstract method", "TShape", []int{20, 25}},
+		{"overridden method", "TSquare", []int{20, 25}},
+		{"most derived override", "TBigSquare", []int{25}},
+		{"inherited method", "TCube", []int{20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typeDecl := hierarchy.FindType("file:///test.dws", tt.typeName)
+			if typeDecl == nil {
+				t.Fatalf("Expected to find %s", tt.typeName)
+			}
+
+			lines := routineLines(hierarchy.Implementations(Member{Type: *typeDecl, Name: "area"}))
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("Expected implementations at lines %v, got %v", tt.expected, lines)
+			}
+
+			for i := range lines {
+				if lines[i] != tt.expected[i] {
+					t.Errorf("Expected implementations at lines %v, got %v", tt.expected, lines)
+				}
+			}
+		})
+	}
+}
+
+func TestCallResolver_CalledMember(t *testing.T) {
+	program, _, err := ParseDocument(implementationCode, "test.dws")
+	if err != nil || program == nil {
+		t.Fatalf("Failed to parse test code: %v", err)
+	}
+
+	resolver := NewCallResolver(nil, nil)
+	resolver.SetProgram("file:///test.dws", program)
+
+	tests := []struct {
+		name         string
+		pos          token.Position
+		expectedType string
+	}{
+		{"call on an interface", token.Position{Line: 32, Column: 11}, "IShape"},
+		{"call on an object", token.Position{Line: 33, Column: 11}, "TCube"},
+		{"variable", token.Position{Line: 33, Column: 9}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typeName, name := resolver.CalledMember("file:///test.dws", tt.pos)
+			if typeName != tt.expectedType {
+				t.Errorf("Expected type %q, got %q", tt.expectedType, typeName)
+			}
+
+			if typeName != "" && name != "Area" {
+				t.Errorf("Expected member Area, got %q", name)
+			}
+		})
+	}
+}
+
+func TestTypeHierarchy_OverridesAndDescendants(t *testing.T) {
+	hierarchy := newTestTypeHierarchy(t, implementationCode)
+
+	square := hierarchy.FindType("file:///test.dws", "TSquare")
+	if square == nil {
+		t.Fatal("Expected to find TSquare")
+	}
+
+	// Unlike Implementations, the method's own implementation is left out
+	if lines := routineLines(hierarchy.Overrides(Member{Type: *square, Name: "Area"})); len(lines) != 1 || lines[0] != 25 {
+		t.Errorf("Expected the override at line 25, got %v", lines)
+	}
+
+	shape := hierarchy.FindType("file:///test.dws", "IShape")
+	if names := typeNames(hierarchy.Descendants(*shape)); len(names) != 4 || names[0] != "TShape" || names[3] != "TCube" {
+		t.Errorf("Expected descendants [TShape TSquare TBigSquare TCube], got %v", names)
+	}
+}
@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// keywordGroup is the keywords of one construct, such as try, except and end.
+type keywordGroup struct {
+	opener   string
+	keywords []lexer.Token
+}
+
+// MatchingKeywords returns the ranges of the keywords forming the same
+// construct as the keyword at position: begin/end, try/except/finally/end,
+// case/end, repeat/until, asm/end and record, class and interface
+// declarations with their end. It returns nil if there is no such keyword at
+// position. The text is scanned rather than parsed, so it works while code is
+// being edited.
+func MatchingKeywords(text string, position protocol.Position) []protocol.Range {
+	tokens := lexer.Scan(text)
+
+	var (
+		stack []*keywordGroup
+		found *keywordGroup
+	)
+
+	for i, tok := range tokens {
+		if !tok.IsCode() {
+			continue
+		}
+
+		keyword := tok.Keyword()
+		if keyword != "" && i > 0 && (tokens[i-1].Is(".") || tokens[i-1].Is("?.")) {
+			// A member named like a keyword
+			continue
+		}
+
+		var group *keywordGroup
+
+		switch keyword {
+		case "begin", "asm", "try", "repeat", "record":
+			group = &keywordGroup{opener: keyword}
+			stack = append(stack, group)
+
+		case "case":
+			// The case of a variant record has no end of its own
+			if len(stack) > 0 && stack[len(stack)-1].opener == "record" {
+				continue
+			}
+
+			group = &keywordGroup{opener: keyword}
+			stack = append(stack, group)
+
+		case "class", "interface":
+			if !opensTypeBody(tokens, i) {
+				continue
+			}
+
+			group = &keywordGroup{opener: keyword}
+			stack = append(stack, group)
+
+		case "except", "finally":
+			if len(stack) == 0 || stack[len(stack)-1].opener != "try" {
+				continue
+			}
+
+			group = stack[len(stack)-1]
+
+		case "end", "until":
+			if len(stack) == 0 {
+				continue
+			}
+
+			group = stack[len(stack)-1]
+			if (keyword == "until") != (group.opener == "repeat") {
+				continue
+			}
+
+			stack = stack[:len(stack)-1]
+
+		default:
+			continue
+		}
+
+		group.keywords = append(group.keywords, tok)
+
+		if found == nil && tokenContains(text, tok, position) {
+			found = group
+		}
+
+		// The group is complete once it is closed
+		if found != nil && (keyword == "end" || keyword == "until") && group == found {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	ranges := make([]protocol.Range, 0, len(found.keywords))
+	for _, tok := range found.keywords {
+		ranges = append(ranges, tokenRange(text, tok))
+	}
+
+	return ranges
+}
+
+// opensTypeBody reports whether the class or interface keyword at tokens[i]
+// starts a declaration with a body and an end, rather than a forward
+// declaration such as TFoo = class; or a class reference type.
+func opensTypeBody(tokens []lexer.Token, i int) bool {
+	prev := previousCode(tokens, i)
+	if prev < 0 {
+		return false
+	}
+
+	switch strings.ToLower(tokens[prev].Text) {
+	case "=", "partial", "sealed", "static", "abstract":
+	default:
+		return false
+	}
+
+	next := nextCode(tokens, i)
+
+	// Skip the ancestor list
+	if next >= 0 && tokens[next].Is("(") {
+		for depth := 0; next >= 0; next = nextCode(tokens, next) {
+			if tokens[next].Is("(") {
+				depth++
+			} else if tokens[next].Is(")") {
+				depth--
+				if depth == 0 {
+					next = nextCode(tokens, next)
+					break
+				}
+			}
+		}
+	}
+
+	return next < 0 || !(tokens[next].Is(";") || tokens[next].Is("of"))
+}
+
+// previousCode returns the index of the code token before tokens[i], or -1.
+func previousCode(tokens []lexer.Token, i int) int {
+	for i--; i >= 0; i-- {
+		if tokens[i].IsCode() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// nextCode returns the index of the code token after tokens[i], or -1.
+func nextCode(tokens []lexer.Token, i int) int {
+	for i++; i < len(tokens); i++ {
+		if tokens[i].IsCode() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// tokenRange returns the LSP range of a single-line token.
+func tokenRange(text string, tok lexer.Token) protocol.Range {
+	lineStart := strings.LastIndexByte(text[:tok.Offset], '\n') + 1
+	start := uint32(len(utf16.Encode([]rune(text[lineStart:tok.Offset]))))
+	end := start + uint32(len(utf16.Encode([]rune(tok.Text))))
+
+	return protocol.Range{
+		Start: protocol.Position{Line: uint32(tok.Line), Character: start},
+		End:   protocol.Position{Line: uint32(tok.Line), Character: end},
+	}
+}
+
+// tokenContains reports whether the single-line token contains position,
+// including the position right after it.
+func tokenContains(text string, tok lexer.Token, position protocol.Position) bool {
+	if uint32(tok.Line) != position.Line {
+		return false
+	}
+
+	rng := tokenRange(text, tok)
+
+	return rng.Start.Character <= position.Character && position.Character <= rng.End.Character
+}
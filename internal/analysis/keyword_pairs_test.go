@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestMatchingKeywords(t *testing.T) {
+	text := `type
+  TFoo = class
+    FX: Integer;
+  end;
+  TBar = class;
+
+procedure Foo;
+begin
+  try
+    repeat
+      x.End := 1;
+    until x > 0;
+  except
+    case x of
+      1: ;
+    end;
+  end;
+end;`
+
+	tests := []struct {
+		name     string
+		position protocol.Position
+		expected []protocol.Position
+	}{
+		{
+			name:     "class and end",
+			position: protocol.Position{Line: 1, Character: 9},
+			expected: []protocol.Position{{Line: 1, Character: 9}, {Line: 3, Character: 2}},
+		},
+		{
+			name:     "begin from its end",
+			position: protocol.Position{Line: 17, Character: 1},
+			expected: []protocol.Position{{Line: 7, Character: 0}, {Line: 17, Character: 0}},
+		},
+		{
+			name:     "try, except and end",
+			position: protocol.Position{Line: 12, Character: 2},
+			expected: []protocol.Position{{Line: 8, Character: 2}, {Line: 12, Character: 2}, {Line: 16, Character: 2}},
+		},
+		{
+			name:     "repeat and until",
+			position: protocol.Position{Line: 9, Character: 4},
+			expected: []protocol.Position{{Line: 9, Character: 4}, {Line: 11, Character: 4}},
+		},
+		{
+			name:     "case and end",
+			position: protocol.Position{Line: 15, Character: 4},
+			expected: []protocol.Position{{Line: 13, Character: 4}, {Line: 15, Character: 4}},
+		},
+		{
+			name:     "member named end",
+			position: protocol.Position{Line: 10, Character: 9},
+		},
+		{
+			name:     "forward declaration",
+			position: protocol.Position{Line: 4, Character: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := MatchingKeywords(text, tt.position)
+			if len(ranges) != len(tt.expected) {
+				t.Fatalf("Expected %d ranges, got %+v", len(tt.expected), ranges)
+			}
+
+			for i, rng := range ranges {
+				if rng.Start != tt.expected[i] {
+					t.Errorf("Range %d starts at %+v, expected %+v", i, rng.Start, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteAccesses(t *testing.T) {
+	code := `procedure Bump(var n: Integer; m: Integer);
+begin
+  n := n + m;
+end;
+
+var a: Integer := 1;
+var b: Integer;
+b := a;
+Inc(a);
+Bump(b, a);
+for var i := 0 to a do
+  PrintLn(i);`
+
+	program := compileCode(t, code)
+	writes := WriteAccesses(program.AST())
+
+	tests := []struct {
+		line, column int
+		write        bool
+	}{
+		{3, 3, true},   // n := ...
+		{3, 8, false},  // ... n + m
+		{6, 5, true},   // var a := 1
+		{7, 5, false},  // var b without initializer
+		{8, 1, true},   // b := a
+		{8, 6, false},  // := a
+		{9, 5, true},   // Inc(a)
+		{10, 6, true},  // Bump(b, ...)
+		{10, 9, false}, // Bump(..., a)
+		{11, 9, true},  // for var i
+	}
+
+	for _, tt := range tests {
+		pos := token.Position{Line: tt.line, Column: tt.column}
+		if writes[pos] != tt.write {
+			t.Errorf("%d:%d: expected write=%v", tt.line, tt.column, tt.write)
+		}
+	}
+}
@@ -64,6 +64,46 @@ func ParseDocument(text string, filename string) (*dwscript.Program, []protocol.
 	return program, diagnostics, nil
 }
 
+// ParseDocumentWithRecovery parses DWScript source code like ParseDocument, but
+// when the code doesn't compile it also returns the syntax tree recovered from it.
+//
+// The go-dws parser recovers at statement boundaries, so the partial AST holds
+// every statement it could parse; statements with syntax errors are left out and
+// reported in the diagnostics. If only type checking failed, the partial AST is
+// the complete syntax tree. Either way it has not been type-checked.
+//
+// Returns:
+//   - *dwscript.Program: The compiled program (nil if compilation failed)
+//   - *ast.Program: The partial AST (nil if the program compiled)
+//   - []protocol.Diagnostic: List of syntax and semantic errors as LSP diagnostics
+//   - error: Critical error that prevented parsing (e.g., engine creation failed)
+func ParseDocumentWithRecovery(text string, filename string) (*dwscript.Program, *ast.Program, []protocol.Diagnostic, error) {
+	program, diagnostics, err := ParseDocument(text, filename)
+	if err != nil || program != nil {
+		return program, nil, diagnostics, err
+	}
+
+	return nil, ParsePartialAST(text, filename), diagnostics, nil
+}
+
+// ParsePartialAST parses DWScript source code without type checking and returns
+// the best-effort syntax tree, even if the code contains syntax errors.
+// Returns nil only if no engine could be created.
+func ParsePartialAST(text string, filename string) *ast.Program {
+	engine, err := dwscript.New()
+	if err != nil {
+		log.Printf("Failed to create DWScript engine for %s: %v", filename, err)
+		return nil
+	}
+
+	tree, err := engine.Parse(text)
+	if err != nil && tree != nil {
+		log.Printf("Recovered partial AST for %s (%d statements)", filename, len(tree.Statements))
+	}
+
+	return tree
+}
+
 // convertStructuredErrors converts go-dws structured Error objects to LSP Diagnostic objects.
 // This uses the new Phase 2 structured error format with position information already included.
 func convertStructuredErrors(errors []*dwscript.Error) []protocol.Diagnostic {
@@ -3,6 +3,7 @@ package analysis
 import (
 	"testing"
 
+	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/dwscript"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -400,3 +401,98 @@ end.`,
 		})
 	}
 }
+
+func TestParseDocumentWithRecovery_ValidCode(t *testing.T) {
+	program, partialAST, diagnostics, err := ParseDocumentWithRecovery("var x: Integer;\nx := 42;", "test.dws")
+	if err != nil {
+		t.Fatalf("ParseDocumentWithRecovery returned unexpected error: %v", err)
+	}
+
+	if program == nil {
+		t.Fatal("Expected non-nil program for valid code")
+	}
+
+	if partialAST != nil {
+		t.Error("Expected no partial AST when the program compiles")
+	}
+
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %d", len(diagnostics))
+	}
+}
+
+func TestParseDocumentWithRecovery_SyntaxErrors(t *testing.T) {
+	source := `var a: Integer;
+function Foo(x: Integer): Integer;
+begin
+  Result := x +;
+end;
+var b := ;
+PrintLn(a);`
+
+	program, partialAST, diagnostics, err := ParseDocumentWithRecovery(source, "test.dws")
+	if err != nil {
+		t.Fatalf("ParseDocumentWithRecovery returned unexpected error: %v", err)
+	}
+
+	if program != nil {
+		t.Error("Expected nil program for code with syntax errors")
+	}
+
+	if len(diagnostics) == 0 {
+		t.Error("Expected diagnostics for code with syntax errors")
+	}
+
+	if partialAST == nil {
+		t.Fatal("Expected a partial AST for code with syntax errors")
+	}
+
+	// The declarations around the broken lines must survive
+	var names []string
+
+	for _, stmt := range partialAST.Statements {
+		switch node := stmt.(type) {
+		case *ast.VarDeclStatement:
+			for _, name := range node.Names {
+				names = append(names, name.Value)
+			}
+		case *ast.FunctionDecl:
+			names = append(names, node.Name.Value)
+		}
+	}
+
+	for _, want := range []string{"a", "Foo"} {
+		found := false
+
+		for _, name := range names {
+			if name == want {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("Expected partial AST to declare %q, got %v", want, names)
+		}
+	}
+}
+
+func TestParseDocumentWithRecovery_SemanticErrors(t *testing.T) {
+	// Syntactically valid, but y is undeclared
+	program, partialAST, diagnostics, err := ParseDocumentWithRecovery("var x: Integer;\nx := y;", "test.dws")
+	if err != nil {
+		t.Fatalf("ParseDocumentWithRecovery returned unexpected error: %v", err)
+	}
+
+	if program != nil {
+		t.Error("Expected nil program for code with semantic errors")
+	}
+
+	if len(diagnostics) == 0 {
+		t.Error("Expected diagnostics for code with semantic errors")
+	}
+
+	if partialAST == nil || len(partialAST.Statements) != 2 {
+		t.Fatalf("Expected the complete syntax tree, got %v", partialAST)
+	}
+}
@@ -135,12 +135,12 @@ func CollectScopeCompletions(doc *server.Document, cache *server.CompletionCache
 		keywords = getKeywordCompletions()
 		builtins = getBuiltInCompletions()
 
-		if doc.Program != nil && doc.Program.AST() != nil {
-			globalItems = getGlobalCompletions(doc.Program.AST())
+		if doc.AST() != nil {
+			globalItems = getGlobalCompletions(doc.AST())
 		}
 
 		// Cache for future requests
-		if cache != nil && doc.Program != nil {
+		if cache != nil && doc.AST() != nil {
 			cache.SetCachedItems(doc.URI, int32(doc.Version), &server.CachedCompletionItems{
 				Keywords:      keywords,
 				Builtins:      builtins,
@@ -154,12 +154,12 @@ func CollectScopeCompletions(doc *server.Document, cache *server.CompletionCache
 	// Add keywords
 	items = append(items, keywords...)
 
-	if doc.Program == nil || doc.Program.AST() == nil {
+	if doc.AST() == nil {
 		log.Println("CollectScopeCompletions: no AST available, returning keywords only")
 		return items, nil
 	}
 
-	program := doc.Program.AST()
+	program := doc.AST()
 
 	// Convert LSP position (0-based) to AST position (1-based)
 	astLine := line + 1
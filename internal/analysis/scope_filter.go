@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -14,16 +15,49 @@ import (
 // It inspects each reference location, determines its scope, and keeps it only if
 // the scope matches. For documents not currently open, it attempts to parse them
 // from disk on-demand.
-func FilterByScope(references []protocol.Location, docStore *server.DocumentStore, targetName string, targetScope *ScopeInfo) []protocol.Location {
+//
+// Filtering stops early when ctx is cancelled; the result is then incomplete
+// and callers should check ctx.Err().
+func FilterByScope(ctx context.Context, references []protocol.Location, docStore *server.DocumentStore, targetName string, targetScope *ScopeInfo) []protocol.Location {
+	return FilterByScopeWithProgress(ctx, references, docStore, targetName, targetScope, nil)
+}
+
+// FilterByScopeWithProgress is FilterByScope with progress reporting. Since
+// files that aren't open are parsed from disk, filtering references spread over
+// many files can take a while. progress, if not nil, is called after each file
+// with the number of files examined so far and the total number of files.
+func FilterByScopeWithProgress(ctx context.Context, references []protocol.Location, docStore *server.DocumentStore, targetName string, targetScope *ScopeInfo, progress func(done, total int)) []protocol.Location {
 	if len(references) == 0 || targetScope == nil || targetScope.Type == ScopeUnknown {
 		return references
 	}
 
+	total := 0
+
+	if progress != nil {
+		seen := make(map[string]bool)
+
+		for _, loc := range references {
+			if !seen[loc.URI] {
+				seen[loc.URI] = true
+				total++
+			}
+		}
+	}
+
 	cache := make(map[string]*dwscript.Program)
 	var filtered []protocol.Location
 
 	for _, loc := range references {
+		_, known := cache[loc.URI]
+		if !known && ctx.Err() != nil {
+			return filtered
+		}
+
 		program := programForURI(loc.URI, docStore, cache)
+		if !known && progress != nil {
+			progress(len(cache), total)
+		}
+
 		if program == nil || program.AST() == nil {
 			// Can't determine scope, keep the reference to avoid false negatives.
 			filtered = append(filtered, loc)
@@ -49,7 +83,9 @@ func programForURI(uri string, docStore *server.DocumentStore, cache map[string]
 	}
 
 	if docStore != nil {
-		if doc, ok := docStore.Get(uri); ok && doc != nil && doc.Program != nil {
+		if doc, ok := docStore.Get(uri); ok && doc != nil {
+			// Reference positions refer to the current text of open documents, so
+			// neither a stale program nor the file on disk can be used to check them.
 			cache[uri] = doc.Program
 			return doc.Program
 		}
@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// SelectionRanges returns the ranges of the nodes of program containing
+// position, from the innermost node (usually an identifier) out to the whole
+// program. Nodes sharing the range of their child, such as an expression
+// statement wrapping a call, are reported once.
+func SelectionRanges(program *ast.Program, position protocol.Position) []protocol.Range {
+	// Convert LSP (0-based) to AST (1-based)
+	path, spans := nodePathAtPosition(program, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+
+	ranges := make([]protocol.Range, 0, len(path))
+
+	for i := len(path) - 1; i >= 0; i-- {
+		span := spans[path[i]]
+
+		rng := protocol.Range{
+			Start: protocol.Position{Line: uint32(span.start.Line - 1), Character: uint32(span.start.Column - 1)},
+			End:   protocol.Position{Line: uint32(max(0, span.end.Line-1)), Character: uint32(max(0, span.end.Column-1))},
+		}
+
+		if len(ranges) > 0 && rng == ranges[len(ranges)-1] {
+			continue
+		}
+
+		ranges = append(ranges, rng)
+	}
+
+	return ranges
+}
+
+// EnclosesRange reports whether outer contains inner.
+func EnclosesRange(outer, inner protocol.Range) bool {
+	return !positionLess(astPosition(inner.Start), astPosition(outer.Start)) &&
+		!positionLess(astPosition(outer.End), astPosition(inner.End))
+}
+
+// astPosition converts a 0-based LSP position to a 1-based AST position.
+func astPosition(position protocol.Position) token.Position {
+	return token.Position{Line: int(position.Line) + 1, Column: int(position.Character) + 1}
+}
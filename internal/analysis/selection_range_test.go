@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestFindNodePathAtPosition(t *testing.T) {
+	code := `function Add(a, b: Integer): Integer;
+begin
+  Result := a + b;
+end;`
+
+	program := parseCode(t, code)
+
+	// "b" in "a + b"
+	path := FindNodePathAtPosition(program, 3, 17)
+	if len(path) < 3 {
+		t.Fatalf("Expected a path of at least 3 nodes, got %d", len(path))
+	}
+
+	if path[0] != program {
+		t.Errorf("Expected the path to start at the program, got %T", path[0])
+	}
+
+	if ident, ok := path[len(path)-1].(*ast.Identifier); !ok || ident.Value != "b" {
+		t.Errorf("Expected the path to end at identifier b, got %T", path[len(path)-1])
+	}
+
+	// The assignment starts at its := but still encloses its target and value
+	var function, assignment bool
+
+	for _, node := range path {
+		switch node.(type) {
+		case *ast.FunctionDecl:
+			function = true
+		case *ast.AssignmentStatement:
+			assignment = true
+		}
+	}
+
+	if !function || !assignment {
+		t.Errorf("Expected the path to contain the function and the assignment, got %d nodes", len(path))
+	}
+}
+
+func TestSelectionRanges(t *testing.T) {
+	code := `function Add(a, b: Integer): Integer;
+begin
+  Result := a + b;
+end;`
+
+	program := parseCode(t, code)
+
+	// "b" in "a + b"
+	ranges := SelectionRanges(program, protocol.Position{Line: 2, Character: 16})
+
+	expected := []protocol.Range{
+		{Start: protocol.Position{Line: 2, Character: 16}, End: protocol.Position{Line: 2, Character: 17}}, // b
+		{Start: protocol.Position{Line: 2, Character: 12}, End: protocol.Position{Line: 2, Character: 17}}, // a + b
+		{Start: protocol.Position{Line: 2, Character: 2}, End: protocol.Position{Line: 2, Character: 18}},  // assignment
+	}
+
+	if len(ranges) < len(expected)+1 {
+		t.Fatalf("Expected at least %d ranges, got %+v", len(expected)+1, ranges)
+	}
+
+	for i, rng := range expected {
+		if ranges[i] != rng {
+			t.Errorf("Range %d: got %+v, expected %+v", i, ranges[i], rng)
+		}
+	}
+
+	// Every range encloses the previous one and none repeats
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i] == ranges[i-1] || !EnclosesRange(ranges[i], ranges[i-1]) {
+			t.Errorf("Range %d %+v doesn't strictly enclose range %d %+v", i, ranges[i], i-1, ranges[i-1])
+		}
+	}
+
+	// The function is among the ranges
+	function := protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 3, Character: 4}}
+
+	found := false
+
+	for _, rng := range ranges {
+		if rng == function {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("Expected the function range %+v, got %+v", function, ranges)
+	}
+}
+
+func TestSelectionRangesNoNode(t *testing.T) {
+	if ranges := SelectionRanges(nil, protocol.Position{}); len(ranges) != 0 {
+		t.Errorf("Expected no ranges without a program, got %+v", ranges)
+	}
+}
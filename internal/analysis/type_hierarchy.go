@@ -0,0 +1,306 @@
+package analysis
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// TypeDecl is a class or interface declaration in a document.
+type TypeDecl struct {
+	URI string
+
+	// Decl is an *ast.ClassDecl or an *ast.InterfaceDecl
+	Decl ast.Statement
+}
+
+// Name returns the name of the type.
+func (t TypeDecl) Name() *ast.Identifier {
+	switch decl := t.Decl.(type) {
+	case *ast.ClassDecl:
+		return decl.Name
+	case *ast.InterfaceDecl:
+		return decl.Name
+	}
+
+	return nil
+}
+
+// Supertypes returns the names of the parent class and the implemented
+// interfaces of a class, or the parent of an interface.
+func (t TypeDecl) Supertypes() []*ast.Identifier {
+	var supertypes []*ast.Identifier
+
+	switch decl := t.Decl.(type) {
+	case *ast.ClassDecl:
+		if decl.Parent != nil {
+			supertypes = append(supertypes, decl.Parent)
+		}
+
+		for _, iface := range decl.Interfaces {
+			if iface != nil {
+				supertypes = append(supertypes, iface)
+			}
+		}
+
+	case *ast.InterfaceDecl:
+		if decl.Parent != nil {
+			supertypes = append(supertypes, decl.Parent)
+		}
+	}
+
+	return supertypes
+}
+
+// TypeHierarchy finds the classes and interfaces around a type. It looks at
+// the open documents and at the files of the workspace index, which are
+// parsed from disk on demand and cached for the lifetime of the hierarchy.
+// Only syntax trees are needed, so documents that don't compile, such as
+// units deriving from classes declared elsewhere, are included.
+type TypeHierarchy struct {
+	docs     *server.DocumentStore
+	index    *workspace.SymbolIndex
+	programs map[string]*ast.Program
+}
+
+// NewTypeHierarchy creates a type hierarchy. Either argument may be nil.
+func NewTypeHierarchy(docs *server.DocumentStore, index *workspace.SymbolIndex) *TypeHierarchy {
+	return &TypeHierarchy{
+		docs:     docs,
+		index:    index,
+		programs: make(map[string]*ast.Program),
+	}
+}
+
+// SetProgram makes the hierarchy use program for uri, such as the last good
+// program of an open document whose current text can't be parsed.
+func (h *TypeHierarchy) SetProgram(uri string, program *ast.Program) {
+	h.programs[uri] = program
+}
+
+// Program returns the syntax tree of uri, or nil if it can't be parsed.
+func (h *TypeHierarchy) Program(uri string) *ast.Program {
+	if program, ok := h.programs[uri]; ok {
+		return program
+	}
+
+	var program *ast.Program
+
+	if doc, ok := h.openDocument(uri); ok {
+		program = doc.AST()
+	} else {
+		program = parseSyntaxFromDisk(uri)
+	}
+
+	h.programs[uri] = program
+
+	return program
+}
+
+// openDocument returns the open document uri, if there is one.
+func (h *TypeHierarchy) openDocument(uri string) (*server.Document, bool) {
+	if h.docs == nil {
+		return nil, false
+	}
+
+	doc, ok := h.docs.Get(uri)
+
+	return doc, ok && doc != nil
+}
+
+// TypeAt returns the class or interface declared or referenced at pos in uri,
+// or nil if there is none.
+func (h *TypeHierarchy) TypeAt(uri string, pos token.Position) *TypeDecl {
+	program := h.Program(uri)
+	if program == nil {
+		return nil
+	}
+
+	path := FindNodePathAtPosition(program, pos.Line, pos.Column)
+	if len(path) == 0 {
+		return nil
+	}
+
+	switch node := path[len(path)-1].(type) {
+	case *ast.Identifier:
+		// The name of a declaration stands for the declaration itself
+		if len(path) > 1 {
+			if t := (TypeDecl{URI: uri, Decl: declStatement(path[len(path)-2])}); t.Decl != nil && t.Name() == node {
+				return &t
+			}
+		}
+
+		return h.FindType(uri, node.Value)
+
+	case *ast.TypeAnnotation:
+		return h.FindType(uri, node.Name)
+	}
+
+	return nil
+}
+
+// FindType looks up the class or interface name as seen from uri: in the
+// document itself, then in the files of the workspace index and the other
+// open documents.
+func (h *TypeHierarchy) FindType(uri, name string) *TypeDecl {
+	if t := typeDeclIn(uri, h.Program(uri), name); t != nil {
+		return t
+	}
+
+	var uris []string
+
+	if h.index != nil {
+		for _, symbol := range h.index.FindSymbol(name) {
+			if symbol.Kind == protocol.SymbolKindClass || symbol.Kind == protocol.SymbolKindInterface {
+				uris = append(uris, symbol.Location.URI)
+			}
+		}
+	}
+
+	if h.docs != nil {
+		uris = append(uris, h.docs.List()...)
+	}
+
+	for _, other := range uris {
+		if other == uri {
+			continue
+		}
+
+		if t := typeDeclIn(other, h.Program(other), name); t != nil {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Supertypes returns the declarations of the supertypes of t. Supertypes
+// that can't be found, such as the built-in TObject, are left out.
+func (h *TypeHierarchy) Supertypes(t TypeDecl) []TypeDecl {
+	var supertypes []TypeDecl
+
+	for _, name := range t.Supertypes() {
+		if supertype := h.FindType(t.URI, name.Value); supertype != nil {
+			supertypes = append(supertypes, *supertype)
+		}
+	}
+
+	return supertypes
+}
+
+// Subtypes returns the classes and interfaces deriving directly from t. They
+// are looked for in the open documents, in t's own document and, through the
+// index of subtypes, in the files of the workspace.
+func (h *TypeHierarchy) Subtypes(t TypeDecl) []TypeDecl {
+	name := t.Name()
+	if name == nil {
+		return nil
+	}
+
+	uris := []string{t.URI}
+
+	if h.docs != nil {
+		uris = append(uris, h.docs.List()...)
+	}
+
+	if h.index != nil {
+		for _, subtype := range h.index.FindSubtypes(name.Value) {
+			uris = append(uris, subtype.Location.URI)
+		}
+	}
+
+	slices.Sort(uris)
+	uris = slices.Compact(uris)
+
+	var subtypes []TypeDecl
+
+	for _, uri := range uris {
+		program := h.Program(uri)
+		if program == nil {
+			continue
+		}
+
+		for _, stmt := range topLevelStatements(program) {
+			candidate := TypeDecl{URI: uri, Decl: declStatement(stmt)}
+			if candidate.Decl == nil {
+				continue
+			}
+
+			for _, supertype := range candidate.Supertypes() {
+				if strings.EqualFold(supertype.Value, name.Value) {
+					subtypes = append(subtypes, candidate)
+					break
+				}
+			}
+		}
+	}
+
+	return subtypes
+}
+
+// declStatement returns node if it is a class or interface declaration.
+func declStatement(node ast.Node) ast.Statement {
+	switch decl := node.(type) {
+	case *ast.ClassDecl:
+		return decl
+	case *ast.InterfaceDecl:
+		return decl
+	}
+
+	return nil
+}
+
+// typeDeclIn returns the top-level class or interface name of program.
+func typeDeclIn(uri string, program *ast.Program, name string) *TypeDecl {
+	if program == nil {
+		return nil
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		t := TypeDecl{URI: uri, Decl: declStatement(stmt)}
+		if t.Decl == nil {
+			continue
+		}
+
+		if typeName := t.Name(); typeName != nil && strings.EqualFold(typeName.Value, name) {
+			return &t
+		}
+	}
+
+	return nil
+}
+
+// parseSyntaxFromDisk returns the syntax tree of the file uri, which needn't
+// compile, or nil if it can't be read.
+func parseSyntaxFromDisk(uri string) *ast.Program {
+	path, err := uriToPath(uri)
+	if err != nil {
+		log.Printf("Unable to resolve path for %s: %v", uri, err)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Unable to read %s: %v", path, err)
+		return nil
+	}
+
+	program, partial, _, err := ParseDocumentWithRecovery(string(data), uri)
+	if err != nil {
+		log.Printf("Unable to parse %s: %v", uri, err)
+		return nil
+	}
+
+	if program != nil {
+		return program.AST()
+	}
+
+	return partial
+}
@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+const typeHierarchyCode = `type IShape = interface
+  function Area: Float;
+end;
+
+type IPolygon = interface(IShape)
+end;
+
+type TBase = class
+end;
+
+type TSquare = class(TBase, IShape)
+  function Area: Float;
+end;
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;
+
+var s: TSquare;
+var b := TBase.Create;`
+
+// newTestTypeHierarchy returns a type hierarchy that knows code as test.dws.
+func newTestTypeHierarchy(t *testing.T, code string) *TypeHierarchy {
+	t.Helper()
+
+	program, _, err := ParseDocument(code, "test.dws")
+	if err != nil || program == nil {
+		t.Fatalf("Failed to parse test code: %v", err)
+	}
+
+	hierarchy := NewTypeHierarchy(nil, nil)
+	hierarchy.SetProgram("file:///test.dws", program.AST())
+
+	return hierarchy
+}
+
+// typeNames returns the names of types for test messages.
+func typeNames(types []TypeDecl) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name().Value
+	}
+
+	return names
+}
+
+func TestTypeHierarchy_TypeAt(t *testing.T) {
+	hierarchy := newTestTypeHierarchy(t, typeHierarchyCode)
+
+	tests := []struct {
+		name     string
+		pos      token.Position
+		expected string
+	}{
+		{"interface declaration", token.Position{Line: 1, Column: 6}, "IShape"},
+		{"class declaration", token.Position{Line: 11, Column: 6}, "TSquare"},
+		{"parent class", token.Position{Line: 11, Column: 22}, "TBase"},
+		{"implemented interface", token.Position{Line: 11, Column: 30}, "IShape"},
+		{"variable type", token.Position{Line: 20, Column: 8}, "TSquare"},
+		{"constructor call", token.Position{Line: 21, Column: 10}, "TBase"},
+		{"routine name", token.Position{Line: 15, Column: 18}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var name string
+			if typeDecl := hierarchy.TypeAt("file:///test.dws", tt.pos); typeDecl != nil {
+				name = typeDecl.Name().Value
+			}
+
+			if name != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestTypeHierarchy_SupertypesAndSubtypes(t *testing.T) {
+	hierarchy := newTestTypeHierarchy(t, typeHierarchyCode)
+	square := hierarchy.FindType("file:///test.dws", "tsquare")
+	if square == nil {
+		t.Fatal("Expected to find TSquare")
+	}
+
+	if names := typeNames(hierarchy.Supertypes(*square)); len(names) != 2 || names[0] != "TBase" || names[1] != "IShape" {
+		t.Errorf("Expected supertypes [TBase IShape], got %v", names)
+	}
+
+	if names := typeNames(hierarchy.Subtypes(*square)); len(names) != 0 {
+		t.Errorf("Expected no subtypes of TSquare, got %v", names)
+	}
+
+	shape := hierarchy.FindType("file:///test.dws", "IShape")
+	if names := typeNames(hierarchy.Subtypes(*shape)); len(names) != 2 || names[0] != "IPolygon" || names[1] != "TSquare" {
+		t.Errorf("Expected subtypes [IPolygon TSquare], got %v", names)
+	}
+
+	// TObject is built in and has no declaration
+	base := hierarchy.FindType("file:///test.dws", "TBase")
+	if names := typeNames(hierarchy.Supertypes(*base)); len(names) != 0 {
+		t.Errorf("Expected no declared supertypes of TBase, got %v", names)
+	}
+}
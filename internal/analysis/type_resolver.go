@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/token"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -34,7 +35,7 @@ type TypeInfo struct {
 func ResolveMemberType(doc *server.Document, identifier string, line, character int) *TypeInfo {
 	log.Printf("ResolveMemberType: resolving type of '%s' at %d:%d", identifier, line, character)
 
-	if doc.Program == nil || doc.Program.AST() == nil {
+	if doc.AST() == nil {
 		log.Println("ResolveMemberType: no AST available")
 		return nil
 	}
@@ -48,7 +49,7 @@ func ResolveMemberType(doc *server.Document, identifier string, line, character
 	}
 
 	// Create a symbol resolver to find the identifier declaration
-	resolver := NewSymbolResolver(doc.URI, doc.Program.AST(), pos)
+	resolver := NewSymbolResolver(doc.URI, doc.AST(), pos)
 
 	// Resolve the identifier to its declaration
 	locations := resolver.ResolveSymbol(identifier)
@@ -64,7 +65,7 @@ func ResolveMemberType(doc *server.Document, identifier string, line, character
 
 	// Now we need to find the actual declaration node and extract its type
 	// We'll search the AST for a node at the resolved location
-	typeInfo := extractTypeFromLocation(doc.Program.AST(), identifier, location)
+	typeInfo := extractTypeFromLocation(doc.AST(), identifier, location)
 
 	if typeInfo != nil {
 		log.Printf("ResolveMemberType: resolved '%s' to type '%s'", identifier, typeInfo.TypeName)
@@ -75,6 +76,76 @@ func ResolveMemberType(doc *server.Document, identifier string, line, character
 	return typeInfo
 }
 
+// ResolveSymbolType resolves the type of the symbol name at a given position
+// for go to type definition: the declared type of a variable, field or
+// parameter, the class a variable is constructed from, the result type of a
+// function or method, or the type itself if name is the name of a type. The
+// workspace index, which may be nil, is used to recognize types declared
+// elsewhere. Returns the type information or nil if the type cannot be
+// determined.
+func ResolveSymbolType(doc *server.Document, index *workspace.SymbolIndex, name string, line, character int) *TypeInfo {
+	if typeInfo := ResolveMemberType(doc, name, line, character); typeInfo != nil {
+		return typeInfo
+	}
+
+	if isTypeName(doc.AST(), index, name) {
+		return &TypeInfo{
+			TypeName:  name,
+			IsBuiltIn: isBuiltInType(name),
+		}
+	}
+
+	// Fields and methods accessed on an object aren't in scope at the position,
+	// so they are matched by name
+	if typeInfo := findFieldType(doc.AST(), name); typeInfo != nil {
+		return typeInfo
+	}
+
+	return findFunctionResultType(doc.AST(), name)
+}
+
+// isTypeName reports whether name is a built-in type or a type declared in
+// program or in the workspace index.
+func isTypeName(program *ast.Program, index *workspace.SymbolIndex, name string) bool {
+	if isBuiltInType(name) {
+		return true
+	}
+
+	for _, stmt := range topLevelStatements(program) {
+		var typeName *ast.Identifier
+
+		switch decl := stmt.(type) {
+		case *ast.ClassDecl:
+			typeName = decl.Name
+		case *ast.InterfaceDecl:
+			typeName = decl.Name
+		case *ast.RecordDecl:
+			typeName = decl.Name
+		case *ast.EnumDecl:
+			typeName = decl.Name
+		case *ast.TypeDeclaration:
+			typeName = decl.Name
+		}
+
+		if typeName != nil && strings.EqualFold(typeName.Value, name) {
+			return true
+		}
+	}
+
+	if index == nil {
+		return false
+	}
+
+	for _, symbol := range index.FindSymbol(name) {
+		switch symbol.Kind {
+		case protocol.SymbolKindClass, protocol.SymbolKindInterface, protocol.SymbolKindStruct, protocol.SymbolKindEnum:
+			return true
+		}
+	}
+
+	return false
+}
+
 // extractTypeFromLocation finds the declaration node at the given location
 // and extracts type information from it.
 func extractTypeFromLocation(program *ast.Program, identifier string, location protocol.Location) *TypeInfo {
@@ -125,6 +196,10 @@ func extractTypeFromNode(program *ast.Program, node ast.Node, identifier string)
 		return typeInfo
 	}
 
+	if typeInfo := findFunctionResultType(program, identifier); typeInfo != nil {
+		return typeInfo
+	}
+
 	return nil
 }
 
@@ -145,6 +220,14 @@ func findVariableType(program *ast.Program, varName string) *TypeInfo {
 					typeInfo = typeAnnotationToTypeInfo(varDecl.Type)
 					return false
 				}
+
+				// A variable without a type takes the class it is constructed from
+				if name.Value == varName && varDecl.Value != nil {
+					if className := constructedClass(varDecl.Value); className != "" {
+						typeInfo = &TypeInfo{TypeName: className}
+						return false
+					}
+				}
 			}
 		}
 
@@ -204,6 +287,56 @@ func findFieldType(program *ast.Program, fieldName string) *TypeInfo {
 	return typeInfo
 }
 
+// findFunctionResultType searches for a function declaration and returns its
+// result type.
+func findFunctionResultType(program *ast.Program, funcName string) *TypeInfo {
+	var typeInfo *TypeInfo
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil || typeInfo != nil {
+			return false
+		}
+
+		if funcDecl, ok := node.(*ast.FunctionDecl); ok {
+			if funcDecl.Name != nil && funcDecl.Name.Value == funcName && funcDecl.ReturnType != nil {
+				typeInfo = typeAnnotationToTypeInfo(funcDecl.ReturnType)
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return typeInfo
+}
+
+// constructedClass returns the name of the class a constructor call like
+// TFoo.Create, TFoo.Create(...) or new TFoo creates, or "" for other
+// expressions.
+func constructedClass(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.NewExpression:
+		if expr.ClassName != nil {
+			return expr.ClassName.Value
+		}
+
+	case *ast.MemberAccessExpression:
+		if class, ok := expr.Object.(*ast.Identifier); ok && expr.Member != nil && strings.EqualFold(expr.Member.Value, "Create") {
+			return class.Value
+		}
+
+	case *ast.MethodCallExpression:
+		if class, ok := expr.Object.(*ast.Identifier); ok && expr.Method != nil && strings.EqualFold(expr.Method.Value, "Create") {
+			return class.Value
+		}
+
+	case *ast.CallExpression:
+		return constructedClass(expr.Function)
+	}
+
+	return ""
+}
+
 // typeAnnotationToTypeInfo converts a TypeAnnotation to TypeInfo.
 func typeAnnotationToTypeInfo(typeAnnotation *ast.TypeAnnotation) *TypeInfo {
 	if typeAnnotation == nil {
@@ -266,7 +399,7 @@ func isBuiltInType(typeName string) bool {
 func GetTypeMembers(doc *server.Document, typeName string) ([]protocol.CompletionItem, error) {
 	log.Printf("GetTypeMembers: retrieving members for type '%s'", typeName)
 
-	if doc.Program == nil || doc.Program.AST() == nil {
+	if doc.AST() == nil {
 		log.Println("GetTypeMembers: no AST available")
 		return nil, nil
 	}
@@ -281,7 +414,7 @@ func GetTypeMembers(doc *server.Document, typeName string) ([]protocol.Completio
 	}
 
 	// Search for the type definition in the AST
-	program := doc.Program.AST()
+	program := doc.AST()
 
 	// Try to find as a class
 	if classMembers := extractClassMembers(program, typeName); len(classMembers) > 0 {
@@ -494,3 +494,64 @@ end.`
 		t.Errorf("Expected third member to be 'ZField', got '%s'", members[2].Label)
 	}
 }
+
+func TestResolveSymbolType(t *testing.T) {
+	source := `type TConnection = class
+  Port: Integer;
+end;
+
+type TPool = class
+  Conn: TConnection;
+end;
+
+function Connect: TConnection;
+begin
+  Result := TConnection.Create;
+end;
+
+var pool := TPool.Create;
+var conn := Connect();
+pool.Conn := conn;`
+
+	program, _, err := ParseDocument(source, "test.dws")
+	if err != nil || program == nil {
+		t.Fatalf("Failed to parse source: %v", err)
+	}
+
+	doc := &server.Document{
+		URI:     "file:///test.dws",
+		Text:    source,
+		Program: program,
+	}
+
+	tests := []struct {
+		name      string
+		symbol    string
+		line      int
+		character int
+		expected  string
+	}{
+		{"constructed variable", "pool", 15, 1, "TPool"},
+		{"function result", "Connect", 14, 12, "TConnection"},
+		{"field accessed on an object", "Conn", 15, 6, "TConnection"},
+		{"type name", "TPool", 4, 6, "TPool"},
+		{"built-in field type", "Port", 1, 3, "Integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typeInfo := ResolveSymbolType(doc, nil, tt.symbol, tt.line, tt.character)
+			if typeInfo == nil {
+				t.Fatal("Expected typeInfo to be non-nil, got nil")
+			}
+
+			if typeInfo.TypeName != tt.expected {
+				t.Errorf("Expected type '%s', got '%s'", tt.expected, typeInfo.TypeName)
+			}
+		})
+	}
+
+	if typeInfo := ResolveSymbolType(doc, nil, "unknown", 15, 1); typeInfo != nil {
+		t.Errorf("Expected nil for an unknown symbol, got %+v", typeInfo)
+	}
+}
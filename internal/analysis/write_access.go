@@ -0,0 +1,134 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+// writingBuiltins are the built-in procedures that modify their first argument.
+var writingBuiltins = map[string]bool{
+	"inc": true, "dec": true,
+}
+
+// WriteAccesses returns the start positions, without byte offsets, of the
+// identifiers in program whose variable is written rather than read:
+// assignment targets, loop variables, initialized declarations, arguments
+// passed to var parameters of the program's functions and the first argument
+// of Inc and Dec.
+func WriteAccesses(program *ast.Program) map[token.Position]bool {
+	writes := make(map[token.Position]bool)
+	if program == nil {
+		return writes
+	}
+
+	byRef := varParameters(program)
+
+	markWritten := func(expr ast.Expression) {
+		if ident := writtenIdentifier(expr); ident != nil {
+			writes[lineColumn(ident.Pos())] = true
+		}
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignmentStatement:
+			markWritten(n.Target)
+
+		case *ast.ForStatement:
+			if n.Variable != nil {
+				writes[lineColumn(n.Variable.Pos())] = true
+			}
+
+		case *ast.ForInStatement:
+			if n.Variable != nil {
+				writes[lineColumn(n.Variable.Pos())] = true
+			}
+
+		case *ast.VarDeclStatement:
+			if n.Value != nil {
+				for _, name := range n.Names {
+					if name != nil {
+						writes[lineColumn(name.Pos())] = true
+					}
+				}
+			}
+
+		case *ast.CallExpression:
+			function, ok := n.Function.(*ast.Identifier)
+			if !ok || function == nil {
+				return true
+			}
+
+			name := strings.ToLower(function.Value)
+
+			if writingBuiltins[name] && len(n.Arguments) > 0 {
+				markWritten(n.Arguments[0])
+			}
+
+			for i, arg := range n.Arguments {
+				if i < len(byRef[name]) && byRef[name][i] {
+					markWritten(arg)
+				}
+			}
+		}
+
+		return true
+	})
+
+	return writes
+}
+
+// lineColumn returns pos without its byte offset.
+func lineColumn(pos token.Position) token.Position {
+	return token.Position{Line: pos.Line, Column: pos.Column}
+}
+
+// varParameters maps the lower-case names of the functions declared in
+// program to whether each of their parameters is a var parameter. A parameter
+// of overloaded functions counts as var if it is in any overload.
+func varParameters(program *ast.Program) map[string][]bool {
+	byRef := make(map[string][]bool)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		fn, ok := node.(*ast.FunctionDecl)
+		if !ok || fn == nil || fn.Name == nil {
+			return true
+		}
+
+		name := strings.ToLower(fn.Name.Value)
+
+		for i, param := range fn.Parameters {
+			if param == nil || !param.ByRef {
+				continue
+			}
+
+			for len(byRef[name]) <= i {
+				byRef[name] = append(byRef[name], false)
+			}
+
+			byRef[name][i] = true
+		}
+
+		return true
+	})
+
+	return byRef
+}
+
+// writtenIdentifier returns the identifier whose variable an assignment to
+// expr writes: the variable itself, the array of an indexed element, or the
+// field of a member access.
+func writtenIdentifier(expr ast.Expression) *ast.Identifier {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return e
+	case *ast.IndexExpression:
+		return writtenIdentifier(e.Left)
+	case *ast.MemberAccessExpression:
+		return e.Member
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,284 @@
+package document
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// PositionMap records the edits applied to a document since a snapshot of its
+// text was taken. It translates positions between the snapshot and the current
+// text, so results computed on an older AST can be shown at the right place.
+//
+// A PositionMap is immutable; the With* methods return a new map. A nil map is
+// valid and represents "no edits", mapping every position to itself.
+type PositionMap struct {
+	edits []positionEdit
+}
+
+// positionEdit is a single replacement of the range [start, oldEnd) by text
+// that now spans [start, newEnd). All positions are 0-based LSP positions.
+type positionEdit struct {
+	start  protocol.Position
+	oldEnd protocol.Position
+	newEnd protocol.Position
+}
+
+// Len returns the number of recorded edits.
+func (m *PositionMap) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return len(m.edits)
+}
+
+// WithEdit returns a map that additionally records the replacement of rng by text.
+func (m *PositionMap) WithEdit(rng protocol.Range, text string) *PositionMap {
+	edit := positionEdit{
+		start:  rng.Start,
+		oldEnd: rng.End,
+		newEnd: endOfInsertedText(rng.Start, text),
+	}
+
+	var edits []positionEdit
+	if m != nil {
+		// Clip so that appending never writes into a slice shared with m
+		edits = slices.Clip(m.edits)
+	}
+
+	return &PositionMap{edits: append(edits, edit)}
+}
+
+// WithTextChange returns a map that additionally records the replacement of
+// oldText by newText, as sent by clients using full document sync. The change is
+// reduced to the smallest edit covering the difference between the two texts.
+func (m *PositionMap) WithTextChange(oldText, newText string) *PositionMap {
+	prefix := commonPrefixLength(oldText, newText)
+	suffix := commonSuffixLength(oldText[prefix:], newText[prefix:])
+
+	if prefix == len(oldText) && prefix == len(newText) {
+		return m
+	}
+
+	startLine, startChar, err := OffsetToPosition(oldText, prefix)
+	if err != nil {
+		return m
+	}
+
+	endLine, endChar, err := OffsetToPosition(oldText, len(oldText)-suffix)
+	if err != nil {
+		return m
+	}
+
+	rng := protocol.Range{
+		Start: protocol.Position{Line: uint32(startLine), Character: uint32(startChar)},
+		End:   protocol.Position{Line: uint32(endLine), Character: uint32(endChar)},
+	}
+
+	return m.WithEdit(rng, newText[prefix:len(newText)-suffix])
+}
+
+// ToCurrent maps a position in the snapshot to the current text.
+// The second result is false if the position lies inside text that has since
+// been replaced; the returned position is then the start of the replacement.
+func (m *PositionMap) ToCurrent(pos protocol.Position) (protocol.Position, bool) {
+	return m.toCurrent(pos, false)
+}
+
+// ToSnapshot maps a position in the current text back to the snapshot.
+// The second result is false if the position lies inside text that was inserted
+// after the snapshot was taken; the returned position is then the start of the
+// edit in the snapshot.
+func (m *PositionMap) ToSnapshot(pos protocol.Position) (protocol.Position, bool) {
+	if m == nil {
+		return pos, true
+	}
+
+	exact := true
+
+	for i := len(m.edits) - 1; i >= 0; i-- {
+		edit := m.edits[i]
+
+		var ok bool
+
+		pos, ok = mapThroughEdit(pos, edit.start, edit.newEnd, edit.oldEnd, false)
+		exact = exact && ok
+	}
+
+	return pos, exact
+}
+
+// RangeToCurrent maps a snapshot range to the current text.
+// Edits inside the range grow or shrink it; the second result is false only if
+// one of the range's endpoints lies inside replaced text.
+func (m *PositionMap) RangeToCurrent(rng protocol.Range) (protocol.Range, bool) {
+	start, startOK := m.toCurrent(rng.Start, false)
+	end, endOK := m.toCurrent(rng.End, true)
+
+	if positionLess(end, start) {
+		end = start
+	}
+
+	return protocol.Range{Start: start, End: end}, startOK && endOK
+}
+
+// RangeToCurrentExact maps a snapshot range to the current text if the text it
+// covers has not been touched by any edit. Use it for ranges that must still
+// denote exactly the same text, such as identifiers that are about to be edited.
+func (m *PositionMap) RangeToCurrentExact(rng protocol.Range) (protocol.Range, bool) {
+	if m == nil {
+		return rng, true
+	}
+
+	for _, edit := range m.edits {
+		if editTouchesRange(edit, rng) {
+			return rng, false
+		}
+
+		rng.Start, _ = mapThroughEdit(rng.Start, edit.start, edit.oldEnd, edit.newEnd, false)
+		rng.End, _ = mapThroughEdit(rng.End, edit.start, edit.oldEnd, edit.newEnd, true)
+	}
+
+	return rng, true
+}
+
+// toCurrent maps a snapshot position through all edits in order.
+// atRangeEnd decides where a position sitting exactly at a pure insertion ends
+// up: range ends stay before the inserted text, everything else moves after it.
+func (m *PositionMap) toCurrent(pos protocol.Position, atRangeEnd bool) (protocol.Position, bool) {
+	if m == nil {
+		return pos, true
+	}
+
+	exact := true
+
+	for _, edit := range m.edits {
+		var ok bool
+
+		pos, ok = mapThroughEdit(pos, edit.start, edit.oldEnd, edit.newEnd, atRangeEnd)
+		exact = exact && ok
+	}
+
+	return pos, exact
+}
+
+// mapThroughEdit maps pos across a replacement of [start, fromEnd) by text
+// spanning [start, toEnd).
+func mapThroughEdit(pos, start, fromEnd, toEnd protocol.Position, atRangeEnd bool) (protocol.Position, bool) {
+	switch {
+	case positionLess(pos, start):
+		return pos, true
+
+	case pos == start && start == fromEnd:
+		// Pure insertion exactly at pos
+		if atRangeEnd {
+			return pos, true
+		}
+
+		return shiftPosition(pos, fromEnd, toEnd), true
+
+	case pos == start:
+		return pos, true
+
+	case positionLess(pos, fromEnd):
+		// Inside the replaced text: there is no exact counterpart
+		return start, false
+
+	default:
+		return shiftPosition(pos, fromEnd, toEnd), true
+	}
+}
+
+// shiftPosition moves a position at or after fromEnd so that it keeps its
+// distance to the end of the edit, which is now toEnd.
+func shiftPosition(pos, fromEnd, toEnd protocol.Position) protocol.Position {
+	if pos.Line == fromEnd.Line {
+		return protocol.Position{
+			Line:      toEnd.Line,
+			Character: toEnd.Character + (pos.Character - fromEnd.Character),
+		}
+	}
+
+	return protocol.Position{
+		Line:      uint32(int(pos.Line) + int(toEnd.Line) - int(fromEnd.Line)),
+		Character: pos.Character,
+	}
+}
+
+// editTouchesRange reports whether an edit changes any text within rng,
+// including insertions strictly inside it.
+func editTouchesRange(edit positionEdit, rng protocol.Range) bool {
+	if edit.start == edit.oldEnd {
+		return positionLess(rng.Start, edit.start) && positionLess(edit.start, rng.End)
+	}
+
+	return positionLess(edit.start, rng.End) && positionLess(rng.Start, edit.oldEnd)
+}
+
+// endOfInsertedText returns the position just after text inserted at start.
+func endOfInsertedText(start protocol.Position, text string) protocol.Position {
+	lastNewline := strings.LastIndexByte(text, '\n')
+	if lastNewline < 0 {
+		return protocol.Position{
+			Line:      start.Line,
+			Character: start.Character + utf16Length(text),
+		}
+	}
+
+	return protocol.Position{
+		Line:      start.Line + uint32(strings.Count(text, "\n")),
+		Character: utf16Length(text[lastNewline+1:]),
+	}
+}
+
+// utf16Length returns the length of s in UTF-16 code units.
+func utf16Length(s string) uint32 {
+	return uint32(len(utf16.Encode([]rune(s))))
+}
+
+// commonPrefixLength returns the length in bytes of the common prefix of a and b,
+// never splitting a UTF-8 sequence.
+func commonPrefixLength(a, b string) int {
+	n := min(len(a), len(b))
+
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+
+	return i
+}
+
+// commonSuffixLength returns the length in bytes of the common suffix of a and b,
+// never splitting a UTF-8 sequence.
+func commonSuffixLength(a, b string) int {
+	n := min(len(a), len(b))
+
+	i := 0
+	for i < n && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+
+	for i > 0 && !utf8.RuneStart(a[len(a)-i]) {
+		i--
+	}
+
+	return i
+}
+
+// positionLess reports whether a comes before b.
+func positionLess(a, b protocol.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+
+	return a.Character < b.Character
+}
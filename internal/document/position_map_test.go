@@ -0,0 +1,181 @@
+package document
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func pos(line, character uint32) protocol.Position {
+	return protocol.Position{Line: line, Character: character}
+}
+
+func rng(startLine, startChar, endLine, endChar uint32) protocol.Range {
+	return protocol.Range{Start: pos(startLine, startChar), End: pos(endLine, endChar)}
+}
+
+func TestPositionMap_NilIsIdentity(t *testing.T) {
+	var m *PositionMap
+
+	if got, ok := m.ToCurrent(pos(3, 4)); !ok || got != pos(3, 4) {
+		t.Errorf("ToCurrent = %v, %v; want {3 4}, true", got, ok)
+	}
+
+	if got, ok := m.ToSnapshot(pos(3, 4)); !ok || got != pos(3, 4) {
+		t.Errorf("ToSnapshot = %v, %v; want {3 4}, true", got, ok)
+	}
+
+	if m.Len() != 0 {
+		t.Errorf("Len = %d, want 0", m.Len())
+	}
+}
+
+func TestPositionMap_InsertedLines(t *testing.T) {
+	// Insert two new lines at the start of line 1
+	m := (*PositionMap)(nil).WithEdit(rng(1, 0, 1, 0), "var a;\nvar b;\n")
+
+	tests := []struct {
+		name string
+		in   protocol.Position
+		want protocol.Position
+	}{
+		{"before edit", pos(0, 5), pos(0, 5)},
+		{"at insertion point", pos(1, 0), pos(3, 0)},
+		{"same line after insertion", pos(1, 4), pos(3, 4)},
+		{"later line", pos(5, 2), pos(7, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.ToCurrent(tt.in)
+			if !ok || got != tt.want {
+				t.Errorf("ToCurrent(%v) = %v, %v; want %v, true", tt.in, got, ok, tt.want)
+			}
+
+			back, ok := m.ToSnapshot(got)
+			if !ok || back != tt.in {
+				t.Errorf("ToSnapshot(%v) = %v, %v; want %v, true", got, back, ok, tt.in)
+			}
+		})
+	}
+}
+
+func TestPositionMap_ReplacedText(t *testing.T) {
+	// "var x: Integer;" -> "var x: Str;"
+	m := (*PositionMap)(nil).WithEdit(rng(0, 7, 0, 14), "Str")
+
+	if got, ok := m.ToCurrent(pos(0, 10)); ok || got != pos(0, 7) {
+		t.Errorf("ToCurrent inside replaced text = %v, %v; want {0 7}, false", got, ok)
+	}
+
+	if got, ok := m.ToCurrent(pos(0, 14)); !ok || got != pos(0, 10) {
+		t.Errorf("ToCurrent after replaced text = %v, %v; want {0 10}, true", got, ok)
+	}
+
+	if got, ok := m.ToSnapshot(pos(0, 8)); ok || got != pos(0, 7) {
+		t.Errorf("ToSnapshot inside inserted text = %v, %v; want {0 7}, false", got, ok)
+	}
+}
+
+func TestPositionMap_RangeToCurrent(t *testing.T) {
+	// Insert a statement inside a function body spanning lines 2-6
+	m := (*PositionMap)(nil).WithEdit(rng(4, 2, 4, 2), "x := 1;\n  ")
+
+	got, ok := m.RangeToCurrent(rng(2, 0, 6, 4))
+	if !ok || got != rng(2, 0, 7, 4) {
+		t.Errorf("RangeToCurrent = %v, %v; want {2 0}-{7 4}, true", got, ok)
+	}
+
+	if _, ok := m.RangeToCurrentExact(rng(2, 0, 6, 4)); ok {
+		t.Error("RangeToCurrentExact should reject a range containing an edit")
+	}
+
+	got, ok = m.RangeToCurrentExact(rng(5, 2, 5, 5))
+	if !ok || got != rng(6, 2, 6, 5) {
+		t.Errorf("RangeToCurrentExact = %v, %v; want {6 2}-{6 5}, true", got, ok)
+	}
+}
+
+func TestPositionMap_InsertionAtRangeEnd(t *testing.T) {
+	// Typing directly after an identifier must not extend its range
+	m := (*PositionMap)(nil).WithEdit(rng(0, 7, 0, 7), "x")
+
+	got, ok := m.RangeToCurrentExact(rng(0, 4, 0, 7))
+	if !ok || got != rng(0, 4, 0, 7) {
+		t.Errorf("RangeToCurrentExact = %v, %v; want {0 4}-{0 7}, true", got, ok)
+	}
+
+	// Typing directly before it moves it
+	got, ok = m.RangeToCurrentExact(rng(0, 7, 0, 10))
+	if !ok || got != rng(0, 8, 0, 11) {
+		t.Errorf("RangeToCurrentExact = %v, %v; want {0 8}-{0 11}, true", got, ok)
+	}
+}
+
+func TestPositionMap_SequentialEdits(t *testing.T) {
+	m := (*PositionMap)(nil).
+		WithEdit(rng(0, 0, 0, 0), "// header\n").
+		WithEdit(rng(3, 0, 4, 0), "")
+
+	if m.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", m.Len())
+	}
+
+	// Line 5 of the snapshot is line 6 after the first edit and line 5 after the second
+	if got, ok := m.ToCurrent(pos(5, 1)); !ok || got != pos(5, 1) {
+		t.Errorf("ToCurrent = %v, %v; want {5 1}, true", got, ok)
+	}
+
+	// Line 2 of the snapshot became line 3, which was deleted
+	if _, ok := m.ToCurrent(pos(2, 1)); ok {
+		t.Error("ToCurrent should report positions in deleted lines as inexact")
+	}
+}
+
+func TestPositionMap_WithEditDoesNotModifyReceiver(t *testing.T) {
+	base := (*PositionMap)(nil).WithEdit(rng(0, 0, 0, 0), "a")
+	first := base.WithEdit(rng(1, 0, 1, 0), "b")
+	second := base.WithEdit(rng(2, 0, 2, 0), "\n")
+
+	if base.Len() != 1 || first.Len() != 2 || second.Len() != 2 {
+		t.Fatalf("Len = %d, %d, %d; want 1, 2, 2", base.Len(), first.Len(), second.Len())
+	}
+
+	if got, _ := first.ToCurrent(pos(3, 0)); got != pos(3, 0) {
+		t.Errorf("first.ToCurrent = %v, want {3 0}", got)
+	}
+}
+
+func TestPositionMap_WithTextChange(t *testing.T) {
+	oldText := "var x: Integer;\nvar y: String;\nPrintLn(y);"
+	newText := "var x: Integer;\nvar yy: String;\nvar z: Float;\nPrintLn(y);"
+
+	m := (*PositionMap)(nil).WithTextChange(oldText, newText)
+
+	// "PrintLn" moved down by one line
+	if got, ok := m.ToCurrent(pos(2, 0)); !ok || got != pos(3, 0) {
+		t.Errorf("ToCurrent = %v, %v; want {3 0}, true", got, ok)
+	}
+
+	// The first line is untouched
+	if got, ok := m.RangeToCurrentExact(rng(0, 4, 0, 5)); !ok || got != rng(0, 4, 0, 5) {
+		t.Errorf("RangeToCurrentExact = %v, %v; want {0 4}-{0 5}, true", got, ok)
+	}
+
+	if same := m.WithTextChange(newText, newText); same != m {
+		t.Error("WithTextChange with identical texts should return the receiver")
+	}
+}
+
+func TestPositionMap_WithTextChangeMultiByte(t *testing.T) {
+	// The common prefix must not split the two-byte "ä" and "ö"
+	m := (*PositionMap)(nil).WithTextChange("s := 'ä';\nx;", "s := 'ö';\nx;")
+
+	if got, ok := m.ToCurrent(pos(1, 0)); !ok || got != pos(1, 0) {
+		t.Errorf("ToCurrent = %v, %v; want {1 0}, true", got, ok)
+	}
+
+	if _, ok := m.ToCurrent(pos(0, 6)); !ok {
+		t.Error("ToCurrent at the start of the replaced character should be exact")
+	}
+}
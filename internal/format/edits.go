@@ -0,0 +1,115 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// DocumentEdits formats text and returns the edits that turn it into the
+// formatted text. The formatter never adds or removes lines, so there is at
+// most one edit per line, replacing only the part of the line that changed.
+func DocumentEdits(text string, options Options) ([]protocol.TextEdit, error) {
+	formatted, err := Format(text, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return lineEdits(text, formatted), nil
+}
+
+// RangeEdits returns the formatting edits of the lines touched by rng. The
+// whole document is formatted, since indentation depends on the enclosing
+// blocks, and the edits outside the range are dropped.
+func RangeEdits(text string, rng protocol.Range, options Options) ([]protocol.TextEdit, error) {
+	edits, err := DocumentEdits(text, options)
+	if err != nil {
+		return nil, err
+	}
+
+	last := rng.End.Line
+	// A range ending at the start of a line doesn't include that line
+	if rng.End.Character == 0 && last > rng.Start.Line {
+		last--
+	}
+
+	var inRange []protocol.TextEdit
+
+	for _, edit := range edits {
+		if edit.Range.Start.Line >= rng.Start.Line && edit.Range.Start.Line <= last {
+			inRange = append(inRange, edit)
+		}
+	}
+
+	return inRange, nil
+}
+
+// lineEdits returns the edits turning text into formatted, which must have the
+// same number of lines.
+func lineEdits(text, formatted string) []protocol.TextEdit {
+	before := strings.Split(text, "\n")
+	after := strings.Split(formatted, "\n")
+
+	var edits []protocol.TextEdit
+
+	for line := range min(len(before), len(after)) {
+		a, b := before[line], after[line]
+		if a == b {
+			continue
+		}
+
+		prefix := commonPrefixLength(a, b)
+		suffix := min(commonSuffixLength(a[prefix:], b[prefix:]), len(a)-prefix, len(b)-prefix)
+
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: utf16Length(a[:prefix])},
+				End:   protocol.Position{Line: uint32(line), Character: utf16Length(a[:len(a)-suffix])},
+			},
+			NewText: b[prefix : len(b)-suffix],
+		})
+	}
+
+	return edits
+}
+
+// utf16Length returns the length of s in UTF-16 code units.
+func utf16Length(s string) uint32 {
+	return uint32(len(utf16.Encode([]rune(s))))
+}
+
+// commonPrefixLength returns the length in bytes of the common prefix of a and b,
+// never splitting a UTF-8 sequence.
+func commonPrefixLength(a, b string) int {
+	n := min(len(a), len(b))
+
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+
+	return i
+}
+
+// commonSuffixLength returns the length in bytes of the common suffix of a and b,
+// never splitting a UTF-8 sequence.
+func commonSuffixLength(a, b string) int {
+	n := min(len(a), len(b))
+
+	i := 0
+	for i < n && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+
+	for i > 0 && !utf8.RuneStart(a[len(a)-i]) {
+		i--
+	}
+
+	return i
+}
@@ -0,0 +1,161 @@
+// Package format implements a pretty printer for DWScript source code.
+//
+// The printer keeps the line structure of the source. The indentation of
+// every line comes from the AST: each line is indented by the nesting depth of
+// the statement or declaration it starts (blocks, try, case, repeat, records
+// and classes, declaration sections and hanging statements after
+// then/do/else), and lines the tree doesn't start, such as wrapped expressions
+// and closing keywords, continue the line they belong to. The tokens of the
+// source supply the text: the printer normalizes the spacing between tokens
+// and the casing of reserved words, removes trailing whitespace, and preserves
+// comments, string literals and blank lines.
+//
+// Source with syntax errors isn't formatted, and neither is source using
+// constructs the go-dws parser doesn't support yet. The result is checked to
+// consist of the same tokens as the input, so formatting never changes the
+// meaning of a program. Indentation for on-type formatting, where the code
+// being typed usually doesn't parse, is derived from the tokens alone.
+package format
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+)
+
+// byteOrderMark is the UTF-8 byte order mark some editors put at the start of a file.
+const byteOrderMark = "\uFEFF"
+
+// ErrSyntax is returned when the source has syntax errors and isn't formatted.
+var ErrSyntax = errors.New("source has syntax errors")
+
+// errTokensChanged is returned if formatting would change the token stream,
+// which indicates a bug in the formatter.
+var errTokensChanged = errors.New("formatting would change the program")
+
+// KeywordCase selects how reserved words are written.
+type KeywordCase int
+
+const (
+	// KeywordCaseLower writes reserved words in lower case, e.g. begin
+	KeywordCaseLower KeywordCase = iota
+
+	// KeywordCaseUpper writes reserved words in upper case, e.g. BEGIN
+	KeywordCaseUpper
+
+	// KeywordCasePreserve leaves reserved words as written
+	KeywordCasePreserve
+)
+
+// Options configures the formatter.
+type Options struct {
+	// TabSize is the number of spaces per indentation level; 0 uses 2
+	TabSize int
+
+	// InsertSpaces indents with spaces rather than tabs
+	InsertSpaces bool
+
+	// KeywordCase selects how reserved words are written
+	KeywordCase KeywordCase
+}
+
+// indentUnit returns the text of one indentation level.
+func (o Options) indentUnit() string {
+	if !o.InsertSpaces {
+		return "\t"
+	}
+
+	if o.TabSize <= 0 {
+		return "  "
+	}
+
+	return strings.Repeat(" ", o.TabSize)
+}
+
+// reservedWords are the keywords whose casing is normalized. Directives such
+// as virtual or read, which may also be used as identifiers, are left alone.
+var reservedWords = map[string]bool{
+	"and": true, "array": true, "as": true, "asm": true, "begin": true, "case": true,
+	"class": true, "const": true, "constructor": true, "destructor": true, "div": true,
+	"do": true, "downto": true, "else": true, "end": true, "except": true,
+	"finalization": true, "finally": true, "for": true, "function": true, "if": true,
+	"implementation": true, "in": true, "inherited": true, "initialization": true,
+	"interface": true, "is": true, "lambda": true, "mod": true, "nil": true, "not": true,
+	"of": true, "or": true, "procedure": true, "program": true, "property": true,
+	"raise": true, "record": true, "repeat": true, "resourcestring": true, "set": true,
+	"shl": true, "shr": true, "then": true, "to": true, "try": true, "type": true,
+	"unit": true, "until": true, "uses": true, "var": true, "while": true, "xor": true,
+}
+
+// Format formats DWScript source code. It returns ErrSyntax if the source
+// doesn't parse, including source the parser doesn't support.
+func Format(text string, options Options) (string, error) {
+	// The parser skips a byte order mark, so node offsets start after it
+	if strings.HasPrefix(text, byteOrderMark) {
+		formatted, err := Format(text[len(byteOrderMark):], options)
+		if err != nil {
+			return "", err
+		}
+
+		return byteOrderMark + formatted, nil
+	}
+
+	engine, err := dwscript.New()
+	if err != nil {
+		return "", err
+	}
+
+	program, err := engine.Parse(text)
+	if err != nil {
+		return "", ErrSyntax
+	}
+
+	p := newPrinter(text, options)
+	formatted := p.print(newLayout(program, p.tokens).level(len(p.lines)))
+
+	if !sameTokens(lexer.Scan(text), lexer.Scan(formatted)) {
+		return "", errTokensChanged
+	}
+
+	return formatted, nil
+}
+
+// Indentation returns the indentation of the given 0-based line as the
+// formatter would write it, based on the lines before it. Unlike Format it
+// works on source with syntax errors, such as code being typed. It returns
+// false if the line is inside a multi-line comment or string or an asm
+// block, or past the end of the text.
+func Indentation(text string, line int, options Options) (string, bool) {
+	level, ok := newPrinter(text, options).indent(line)
+	if !ok {
+		return "", false
+	}
+
+	return strings.Repeat(options.indentUnit(), level), true
+}
+
+// sameTokens reports whether two token streams are equal, ignoring the casing
+// of identifiers and keywords, which DWScript doesn't distinguish.
+func sameTokens(a, b []lexer.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Kind != b[i].Kind {
+			return false
+		}
+
+		if a[i].Kind == lexer.Ident {
+			if !strings.EqualFold(a[i].Text, b[i].Text) {
+				return false
+			}
+		} else if a[i].Text != b[i].Text {
+			return false
+		}
+	}
+
+	return true
+}
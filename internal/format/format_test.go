@@ -0,0 +1,422 @@
+package format
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var spaces = Options{TabSize: 2, InsertSpaces: true}
+
+func TestFormat_Indentation(t *testing.T) {
+	input := `function Sum(a,b : Integer) : Integer;
+var
+i: Integer;
+begin
+Result:=0;
+for i:=a to b do begin
+if (i mod 2=0) AND (i>1) then
+Result:=Result+i
+else
+Result := Result-(-i);
+end;
+case a of
+1: PrintLn('one');
+2..3:
+begin
+PrintLn('two');
+end;
+else
+PrintLn('many');
+end;
+try
+Inc(i);
+except
+on E: Exception do
+PrintLn(E.Message);
+end;
+repeat
+Dec(i);
+until i<0;
+end;
+`
+
+	expected := `function Sum(a, b: Integer): Integer;
+var
+  i: Integer;
+begin
+  Result := 0;
+  for i := a to b do begin
+    if (i mod 2 = 0) and (i > 1) then
+      Result := Result + i
+    else
+      Result := Result - (-i);
+  end;
+  case a of
+    1: PrintLn('one');
+    2..3:
+      begin
+        PrintLn('two');
+      end;
+  else
+    PrintLn('many');
+  end;
+  try
+    Inc(i);
+  except
+    on E: Exception do
+      PrintLn(E.Message);
+  end;
+  repeat
+    Dec(i);
+  until i < 0;
+end;
+`
+
+	got, err := Format(input, spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if got != expected {
+		t.Errorf("Unexpected formatting:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestFormat_ClassDeclaration(t *testing.T) {
+	input := `type
+TPoint = class
+private
+    FX : Integer;
+public
+  constructor Create(x:Integer);
+  property X: Integer read FX;
+end;
+
+constructor TPoint.Create(x:Integer);
+begin
+FX:=x;
+end;
+`
+
+	expected := `type
+  TPoint = class
+  private
+    FX: Integer;
+  public
+    constructor Create(x: Integer);
+    property X: Integer read FX;
+  end;
+
+constructor TPoint.Create(x: Integer);
+begin
+  FX := x;
+end;
+`
+
+	got, err := Format(input, spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if got != expected {
+		t.Errorf("Unexpected formatting:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestFormat_PreservesCommentsAndStrings(t *testing.T) {
+	input := "begin\n" +
+		"   // keep   this\n" +
+		"x:='a  :=  b';   { and   this }\n" +
+		"   (* multi\n" +
+		"        line *)\n" +
+		"\n" +
+		"PrintLn(x);  \n" +
+		"end;"
+
+	expected := "begin\n" +
+		"  // keep   this\n" +
+		"  x := 'a  :=  b'; { and   this }\n" +
+		"  (* multi\n" +
+		"        line *)\n" +
+		"\n" +
+		"  PrintLn(x);\n" +
+		"end;"
+
+	got, err := Format(input, spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if got != expected {
+		t.Errorf("Unexpected formatting:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestFormat_Options(t *testing.T) {
+	input := "BEGIN\nif True THEN\nPrintLn(1);\nEnd;"
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{"tabs", Options{}, "begin\n\tif True then\n\t\tPrintLn(1);\nend;"},
+		{"four spaces", Options{TabSize: 4, InsertSpaces: true}, "begin\n    if True then\n        PrintLn(1);\nend;"},
+		{"upper case", Options{TabSize: 2, InsertSpaces: true, KeywordCase: KeywordCaseUpper}, "BEGIN\n  IF True THEN\n    PrintLn(1);\nEND;"},
+		{"preserve case", Options{TabSize: 2, InsertSpaces: true, KeywordCase: KeywordCasePreserve}, "BEGIN\n  if True THEN\n    PrintLn(1);\nEnd;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(input, tt.options)
+			if err != nil {
+				t.Fatalf("Format failed: %v", err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormat_CRLF(t *testing.T) {
+	got, err := Format("begin\r\nx:=1;\r\nend;\r\n", spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if expected := "begin\r\n  x := 1;\r\nend;\r\n"; got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestFormat_Idempotent(t *testing.T) {
+	input := `var p := TPoint.Create(1);
+PrintLn(Sum(1,
+10));
+if a and
+b then
+PrintLn(a);`
+
+	once, err := Format(input, spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	twice, err := Format(once, spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if once != twice {
+		t.Errorf("Formatting isn't idempotent:\n%s\nthen:\n%s", once, twice)
+	}
+}
+
+func TestFormat_SyntaxError(t *testing.T) {
+	_, err := Format("begin\nx := ;\n", spaces)
+	if !errors.Is(err, ErrSyntax) {
+		t.Errorf("Expected ErrSyntax, got %v", err)
+	}
+}
+
+func TestFormat_Lambda(t *testing.T) {
+	got, err := Format("var f:=lambda(x:Integer):Integer=>x*2;\nvar b:=a.Map(lambda(x)=>x+1);\n", spaces)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	if expected := "var f := lambda(x: Integer): Integer => x * 2;\nvar b := a.Map(lambda(x) => x + 1);\n"; got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestFormat_Layout(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "else if chain",
+			input:    "if a then\nx := 1\nelse if b then\nx := 2\nelse begin\nx := 3;\nend;\n",
+			expected: "if a then\n  x := 1\nelse if b then\n  x := 2\nelse begin\n  x := 3;\nend;\n",
+		},
+		{
+			name:     "end else if",
+			input:    "while a do begin\nif b then begin\nx := 1;\nend else if c then begin\nx := 2;\nend;\nend;\n",
+			expected: "while a do begin\n  if b then begin\n    x := 1;\n  end else if c then begin\n    x := 2;\n  end;\nend;\n",
+		},
+		{
+			name:     "contracts",
+			input:    "function Half(x: Integer): Integer;\nrequire\nx >= 0;\nbegin\nResult := x div 2;\nend;\nensure\nResult <= x;\n",
+			expected: "function Half(x: Integer): Integer;\nrequire\n  x >= 0;\nbegin\n  Result := x div 2;\nend;\nensure\n  Result <= x;\n",
+		},
+		{
+			name:     "const section",
+			input:    "const\ncOne = 1;\ncTwo = 2;\n// done\nPrintLn(cOne);\n",
+			expected: "const\n  cOne = 1;\n  cTwo = 2;\n// done\nPrintLn(cOne);\n",
+		},
+		{
+			name:     "helper",
+			input:    "type TIntHelper = helper for Integer\nfunction Twice: Integer;\nbegin\nResult := Self * 2;\nend;\nend;\n",
+			expected: "type TIntHelper = helper for Integer\n  function Twice: Integer;\n  begin\n    Result := Self * 2;\n  end;\nend;\n",
+		},
+		{
+			name:     "comment before visibility",
+			input:    "type\nTAnimal = class\nprivate\n// fields\npublic\nprocedure Speak;\nend;\n",
+			expected: "type\n  TAnimal = class\n  private\n    // fields\n  public\n    procedure Speak;\n  end;\n",
+		},
+		{
+			name:     "program",
+			input:    "program Test;\nvar\nv: Integer;\nbegin\nv := 1;\nend.\n",
+			expected: "program Test;\nvar\n  v: Integer;\nbegin\n  v := 1;\nend.\n",
+		},
+		{
+			name:     "continuation lines",
+			input:    "Result := (y mod 4 = 0)\nand ((y mod 100 <> 0)\nor (y mod 400 = 0));\n",
+			expected: "Result := (y mod 4 = 0)\n  and ((y mod 100 <> 0)\n    or (y mod 400 = 0));\n",
+		},
+		{
+			name:     "byte order mark",
+			input:    "\uFEFFbegin\nx := 1;\nend;\n",
+			expected: "\uFEFFbegin\n  x := 1;\nend;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.input, spaces)
+			if err != nil {
+				t.Fatalf("Format failed: %v", err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormat_UnsupportedSyntax(t *testing.T) {
+	// Anonymous methods don't parse yet, so source using them isn't formatted
+	tests := []string{
+		"var f: function(x: Integer): Integer;\nf := function(x: Integer): Integer\nbegin\n  Result := x * 2;\nend;\n",
+		"var p: procedure;\np := procedure\nbegin\n  PrintLn('x');\nend;\n",
+	}
+
+	for _, input := range tests {
+		if _, err := Format(input, spaces); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: expected ErrSyntax, got %v", input, err)
+		}
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x:=-1", "x := -1"},
+		{"p:=@Foo", "p := @Foo"},
+		{"p^.x:=a[i+1]", "p^.x := a[i + 1]"},
+		{"var l:TList<Integer>", "var l: TList<Integer>"},
+		{"if i<0 then", "if i < 0 then"},
+		{"x:array [0..9] of Integer", "x: array [0..9] of Integer"},
+		{"Foo ( a , b ) ;", "Foo(a, b);"},
+		{"s:='a'#13#10'b'", "s := 'a'#13#10'b'"},
+		{"x:=a  {c}  +b", "x := a {c} + b"},
+		{"x:=a{c}", "x := a{c}"},
+		{"x.Type:=1", "x.Type := 1"},
+	}
+
+	for _, tt := range tests {
+		if got := newPrinter(tt.input, spaces).printTokens(lexer.Scan(tt.input)); got != tt.expected {
+			t.Errorf("%q: got %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestDocumentEdits_Minimal(t *testing.T) {
+	input := "begin\nx:=1;\n  y := 2;\nend;"
+
+	edits, err := DocumentEdits(input, spaces)
+	if err != nil {
+		t.Fatalf("DocumentEdits failed: %v", err)
+	}
+
+	// Only the second line changes
+	if len(edits) != 1 {
+		t.Fatalf("Expected 1 edit, got %d: %+v", len(edits), edits)
+	}
+
+	edit := edits[0]
+	if edit.Range.Start.Line != 1 || edit.Range.End.Line != 1 {
+		t.Errorf("Expected an edit on line 1, got %+v", edit.Range)
+	}
+
+	// "x:=1;" becomes "  x := 1;": the edit replaces "x:=" up to the common "1;"
+	if edit.Range.Start.Character != 0 || edit.Range.End.Character != 3 || edit.NewText != "  x := " {
+		t.Errorf("Unexpected edit %+v", edit)
+	}
+}
+
+func TestRangeEdits(t *testing.T) {
+	input := "begin\nx:=1;\ny:=2;\nz:=3;\nend;"
+
+	rng := protocol.Range{
+		Start: protocol.Position{Line: 2, Character: 0},
+		End:   protocol.Position{Line: 3, Character: 0},
+	}
+
+	edits, err := RangeEdits(input, rng, spaces)
+	if err != nil {
+		t.Fatalf("RangeEdits failed: %v", err)
+	}
+
+	// A range ending at the start of line 3 only covers line 2
+	if len(edits) != 1 || edits[0].Range.Start.Line != 2 {
+		t.Fatalf("Expected one edit on line 2, got %+v", edits)
+	}
+}
+
+func TestLineEdits_UTF16(t *testing.T) {
+	edits := lineEdits("s:='😀';x:=1", "s:='😀';x := 1")
+	if len(edits) != 1 {
+		t.Fatalf("Expected 1 edit, got %d", len(edits))
+	}
+
+	// The emoji takes two UTF-16 code units
+	if edits[0].Range.Start.Character != 9 {
+		t.Errorf("Expected the edit to start at character 9, got %d", edits[0].Range.Start.Character)
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	// Incomplete code being typed still gets indented
+	text := "procedure Foo;\nbegin\n  if x then\n\n  end\n  { comment\nstill comment }\n"
+
+	tests := []struct {
+		line     int
+		expected string
+		ok       bool
+	}{
+		{1, "", true},
+		{2, "  ", true},
+		{3, "    ", true},
+		{4, "", true},
+		{6, "", false},
+		{20, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Indentation(text, tt.line, spaces)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("line %d: got %q, %v, expected %q, %v", tt.line, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,666 @@
+package format
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+	"github.com/cwbudde/go-dws/pkg/ast"
+)
+
+// layout computes the indentation of the lines of a program from its syntax
+// tree. Every statement, declaration, case branch, exception handler and
+// class member is indented by its depth in the tree. The keywords closing a
+// block, such as end, until, except and finally, line up with the line that
+// opened it; the tree doesn't record them, so they are matched on the tokens.
+type layout struct {
+	// tokens are the code tokens of the source, without comments and directives
+	tokens []lexer.Token
+
+	// levels maps 0-based lines to the indentation level of the node starting them
+	levels map[int]int
+
+	// openers maps the index of a token closing a block to the index of the
+	// token that opened it, and closers the other way round
+	openers map[int]int
+	closers map[int]int
+}
+
+// sectionKeywords open var, const and type sections.
+var sectionKeywords = map[string]bool{
+	"var": true, "const": true, "type": true, "resourcestring": true,
+}
+
+func newLayout(program *ast.Program, tokens []lexer.Token) *layout {
+	l := &layout{
+		tokens:  codeTokens(tokens),
+		levels:  make(map[int]int),
+		openers: make(map[int]int),
+		closers: make(map[int]int),
+	}
+
+	l.matchBlocks()
+
+	// The program header isn't part of the tree
+	if len(l.tokens) > 0 && l.tokens[0].Is("program") {
+		l.assign(0, 0)
+	}
+
+	l.declarations(program.Statements, 0)
+
+	// Lambdas are expressions, so the walk above doesn't enter their bodies.
+	// Inspect visits them outside in, after the lines around them are laid out.
+	ast.Inspect(program, func(node ast.Node) bool {
+		if lambda, ok := node.(*ast.LambdaExpression); ok && !lambda.IsShorthand && lambda.Body != nil {
+			l.lambda(lambda)
+		}
+
+		return node != nil
+	})
+
+	return l
+}
+
+// matchBlocks pairs the keywords opening and closing blocks.
+func (l *layout) matchBlocks() {
+	var open []int
+
+	for i, tok := range l.tokens {
+		keyword := tok.Keyword()
+		if i > 0 && (l.tokens[i-1].Is(".") || l.tokens[i-1].Is("?.")) {
+			keyword = ""
+		}
+
+		switch keyword {
+		case "begin", "try", "repeat", "asm", "record":
+			open = append(open, i)
+
+		case "case":
+			// The case of a variant record has no end of its own
+			if len(open) == 0 || !l.opensType(open[len(open)-1]) {
+				open = append(open, i)
+			}
+
+		case "class", "interface":
+			if opensTypeBody(l.tokens, i) {
+				open = append(open, i)
+			}
+
+		case "helper":
+			// The helper of class helper and record helper is already open
+			if i > 0 && l.tokens[i-1].Is("=") {
+				open = append(open, i)
+			}
+
+		case "except", "finally":
+			if len(open) > 0 {
+				l.openers[i] = open[len(open)-1]
+			}
+
+		case "end", "until":
+			// The end of a unit or program has no opener
+			if len(open) == 0 {
+				l.openers[i] = -1
+				continue
+			}
+
+			l.openers[i] = open[len(open)-1]
+			l.closers[open[len(open)-1]] = i
+			open = open[:len(open)-1]
+
+		case "implementation":
+			open = open[:0]
+
+		case "initialization", "finalization":
+			open = append(open[:0], i)
+		}
+	}
+}
+
+// opensType reports whether the block opened by the token at i is the body
+// of a record, class or interface.
+func (l *layout) opensType(i int) bool {
+	keyword := l.tokens[i].Keyword()
+	return keyword == "record" || keyword == "class" || keyword == "interface" || keyword == "helper"
+}
+
+// tokenAt returns the index of the first code token at or after the byte offset.
+func (l *layout) tokenAt(offset int) int {
+	return sort.Search(len(l.tokens), func(i int) bool {
+		return l.tokens[i].Offset >= offset
+	})
+}
+
+// first returns the index of the first token of node. Node positions don't
+// always point at the first token, e.g. an assignment is positioned at :=,
+// so the earliest position of the node and its children is used.
+func (l *layout) first(node ast.Node) int {
+	start := -1
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+
+		// Blocks without begin are positioned at whatever token preceded them
+		if block, ok := n.(*ast.BlockStatement); ok && !strings.EqualFold(block.Token.Literal, "begin") {
+			return true
+		}
+
+		if pos := n.Pos(); pos.IsValid() && (start < 0 || pos.Offset < start) {
+			start = pos.Offset
+		}
+
+		return true
+	})
+
+	// A helper is positioned at helper, and its name isn't walked
+	if helper, ok := node.(*ast.HelperDecl); ok && helper.Name != nil && helper.Name.Pos().Offset < start {
+		start = helper.Name.Pos().Offset
+	}
+
+	if start < 0 {
+		return len(l.tokens)
+	}
+
+	return l.tokenAt(start)
+}
+
+// assign sets the indentation level of the line starting with the token at i.
+// Lines are laid out by the outermost node starting them, so a line that
+// already has a level keeps it, and a token in the middle of a line is ignored.
+func (l *layout) assign(i int, level int) {
+	if i >= len(l.tokens) {
+		return
+	}
+
+	// Modifiers like the class of class function belong to the member
+	if i > 0 && l.tokens[i-1].Is("class") && l.tokens[i-1].Line == l.tokens[i].Line {
+		i--
+	}
+
+	// So do the parentheses around the start of an expression
+	for i > 0 && (l.tokens[i-1].Is("(") || l.tokens[i-1].Is("[")) && l.tokens[i-1].Line == l.tokens[i].Line {
+		i--
+	}
+
+	if !l.startsLine(i) {
+		return
+	}
+
+	if _, ok := l.levels[l.tokens[i].Line]; !ok {
+		l.levels[l.tokens[i].Line] = level
+	}
+}
+
+// lineLevel returns the level assigned to the line of the token at i. A line
+// starting with a closing keyword, like end else, has the level of its opener.
+func (l *layout) lineLevel(i int) (int, bool) {
+	for !l.startsLine(i) {
+		i--
+	}
+
+	if level, ok := l.levels[l.tokens[i].Line]; ok {
+		return level, true
+	}
+
+	if opener, ok := l.openers[i]; ok && opener >= 0 {
+		level, ok := l.levels[l.tokens[opener].Line]
+		return level, ok
+	}
+
+	return 0, false
+}
+
+// startsLine reports whether the token at i is the first code token of its line.
+func (l *layout) startsLine(i int) bool {
+	return i == 0 || l.tokens[i-1].EndLine < l.tokens[i].Line
+}
+
+// isDeclaration reports whether the statement can be part of a var, const or type section.
+func isDeclaration(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.VarDeclStatement, *ast.ConstDecl, *ast.TypeDeclaration, *ast.ClassDecl, *ast.RecordDecl,
+		*ast.InterfaceDecl, *ast.EnumDecl, *ast.HelperDecl, *ast.ArrayDecl, *ast.SetDecl:
+		return true
+	}
+
+	return false
+}
+
+// isConstant reports whether the statement is a constant the parser read as
+// a comparison, which it does for the constants after the first of a section.
+func isConstant(stmt ast.Statement) bool {
+	expr, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	binary, ok := expr.Expression.(*ast.BinaryExpression)
+	if !ok || binary.Operator != "=" {
+		return false
+	}
+
+	_, ok = binary.Left.(*ast.Identifier)
+
+	return ok
+}
+
+// declarations lays out statements that may include var, const and type
+// sections. The declarations of a section whose keyword is on a line of its
+// own are indented below the keyword.
+func (l *layout) declarations(stmts []ast.Statement, level int) {
+	section := false
+
+	for _, stmt := range stmts {
+		if section && isConstant(stmt) {
+			l.statement(stmt, level+1)
+
+			continue
+		}
+
+		if !isDeclaration(stmt) {
+			section = false
+
+			l.statement(stmt, level)
+
+			continue
+		}
+
+		first := l.start(stmt)
+
+		switch {
+		case first < len(l.tokens)-1 && sectionKeywords[l.tokens[first].Keyword()]:
+			section = l.tokens[first+1].Line > l.tokens[first].EndLine
+
+			if section {
+				l.assign(first, level)
+				l.assign(first+1, level+1)
+				l.statement(stmt, level+1)
+			} else {
+				l.statement(stmt, level)
+			}
+
+		case section:
+			l.statement(stmt, level+1)
+
+		default:
+			l.statement(stmt, level)
+		}
+	}
+}
+
+// start returns the index of the first token of a statement. The section
+// keyword is part of the first var declaration, but precedes a const or type
+// declaration.
+func (l *layout) start(stmt ast.Statement) int {
+	first := l.first(stmt)
+	if isDeclaration(stmt) && first > 0 && first < len(l.tokens) && sectionKeywords[l.tokens[first-1].Keyword()] {
+		return first - 1
+	}
+
+	return first
+}
+
+// statements lays out the statements of a block.
+func (l *layout) statements(stmts []ast.Statement, level int) {
+	for _, stmt := range stmts {
+		l.statement(stmt, level)
+	}
+}
+
+// statement lays out a statement or declaration starting at the given level.
+func (l *layout) statement(stmt ast.Statement, level int) {
+	if stmt == nil {
+		return
+	}
+
+	first := l.start(stmt)
+	l.assign(first, level)
+
+	// A statement in the middle of a line, like the if of else if, is laid
+	// out relative to the line
+	if first < len(l.tokens) && !l.startsLine(first) {
+		if lineLevel, ok := l.lineLevel(first); ok {
+			level = lineLevel
+		}
+	}
+
+	switch s := stmt.(type) {
+	case *ast.BlockStatement:
+		l.assign(l.tokenAt(s.Token.Pos.Offset), level)
+		l.statements(s.Statements, level+1)
+
+	case *ast.IfStatement:
+		l.body(s.Consequence, level)
+
+		if s.Alternative != nil {
+			l.keywordBefore(s.Alternative, "else", level)
+			l.body(s.Alternative, level)
+		}
+
+	case *ast.WhileStatement:
+		l.body(s.Body, level)
+
+	case *ast.ForStatement:
+		l.body(s.Body, level)
+
+	case *ast.ForInStatement:
+		l.body(s.Body, level)
+
+	case *ast.RepeatStatement:
+		l.inner(s.Body, level+1)
+
+	case *ast.CaseStatement:
+		for _, branch := range s.Cases {
+			for _, value := range branch.Values {
+				l.assign(l.first(value), level+1)
+			}
+
+			l.statement(branch.Statement, level+2)
+		}
+
+		if s.Else != nil {
+			l.keywordBefore(s.Else, "else", level)
+			l.inner(s.Else, level+1)
+		}
+
+	case *ast.TryStatement:
+		l.tryStatement(s, level)
+
+	case *ast.FunctionDecl:
+		l.function(s, level)
+
+	case *ast.ClassDecl:
+		l.typeBody(s, level)
+		members(l, level+1, s.Fields...)
+		members(l, level+1, s.Operators...)
+		members(l, level+1, s.Properties...)
+		l.methods(level+1, s.Methods...)
+
+		for _, method := range []*ast.FunctionDecl{s.Constructor, s.Destructor} {
+			if method != nil {
+				l.statement(method, level+1)
+			}
+		}
+
+	case *ast.RecordDecl:
+		l.typeBody(s, level)
+		members(l, level+1, s.Fields...)
+		l.methods(level+1, s.Methods...)
+
+		for _, property := range s.Properties {
+			l.assign(l.tokenAt(property.Token.Pos.Offset), level+1)
+		}
+
+	case *ast.InterfaceDecl:
+		for _, method := range s.Methods {
+			l.assign(l.tokenAt(method.Token.Pos.Offset), level+1)
+		}
+
+	case *ast.HelperDecl:
+		l.typeBody(s, level)
+		l.methods(level+1, s.Methods...)
+		members(l, level+1, s.Properties...)
+		members(l, level+1, s.ClassVars...)
+		members(l, level+1, s.ClassConsts...)
+
+	case *ast.UnitDeclaration:
+		for _, section := range []*ast.BlockStatement{s.InterfaceSection, s.ImplementationSection} {
+			if section != nil {
+				l.assign(l.tokenAt(section.Token.Pos.Offset), level)
+				l.declarations(section.Statements, level)
+			}
+		}
+
+		for _, section := range []*ast.BlockStatement{s.InitSection, s.FinalSection} {
+			if section != nil {
+				l.assign(l.tokenAt(section.Token.Pos.Offset), level)
+				l.statements(section.Statements, level+1)
+			}
+		}
+	}
+}
+
+// body lays out the statement after then, do or else on a line at the given
+// level. A begin on a line of its own lines up with that line.
+func (l *layout) body(stmt ast.Statement, level int) {
+	if block, ok := stmt.(*ast.BlockStatement); ok {
+		l.statement(block, level)
+		return
+	}
+
+	l.statement(stmt, level+1)
+}
+
+// inner lays out the statements of a block without begin, like the body of
+// repeat or the else part of case.
+func (l *layout) inner(stmt ast.Statement, level int) {
+	if block, ok := stmt.(*ast.BlockStatement); ok && !strings.EqualFold(block.Token.Literal, "begin") {
+		l.statements(block.Statements, level)
+		return
+	}
+
+	l.statement(stmt, level)
+}
+
+// keywordBefore lays out the keyword that precedes stmt, such as else.
+func (l *layout) keywordBefore(stmt ast.Statement, keyword string, level int) {
+	if i := l.first(stmt) - 1; i >= 0 && i < len(l.tokens) && l.tokens[i].Is(keyword) {
+		l.assign(i, level)
+	}
+}
+
+// tryStatement lays out a try statement. Except and finally line up with try
+// through the matched keywords, the handlers are indented below except.
+func (l *layout) tryStatement(s *ast.TryStatement, level int) {
+	if s.TryBlock != nil {
+		l.statements(s.TryBlock.Statements, level+1)
+	}
+
+	if clause := s.ExceptClause; clause != nil {
+		for _, handler := range clause.Handlers {
+			// The statements of a bare except end up in a handler without variable and type
+			if handler.Variable == nil && handler.ExceptionType == nil {
+				l.inner(handler.Statement, level+1)
+				continue
+			}
+
+			l.assign(l.tokenAt(handler.Token.Pos.Offset), level+1)
+			l.body(handler.Statement, level+1)
+		}
+
+		if clause.ElseBlock != nil && len(clause.ElseBlock.Statements) > 0 {
+			l.keywordBefore(clause.ElseBlock.Statements[0], "else", level+1)
+			l.statements(clause.ElseBlock.Statements, level+2)
+		}
+	}
+
+	if s.FinallyClause != nil && s.FinallyClause.Block != nil {
+		l.statements(s.FinallyClause.Block.Statements, level+1)
+	}
+}
+
+// function lays out a function or method. The declarations of its body come
+// before begin and line up with the function; its statements are indented.
+func (l *layout) function(s *ast.FunctionDecl, level int) {
+	if s.PreConditions != nil {
+		l.contract(s.PreConditions.Token.Pos.Offset, s.PreConditions.Conditions, level)
+	}
+
+	if s.PostConditions != nil {
+		l.contract(s.PostConditions.Token.Pos.Offset, s.PostConditions.Conditions, level)
+	}
+
+	if s.Body == nil {
+		return
+	}
+
+	begin := l.tokenAt(s.Body.Token.Pos.Offset)
+	for begin < len(l.tokens) && !l.tokens[begin].Is("begin") {
+		begin++
+	}
+
+	split := len(s.Body.Statements)
+
+	for i, stmt := range s.Body.Statements {
+		if l.first(stmt) > begin {
+			split = i
+			break
+		}
+	}
+
+	l.declarations(s.Body.Statements[:split], level)
+	l.assign(begin, level)
+	l.statements(s.Body.Statements[split:], level+1)
+}
+
+// contract lays out the require or ensure keyword at offset, which lines up
+// with the function, and its conditions.
+func (l *layout) contract(offset int, conditions []*ast.Condition, level int) {
+	l.assign(l.tokenAt(offset), level)
+	members(l, level+1, conditions...)
+}
+
+// typeBody lays out the visibility sections of a class, record or helper,
+// which line up with the declaration.
+func (l *layout) typeBody(decl ast.Node, level int) {
+	// The body opens at the first keyword with a matching end, before any ;
+	open := l.first(decl)
+	for open < len(l.tokens) && !l.tokens[open].Is(";") {
+		if _, ok := l.closers[open]; ok {
+			break
+		}
+
+		open++
+	}
+
+	end, ok := l.closers[open]
+	if !ok {
+		return
+	}
+
+	for i := open + 1; i < end; i++ {
+		if visibilityWords[l.tokens[i].Keyword()] {
+			l.assign(i, level)
+		}
+	}
+}
+
+// members lays out the members of a class, record or helper.
+func members[T ast.Node](l *layout, level int, nodes ...T) {
+	for _, node := range nodes {
+		l.assign(l.first(node), level)
+	}
+}
+
+// methods lays out the methods declared in a class, record or helper, which
+// may include their bodies.
+func (l *layout) methods(level int, methods ...*ast.FunctionDecl) {
+	for _, method := range methods {
+		l.statement(method, level)
+	}
+}
+
+// lambda lays out the body of a lambda. A begin on a line of its own lines up
+// with the statement the lambda is part of.
+func (l *layout) lambda(lambda *ast.LambdaExpression) {
+	i := l.tokenAt(lambda.Token.Pos.Offset)
+	if i == len(l.tokens) {
+		return
+	}
+
+	level := 0
+
+	for line := l.tokens[i].Line; line >= 0; line-- {
+		if lineLevel, ok := l.levels[line]; ok {
+			level = lineLevel
+			break
+		}
+	}
+
+	l.statement(lambda.Body, level)
+}
+
+// level returns the indentation level of every line of the source. Lines the
+// tree doesn't lay out continue the line before them: closing keywords line up
+// with the line that opened their block, lines inside parentheses are indented
+// below the line with the parenthesis, and other continuation lines below the
+// last line laid out. Lines without code are indented like the code after them.
+func (l *layout) level(lines int) []int {
+	levels := make([]int, lines)
+	code := make([]bool, lines)
+
+	var parens []int
+
+	anchor := 0
+
+	for i := 0; i < len(l.tokens); {
+		tok := l.tokens[i]
+
+		level, ok := l.levels[tok.Line]
+		if opener, closes := l.openers[i]; closes {
+			level, ok = 0, true
+			if opener >= 0 {
+				level = levels[l.tokens[opener].Line]
+			}
+		}
+
+		switch {
+		case ok:
+			anchor = level
+		case len(parens) > 0 && (tok.Is(")") || tok.Is("]")):
+			level = parens[len(parens)-1]
+		case len(parens) > 0:
+			level = parens[len(parens)-1] + 1
+		default:
+			level = anchor + 1
+		}
+
+		levels[tok.Line] = level
+		code[tok.Line] = true
+
+		for ; i < len(l.tokens) && l.tokens[i].Line == tok.Line; i++ {
+			switch {
+			case l.tokens[i].Is("(") || l.tokens[i].Is("["):
+				parens = append(parens, level)
+			case (l.tokens[i].Is(")") || l.tokens[i].Is("]")) && len(parens) > 0:
+				parens = parens[:len(parens)-1]
+			}
+		}
+	}
+
+	// Comments before a closing keyword belong to the block it closes
+	next := 0
+
+	for line := lines - 1; line >= 0; line-- {
+		if code[line] {
+			next = levels[line]
+
+			if l.closesBlock(line) {
+				next++
+			}
+
+			continue
+		}
+
+		levels[line] = next
+	}
+
+	return levels
+}
+
+// closesBlock reports whether the line starts with a keyword that ends a
+// block or one of its parts, including the visibility sections of a class.
+func (l *layout) closesBlock(line int) bool {
+	i := sort.Search(len(l.tokens), func(i int) bool { return l.tokens[i].Line >= line })
+	if i == len(l.tokens) {
+		return false
+	}
+
+	_, closes := l.openers[i]
+
+	keyword := l.tokens[i].Keyword()
+
+	return closes || keyword == "else" || visibilityWords[keyword]
+}
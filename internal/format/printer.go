@@ -0,0 +1,588 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+)
+
+// blockKind identifies the constructs that indent their contents.
+type blockKind int
+
+const (
+	blockBegin   blockKind = iota // begin ... end, initialization ... end.
+	blockAsm                      // asm ... end; the contents are left as written
+	blockTry                      // try ... except/finally ... end
+	blockCase                     // case ... of ... end
+	blockRepeat                   // repeat ... until
+	blockType                     // record, class and interface declarations ... end
+	blockSection                  // var, const and type sections, closed implicitly
+)
+
+// block is an open construct. indent is the indentation level of the line
+// that opened it; its contents are indented one level deeper.
+type block struct {
+	kind   blockKind
+	indent int
+
+	// parens is the number of open parentheses when the block was opened
+	parens int
+
+	// The statement state of the enclosing block, restored when the block closes
+	pending    int
+	stmtIndent int
+	continuing bool
+}
+
+// hangingWords end a line whose continuation is indented one level deeper,
+// such as the statement after then or do.
+var hangingWords = map[string]bool{
+	"then": true, "do": true, "else": true,
+}
+
+// continuationWords end a line that is continued by the next one, like a
+// binary operator in the middle of an expression or uses before a unit list.
+var continuationWords = map[string]bool{
+	"and": true, "or": true, "xor": true, "not": true, "div": true, "mod": true,
+	"shl": true, "shr": true, "in": true, "is": true, "as": true, "uses": true,
+}
+
+// continuationSymbols are the symbols that continue an expression on the next line.
+var continuationSymbols = map[string]bool{
+	":=": true, "=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"+": true, "-": true, "*": true, "/": true, ",": true, "+=": true, "-=": true,
+	"*=": true, "/=": true, "==": true, "!=": true, "&&": true, "||": true, "??": true,
+	"=>": true, "**": true,
+}
+
+// sectionTerminators start a line that ends a var, const or type section.
+var sectionTerminators = map[string]bool{
+	"begin": true, "end": true, "function": true, "procedure": true, "constructor": true,
+	"destructor": true, "method": true, "operator": true, "property": true,
+	"var": true, "const": true, "type": true, "resourcestring": true,
+	"private": true, "protected": true, "public": true, "published": true, "strict": true,
+	"implementation": true, "initialization": true, "finalization": true,
+}
+
+// visibilityWords start the visibility sections of classes and records.
+var visibilityWords = map[string]bool{
+	"private": true, "protected": true, "public": true, "published": true, "strict": true,
+}
+
+// printer formats a token stream line by line.
+type printer struct {
+	options Options
+	lines   []string
+	tokens  []lexer.Token
+
+	blocks []block
+	parens []int
+
+	// pending is the number of levels, relative to the enclosing block, by
+	// which the next line hangs, e.g. the statement after then
+	pending int
+
+	// stmtIndent is the indentation of the line that started the current statement
+	stmtIndent int
+
+	// continuing is set when the previous line ended in the middle of an expression
+	continuing bool
+
+	// label is set when the next line follows a case label
+	label bool
+}
+
+func newPrinter(text string, options Options) *printer {
+	return &printer{
+		options: options,
+		lines:   strings.Split(text, "\n"),
+		tokens:  lexer.Scan(text),
+	}
+}
+
+// print returns the text with every line indented by its level, which is
+// indexed by 0-based line.
+func (p *printer) print(levels []int) string {
+	out := make([]string, 0, len(p.lines))
+
+	p.groups(func(first, last int, tokens []lexer.Token) bool {
+		out = append(out, p.printGroup(first, last, tokens, levels[first])...)
+		return true
+	})
+
+	return strings.Join(out, "\n")
+}
+
+// indent returns the indentation level of the given line, formatting the
+// lines before it. It returns false if the line is inside a multi-line
+// comment or string, or inside an asm block, whose indentation is kept.
+func (p *printer) indent(line int) (int, bool) {
+	indent, ok := 0, false
+
+	p.groups(func(first, last int, tokens []lexer.Token) bool {
+		switch {
+		case first == line:
+			if p.inAsm() && (len(tokens) == 0 || !tokens[0].Is("end")) {
+				return false
+			}
+
+			indent, ok = p.lineIndent(tokens), true
+
+			return false
+
+		case last >= line:
+			return false
+		}
+
+		if len(tokens) > 0 && (!p.inAsm() || tokens[0].Is("end")) {
+			p.update(tokens, p.lineIndent(tokens))
+		}
+
+		return true
+	})
+
+	return indent, ok
+}
+
+// groups passes the lines of the text to visit in groups, until visit returns
+// false. A group is a line plus the lines covered by multi-line tokens
+// starting on it; tokens are the tokens of the group.
+func (p *printer) groups(visit func(first, last int, tokens []lexer.Token) bool) {
+	next := 0
+
+	for line := 0; line < len(p.lines); {
+		first := next
+		last := line
+
+		for next < len(p.tokens) && p.tokens[next].Line <= last {
+			last = max(last, p.tokens[next].EndLine)
+			next++
+		}
+
+		if !visit(line, last, p.tokens[first:next]) {
+			return
+		}
+
+		line = last + 1
+	}
+}
+
+// printGroup formats the lines from first to last, whose tokens are tokens,
+// indenting the first by indent levels. The other lines are inside multi-line
+// comments or strings and are kept as written.
+func (p *printer) printGroup(first, last int, tokens []lexer.Token, indent int) []string {
+	out := make([]string, 0, last-first+1)
+
+	text := ""
+	if len(tokens) > 0 {
+		text = strings.Repeat(p.options.indentUnit(), indent) + p.printTokens(tokens)
+	}
+
+	if strings.HasSuffix(p.lines[first], "\r") {
+		text += "\r"
+	}
+
+	out = append(out, text)
+	out = append(out, p.lines[first+1:last+1]...)
+
+	return out
+}
+
+// printTokens joins the tokens of a line with normalized spacing. Only the
+// first line of a multi-line token is included.
+func (p *printer) printTokens(tokens []lexer.Token) string {
+	var sb strings.Builder
+
+	spaces := newSpacing(tokens)
+
+	for i, tok := range tokens {
+		if i > 0 && spaces.spaceBefore(i) {
+			sb.WriteByte(' ')
+		}
+
+		text := tok.Text
+		if before, _, found := strings.Cut(text, "\n"); found {
+			sb.WriteString(strings.TrimSuffix(before, "\r"))
+			break
+		}
+
+		sb.WriteString(p.keywordCase(tokens, i, text))
+	}
+
+	return sb.String()
+}
+
+// keywordCase applies the configured casing to reserved words.
+func (p *printer) keywordCase(tokens []lexer.Token, i int, text string) string {
+	tok := tokens[i]
+	if tok.Kind != lexer.Ident || !reservedWords[strings.ToLower(text)] || p.afterDot(tokens, i) {
+		return text
+	}
+
+	switch p.options.KeywordCase {
+	case KeywordCaseLower:
+		return strings.ToLower(text)
+	case KeywordCaseUpper:
+		return strings.ToUpper(text)
+	default:
+		return text
+	}
+}
+
+// afterDot reports whether the token is a member name, such as the Type in x.Type.
+func (p *printer) afterDot(tokens []lexer.Token, i int) bool {
+	return i > 0 && (tokens[i-1].Is(".") || tokens[i-1].Is("?."))
+}
+
+// base returns the indentation of the contents of the innermost block.
+func (p *printer) base() int {
+	if len(p.blocks) == 0 {
+		return 0
+	}
+
+	return p.blocks[len(p.blocks)-1].indent + 1
+}
+
+// top returns the innermost block, or nil if there is none.
+func (p *printer) top() *block {
+	if len(p.blocks) == 0 {
+		return nil
+	}
+
+	return &p.blocks[len(p.blocks)-1]
+}
+
+// inAsm reports whether the line is inside an asm block.
+func (p *printer) inAsm() bool {
+	top := p.top()
+	return top != nil && top.kind == blockAsm
+}
+
+// inType reports whether the innermost block, ignoring sections, is a record,
+// class or interface declaration.
+func (p *printer) inType() bool {
+	for i := len(p.blocks) - 1; i >= 0; i-- {
+		if p.blocks[i].kind != blockSection {
+			return p.blocks[i].kind == blockType
+		}
+	}
+
+	return false
+}
+
+// inParens reports whether the line continues inside parentheses or brackets
+// opened outside the innermost block.
+func (p *printer) inParens() bool {
+	if len(p.parens) == 0 {
+		return false
+	}
+
+	top := p.top()
+
+	return top == nil || top.parens < len(p.parens)
+}
+
+// push opens a block at the given indentation.
+func (p *printer) push(kind blockKind, indent int) {
+	p.blocks = append(p.blocks, block{
+		kind:       kind,
+		indent:     indent,
+		parens:     len(p.parens),
+		pending:    p.pending,
+		stmtIndent: p.stmtIndent,
+		continuing: p.continuing,
+	})
+
+	p.pending = 0
+	p.stmtIndent = indent + 1
+	p.continuing = false
+}
+
+// pop closes the innermost block and restores the statement state around it.
+func (p *printer) pop() {
+	top := p.top()
+	if top == nil {
+		return
+	}
+
+	p.pending = top.pending
+	p.stmtIndent = top.stmtIndent
+	p.continuing = top.continuing
+	p.blocks = p.blocks[:len(p.blocks)-1]
+}
+
+// popSections closes the sections at the top of the block stack.
+func (p *printer) popSections() {
+	for top := p.top(); top != nil && top.kind == blockSection; top = p.top() {
+		p.pop()
+	}
+}
+
+// codeTokens returns the tokens of a line that aren't comments or directives.
+func codeTokens(tokens []lexer.Token) []lexer.Token {
+	code := make([]lexer.Token, 0, len(tokens))
+
+	for _, tok := range tokens {
+		if tok.IsCode() {
+			code = append(code, tok)
+		}
+	}
+
+	return code
+}
+
+// lineIndent returns the indentation level of a line and closes sections the
+// line ends.
+func (p *printer) lineIndent(tokens []lexer.Token) int {
+	code := codeTokens(tokens)
+
+	// Comments and directives are indented like the code around them
+	if len(code) == 0 {
+		if p.inParens() {
+			return p.parens[len(p.parens)-1] + 1
+		}
+
+		return p.base() + p.pending
+	}
+
+	first := code[0]
+
+	if p.inParens() {
+		if first.Is(")") || first.Is("]") {
+			return p.parens[len(p.parens)-1]
+		}
+
+		return p.parens[len(p.parens)-1] + 1
+	}
+
+	if top := p.top(); top != nil && top.kind == blockSection && !p.continuing && p.endsSection(code) {
+		p.popSections()
+	}
+
+	keyword := first.Keyword()
+
+	switch {
+	case keyword == "unit" || keyword == "program" || keyword == "library" || keyword == "implementation" ||
+		keyword == "initialization" || keyword == "finalization" ||
+		(keyword == "interface" && len(code) == 1):
+		// Unit sections start at the left margin
+		p.blocks = p.blocks[:0]
+		p.parens = p.parens[:0]
+		p.pending, p.stmtIndent, p.continuing = 0, 0, false
+
+		return 0
+
+	case keyword == "end" || keyword == "until":
+		p.popSections()
+
+		if top := p.top(); top != nil {
+			return top.indent
+		}
+
+		return 0
+
+	case keyword == "except" || keyword == "finally":
+		if top := p.top(); top != nil && top.kind == blockTry {
+			return top.indent
+		}
+
+	case keyword == "else":
+		if top := p.top(); top != nil && top.kind == blockCase && p.pending == 0 && !p.continuing {
+			return top.indent
+		}
+
+		return max(p.base(), p.base()+p.pending-1)
+
+	case keyword == "begin":
+		// A begin after then or do lines up with the statement, but one after a
+		// case label is indented below it
+		if p.label {
+			return p.base() + p.pending
+		}
+
+		return max(p.base(), p.base()+p.pending-1)
+
+	case visibilityWords[keyword] && p.inType():
+		p.popSections()
+		return p.top().indent
+	}
+
+	return p.base() + p.pending
+}
+
+// endsSection reports whether a line inside a var, const or type section ends
+// it: either it starts with a keyword that can't appear in the section, or it
+// isn't a declaration, like a statement following the section in a script.
+func (p *printer) endsSection(code []lexer.Token) bool {
+	first := code[0]
+
+	if keyword := first.Keyword(); sectionTerminators[keyword] {
+		return true
+	} else if keyword == "class" && len(code) > 1 {
+		return true
+	}
+
+	// Attributes precede declarations
+	if first.Is("[") {
+		return false
+	}
+
+	// A declaration starts with a list of names followed by : or =
+	for i := 0; i < len(code); i += 2 {
+		if code[i].Kind != lexer.Ident || reservedWords[strings.ToLower(code[i].Text)] {
+			return true
+		}
+
+		if i+1 == len(code) {
+			return true
+		}
+
+		switch next := code[i+1]; {
+		case next.Is(","):
+			continue
+		case next.Is(":") || next.Is("=") || next.Is("<"):
+			return false
+		default:
+			return true
+		}
+	}
+
+	return true
+}
+
+// update advances the block structure over the tokens of a line indented by indent.
+func (p *printer) update(tokens []lexer.Token, indent int) {
+	code := codeTokens(tokens)
+	if len(code) == 0 {
+		return
+	}
+
+	if !p.continuing {
+		p.stmtIndent = indent
+	}
+
+	for i, tok := range code {
+		keyword := tok.Keyword()
+		if i > 0 && (code[i-1].Is(".") || code[i-1].Is("?.")) {
+			keyword = ""
+		}
+
+		switch {
+		case tok.Is("(") || tok.Is("["):
+			p.parens = append(p.parens, indent)
+
+		case tok.Is(")") || tok.Is("]"):
+			if len(p.parens) > 0 {
+				p.parens = p.parens[:len(p.parens)-1]
+			}
+
+		case tok.Is(";"):
+			if !p.inParens() {
+				p.pending = 0
+				p.continuing = false
+			}
+
+		case keyword == "begin":
+			p.push(blockBegin, indent)
+
+		case keyword == "asm":
+			p.push(blockAsm, indent)
+
+		case keyword == "try":
+			p.push(blockTry, indent)
+
+		case keyword == "repeat":
+			p.push(blockRepeat, indent)
+
+		case keyword == "case":
+			// The case of a variant record has no end of its own
+			if !p.inType() {
+				p.push(blockCase, indent)
+			}
+
+		case keyword == "record":
+			p.push(blockType, indent)
+
+		case keyword == "class" || keyword == "interface":
+			if opensTypeBody(code, i) {
+				p.push(blockType, indent)
+			}
+
+		case keyword == "end" || keyword == "until":
+			p.popSections()
+			p.pop()
+
+		case keyword == "initialization" || keyword == "finalization":
+			p.push(blockBegin, indent)
+
+		case (keyword == "var" || keyword == "const" || keyword == "type" || keyword == "resourcestring") &&
+			i == 0 && len(code) == 1:
+			p.push(blockSection, indent)
+		}
+	}
+
+	if p.inParens() {
+		return
+	}
+
+	last := code[len(code)-1]
+	lastKeyword := last.Keyword()
+	p.label = false
+
+	switch {
+	case hangingWords[lastKeyword] || (last.Is(":") && p.top() != nil && p.top().kind == blockCase):
+		// The next line starts a new clause, indented below this one
+		p.pending = p.stmtIndent - p.base() + 1
+		p.continuing = false
+
+		if lastKeyword == "else" || last.Is(":") {
+			p.pending = indent - p.base() + 1
+			p.label = last.Is(":")
+		}
+
+	case continuationWords[lastKeyword] || (last.Kind == lexer.Symbol && continuationSymbols[last.Text]):
+		p.pending = p.stmtIndent - p.base() + 1
+		p.continuing = true
+
+	default:
+		p.continuing = false
+	}
+}
+
+// opensTypeBody reports whether the class or interface keyword at code[i]
+// starts a declaration with a body, rather than a forward declaration such as
+// TFoo = class; or a class reference type or method modifier.
+func opensTypeBody(code []lexer.Token, i int) bool {
+	if i == 0 {
+		return false
+	}
+
+	prev := code[i-1]
+	if !prev.Is("=") && !prev.Is("partial") && !prev.Is("sealed") && !prev.Is("static") && !prev.Is("abstract") {
+		return false
+	}
+
+	// Skip the ancestor list
+	j := i + 1
+	if j < len(code) && code[j].Is("(") {
+		depth := 0
+
+		for ; j < len(code); j++ {
+			if code[j].Is("(") {
+				depth++
+			} else if code[j].Is(")") {
+				depth--
+				if depth == 0 {
+					j++
+					break
+				}
+			}
+		}
+	}
+
+	if j < len(code) && (code[j].Is(";") || code[j].Is("of")) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,171 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/lexer"
+)
+
+// binaryOperators are the symbols written with a space on both sides when
+// used as binary operators.
+var binaryOperators = map[string]bool{
+	":=": true, "=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"+": true, "-": true, "*": true, "/": true, "+=": true, "-=": true, "*=": true,
+	"/=": true, "%=": true, "^=": true, "@=": true, "~=": true, "==": true, "===": true,
+	"!=": true, "&&": true, "||": true, "??": true, "=>": true, "**": true, "<<": true,
+	">>": true, "%": true,
+}
+
+// prefixOperators are the symbols that may be unary prefix operators, which
+// are written without a space before their operand.
+var prefixOperators = map[string]bool{
+	"-": true, "+": true, "@": true, "^": true,
+}
+
+// calledWords are reserved words that may be directly followed by a
+// parenthesis or bracket, like array[0..1] or function(x: Integer).
+var calledWords = map[string]bool{
+	"array": true, "class": true, "function": true, "procedure": true, "lambda": true, "inherited": true,
+}
+
+// spacing decides the whitespace between the tokens of a line.
+type spacing struct {
+	tokens []lexer.Token
+
+	// generic marks the angle brackets of generic types, like TList<Integer>
+	generic []bool
+}
+
+func newSpacing(tokens []lexer.Token) *spacing {
+	s := &spacing{tokens: tokens, generic: make([]bool, len(tokens))}
+
+	// A < written without spaces between two names opens a generic parameter
+	// list if a > written without a space before it closes it
+	var open []int
+
+	for i, tok := range tokens {
+		switch {
+		case tok.Is("<") && i > 0 && tokens[i-1].Kind == lexer.Ident && !tok.SpaceBefore &&
+			i+1 < len(tokens) && tokens[i+1].Kind == lexer.Ident && !tokens[i+1].SpaceBefore:
+			open = append(open, i)
+
+		case (tok.Is(">") || tok.Is(">>")) && len(open) >= len(tok.Text) && !tok.SpaceBefore:
+			for range tok.Text {
+				s.generic[open[len(open)-1]] = true
+				open = open[:len(open)-1]
+			}
+
+			s.generic[i] = true
+		}
+	}
+
+	return s
+}
+
+// operand reports whether the token at i ends an operand, so that a following
+// operator is binary and a following parenthesis is a call or index.
+func (s *spacing) operand(i int) bool {
+	if i < 0 {
+		return false
+	}
+
+	tok := s.tokens[i]
+
+	switch tok.Kind {
+	case lexer.Comment, lexer.Directive:
+		return s.operand(i - 1)
+
+	case lexer.Number, lexer.String:
+		return true
+
+	case lexer.Ident:
+		lower := strings.ToLower(tok.Text)
+		return !reservedWords[lower] || lower == "nil" || (i > 0 && (s.tokens[i-1].Is(".") || s.tokens[i-1].Is("?.")))
+
+	case lexer.Symbol:
+		switch {
+		case tok.Is(")") || tok.Is("]"):
+			return true
+		case tok.Is("^"):
+			// A postfix dereference, as in p^
+			return s.operand(i - 1)
+		case tok.Is(">") || tok.Is(">>"):
+			return s.generic[i]
+		}
+	}
+
+	return false
+}
+
+// unary reports whether the symbol at i is a prefix operator.
+func (s *spacing) unary(i int) bool {
+	return s.tokens[i].Kind == lexer.Symbol && prefixOperators[s.tokens[i].Text] && !s.operand(i-1)
+}
+
+// spaceBefore reports whether a space separates the token at i from the one before it.
+func (s *spacing) spaceBefore(i int) bool {
+	prev, cur := s.tokens[i-1], s.tokens[i]
+
+	space := s.wantSpace(i)
+
+	// Joining the tokens must not create a different token, like : and = making :=
+	if !space && len(lexer.Scan(lastLine(prev.Text)+cur.Text)) != 2 {
+		space = true
+	}
+
+	return space
+}
+
+// lastLine returns the last line of text.
+func lastLine(text string) string {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return text[i+1:]
+	}
+
+	return text
+}
+
+// wantSpace applies the spacing rules to the tokens at i-1 and i.
+func (s *spacing) wantSpace(i int) bool {
+	prev, cur := s.tokens[i-1], s.tokens[i]
+
+	// Comments and directives stay attached or detached as written
+	if !prev.IsCode() || !cur.IsCode() {
+		return cur.SpaceBefore
+	}
+
+	switch {
+	case s.generic[i-1] && prev.Is("<"), s.generic[i]:
+		return false
+
+	case cur.Is(")"), cur.Is("]"), cur.Is(","), cur.Is(";"), cur.Is(":"), cur.Is("."), cur.Is(".."), cur.Is("?."):
+		return false
+
+	case prev.Is("("), prev.Is("["), prev.Is("."), prev.Is(".."), prev.Is("?."):
+		return false
+
+	case cur.Is("(") || cur.Is("["):
+		if prev.Kind == lexer.Ident && calledWords[strings.ToLower(prev.Text)] {
+			return cur.SpaceBefore
+		}
+
+		return !s.operand(i - 1)
+
+	case cur.Is("^") && s.operand(i-1):
+		// Postfix dereference
+		return false
+
+	case s.unary(i - 1):
+		return false
+
+	case prev.Kind == lexer.Symbol && !binaryOperators[prev.Text] && !prev.Is(",") && !prev.Is(";") &&
+		!prev.Is(":") && !prev.Is(")") && !prev.Is("]") && !prev.Is("^") && !prev.Is(">"):
+		// Symbols without a rule, like &, keep their spacing
+		return cur.SpaceBefore
+
+	case cur.Kind == lexer.Symbol && !binaryOperators[cur.Text] && !prefixOperators[cur.Text] && !cur.Is("("):
+		return cur.SpaceBefore
+	}
+
+	return true
+}
@@ -0,0 +1,290 @@
+// Package lexer splits DWScript source code into tokens.
+//
+// Unlike the go-dws lexer it keeps comments and directives, never fails on
+// malformed input and only distinguishes the token classes needed by features
+// that work on source text, such as formatting, folding and keyword matching.
+package lexer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cwbudde/go-dws/pkg/token"
+)
+
+// Kind classifies tokens.
+type Kind int
+
+const (
+	Ident     Kind = iota // identifiers and keywords
+	Number                // numeric literals
+	String                // string and character literals, including adjacent sequences
+	Comment               // line and block comments
+	Directive             // compiler directives such as {$IFDEF DEBUG}
+	Symbol                // operators and delimiters
+)
+
+// Token is a token of the source text.
+type Token struct {
+	Kind Kind
+	Text string
+
+	// Offset is the byte offset of the token in the text
+	Offset int
+
+	// Line is the 0-based line the token starts on and EndLine the one it ends on
+	Line    int
+	EndLine int
+
+	// SpaceBefore is set if whitespace precedes the token on the same line
+	SpaceBefore bool
+}
+
+// Keyword returns the lower-case keyword the token spells, or "" if it isn't one.
+func (t Token) Keyword() string {
+	if t.Kind != Ident {
+		return ""
+	}
+
+	lower := strings.ToLower(t.Text)
+	if !token.IsKeyword(lower) {
+		return ""
+	}
+
+	return lower
+}
+
+// Is reports whether the token is the keyword or symbol s, which must be lower case.
+func (t Token) Is(s string) bool {
+	switch t.Kind {
+	case Ident:
+		return strings.EqualFold(t.Text, s)
+	case Symbol:
+		return t.Text == s
+	default:
+		return false
+	}
+}
+
+// IsCode reports whether the token is code rather than a comment or directive.
+func (t Token) IsCode() bool {
+	return t.Kind != Comment && t.Kind != Directive
+}
+
+// symbols lists the multi-character operators, longest first.
+var symbols = []string{
+	"===", "**", ":=", "..", "<>", "<=", ">=", "==", "!=", "+=", "-=", "*=", "/=", "%=", "^=", "@=", "~=",
+	"++", "--", "<<", ">>", "||", "&&", "??", "?.", "=>",
+}
+
+// Scan splits text into tokens. It never fails: unterminated strings and
+// comments extend to the end of the text, and unknown characters become
+// single-character symbols.
+func Scan(text string) []Token {
+	var tokens []Token
+
+	line := 0
+	space := false
+
+	for i := 0; i < len(text); {
+		ch := text[i]
+
+		switch {
+		case ch == '\n':
+			line++
+			space = false
+			i++
+
+			continue
+
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\f' || ch == '\v':
+			space = true
+			i++
+
+			continue
+		}
+
+		start := i
+		kind := Symbol
+
+		switch {
+		case strings.HasPrefix(text[i:], "//"):
+			kind = Comment
+			i = indexFrom(text, i, "\n", false)
+
+		case strings.HasPrefix(text[i:], "{$"):
+			kind = Directive
+			i = indexFrom(text, i+2, "}", true)
+
+		case ch == '{':
+			kind = Comment
+			i = indexFrom(text, i+1, "}", true)
+
+		case strings.HasPrefix(text[i:], "(*"):
+			kind = Comment
+			i = indexFrom(text, i+2, "*)", true)
+
+		case strings.HasPrefix(text[i:], "/*"):
+			kind = Comment
+			i = indexFrom(text, i+2, "*/", true)
+
+		case ch == '\'' || ch == '"' || (ch == '#' && i+1 < len(text) && (isDigit(text[i+1]) || text[i+1] == '$')):
+			kind = String
+			i = scanStringSequence(text, i)
+
+		case isDigit(ch) || (ch == '$' && i+1 < len(text) && isHexDigit(text[i+1])) ||
+			(ch == '%' && i+1 < len(text) && (text[i+1] == '0' || text[i+1] == '1')):
+			kind = Number
+			i = scanNumber(text, i)
+
+		default:
+			if r, size := utf8.DecodeRuneInString(text[i:]); r == '_' || unicode.IsLetter(r) {
+				kind = Ident
+				i += size
+
+				for i < len(text) {
+					r, size := utf8.DecodeRuneInString(text[i:])
+					if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+						break
+					}
+
+					i += size
+				}
+			} else {
+				i += symbolLength(text[i:])
+			}
+		}
+
+		tok := Token{Kind: kind, Text: text[start:i], Offset: start, Line: line, SpaceBefore: space}
+		line += strings.Count(tok.Text, "\n")
+		tok.EndLine = line
+
+		tokens = append(tokens, tok)
+		space = false
+	}
+
+	return tokens
+}
+
+// indexFrom returns the offset after the first occurrence of end in text at or
+// after offset i, or len(text) if there is none. The end itself is included in
+// the token if inclusive is set.
+func indexFrom(text string, i int, end string, inclusive bool) int {
+	n := strings.Index(text[i:], end)
+	if n < 0 {
+		return len(text)
+	}
+
+	if inclusive {
+		return i + n + len(end)
+	}
+
+	return i + n
+}
+
+// scanStringSequence returns the offset after a sequence of adjacent string
+// and character literals starting at i, such as 'a'#13#10'b'.
+func scanStringSequence(text string, i int) int {
+	for i < len(text) {
+		switch ch := text[i]; {
+		case ch == '\'' || ch == '"':
+			i++
+
+			for i < len(text) {
+				if text[i] == ch {
+					// A doubled quote is an escaped quote
+					if i+1 < len(text) && text[i+1] == ch {
+						i += 2
+						continue
+					}
+
+					i++
+
+					break
+				}
+
+				i++
+			}
+
+		case ch == '#' && i+1 < len(text) && text[i+1] == '$':
+			i += 2
+			for i < len(text) && isHexDigit(text[i]) {
+				i++
+			}
+
+		case ch == '#' && i+1 < len(text) && isDigit(text[i+1]):
+			i++
+			for i < len(text) && isDigit(text[i]) {
+				i++
+			}
+
+		default:
+			return i
+		}
+	}
+
+	return i
+}
+
+// scanNumber returns the offset after the numeric literal starting at i.
+func scanNumber(text string, i int) int {
+	switch {
+	case text[i] == '$' || text[i] == '%':
+		i++
+	case text[i] == '0' && i+1 < len(text) && (text[i+1] == 'x' || text[i+1] == 'X'):
+		i += 2
+	default:
+		for i < len(text) && isDigit(text[i]) {
+			i++
+		}
+
+		// A dot starts the fraction only if a digit follows, so 1..10 is a range
+		if i+1 < len(text) && text[i] == '.' && isDigit(text[i+1]) {
+			i++
+			for i < len(text) && isDigit(text[i]) {
+				i++
+			}
+		}
+
+		if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+			i++
+			if i < len(text) && (text[i] == '+' || text[i] == '-') {
+				i++
+			}
+		}
+
+		for i < len(text) && isDigit(text[i]) {
+			i++
+		}
+
+		return i
+	}
+
+	for i < len(text) && isHexDigit(text[i]) {
+		i++
+	}
+
+	return i
+}
+
+// symbolLength returns the length of the operator or delimiter text starts with.
+func symbolLength(text string) int {
+	for _, symbol := range symbols {
+		if strings.HasPrefix(text, symbol) {
+			return len(symbol)
+		}
+	}
+
+	_, size := utf8.DecodeRuneInString(text)
+
+	return size
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
@@ -0,0 +1,60 @@
+package lexer
+
+import "testing"
+
+func TestScan(t *testing.T) {
+	text := "x:='it''s'#13#10; // done\n{$IFDEF A} (* a\nb *) y:=$FF+1.5e3..2"
+
+	expected := []struct {
+		kind Kind
+		text string
+		line int
+	}{
+		{Ident, "x", 0},
+		{Symbol, ":=", 0},
+		{String, "'it''s'#13#10", 0},
+		{Symbol, ";", 0},
+		{Comment, "// done", 0},
+		{Directive, "{$IFDEF A}", 1},
+		{Comment, "(* a\nb *)", 1},
+		{Ident, "y", 2},
+		{Symbol, ":=", 2},
+		{Number, "$FF", 2},
+		{Symbol, "+", 2},
+		{Number, "1.5e3", 2},
+		{Symbol, "..", 2},
+		{Number, "2", 2},
+	}
+
+	tokens := Scan(text)
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %+v", len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok.Kind != expected[i].kind || tok.Text != expected[i].text || tok.Line != expected[i].line {
+			t.Errorf("Token %d: got %+v, expected %+v", i, tok, expected[i])
+		}
+
+		if text[tok.Offset:tok.Offset+len(tok.Text)] != tok.Text {
+			t.Errorf("Token %d: offset %d doesn't point at %q", i, tok.Offset, tok.Text)
+		}
+	}
+
+	if tokens[6].EndLine != 2 {
+		t.Errorf("Expected the block comment to end on line 2, got %d", tokens[6].EndLine)
+	}
+}
+
+func TestScan_Unterminated(t *testing.T) {
+	// DWScript strings may span lines, so an unterminated one runs to the end
+	tokens := Scan("x := 'abc\n{ open")
+	if len(tokens) != 3 || tokens[2].Kind != String || tokens[2].EndLine != 1 {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	tokens = Scan("x := 1; { open\ny")
+	if len(tokens) != 5 || tokens[4].Kind != Comment || tokens[4].EndLine != 1 {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+}
@@ -0,0 +1,138 @@
+// Package lsp implements LSP protocol handlers.
+package lsp
+
+import (
+	"log"
+
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Handlers that work on the AST obtain it through Document.AnalysisView. While a
+// document doesn't compile, the view holds the last good program and positions
+// must be translated: request positions from the current text to the view with
+// toSnapshotPosition, and result ranges back with the mapping helpers below.
+// With an up-to-date program the position map is nil and all helpers are no-ops.
+
+// toSnapshotPosition maps a request position in the current text to the
+// analyzed snapshot. It returns false if the position lies in text that was
+// typed after the last successful compile, where the stale AST has no answer.
+func toSnapshotPosition(positions *document.PositionMap, position protocol.Position) (protocol.Position, bool) {
+	mapped, ok := positions.ToSnapshot(position)
+	if !ok {
+		log.Printf("Position %d:%d is in text edited since the last successful compile\n",
+			position.Line, position.Character)
+	}
+
+	return mapped, ok
+}
+
+// mapLocationToCurrent translates a location in the analyzed snapshot of uri to
+// the current text. Locations in other documents are returned unchanged.
+// Edits inside the location grow or shrink it, which suits declarations and
+// other ranges that enclose code. It returns nil if the location's start or end
+// lies in text that has been edited since.
+func mapLocationToCurrent(loc *protocol.Location, uri string, positions *document.PositionMap) *protocol.Location {
+	if loc == nil || positions == nil || loc.URI != uri {
+		return loc
+	}
+
+	mapped, ok := positions.RangeToCurrent(loc.Range)
+	if !ok {
+		return nil
+	}
+
+	return &protocol.Location{URI: loc.URI, Range: mapped}
+}
+
+// mapLocationsToCurrent applies mapLocationToCurrent to each location, dropping
+// those that can't be mapped.
+func mapLocationsToCurrent(locations []protocol.Location, uri string, positions *document.PositionMap) []protocol.Location {
+	if positions == nil {
+		return locations
+	}
+
+	mapped := make([]protocol.Location, 0, len(locations))
+
+	for i := range locations {
+		if loc := mapLocationToCurrent(&locations[i], uri, positions); loc != nil {
+			mapped = append(mapped, *loc)
+		}
+	}
+
+	return mapped
+}
+
+// mapReferencesToCurrent translates identifier locations in the analyzed
+// snapshot of uri to the current text. Unlike mapLocationsToCurrent, it drops
+// every location whose text has been touched by an edit, since the identifier
+// it pointed at may no longer be there.
+func mapReferencesToCurrent(locations []protocol.Location, uri string, positions *document.PositionMap) []protocol.Location {
+	if positions == nil {
+		return locations
+	}
+
+	mapped := make([]protocol.Location, 0, len(locations))
+
+	for _, loc := range locations {
+		if loc.URI != uri {
+			mapped = append(mapped, loc)
+			continue
+		}
+
+		if rng, ok := positions.RangeToCurrentExact(loc.Range); ok {
+			mapped = append(mapped, protocol.Location{URI: loc.URI, Range: rng})
+		}
+	}
+
+	return mapped
+}
+
+// openAnalysisViews passes the program of each open document's analysis view
+// to setProgram, for features that look at several documents. It returns the
+// maps translating positions in those programs to the current texts, which
+// are nil for documents whose current text compiled.
+func openAnalysisViews(srv *server.Server, setProgram func(uri string, program *dwscript.Program)) map[string]*document.PositionMap {
+	positionMaps := make(map[string]*document.PositionMap)
+
+	for _, uri := range srv.Documents().List() {
+		doc, exists := srv.Documents().Get(uri)
+		if !exists {
+			continue
+		}
+
+		view, positions := doc.AnalysisView()
+		if view.Program != nil {
+			setProgram(uri, view.Program)
+		}
+
+		positionMaps[uri] = positions
+	}
+
+	return positionMaps
+}
+
+// openSyntaxViews is like openAnalysisViews, but passes the syntax tree of
+// each open document's syntax view to setProgram.
+func openSyntaxViews(srv *server.Server, setProgram func(uri string, program *ast.Program)) map[string]*document.PositionMap {
+	positionMaps := make(map[string]*document.PositionMap)
+
+	for _, uri := range srv.Documents().List() {
+		doc, exists := srv.Documents().Get(uri)
+		if !exists {
+			continue
+		}
+
+		view, positions := doc.SyntaxView()
+		if program := view.AST(); program != nil {
+			setProgram(uri, program)
+		}
+
+		positionMaps[uri] = positions
+	}
+
+	return positionMaps
+}
@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"log"
+	"path"
+	"slices"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// PrepareCallHierarchy handles the textDocument/prepareCallHierarchy request.
+// It returns the routine declared or called at the position.
+func PrepareCallHierarchy(context *glsp.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in PrepareCallHierarchy")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+	log.Printf("PrepareCallHierarchy request at %s line %d, character %d\n", uri, position.Line, position.Character)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for call hierarchy: %s\n", uri)
+		return nil, nil
+	}
+
+	// Use the last good program if the current text doesn't compile
+	view, positions := doc.AnalysisView()
+	if view.Program == nil {
+		return nil, nil
+	}
+
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return nil, nil
+	}
+
+	hierarchy := newCallHierarchy(srv)
+
+	// Convert LSP (0-based) to AST (1-based)
+	routine := hierarchy.resolver.RoutineAt(uri, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if routine == nil {
+		log.Printf("No routine at %s line %d, character %d\n", uri, position.Line, position.Character)
+		return nil, nil
+	}
+
+	item, ok := hierarchy.item(*routine)
+	if !ok {
+		return nil, nil
+	}
+
+	return []protocol.CallHierarchyItem{item}, nil
+}
+
+// CallHierarchyIncomingCalls handles the callHierarchy/incomingCalls request.
+// It searches the open documents and the workspace files mentioning the
+// routine's name for calls resolving to it, and groups them by caller. Calls
+// from the main code of a script come from an item of kind File.
+func CallHierarchyIncomingCalls(context *glsp.Context, params *protocol.CallHierarchyIncomingCallsParams) ([]protocol.CallHierarchyIncomingCall, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in CallHierarchyIncomingCalls")
+		return nil, nil
+	}
+
+	log.Printf("CallHierarchyIncomingCalls request for %s in %s\n", params.Item.Name, params.Item.URI)
+
+	hierarchy := newCallHierarchy(srv)
+
+	target := hierarchy.routine(params.Item)
+	if target == nil || target.Decl == nil {
+		return nil, nil
+	}
+
+	// Candidate documents: the open ones, the routine's own and indexed files using its name
+	uris := srv.Documents().List()
+	uris = append(uris, params.Item.URI)
+
+	if srv.Symbols() != nil {
+		for _, loc := range srv.Symbols().FindReferences(target.Decl.Name.Value, srv.Documents()) {
+			uris = append(uris, loc.URI)
+		}
+	}
+
+	slices.Sort(uris)
+	uris = slices.Compact(uris)
+
+	ctx := requestContext(srv, context)
+	calls := hierarchy.resolver.IncomingCalls(ctx, *target, uris)
+
+	if err := ctx.Err(); err != nil {
+		log.Printf("CallHierarchyIncomingCalls for %s cancelled\n", params.Item.Name)
+		return nil, err
+	}
+
+	result := make([]protocol.CallHierarchyIncomingCall, 0, len(calls))
+
+	for _, call := range calls {
+		item, ok := hierarchy.item(call.Routine)
+		if !ok {
+			continue
+		}
+
+		ranges := hierarchy.siteRanges(call.Routine.URI, call.Sites)
+		if len(ranges) == 0 {
+			continue
+		}
+
+		result = append(result, protocol.CallHierarchyIncomingCall{From: item, FromRanges: ranges})
+	}
+
+	log.Printf("Found %d callers of %s\n", len(result), params.Item.Name)
+
+	return result, nil
+}
+
+// CallHierarchyOutgoingCalls handles the callHierarchy/outgoingCalls request.
+// It returns the routines called by the item, with the call sites of each.
+// Calls of built-in functions are not reported.
+func CallHierarchyOutgoingCalls(context *glsp.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in CallHierarchyOutgoingCalls")
+		return nil, nil
+	}
+
+	log.Printf("CallHierarchyOutgoingCalls request for %s in %s\n", params.Item.Name, params.Item.URI)
+
+	hierarchy := newCallHierarchy(srv)
+
+	caller := hierarchy.routine(params.Item)
+	if caller == nil {
+		return nil, nil
+	}
+
+	calls := hierarchy.resolver.OutgoingCalls(*caller)
+	result := make([]protocol.CallHierarchyOutgoingCall, 0, len(calls))
+
+	for _, call := range calls {
+		item, ok := hierarchy.item(call.Routine)
+		if !ok {
+			continue
+		}
+
+		// The call sites are in the caller's document
+		ranges := hierarchy.siteRanges(caller.URI, call.Sites)
+		if len(ranges) == 0 {
+			continue
+		}
+
+		result = append(result, protocol.CallHierarchyOutgoingCall{To: item, FromRanges: ranges})
+	}
+
+	log.Printf("Found %d callees of %s\n", len(result), params.Item.Name)
+
+	return result, nil
+}
+
+// callHierarchy resolves calls for one call hierarchy request. Open documents
+// are analyzed through their AnalysisView, so positions in them must be
+// translated between the analyzed snapshot and the current text.
+type callHierarchy struct {
+	resolver  *analysis.CallResolver
+	positions map[string]*document.PositionMap
+}
+
+// newCallHierarchy creates a callHierarchy over the open documents of srv and
+// its workspace index.
+func newCallHierarchy(srv *server.Server) *callHierarchy {
+	resolver := analysis.NewCallResolver(srv.Documents(), srv.WorkspaceIndex())
+
+	return &callHierarchy{
+		resolver:  resolver,
+		positions: openAnalysisViews(srv, resolver.SetProgram),
+	}
+}
+
+// routine returns the routine an item returned earlier stands for, or nil if
+// it can no longer be found.
+func (h *callHierarchy) routine(item protocol.CallHierarchyItem) *analysis.Routine {
+	if item.Kind == protocol.SymbolKindFile {
+		return &analysis.Routine{URI: item.URI}
+	}
+
+	position := item.SelectionRange.Start
+	if positions := h.positions[item.URI]; positions != nil {
+		var ok bool
+		if position, ok = positions.ToSnapshot(position); !ok {
+			return nil
+		}
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	routine := h.resolver.RoutineAt(item.URI, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if routine == nil || routine.Decl == nil {
+		log.Printf("Call hierarchy item %s not found in %s\n", item.Name, item.URI)
+		return nil
+	}
+
+	return routine
+}
+
+// item returns the call hierarchy item for routine. It returns false if the
+// routine's declaration has been edited since the last successful compile.
+func (h *callHierarchy) item(routine analysis.Routine) (protocol.CallHierarchyItem, bool) {
+	if routine.Decl == nil {
+		program := h.resolver.Program(routine.URI)
+		if program == nil {
+			return protocol.CallHierarchyItem{}, false
+		}
+
+		// The main code is represented by the whole script
+		rng := nodeRange(program)
+		rng.Start = protocol.Position{}
+
+		if positions := h.positions[routine.URI]; positions != nil {
+			var ok bool
+			if rng, ok = positions.RangeToCurrent(rng); !ok {
+				return protocol.CallHierarchyItem{}, false
+			}
+		}
+
+		return protocol.CallHierarchyItem{
+			Name:           path.Base(routine.URI),
+			Kind:           protocol.SymbolKindFile,
+			URI:            routine.URI,
+			Range:          rng,
+			SelectionRange: protocol.Range{Start: rng.Start, End: rng.Start},
+		}, true
+	}
+
+	item := protocol.CallHierarchyItem{
+		Name:           routine.Decl.Name.Value,
+		Kind:           protocol.SymbolKindFunction,
+		URI:            routine.URI,
+		Range:          nodeRange(routine.Decl),
+		SelectionRange: nodeRange(routine.Decl.Name),
+	}
+
+	if className := h.resolver.ClassName(routine); className != "" {
+		item.Kind = protocol.SymbolKindMethod
+		item.Detail = &className
+
+		if routine.Decl.IsConstructor {
+			item.Kind = protocol.SymbolKindConstructor
+		}
+	}
+
+	if positions := h.positions[routine.URI]; positions != nil {
+		var ok bool
+		if item.Range, ok = positions.RangeToCurrent(item.Range); !ok {
+			return protocol.CallHierarchyItem{}, false
+		}
+
+		if item.SelectionRange, ok = positions.RangeToCurrentExact(item.SelectionRange); !ok {
+			return protocol.CallHierarchyItem{}, false
+		}
+	}
+
+	return item, true
+}
+
+// siteRanges returns the ranges of the call sites in uri, dropping those that
+// have been edited since the last successful compile.
+func (h *callHierarchy) siteRanges(uri string, sites []*ast.Identifier) []protocol.Range {
+	positions := h.positions[uri]
+	ranges := make([]protocol.Range, 0, len(sites))
+
+	for _, site := range sites {
+		rng := nodeRange(site)
+
+		if positions != nil {
+			var ok bool
+			if rng, ok = positions.RangeToCurrentExact(rng); !ok {
+				continue
+			}
+		}
+
+		ranges = append(ranges, rng)
+	}
+
+	return ranges
+}
+
+// nodeRange converts the AST (1-based) range of node to an LSP (0-based) range.
+func nodeRange(node ast.Node) protocol.Range {
+	start := node.Pos()
+	end := node.End()
+
+	return protocol.Range{
+		Start: protocol.Position{
+			Line:      uint32(max(0, start.Line-1)),
+			Character: uint32(max(0, start.Column-1)),
+		},
+		End: protocol.Position{
+			Line:      uint32(max(0, end.Line-1)),
+			Character: uint32(max(0, end.Column-1)),
+		},
+	}
+}
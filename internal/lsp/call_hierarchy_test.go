@@ -0,0 +1,174 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const callHierarchyContent = `type TCounter = class
+  procedure Increment;
+end;
+
+procedure Log(msg: String);
+begin
+  PrintLn(msg);
+end;
+
+procedure TCounter.Increment;
+begin
+  Log('increment');
+end;
+
+var c := TCounter.Create;
+c.Increment;
+c.Increment;
+Log('done');`
+
+func prepareCallHierarchy(t *testing.T, uri string, line, character uint32) []protocol.CallHierarchyItem {
+	t.Helper()
+
+	items, err := PrepareCallHierarchy(&glsp.Context{}, &protocol.CallHierarchyPrepareParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PrepareCallHierarchy failed: %v", err)
+	}
+
+	return items
+}
+
+func openCallHierarchyDocument(t *testing.T, uri string) {
+	t.Helper()
+
+	SetServer(server.New())
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: callHierarchyContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+}
+
+func TestPrepareCallHierarchy(t *testing.T) {
+	uri := "file:///calls.dws"
+	openCallHierarchyDocument(t, uri)
+
+	// "Increment" in "c.Increment" resolves to the method implementation
+	items := prepareCallHierarchy(t, uri, 15, 3)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+
+	item := items[0]
+	if item.Name != "Increment" || item.Kind != protocol.SymbolKindMethod {
+		t.Errorf("Expected method Increment, got %s of kind %d", item.Name, item.Kind)
+	}
+
+	if item.Detail == nil || *item.Detail != "TCounter" {
+		t.Errorf("Expected detail TCounter, got %v", item.Detail)
+	}
+
+	selection := protocol.Range{
+		Start: protocol.Position{Line: 9, Character: 19},
+		End:   protocol.Position{Line: 9, Character: 28},
+	}
+	if item.SelectionRange != selection {
+		t.Errorf("Expected selection range %+v, got %+v", selection, item.SelectionRange)
+	}
+
+	// No routine at a variable
+	if items := prepareCallHierarchy(t, uri, 14, 4); len(items) != 0 {
+		t.Errorf("Expected no item for a variable, got %+v", items)
+	}
+}
+
+func TestCallHierarchyIncomingCalls(t *testing.T) {
+	uri := "file:///calls.dws"
+	openCallHierarchyDocument(t, uri)
+
+	// "Log" in its declaration
+	items := prepareCallHierarchy(t, uri, 4, 11)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+
+	calls, err := CallHierarchyIncomingCalls(&glsp.Context{}, &protocol.CallHierarchyIncomingCallsParams{Item: items[0]})
+	if err != nil {
+		t.Fatalf("CallHierarchyIncomingCalls failed: %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 callers, got %d: %+v", len(calls), calls)
+	}
+
+	if calls[0].From.Kind != protocol.SymbolKindFile || calls[0].From.Name != "calls.dws" {
+		t.Errorf("Expected the main code as first caller, got %s of kind %d", calls[0].From.Name, calls[0].From.Kind)
+	}
+
+	main := protocol.Range{
+		Start: protocol.Position{Line: 17, Character: 0},
+		End:   protocol.Position{Line: 17, Character: 3},
+	}
+	if len(calls[0].FromRanges) != 1 || calls[0].FromRanges[0] != main {
+		t.Errorf("Expected call site %+v, got %+v", main, calls[0].FromRanges)
+	}
+
+	if calls[1].From.Name != "Increment" || calls[1].From.Kind != protocol.SymbolKindMethod {
+		t.Errorf("Expected TCounter.Increment as second caller, got %s", calls[1].From.Name)
+	}
+}
+
+func TestCallHierarchyOutgoingCalls(t *testing.T) {
+	uri := "file:///calls.dws"
+	openCallHierarchyDocument(t, uri)
+
+	// The main code calls TCounter.Increment twice and Log once
+	calls, err := CallHierarchyOutgoingCalls(&glsp.Context{}, &protocol.CallHierarchyOutgoingCallsParams{
+		Item: protocol.CallHierarchyItem{Name: "calls.dws", Kind: protocol.SymbolKindFile, URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("CallHierarchyOutgoingCalls failed: %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 callees, got %d: %+v", len(calls), calls)
+	}
+
+	if calls[0].To.Name != "Increment" || len(calls[0].FromRanges) != 2 {
+		t.Errorf("Expected Increment called twice, got %s called %d time(s)", calls[0].To.Name, len(calls[0].FromRanges))
+	}
+
+	if calls[1].To.Name != "Log" || len(calls[1].FromRanges) != 1 {
+		t.Errorf("Expected Log called once, got %s called %d time(s)", calls[1].To.Name, len(calls[1].FromRanges))
+	}
+
+	// The method calls Log, but PrintLn is a built-in
+	items := prepareCallHierarchy(t, uri, 9, 20)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+
+	calls, err = CallHierarchyOutgoingCalls(&glsp.Context{}, &protocol.CallHierarchyOutgoingCallsParams{Item: items[0]})
+	if err != nil {
+		t.Fatalf("CallHierarchyOutgoingCalls failed: %v", err)
+	}
+
+	if len(calls) != 1 || calls[0].To.Name != "Log" {
+		t.Errorf("Expected Increment to call Log, got %+v", calls)
+	}
+}
+
+func TestPrepareCallHierarchyUnknownDocument(t *testing.T) {
+	SetServer(server.New())
+
+	if items := prepareCallHierarchy(t, "file:///missing.dws", 0, 0); items != nil {
+		t.Errorf("Expected no items for an unknown document, got %+v", items)
+	}
+}
@@ -45,12 +45,21 @@ func CodeAction(context *glsp.Context, params *protocol.CodeActionParams) (any,
 	log.Printf("CodeAction context has %d diagnostics\n", len(diagnostics))
 
 	// Retrieve document from DocumentStore
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for code action: %s\n", uri)
 		return []protocol.CodeAction{}, nil
 	}
 
+	// Quick fixes and source actions edit the current text and only look up
+	// names in the program, so the last good program can stand in while the
+	// document doesn't compile
+	if doc.Program == nil && doc.LastGoodProgram != nil {
+		fallback := *doc
+		fallback.Program = doc.LastGoodProgram
+		doc = &fallback
+	}
+
 	// Check if document has AST available
 	if doc.Program == nil {
 		log.Printf("No AST available for code action (document has parse errors): %s\n", uri)
@@ -1007,6 +1016,17 @@ func GenerateSourceActions(doc *server.Document, uri string, context protocol.Co
 		actions = append(actions, *organizeAction)
 	}
 
+	// Organizing every file is left to the server; the action's kind is plain
+	// source, so that editors don't run it when organizing imports on save
+	if len(context.Only) == 0 || slices.Contains(context.Only, protocol.CodeActionKindSource) {
+		title := "Organize units in workspace"
+		actions = append(actions, protocol.CodeAction{
+			Title:   title,
+			Kind:    stringPtr(string(protocol.CodeActionKindSource)),
+			Command: &protocol.Command{Title: title, Command: organizeUnitsInWorkspaceCommand},
+		})
+	}
+
 	return actions
 }
 
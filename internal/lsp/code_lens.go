@@ -0,0 +1,267 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Kinds of code lenses, stored in their data until they are resolved.
+const (
+	codeLensReferences      = "references"
+	codeLensImplementations = "implementations"
+	codeLensOverrides       = "overrides"
+	codeLensRun             = "run"
+)
+
+// showReferencesCommand is the client command that shows a list of locations,
+// taking the document URI, the position and the locations as arguments.
+const showReferencesCommand = "editor.action.showReferences"
+
+// codeLensData identifies the symbol of an unresolved code lens. Position is
+// the start of the symbol's name in the text the lens was computed for.
+type codeLensData struct {
+	Kind     string            `json:"kind"`
+	URI      string            `json:"uri"`
+	Position protocol.Position `json:"position"`
+}
+
+// CodeLens handles the textDocument/codeLens request.
+// It places a reference count above every routine, class, interface and
+// global variable, and a count of overrides or implementations above virtual
+// methods and interfaces. The counts are left for CodeLensResolve, which
+// computes them only for the lenses the editor shows. Scripts, unlike units,
+// get a lens at the top that runs them.
+func CodeLens(context *glsp.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in CodeLens")
+		return []protocol.CodeLens{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("CodeLens request for %s\n", uri)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for code lens: %s\n", uri)
+		return []protocol.CodeLens{}, nil
+	}
+
+	// Use the last good program if the current text doesn't compile
+	view, positions := doc.AnalysisView()
+	if view.Program == nil || view.Program.AST() == nil {
+		return []protocol.CodeLens{}, nil
+	}
+
+	lenses := []protocol.CodeLens{}
+
+	isUnit := slices.ContainsFunc(view.Program.AST().Statements, func(stmt ast.Statement) bool {
+		_, ok := stmt.(*ast.UnitDeclaration)
+		return ok
+	})
+
+	if !isUnit {
+		lenses = append(lenses, protocol.CodeLens{
+			Data: codeLensData{Kind: codeLensRun, URI: uri},
+		})
+	}
+
+	add := func(name *ast.Identifier, kinds ...string) {
+		if name == nil {
+			return
+		}
+
+		rng := nodeRange(name)
+		if positions != nil {
+			var ok bool
+			if rng, ok = positions.RangeToCurrentExact(rng); !ok {
+				return
+			}
+		}
+
+		for _, kind := range kinds {
+			lenses = append(lenses, protocol.CodeLens{
+				Range: rng,
+				Data:  codeLensData{Kind: kind, URI: uri, Position: rng.Start},
+			})
+		}
+	}
+
+	for _, stmt := range view.Program.AST().Statements {
+		switch decl := stmt.(type) {
+		case *ast.FunctionDecl:
+			// Methods get their lenses in the class body, routines at their body
+			if decl.ClassName == nil && decl.Body != nil {
+				add(decl.Name, codeLensReferences)
+			}
+
+		case *ast.ClassDecl:
+			add(decl.Name, codeLensReferences)
+
+			for _, method := range append([]*ast.FunctionDecl{decl.Constructor, decl.Destructor}, decl.Methods...) {
+				if method == nil {
+					continue
+				}
+
+				if method.IsVirtual || method.IsAbstract || method.IsOverride {
+					add(method.Name, codeLensReferences, codeLensOverrides)
+				} else {
+					add(method.Name, codeLensReferences)
+				}
+			}
+
+		case *ast.InterfaceDecl:
+			add(decl.Name, codeLensReferences, codeLensImplementations)
+
+			for _, method := range decl.Methods {
+				if method != nil {
+					add(method.Name, codeLensReferences, codeLensImplementations)
+				}
+			}
+
+		case *ast.VarDeclStatement:
+			for _, name := range decl.Names {
+				add(name, codeLensReferences)
+			}
+		}
+	}
+
+	log.Printf("Returning %d code lenses for %s\n", len(lenses), uri)
+
+	return lenses, nil
+}
+
+// CodeLensResolve handles the codeLens/resolve request.
+// It counts the references, overrides or implementations of the lens's
+// symbol and attaches a command showing them.
+func CodeLensResolve(context *glsp.Context, params *protocol.CodeLens) (*protocol.CodeLens, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in CodeLensResolve")
+		return params, nil
+	}
+
+	var data codeLensData
+	if encoded, err := json.Marshal(params.Data); err != nil || json.Unmarshal(encoded, &data) != nil {
+		log.Printf("Invalid code lens data: %v\n", params.Data)
+		return params, nil
+	}
+
+	log.Printf("CodeLensResolve request for %s lens at %s line %d, character %d\n",
+		data.Kind, data.URI, data.Position.Line, data.Position.Character)
+
+	if data.Kind == codeLensRun {
+		params.Command = &protocol.Command{
+			Title:     "Run script",
+			Command:   runScriptCommand,
+			Arguments: []any{data.URI},
+		}
+
+		return params, nil
+	}
+
+	var (
+		locations []protocol.Location
+		noun      string
+	)
+
+	switch data.Kind {
+	case codeLensReferences:
+		var err error
+
+		locations, err = findReferences(requestContext(srv, context), srv, &protocol.ReferenceParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: data.URI},
+				Position:     data.Position,
+			},
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		noun = "reference"
+
+	case codeLensOverrides, codeLensImplementations:
+		locations = findImplementingLocations(srv, data)
+		noun = "implementation"
+
+		if data.Kind == codeLensOverrides {
+			noun = "override"
+		}
+
+	default:
+		log.Printf("Unknown code lens kind: %s\n", data.Kind)
+		return params, nil
+	}
+
+	title := fmt.Sprintf("%d %ss", len(locations), noun)
+	if len(locations) == 1 {
+		title = "1 " + noun
+	}
+
+	// A lens without locations shows its title but does nothing when clicked
+	command := protocol.Command{Title: title}
+	if len(locations) > 0 {
+		command.Command = showReferencesCommand
+		command.Arguments = []any{data.URI, data.Position, locations}
+	}
+
+	params.Command = &command
+
+	return params, nil
+}
+
+// findImplementingLocations returns the locations of the overrides of the
+// method, or the implementations of the interface or interface method, whose
+// name is at the lens position. For an interface these are the classes
+// implementing it.
+func findImplementingLocations(srv *server.Server, data codeLensData) []protocol.Location {
+	if _, exists := srv.Documents().Get(data.URI); !exists {
+		return nil
+	}
+
+	hierarchy := newTypeHierarchy(srv)
+
+	if member := declaredMember(hierarchy, data.URI, data.Position); member != nil {
+		return hierarchy.routineLocations(hierarchy.types.Overrides(*member))
+	}
+
+	position := data.Position
+	if positions := hierarchy.positions[data.URI]; positions != nil {
+		var ok bool
+		if position, ok = toSnapshotPosition(positions, position); !ok {
+			return nil
+		}
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	typeDecl := hierarchy.types.TypeAt(data.URI, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if typeDecl == nil {
+		return nil
+	}
+
+	locations := []protocol.Location{}
+
+	for _, descendant := range hierarchy.types.Descendants(*typeDecl) {
+		if _, ok := descendant.Decl.(*ast.ClassDecl); !ok {
+			continue
+		}
+
+		if location, ok := hierarchy.location(descendant.URI, descendant.Name()); ok {
+			locations = append(locations, location)
+		}
+	}
+
+	return locations
+}
@@ -0,0 +1,217 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const codeLensContent = `type IShape = interface
+  function Area: Float;
+end;
+
+type TShape = class(IShape)
+  function Area: Float; virtual;
+end;
+
+type TSquare = class(TShape)
+  function Area: Float; override;
+end;
+
+function TShape.Area: Float;
+begin
+  Result := 0;
+end;
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;
+
+function Total(a, b: TShape): Float;
+begin
+  Result := a.Area() + b.Area();
+end;
+
+var square := TSquare.Create;
+PrintLn(Total(square, square));`
+
+func TestCodeLens(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///lenses.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: codeLensContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	lenses, err := CodeLens(&glsp.Context{}, &protocol.CodeLensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("CodeLens failed: %v", err)
+	}
+
+	// Lenses are resolved lazily
+	byPosition := make(map[protocol.Position][]protocol.CodeLens)
+
+	for _, lens := range lenses {
+		if lens.Command != nil {
+			t.Errorf("Expected an unresolved lens, got command %+v", lens.Command)
+		}
+
+		byPosition[lens.Range.Start] = append(byPosition[lens.Range.Start], lens)
+	}
+
+	resolve := func(lens protocol.CodeLens) string {
+		t.Helper()
+
+		// The data makes a round trip through the client as JSON
+		encoded, err := json.Marshal(lens)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded protocol.CodeLens
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		resolved, err := CodeLensResolve(&glsp.Context{}, &decoded)
+		if err != nil {
+			t.Fatalf("CodeLensResolve failed: %v", err)
+		}
+
+		if resolved.Command == nil {
+			t.Fatal("Expected a command on the resolved lens")
+		}
+
+		return resolved.Command.Title
+	}
+
+	tests := []struct {
+		name     string
+		position protocol.Position
+		titles   []string
+	}{
+		{"interface", protocol.Position{Line: 0, Character: 5}, []string{"", "2 implementations"}},
+		{"interface method", protocol.Position{Line: 1, Character: 11}, []string{"", "2 implementations"}},
+		{"virtual method", protocol.Position{Line: 5, Character: 11}, []string{"", "1 override"}},
+		{"override", protocol.Position{Line: 9, Character: 11}, []string{"", "0 overrides"}},
+		{"routine", protocol.Position{Line: 22, Character: 9}, []string{"1 reference"}},
+		{"global variable", protocol.Position{Line: 27, Character: 4}, []string{"2 references"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := byPosition[tt.position]
+			if len(found) != len(tt.titles) {
+				t.Fatalf("Expected %d lenses at %+v, got %d", len(tt.titles), tt.position, len(found))
+			}
+
+			for i, lens := range found {
+				title := resolve(lens)
+
+				// Reference counts of methods depend on name matching; only check they resolve
+				if tt.titles[i] != "" && title != tt.titles[i] {
+					t.Errorf("Expected title %q, got %q", tt.titles[i], title)
+				}
+			}
+		})
+	}
+
+	// No lenses for method implementations, which get theirs in the class body
+	if found := byPosition[protocol.Position{Line: 12, Character: 16}]; len(found) != 0 {
+		t.Errorf("Expected no lenses on a method implementation, got %d", len(found))
+	}
+}
+
+func TestCodeLensResolveCommand(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///lenses.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: codeLensContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	position := protocol.Position{Line: 5, Character: 11}
+
+	lens, err := CodeLensResolve(&glsp.Context{}, &protocol.CodeLens{
+		Range: protocol.Range{Start: position, End: protocol.Position{Line: 5, Character: 15}},
+		Data:  codeLensData{Kind: codeLensOverrides, URI: uri, Position: position},
+	})
+	if err != nil {
+		t.Fatalf("CodeLensResolve failed: %v", err)
+	}
+
+	if lens.Command == nil || lens.Command.Command != showReferencesCommand || len(lens.Command.Arguments) != 3 {
+		t.Fatalf("Expected a %s command with 3 arguments, got %+v", showReferencesCommand, lens.Command)
+	}
+
+	locations, ok := lens.Command.Arguments[2].([]protocol.Location)
+	if !ok || len(locations) != 1 || locations[0].Range.Start != (protocol.Position{Line: 17, Character: 17}) {
+		t.Errorf("Expected the override TSquare.Area, got %+v", lens.Command.Arguments[2])
+	}
+
+	// A lens without matches has a title but no command to run
+	lens, err = CodeLensResolve(&glsp.Context{}, &protocol.CodeLens{
+		Data: codeLensData{Kind: codeLensOverrides, URI: uri, Position: protocol.Position{Line: 9, Character: 11}},
+	})
+	if err != nil {
+		t.Fatalf("CodeLensResolve failed: %v", err)
+	}
+
+	if lens.Command == nil || lens.Command.Command != "" || lens.Command.Title != "0 overrides" {
+		t.Errorf("Expected an inert 0 overrides lens, got %+v", lens.Command)
+	}
+}
+
+func TestCodeLensRunScript(t *testing.T) {
+	SetServer(server.New())
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: "file:///script.dws", Text: "PrintLn('Hello');"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	all, err := CodeLens(&glsp.Context{}, &protocol.CodeLensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///script.dws"},
+	})
+	if err != nil {
+		t.Fatalf("CodeLens failed: %v", err)
+	}
+
+	var lenses []protocol.CodeLens
+
+	for _, lens := range all {
+		if data, ok := lens.Data.(codeLensData); ok && data.Kind == codeLensRun {
+			lenses = append(lenses, lens)
+		}
+	}
+
+	if len(lenses) != 1 || lenses[0].Range.Start != (protocol.Position{}) {
+		t.Fatalf("Expected a run lens at the top of the script, got %+v", lenses)
+	}
+
+	lens, err := CodeLensResolve(&glsp.Context{}, &lenses[0])
+	if err != nil {
+		t.Fatalf("CodeLensResolve failed: %v", err)
+	}
+
+	if lens.Command == nil || lens.Command.Command != runScriptCommand ||
+		len(lens.Command.Arguments) != 1 || lens.Command.Arguments[0] != "file:///script.dws" {
+		t.Errorf("Expected a %s command for the script, got %+v", runScriptCommand, lens.Command)
+	}
+}
@@ -37,14 +37,18 @@ func Completion(context *glsp.Context, params *protocol.CompletionParams) (any,
 		uri, position.Line, position.Character)
 
 	// Retrieve document from DocumentStore
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for completion: %s\n", uri)
 		return &protocol.CompletionList{IsIncomplete: false, Items: []protocol.CompletionItem{}}, nil
 	}
 
+	// The completion context is read from the current text, while symbols come
+	// from its partial AST or the last good program if it doesn't compile
+	view, positions := doc.SyntaxView()
+
 	// Check if document and AST are available
-	if doc.Program == nil {
+	if view.AST() == nil {
 		log.Printf("No AST available for completion (document has parse errors): %s\n", uri)
 		// Return empty completion list instead of nil to indicate completion is supported
 		return &protocol.CompletionList{
@@ -54,7 +58,7 @@ func Completion(context *glsp.Context, params *protocol.CompletionParams) (any,
 	}
 
 	// Get AST from Program
-	programAST := doc.Program.AST()
+	programAST := view.AST()
 	if programAST == nil {
 		log.Printf("AST is nil for document: %s\n", uri)
 
@@ -86,6 +90,11 @@ func Completion(context *glsp.Context, params *protocol.CompletionParams) (any,
 		}, nil
 	}
 
+	// Position in the analyzed program. Text typed since the last successful
+	// compile has no counterpart there, so use the start of that edit instead,
+	// which lies in the same scope.
+	snapshotPosition, _ := positions.ToSnapshot(position)
+
 	// Task 9.3: Detect trigger characters (dot for member access)
 	if params.Context != nil {
 		// Check if completion was triggered by a trigger character
@@ -121,13 +130,13 @@ func Completion(context *glsp.Context, params *protocol.CompletionParams) (any,
 		if completionContext.ParentIdentifier != "" {
 			log.Printf("Resolving type of parent identifier: %s", completionContext.ParentIdentifier)
 
-			typeInfo := analysis.ResolveMemberType(doc, completionContext.ParentIdentifier,
-				int(position.Line), int(position.Character))
+			typeInfo := analysis.ResolveMemberType(view, completionContext.ParentIdentifier,
+				int(snapshotPosition.Line), int(snapshotPosition.Character))
 			if typeInfo != nil {
 				log.Printf("Resolved parent type: %s (built-in: %v)", typeInfo.TypeName, typeInfo.IsBuiltIn)
 
 				// Task 9.5-9.6: Get members of the resolved type
-				members, err := analysis.GetTypeMembers(doc, typeInfo.TypeName)
+				members, err := analysis.GetTypeMembers(view, typeInfo.TypeName)
 				if err != nil {
 					log.Printf("Error retrieving type members: %v", err)
 				} else if len(members) > 0 {
@@ -164,7 +173,8 @@ func Completion(context *glsp.Context, params *protocol.CompletionParams) (any,
 		// Get completion cache (task 9.17)
 		cache := srv.CompletionCache()
 
-		items, err := analysis.CollectScopeCompletions(doc, cache, int(position.Line), int(position.Character))
+		items, err := analysis.CollectScopeCompletions(view, cache,
+			int(snapshotPosition.Line), int(snapshotPosition.Character))
 		if err != nil {
 			log.Printf("Error collecting scope completions: %v", err)
 
@@ -3,8 +3,10 @@ package lsp
 
 import (
 	"log"
+	"slices"
 
 	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/token"
@@ -14,16 +16,35 @@ import (
 
 // Definition handles the textDocument/definition request.
 // This provides "go-to definition" functionality, allowing users to navigate
-// to where a symbol is defined.
+// to where a symbol is defined. For routines that is the implementation body,
+// not a method declared in a class body or a forward declaration.
 func Definition(context *glsp.Context, params *protocol.DefinitionParams) (any, error) {
+	log.Printf("Definition request at %s line %d, character %d\n",
+		params.TextDocument.URI, params.Position.Line, params.Position.Character)
+
+	return findSymbolLocations(params.TextDocumentPositionParams, analysis.RoutineDefinition)
+}
+
+// Declaration handles the textDocument/declaration request.
+// It works like Definition, except that routines lead to their declaration:
+// the method declared in the class body rather than its implementation, or
+// the forward declaration of a routine.
+func Declaration(context *glsp.Context, params *protocol.DeclarationParams) (any, error) {
+	log.Printf("Declaration request at %s line %d, character %d\n",
+		params.TextDocument.URI, params.Position.Line, params.Position.Character)
+
+	return findSymbolLocations(params.TextDocumentPositionParams, analysis.RoutineDeclaration)
+}
+
+// findSymbolLocations resolves the symbol at a position to the locations of
+// its declarations. Locations of routines are passed through routine, which
+// picks either the declaration or the implementation of the routine.
+func findSymbolLocations(params protocol.TextDocumentPositionParams, routine func(*ast.Program, *ast.FunctionDecl) *ast.FunctionDecl) (any, error) {
 	uri := params.TextDocument.URI
 	position := params.Position
 
-	log.Printf("Definition request at %s line %d, character %d\n",
-		uri, position.Line, position.Character)
-
 	// Validate and get required components
-	programAST, astLine, astColumn := validateDefinitionRequest(uri, position)
+	programAST, positions, astLine, astColumn := validateDefinitionRequest(uri, position)
 	if programAST == nil {
 		return []protocol.Location{}, nil
 	}
@@ -48,7 +69,12 @@ func Definition(context *glsp.Context, params *protocol.DefinitionParams) (any,
 	if IsDeclaration(node) {
 		log.Printf("Already on declaration of %s, returning its location", symbolInfo.Name)
 		// Return the declaration's own location
-		return nodeToLocation(node, uri), nil
+		location := mapLocationToCurrent(nodeToLocation(node, uri), uri, positions)
+		if location == nil {
+			return []protocol.Location{}, nil
+		}
+
+		return location, nil
 	}
 
 	// Use the new symbol resolver for scope-based resolution (Task 5.3)
@@ -59,7 +85,10 @@ func Definition(context *glsp.Context, params *protocol.DefinitionParams) (any,
 
 	log.Printf("Resolution scope: %s", resolver.GetResolutionScope())
 
-	locations := resolver.ResolveSymbol(symbolInfo.Name)
+	locations := routineLocations(uri, programAST, resolver.ResolveSymbol(symbolInfo.Name), routine)
+
+	// Locations in this document refer to the analyzed snapshot
+	locations = mapLocationsToCurrent(locations, uri, positions)
 	if len(locations) == 0 {
 		log.Printf("No definition found for symbol %s at position %d:%d\n", symbolInfo.Name, astLine, astColumn)
 		return []protocol.Location{}, nil
@@ -76,37 +105,85 @@ func Definition(context *glsp.Context, params *protocol.DefinitionParams) (any,
 	return locations, nil // Return array of locations
 }
 
-// validateDefinitionRequest validates the definition request and returns the AST and position.
+// routineLocations replaces the locations of routine names among locations,
+// found in the program of uri or read from other documents, by the location
+// of the name of the routine picked by routine. Other locations are kept and
+// duplicates are dropped.
+func routineLocations(uri string, program *ast.Program, locations []protocol.Location, routine func(*ast.Program, *ast.FunctionDecl) *ast.FunctionDecl) []protocol.Location {
+	var resolver *analysis.CallResolver
+
+	mapped := make([]protocol.Location, 0, len(locations))
+
+	for _, loc := range locations {
+		locProgram := program
+		if loc.URI != uri {
+			if resolver == nil {
+				if srv, ok := serverInstance.(*server.Server); ok && srv != nil {
+					resolver = analysis.NewCallResolver(srv.Documents(), srv.WorkspaceIndex())
+				} else {
+					resolver = analysis.NewCallResolver(nil, nil)
+				}
+			}
+
+			locProgram = resolver.Program(loc.URI)
+		}
+
+		if locProgram != nil {
+			if decl := analysis.FunctionDeclAt(locProgram, loc.Range.Start); decl != nil {
+				if picked := routine(locProgram, decl); picked != decl && picked.Name != nil {
+					loc = protocol.Location{URI: loc.URI, Range: nodeRange(picked.Name)}
+				}
+			}
+		}
+
+		if !slices.Contains(mapped, loc) {
+			mapped = append(mapped, loc)
+		}
+	}
+
+	return mapped
+}
+
+// validateDefinitionRequest validates the definition request and returns the AST,
+// the map from AST positions to the current text, and the position in the AST.
 // Returns nil AST if validation fails.
-func validateDefinitionRequest(uri string, position protocol.Position) (*ast.Program, int, int) {
+func validateDefinitionRequest(uri string, position protocol.Position) (*ast.Program, *document.PositionMap, int, int) {
 	srv, ok := serverInstance.(*server.Server)
 	if !ok || srv == nil {
 		log.Println("Warning: server instance not available in Definition")
-		return nil, 0, 0
+		return nil, nil, 0, 0
 	}
 
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for definition: %s\n", uri)
-		return nil, 0, 0
+		return nil, nil, 0, 0
 	}
 
+	// Use the last good program if the current text doesn't compile
+	doc, positions := doc.AnalysisView()
+
 	if doc.Program == nil {
 		log.Printf("No AST available for definition (document has parse errors): %s\n", uri)
-		return nil, 0, 0
+		return nil, nil, 0, 0
 	}
 
 	programAST := doc.Program.AST()
 	if programAST == nil {
 		log.Printf("AST is nil for document: %s\n", uri)
-		return nil, 0, 0
+		return nil, nil, 0, 0
+	}
+
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return nil, nil, 0, 0
 	}
 
 	// Convert LSP position to AST position (0-based to 1-based)
 	astLine := int(position.Line) + 1
 	astColumn := int(position.Character) + 1
 
-	return programAST, astLine, astColumn
+	return programAST, positions, astLine, astColumn
 }
 
 // findDefinitionLocation finds the definition location for an AST node.
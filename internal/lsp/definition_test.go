@@ -4,9 +4,11 @@ import (
 	"testing"
 
 	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
@@ -1720,3 +1722,92 @@ const DEFAULT_TIMEOUT = 30;
 
 	t.Logf("Successfully resolved MAX_USERS to %s", locations[0].URI)
 }
+
+const routineDeclarationsContent = `type TCounter = class
+  procedure Increment;
+end;
+
+procedure Log(msg: String); forward;
+
+procedure TCounter.Increment;
+begin
+  Log('increment');
+end;
+
+procedure Log(msg: String);
+begin
+  PrintLn(msg);
+end;
+
+var c := TCounter.Create;
+c.Increment;
+Log('done');`
+
+func TestDefinitionAndDeclarationOfRoutines(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///routines.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: routineDeclarationsContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	at := func(line, character, length uint32) protocol.Location {
+		return protocol.Location{
+			URI: uri,
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: character},
+				End:   protocol.Position{Line: line, Character: character + length},
+			},
+		}
+	}
+
+	methodDeclaration := at(1, 12, 9)
+	methodImplementation := at(6, 19, 9)
+	forwardDeclaration := at(4, 10, 3)
+	routineImplementation := at(11, 10, 3)
+
+	tests := []struct {
+		name        string
+		line        uint32
+		character   uint32
+		definition  protocol.Location
+		declaration protocol.Location
+	}{
+		{"method call", 17, 3, methodImplementation, methodDeclaration},
+		{"method implementation", 6, 20, methodImplementation, methodDeclaration},
+		{"method in the class body", 1, 12, methodImplementation, methodDeclaration},
+		{"routine call", 18, 1, routineImplementation, forwardDeclaration},
+		{"forward declaration", 4, 11, routineImplementation, forwardDeclaration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: tt.line, Character: tt.character},
+			}
+
+			definition, err := Definition(&glsp.Context{}, &protocol.DefinitionParams{TextDocumentPositionParams: position})
+			if err != nil {
+				t.Fatalf("Definition failed: %v", err)
+			}
+
+			if loc, ok := definition.(*protocol.Location); !ok || *loc != tt.definition {
+				t.Errorf("Expected definition %+v, got %+v", tt.definition, definition)
+			}
+
+			declaration, err := Declaration(&glsp.Context{}, &protocol.DeclarationParams{TextDocumentPositionParams: position})
+			if err != nil {
+				t.Fatalf("Declaration failed: %v", err)
+			}
+
+			if loc, ok := declaration.(*protocol.Location); !ok || *loc != tt.declaration {
+				t.Errorf("Expected declaration %+v, got %+v", tt.declaration, declaration)
+			}
+		})
+	}
+}
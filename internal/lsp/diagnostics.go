@@ -5,6 +5,11 @@ import (
 	"log"
 	"sort"
 
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -37,6 +42,76 @@ func PublishDiagnostics(context *glsp.Context, uri string, diagnostics []protoco
 	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, params)
 }
 
+// publishDocumentDiagnostics publishes the diagnostics of an open document,
+// unless the client pulls diagnostics through DocumentDiagnostic.
+func publishDocumentDiagnostics(context *glsp.Context, srv *server.Server, uri string, diagnostics []protocol.Diagnostic) {
+	if srv.SupportsPullDiagnostics() {
+		return
+	}
+
+	PublishDiagnostics(context, uri, diagnostics)
+}
+
+// refreshDiagnostics asks a client that pulls diagnostics to pull them again,
+// after a background analysis or the workspace indexer changed them.
+func refreshDiagnostics(context *glsp.Context, srv *server.Server) {
+	if context == nil || context.Call == nil || !srv.SupportsDiagnosticRefresh() {
+		return
+	}
+
+	// The call blocks until the client responds, which can't happen while a
+	// message is still being handled
+	go context.Call(protocol317.MethodWorkspaceDiagnosticRefresh, nil, nil)
+
+	log.Println("Requesting a diagnostics refresh")
+}
+
+// diagnosticsResultID returns the result ID of the diagnostics computed from
+// text. It matches the result ID the workspace indexer records for a file with
+// the same contents, which has the same diagnostics.
+func diagnosticsResultID(text string) string {
+	return workspace.HashContent([]byte(text))
+}
+
+// compileWorkspaceFile is the CompileFunc of the workspace indexer. It
+// compiles files like open documents, so that they get the same diagnostics,
+// and records the units they use. Files that don't compile record the units
+// of their partial syntax tree, since a change to one of them may fix them.
+func compileWorkspaceFile(uri string, content []byte) workspace.CompileResult {
+	program, tree, diagnostics, err := analysis.ParseDocumentWithRecovery(string(content), uri)
+	if err != nil {
+		log.Printf("Error compiling workspace file %s: %v", uri, err)
+		return workspace.CompileResult{}
+	}
+
+	if program == nil || program.AST() == nil {
+		return workspace.CompileResult{Diagnostics: diagnostics, Units: usedUnits(tree)}
+	}
+
+	return workspace.CompileResult{Program: program, Diagnostics: diagnostics, Units: usedUnits(program.AST())}
+}
+
+// usedUnits returns the names of the units in the uses clauses of tree.
+func usedUnits(tree *ast.Program) []string {
+	if tree == nil {
+		return nil
+	}
+
+	var units []string
+
+	ast.Inspect(tree, func(node ast.Node) bool {
+		if uses, ok := node.(*ast.UsesClause); ok {
+			for _, unit := range uses.Units {
+				units = append(units, unit.Value)
+			}
+		}
+
+		return node != nil
+	})
+
+	return units
+}
+
 // sortDiagnostics sorts diagnostics by position (line first, then column).
 // This ensures diagnostics are presented in a predictable order in the editor.
 func sortDiagnostics(diagnostics []protocol.Diagnostic) {
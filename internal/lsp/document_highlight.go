@@ -0,0 +1,168 @@
+package lsp
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// DocumentHighlight handles the textDocument/documentHighlight request.
+// On a block keyword it highlights the other keywords of the block, such as
+// the end of a begin. On a symbol it highlights its occurrences in the
+// document, marking those that write the variable.
+func DocumentHighlight(context *glsp.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentHighlight")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+
+	log.Printf("DocumentHighlight request at %s line %d, character %d\n", uri, position.Line, position.Character)
+
+	current, exists := srv.Documents().Get(uri)
+	if !exists {
+		log.Printf("Document not found for document highlight: %s\n", uri)
+		return nil, nil
+	}
+
+	// Keywords are matched in the current text, which needn't compile
+	if ranges := analysis.MatchingKeywords(current.Text, position); len(ranges) > 0 {
+		return keywordHighlights(ranges), nil
+	}
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		return nil, nil
+	}
+
+	// Use the last good program if the current text doesn't compile
+	doc, positions := doc.AnalysisView()
+
+	if doc.Program == nil || doc.Program.AST() == nil {
+		log.Printf("No AST available for document highlight: %s\n", uri)
+		return nil, nil
+	}
+
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return nil, nil
+	}
+
+	highlights := symbolHighlights(doc, uri, position)
+
+	// Map the highlights to the current text, dropping those that were edited
+	mapped := make([]protocol.DocumentHighlight, 0, len(highlights))
+
+	for _, highlight := range highlights {
+		if positions != nil {
+			rng, ok := positions.RangeToCurrentExact(highlight.Range)
+			if !ok {
+				continue
+			}
+
+			highlight.Range = rng
+		}
+
+		mapped = append(mapped, highlight)
+	}
+
+	log.Printf("DocumentHighlight: %d highlight(s) in %s\n", len(mapped), uri)
+
+	return mapped, nil
+}
+
+// keywordHighlights returns text highlights for matching keywords.
+func keywordHighlights(ranges []protocol.Range) []protocol.DocumentHighlight {
+	kind := protocol.DocumentHighlightKindText
+	highlights := make([]protocol.DocumentHighlight, 0, len(ranges))
+
+	for _, rng := range ranges {
+		highlights = append(highlights, protocol.DocumentHighlight{Range: rng, Kind: &kind})
+	}
+
+	return highlights
+}
+
+// symbolHighlights returns the occurrences of the symbol at position (in the
+// analyzed snapshot) in the document, classified as reads or writes.
+func symbolHighlights(doc *server.Document, uri string, position protocol.Position) []protocol.DocumentHighlight {
+	// Convert LSP (0-based) to AST (1-based)
+	astLine := int(position.Line) + 1
+	astColumn := int(position.Character) + 1
+
+	programAST := doc.Program.AST()
+
+	sym := analysis.IdentifySymbolAtPosition(programAST, astLine, astColumn)
+	if sym == nil || sym.Name == "" {
+		log.Printf("No symbol at position %d:%d for document highlight\n", astLine, astColumn)
+		return nil
+	}
+
+	// Prefer semantic resolution; fall back to scope-limited or name matching
+	ranges := analysis.FindSemanticReferences(doc.Program, sym.Name, token.Position{Line: astLine, Column: astColumn}, uri)
+	if len(ranges) == 0 {
+		scope := analysis.DetermineScope(programAST, sym.Name, analysis.Position{Line: astLine, Column: astColumn})
+		if scope != nil && (scope.Type == analysis.ScopeLocal || scope.Type == analysis.ScopeParameter) && scope.Function != nil {
+			ranges = analysis.FindLocalReferences(programAST, sym.Name, scope.Function)
+		} else {
+			ranges = identifierRanges(programAST, sym.Name)
+		}
+	}
+
+	writes := analysis.WriteAccesses(programAST)
+	highlights := make([]protocol.DocumentHighlight, 0, len(ranges))
+
+	for _, rng := range ranges {
+		kind := protocol.DocumentHighlightKindRead
+		if writes[token.Position{Line: int(rng.Start.Line) + 1, Column: int(rng.Start.Character) + 1}] {
+			kind = protocol.DocumentHighlightKindWrite
+		}
+
+		highlights = append(highlights, protocol.DocumentHighlight{Range: rng, Kind: &kind})
+	}
+
+	sort.Slice(highlights, func(i, j int) bool {
+		a, b := highlights[i].Range.Start, highlights[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Character < b.Character
+	})
+
+	return highlights
+}
+
+// identifierRanges returns the ranges of the identifiers named name in program.
+func identifierRanges(program *ast.Program, name string) []protocol.Range {
+	var ranges []protocol.Range
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Identifier)
+		if !ok || ident == nil || !strings.EqualFold(ident.Value, name) {
+			return true
+		}
+
+		start := ident.Pos()
+		end := ident.End()
+
+		ranges = append(ranges, protocol.Range{
+			Start: protocol.Position{Line: uint32(max(0, start.Line-1)), Character: uint32(max(0, start.Column-1))},
+			End:   protocol.Position{Line: uint32(max(0, end.Line-1)), Character: uint32(max(0, end.Column-1))},
+		})
+
+		return true
+	})
+
+	return ranges
+}
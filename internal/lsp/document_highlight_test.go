@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func requestDocumentHighlight(t *testing.T, uri, content string, position protocol.Position) []protocol.DocumentHighlight {
+	t.Helper()
+
+	srv := server.New()
+	SetServer(srv)
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	highlights, err := DocumentHighlight(&glsp.Context{}, &protocol.DocumentHighlightParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     position,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DocumentHighlight failed: %v", err)
+	}
+
+	return highlights
+}
+
+func TestDocumentHighlight_ReadsAndWrites(t *testing.T) {
+	content := `var count: Integer;
+count := 1;
+Inc(count);
+PrintLn(count);`
+
+	highlights := requestDocumentHighlight(t, "file:///highlight.dws", content, protocol.Position{Line: 3, Character: 9})
+
+	expected := []struct {
+		line uint32
+		kind protocol.DocumentHighlightKind
+	}{
+		{0, protocol.DocumentHighlightKindRead},
+		{1, protocol.DocumentHighlightKindWrite},
+		{2, protocol.DocumentHighlightKindWrite},
+		{3, protocol.DocumentHighlightKindRead},
+	}
+
+	if len(highlights) != len(expected) {
+		t.Fatalf("Expected %d highlights, got %+v", len(expected), highlights)
+	}
+
+	for i, highlight := range highlights {
+		if highlight.Range.Start.Line != expected[i].line {
+			t.Errorf("Highlight %d on line %d, expected line %d", i, highlight.Range.Start.Line, expected[i].line)
+		}
+
+		if highlight.Kind == nil || *highlight.Kind != expected[i].kind {
+			t.Errorf("Highlight %d on line %d has kind %v, expected %d", i, expected[i].line, highlight.Kind, expected[i].kind)
+		}
+	}
+}
+
+func TestDocumentHighlight_Keywords(t *testing.T) {
+	content := `begin
+  repeat
+    PrintLn(1);
+  until True;
+end;`
+
+	highlights := requestDocumentHighlight(t, "file:///highlight_keywords.dws", content, protocol.Position{Line: 3, Character: 3})
+
+	if len(highlights) != 2 {
+		t.Fatalf("Expected 2 highlights, got %+v", highlights)
+	}
+
+	if highlights[0].Range.Start != (protocol.Position{Line: 1, Character: 2}) ||
+		highlights[1].Range != (protocol.Range{Start: protocol.Position{Line: 3, Character: 2}, End: protocol.Position{Line: 3, Character: 7}}) {
+		t.Errorf("Unexpected highlights %+v", highlights)
+	}
+
+	for _, highlight := range highlights {
+		if highlight.Kind == nil || *highlight.Kind != protocol.DocumentHighlightKindText {
+			t.Errorf("Expected text highlights, got %v", highlight.Kind)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package lsp
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Kinds of document links, stored in their data until they are resolved.
+const (
+	documentLinkUnit    = "unit"
+	documentLinkInclude = "include"
+)
+
+// unitExtensions are the extensions of unit files found in library paths,
+// in addition to the extensions of indexed files.
+var unitExtensions = []string{".dws", ".pas"}
+
+// documentLinkData identifies the target of an unresolved document link: a
+// unit name or an included file name, as written in the document URI.
+type documentLinkData struct {
+	Kind   string `json:"kind"`
+	URI    string `json:"uri"`
+	Target string `json:"target"`
+}
+
+// DocumentLink handles the textDocument/documentLink request.
+// It links the unit names of uses clauses to the files declaring the units,
+// the file names of include directives to the included files, and URLs in
+// comments to their targets. Units and included files are looked up by
+// DocumentLinkResolve, only for the links the user follows.
+func DocumentLink(context *glsp.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentLink")
+		return []protocol.DocumentLink{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("DocumentLink request for %s\n", uri)
+
+	// Links are found in the current text, which needn't compile
+	doc, exists := srv.Documents().Get(uri)
+	if !exists {
+		log.Printf("Document not found for document links: %s\n", uri)
+		return []protocol.DocumentLink{}, nil
+	}
+
+	links := []protocol.DocumentLink{}
+
+	for _, textLink := range analysis.TextLinks(doc.Text) {
+		rng, ok := offsetRange(doc.Text, textLink.Start, textLink.End)
+		if !ok {
+			continue
+		}
+
+		link := protocol.DocumentLink{Range: rng}
+
+		switch textLink.Kind {
+		case analysis.UnitLink:
+			tooltip := "Open unit " + textLink.Target
+			link.Tooltip = &tooltip
+			link.Data = documentLinkData{Kind: documentLinkUnit, URI: uri, Target: textLink.Target}
+
+		case analysis.IncludeLink:
+			tooltip := "Open included file " + textLink.Target
+			link.Tooltip = &tooltip
+			link.Data = documentLinkData{Kind: documentLinkInclude, URI: uri, Target: textLink.Target}
+
+		case analysis.URLLink:
+			target := textLink.Target
+			link.Target = &target
+		}
+
+		links = append(links, link)
+	}
+
+	log.Printf("Found %d document links in %s\n", len(links), uri)
+
+	return links, nil
+}
+
+// DocumentLinkResolve handles the documentLink/resolve request.
+// It sets the target of a unit or include link to the file it refers to. The
+// link is returned without a target if the file isn't found.
+func DocumentLinkResolve(context *glsp.Context, params *protocol.DocumentLink) (*protocol.DocumentLink, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentLinkResolve")
+		return params, nil
+	}
+
+	if params.Target != nil {
+		return params, nil
+	}
+
+	var data documentLinkData
+	if encoded, err := json.Marshal(params.Data); err != nil || json.Unmarshal(encoded, &data) != nil {
+		log.Printf("Invalid document link data: %v\n", params.Data)
+		return params, nil
+	}
+
+	log.Printf("DocumentLinkResolve request for %s %s in %s\n", data.Kind, data.Target, data.URI)
+
+	var target string
+
+	switch data.Kind {
+	case documentLinkUnit:
+		target = findUnitFile(srv, data.URI, data.Target)
+	case documentLinkInclude:
+		target = findIncludeFile(srv, data.URI, data.Target)
+	default:
+		log.Printf("Unknown document link kind: %s\n", data.Kind)
+		return params, nil
+	}
+
+	if target == "" {
+		log.Printf("No file found for %s %s\n", data.Kind, data.Target)
+		return params, nil
+	}
+
+	params.Target = &target
+
+	return params, nil
+}
+
+// findUnitFile returns the URI of the file declaring the unit name, which is
+// named after the unit: an open document or indexed workspace file, preferring
+// one next to the document uri, or a file in a library path. It returns "" if
+// there is none.
+func findUnitFile(srv *server.Server, uri string, name string) string {
+	candidates := srv.WorkspaceIndex().FindFilesByName(name)
+
+	for _, open := range srv.Documents().List() {
+		if strings.EqualFold(unitName(open), name) {
+			candidates = append([]string{open}, candidates...)
+		}
+	}
+
+	if len(candidates) > 0 {
+		for _, candidate := range candidates {
+			if path.Dir(candidate) == path.Dir(uri) {
+				return candidate
+			}
+		}
+
+		return candidates[0]
+	}
+
+	filter := srv.Config().IndexFilter
+
+	for _, dir := range libraryDirectories(srv) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			fileName := entry.Name()
+			ext := filepath.Ext(fileName)
+
+			if entry.IsDir() || !strings.EqualFold(strings.TrimSuffix(fileName, ext), name) {
+				continue
+			}
+
+			isUnit := slices.ContainsFunc(unitExtensions, func(unitExt string) bool {
+				return strings.EqualFold(unitExt, ext)
+			})
+
+			if isUnit || filter.HasIndexedExtension(fileName) {
+				return pathToURI(filepath.Join(dir, fileName))
+			}
+		}
+	}
+
+	return ""
+}
+
+// findIncludeFile returns the URI of the file included as name by the
+// document uri. Relative names are looked up next to the document, then in
+// the workspace folders and library paths. It returns "" if the file doesn't
+// exist.
+func findIncludeFile(srv *server.Server, uri string, name string) string {
+	name = filepath.FromSlash(name)
+
+	if filepath.IsAbs(name) {
+		if isFile(name) {
+			return pathToURI(name)
+		}
+
+		return ""
+	}
+
+	dirs := []string{filepath.Dir(uriToPath(uri))}
+	dirs = append(dirs, srv.GetWorkspaceFolders()...)
+	dirs = append(dirs, libraryDirectories(srv)...)
+
+	for _, dir := range dirs {
+		if candidate := filepath.Join(dir, name); isFile(candidate) {
+			return pathToURI(candidate)
+		}
+	}
+
+	return ""
+}
+
+// libraryDirectories returns the configured library paths, with relative
+// paths resolved against each workspace folder.
+func libraryDirectories(srv *server.Server) []string {
+	var dirs []string
+
+	for _, libraryPath := range srv.Config().LibraryPaths {
+		libraryPath = filepath.FromSlash(libraryPath)
+
+		if filepath.IsAbs(libraryPath) {
+			dirs = append(dirs, libraryPath)
+			continue
+		}
+
+		for _, folder := range srv.GetWorkspaceFolders() {
+			dirs = append(dirs, filepath.Join(folder, libraryPath))
+		}
+	}
+
+	return dirs
+}
+
+// isFile reports whether name is an existing regular file.
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// offsetRange converts the byte offsets start and end in text to an LSP range.
+func offsetRange(text string, start, end int) (protocol.Range, bool) {
+	startLine, startChar, err := document.OffsetToPosition(text, start)
+	if err != nil {
+		return protocol.Range{}, false
+	}
+
+	endLine, endChar, err := document.OffsetToPosition(text, end)
+	if err != nil {
+		return protocol.Range{}, false
+	}
+
+	return protocol.Range{
+		Start: protocol.Position{Line: protocol.UInteger(startLine), Character: protocol.UInteger(startChar)},
+		End:   protocol.Position{Line: protocol.UInteger(endLine), Character: protocol.UInteger(endChar)},
+	}, true
+}
@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const documentLinkContent = `// Shapes demo, see https://www.example.com/dwscript
+uses Utils, Geometry, Missing;
+
+{$I 'inc/shapes.inc'}
+{$INCLUDE missing.inc}
+
+PrintLn(Clamp(1));`
+
+func TestDocumentLink(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"inc/shapes.inc":   "var Sides := 4;\n",
+		"lib/Geometry.pas": "unit Geometry;\ninterface\nimplementation\nend.\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{dir})
+	SetServer(srv)
+
+	err := DidChangeConfiguration(nil, &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{
+			"go-dws-lsp": map[string]any{"libraryPaths": []any{"lib"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeConfiguration failed: %v", err)
+	}
+
+	uri := pathToURI(filepath.Join(dir, "main.dws"))
+	utils := pathToURI(filepath.Join(dir, "utils.dws"))
+
+	for docURI, text := range map[string]string{
+		uri:   documentLinkContent,
+		utils: "function Clamp(x: Integer): Integer;\nbegin\n  Result := x;\nend;",
+	} {
+		err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: docURI, Text: text},
+		})
+		if err != nil {
+			t.Fatalf("DidOpen failed: %v", err)
+		}
+	}
+
+	links, err := DocumentLink(&glsp.Context{}, &protocol.DocumentLinkParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DocumentLink failed: %v", err)
+	}
+
+	expected := []struct {
+		start  protocol.Position
+		end    protocol.Position
+		target string
+	}{
+		{protocol.Position{Line: 0, Character: 20}, protocol.Position{Line: 0, Character: 52}, "https://www.example.com/dwscript"},
+		{protocol.Position{Line: 1, Character: 5}, protocol.Position{Line: 1, Character: 10}, utils},
+		{protocol.Position{Line: 1, Character: 12}, protocol.Position{Line: 1, Character: 20}, pathToURI(filepath.Join(dir, "lib", "Geometry.pas"))},
+		{protocol.Position{Line: 1, Character: 22}, protocol.Position{Line: 1, Character: 29}, ""},
+		{protocol.Position{Line: 3, Character: 5}, protocol.Position{Line: 3, Character: 19}, pathToURI(filepath.Join(dir, "inc", "shapes.inc"))},
+		{protocol.Position{Line: 4, Character: 10}, protocol.Position{Line: 4, Character: 21}, ""},
+	}
+
+	if len(links) != len(expected) {
+		t.Fatalf("Expected %d links, got %d: %+v", len(expected), len(links), links)
+	}
+
+	for i, link := range links {
+		want := expected[i]
+
+		if link.Range.Start != want.start || link.Range.End != want.end {
+			t.Errorf("Link %d: expected range %+v-%+v, got %+v", i, want.start, want.end, link.Range)
+		}
+
+		// Only URLs have a target before the link is resolved
+		if i == 0 {
+			if link.Target == nil || *link.Target != want.target {
+				t.Errorf("Expected the URL link to target %s, got %v", want.target, link.Target)
+			}
+		} else if link.Target != nil {
+			t.Errorf("Link %d: expected an unresolved link, got target %s", i, *link.Target)
+		}
+
+		// The data makes a round trip through the client as JSON
+		encoded, err := json.Marshal(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded protocol.DocumentLink
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		resolved, err := DocumentLinkResolve(&glsp.Context{}, &decoded)
+		if err != nil {
+			t.Fatalf("DocumentLinkResolve failed: %v", err)
+		}
+
+		switch {
+		case want.target == "" && resolved.Target != nil:
+			t.Errorf("Link %d: expected no target, got %s", i, *resolved.Target)
+		case want.target != "" && (resolved.Target == nil || *resolved.Target != want.target):
+			t.Errorf("Link %d: expected target %s, got %v", i, want.target, resolved.Target)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/CWBudde/go-dws-lsp/internal/document"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/tliron/glsp"
@@ -27,28 +28,61 @@ func DocumentSymbol(context *glsp.Context, params *protocol.DocumentSymbolParams
 	log.Printf("DocumentSymbol request for %s\n", uri)
 
 	// Retrieve document from DocumentStore
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for document symbols: %s\n", uri)
 		return []protocol.DocumentSymbol{}, nil
 	}
 
+	// Use the partial AST or the last good program if the current text doesn't compile
+	doc, positions := doc.SyntaxView()
+
 	// Check if document has valid AST
-	if doc.Program == nil || doc.Program.AST() == nil {
+	programAST := doc.AST()
+	if programAST == nil {
 		log.Printf("No AST available for document symbols (document has parse errors): %s\n", uri)
 		return []protocol.DocumentSymbol{}, nil
 	}
 
-	programAST := doc.Program.AST()
-
 	// Collect symbols from the AST
-	symbols := collectDocumentSymbols(programAST)
+	symbols := mapDocumentSymbolsToCurrent(collectDocumentSymbols(programAST), positions)
 
 	log.Printf("Found %d top-level symbols in %s\n", len(symbols), uri)
 
 	return symbols, nil
 }
 
+// mapDocumentSymbolsToCurrent translates symbol ranges from the analyzed snapshot
+// to the current text. Symbols whose range can no longer be located are dropped
+// along with their children.
+func mapDocumentSymbolsToCurrent(symbols []protocol.DocumentSymbol, positions *document.PositionMap) []protocol.DocumentSymbol {
+	if positions == nil || len(symbols) == 0 {
+		return symbols
+	}
+
+	mapped := make([]protocol.DocumentSymbol, 0, len(symbols))
+
+	for _, sym := range symbols {
+		symRange, ok := positions.RangeToCurrent(sym.Range)
+		if !ok {
+			continue
+		}
+
+		// Fall back to the start of the symbol if its name was edited
+		selection, ok := positions.RangeToCurrentExact(sym.SelectionRange)
+		if !ok {
+			selection = protocol.Range{Start: symRange.Start, End: symRange.Start}
+		}
+
+		sym.Range = symRange
+		sym.SelectionRange = selection
+		sym.Children = mapDocumentSymbolsToCurrent(sym.Children, positions)
+		mapped = append(mapped, sym)
+	}
+
+	return mapped
+}
+
 // collectDocumentSymbols traverses the AST and collects all top-level symbols
 // including functions, variables, constants, classes, etc.
 func collectDocumentSymbols(program *ast.Program) []protocol.DocumentSymbol {
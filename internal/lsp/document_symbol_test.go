@@ -473,6 +473,56 @@ func TestDocumentSymbol_EmptyDocument(t *testing.T) {
 	}
 }
 
+// TestDocumentSymbol_SyntaxErrors tests that the outline is built from the partial
+// AST when the document doesn't compile.
+func TestDocumentSymbol_SyntaxErrors(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := "file:///test_syntax_errors.dws"
+	content := `var counter: Integer;
+
+function Increment(step: Integer): Integer;
+begin
+  Result := counter +;
+end;
+
+var broken := ;`
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:  uri,
+			Text: content,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	result, err := DocumentSymbol(&glsp.Context{}, &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DocumentSymbol failed: %v", err)
+	}
+
+	symbols, ok := result.([]protocol.DocumentSymbol)
+	if !ok {
+		t.Fatalf("Expected []protocol.DocumentSymbol, got %T", result)
+	}
+
+	names := make(map[string]bool)
+	for _, sym := range symbols {
+		names[sym.Name] = true
+	}
+
+	for _, expected := range []string{"counter", "Increment"} {
+		if !names[expected] {
+			t.Errorf("Expected symbol '%s' in outline of broken document, got %v", expected, symbols)
+		}
+	}
+}
+
 // TestDocumentSymbol_DocumentNotFound tests handling of non-existent document.
 func TestDocumentSymbol_DocumentNotFound(t *testing.T) {
 	srv := server.New()
@@ -0,0 +1,422 @@
+package lsp
+
+import (
+	"bytes"
+	contextpkg "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Commands run by the server through workspace/executeCommand.
+const (
+	reindexWorkspaceCommand         = "dws.reindexWorkspace"
+	clearCachesCommand              = "dws.clearCaches"
+	showServerStatusCommand         = "dws.showServerStatus"
+	organizeUnitsInWorkspaceCommand = "dws.organizeUnitsInWorkspace"
+	runScriptCommand                = "dws.runScript"
+)
+
+// ScriptRunnerEnv is set in the environment of the process dws.runScript
+// starts to run a script. The interpreter can't be interrupted, so scripts run
+// in a child process of the server, which is killed when the script times out
+// or the request is cancelled. The server binary checks for it on start and
+// calls RunScriptProcess instead of serving.
+const ScriptRunnerEnv = "GO_DWS_LSP_RUN_SCRIPT"
+
+// runScriptTimeout bounds how long dws.runScript waits for a script to finish.
+var runScriptTimeout = 10 * time.Second
+
+// serverCommand runs a command of a workspace/executeCommand request. Its
+// result is returned to the client.
+//
+// Commands run outside the connection's read loop, so they may wait for the
+// client, e.g. to apply a workspace edit, and can be cancelled.
+type serverCommand func(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error)
+
+// serverCommands are the commands the server runs, by name.
+var serverCommands = map[string]serverCommand{
+	reindexWorkspaceCommand:         executeReindexWorkspace,
+	clearCachesCommand:              executeClearCaches,
+	showServerStatusCommand:         executeShowServerStatus,
+	organizeUnitsInWorkspaceCommand: executeOrganizeUnitsInWorkspace,
+	runScriptCommand:                executeRunScript,
+}
+
+// serverStatus is the result of dws.showServerStatus.
+type serverStatus struct {
+	Version           string   `json:"version"`
+	WorkspaceFolders  []string `json:"workspaceFolders"`
+	OpenDocuments     int      `json:"openDocuments"`
+	IndexedFiles      int      `json:"indexedFiles"`
+	IndexedSymbols    int      `json:"indexedSymbols"`
+	FilesWithProblems int      `json:"filesWithProblems"`
+}
+
+// organizeUnitsResult is the result of dws.organizeUnitsInWorkspace.
+type organizeUnitsResult struct {
+	// ChangedFiles is the number of files whose uses clauses were changed
+	ChangedFiles int  `json:"changedFiles"`
+	Applied      bool `json:"applied"`
+}
+
+// scriptResult is the result of dws.runScript.
+type scriptResult struct {
+	Output  string `json:"output"`
+	Success bool   `json:"success"`
+
+	// Error is the compile or runtime error that stopped the script
+	Error string `json:"error,omitempty"`
+}
+
+// serverCommandNames returns the names of the server commands, sorted.
+func serverCommandNames() []string {
+	names := make([]string, 0, len(serverCommands))
+	for name := range serverCommands {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ExecuteCommand handles the workspace/executeCommand request.
+// It runs one of the server commands, which code lenses and code actions
+// refer to, and returns its result.
+func ExecuteCommand(context *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in ExecuteCommand")
+		return nil, nil
+	}
+
+	command, ok := serverCommands[params.Command]
+	if !ok {
+		log.Printf("Unknown command: %s\n", params.Command)
+		return nil, fmt.Errorf("unknown command: %s", params.Command)
+	}
+
+	log.Printf("ExecuteCommand request for %s with %d arguments\n", params.Command, len(params.Arguments))
+
+	return command(context, srv, params)
+}
+
+// executeReindexWorkspace discards the workspace index and indexes all
+// workspace folders again. Indexing continues in the background.
+func executeReindexWorkspace(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error) {
+	if len(srv.GetWorkspaceFolders()) == 0 {
+		return nil, errors.New("no workspace folder to index")
+	}
+
+	reindexWorkspace(context, srv, false)
+
+	return nil, nil
+}
+
+// executeClearCaches empties the completion and semantic tokens caches and
+// deletes the index caches of the workspace folders, so that the next indexing
+// run compiles every file.
+func executeClearCaches(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error) {
+	if srv.CompletionCache() != nil {
+		srv.CompletionCache().Clear()
+	}
+
+	if srv.SemanticTokensCache() != nil {
+		srv.SemanticTokensCache().Clear()
+	}
+
+	for _, folder := range srv.GetWorkspaceFolders() {
+		if err := workspace.RemoveIndexCache(srv.Config().IndexCacheDir, folder); err != nil {
+			return nil, fmt.Errorf("failed to remove the index cache of %s: %w", folder, err)
+		}
+	}
+
+	log.Println("Caches cleared")
+
+	return nil, nil
+}
+
+// executeShowServerStatus shows a summary of the server's state to the user
+// and returns the details.
+func executeShowServerStatus(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error) {
+	status := serverStatus{
+		Version:           serverVersion,
+		WorkspaceFolders:  srv.GetWorkspaceFolders(),
+		OpenDocuments:     len(srv.Documents().List()),
+		IndexedFiles:      srv.WorkspaceIndex().GetFileCount(),
+		IndexedSymbols:    srv.WorkspaceIndex().GetSymbolCount(),
+		FilesWithProblems: len(filesWithProblems(srv)),
+	}
+
+	for _, uri := range srv.Documents().List() {
+		if doc, open := srv.Documents().Get(uri); open && len(doc.Diagnostics) > 0 {
+			status.FilesWithProblems++
+		}
+	}
+
+	if context != nil && context.Notify != nil {
+		context.Notify(protocol.ServerWindowShowMessage, protocol.ShowMessageParams{
+			Type: protocol.MessageTypeInfo,
+			Message: fmt.Sprintf("go-dws-lsp %s: %d workspace folders, %d open documents, %d indexed files (%d symbols), %d files with problems",
+				status.Version, len(status.WorkspaceFolders), status.OpenDocuments,
+				status.IndexedFiles, status.IndexedSymbols, status.FilesWithProblems),
+		})
+	}
+
+	return status, nil
+}
+
+// executeOrganizeUnitsInWorkspace organizes the uses clauses of all open
+// documents and workspace files, like the "Organize units" source action does
+// for one document, and asks the client to apply the edits.
+func executeOrganizeUnitsInWorkspace(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error) {
+	if !srv.SupportsApplyEdit() || context == nil || context.Call == nil {
+		return nil, errors.New("the client can't apply workspace edits")
+	}
+
+	ctx := requestContext(srv, context)
+
+	uris := append(srv.Documents().List(), srv.Diagnostics().List()...)
+	slices.Sort(uris)
+	uris = slices.Compact(uris)
+
+	progress := beginRequestProgress(context, srv, params.WorkDoneToken, "Organizing units")
+
+	var documentChanges []any
+
+	for i, uri := range uris {
+		if ctx.Err() != nil {
+			progress.end("Cancelled")
+			log.Println("Organizing units in the workspace cancelled")
+
+			return nil, ctx.Err()
+		}
+
+		progress.report(fmt.Sprintf("%d/%d files", i+1, len(uris)), i+1, len(uris))
+
+		doc, open := organizableDocument(srv, uri)
+		if doc == nil {
+			continue
+		}
+
+		edit := organizeUsesClause(doc.Text, uri, srv.WorkspaceIndex(), doc)
+		if edit == nil {
+			continue
+		}
+
+		// The edits of open documents only apply to the version they were made for
+		var version *int32
+
+		if open {
+			v := int32(doc.Version)
+			version = &v
+		}
+
+		documentChanges = append(documentChanges, protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				Version:                version,
+			},
+			Edits: convertToEdits(edit.Changes[uri]),
+		})
+	}
+
+	progress.end(fmt.Sprintf("Organized units in %d files", len(documentChanges)))
+
+	result := organizeUnitsResult{ChangedFiles: len(documentChanges)}
+	if len(documentChanges) == 0 {
+		return result, nil
+	}
+
+	var response protocol.ApplyWorkspaceEditResponse
+
+	label := "Organize units in workspace"
+	context.Call(protocol.ServerWorkspaceApplyEdit, protocol.ApplyWorkspaceEditParams{
+		Label: &label,
+		Edit:  protocol.WorkspaceEdit{DocumentChanges: documentChanges},
+	}, &response)
+
+	if !response.Applied {
+		reason := "no reason given"
+		if response.FailureReason != nil {
+			reason = *response.FailureReason
+		}
+
+		log.Printf("The client didn't apply the organized units: %s\n", reason)
+	}
+
+	result.Applied = response.Applied
+
+	return result, nil
+}
+
+// organizableDocument returns the document whose uses clause is organized for
+// uri and whether it is open: the open document, or the workspace file
+// compiled from disk. It returns nil if the file can't be read.
+func organizableDocument(srv *server.Server, uri string) (*server.Document, bool) {
+	if doc, open := getAnalyzedDocument(srv, uri); open {
+		// Like the source action, names are looked up in the last good program
+		if doc.Program == nil && doc.LastGoodProgram != nil {
+			fallback := *doc
+			fallback.Program = doc.LastGoodProgram
+
+			return &fallback, true
+		}
+
+		return doc, true
+	}
+
+	content, err := os.ReadFile(uriToPath(uri))
+	if err != nil {
+		log.Printf("Warning: Could not read file %s: %v\n", uri, err)
+		return nil, false
+	}
+
+	// A file with errors still gets its units sorted
+	program, _, err := analysis.ParseDocument(string(content), uri)
+	if err != nil {
+		log.Printf("Error compiling workspace file %s: %v", uri, err)
+	}
+
+	return &server.Document{URI: uri, Text: string(content), Program: program}, false
+}
+
+// executeRunScript compiles and runs the script whose URI is the first
+// argument, taking the text of an open document or the file on disk, and
+// returns its output. It fails if the script doesn't finish in time.
+func executeRunScript(context *glsp.Context, srv *server.Server, params *protocol.ExecuteCommandParams) (any, error) {
+	if len(params.Arguments) == 0 {
+		return nil, errors.New("missing script URI")
+	}
+
+	uri, ok := params.Arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid script URI: %v", params.Arguments[0])
+	}
+
+	var text string
+
+	if doc, open := srv.Documents().Get(uri); open {
+		text = doc.Text
+	} else {
+		content, err := os.ReadFile(uriToPath(uri))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read script %s: %w", uri, err)
+		}
+
+		text = string(content)
+	}
+
+	log.Printf("Running script %s\n", uri)
+
+	result, err := runScriptProcess(requestContext(srv, context), text)
+	if err != nil {
+		log.Printf("Script %s stopped: %v\n", uri, err)
+		return nil, err
+	}
+
+	log.Printf("Script %s finished (success: %v)\n", uri, result.Success)
+
+	return result, nil
+}
+
+// runScriptProcess runs a script in a child process, see ScriptRunnerEnv. The
+// process is killed if the script doesn't finish in time or ctx is cancelled.
+func runScriptProcess(ctx contextpkg.Context, text string) (scriptResult, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return scriptResult{}, fmt.Errorf("cannot start script process: %w", err)
+	}
+
+	runCtx, cancel := contextpkg.WithTimeout(ctx, runScriptTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(runCtx, executable)
+	cmd.Env = append(os.Environ(), ScriptRunnerEnv+"=1")
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+
+	err = cmd.Run()
+
+	switch {
+	case ctx.Err() != nil:
+		return scriptResult{}, ctx.Err()
+	case runCtx.Err() != nil:
+		return scriptResult{}, fmt.Errorf("script did not finish within %v", runScriptTimeout)
+	case err != nil:
+		return scriptResult{}, fmt.Errorf("script process failed: %w", err)
+	}
+
+	var result scriptResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return scriptResult{}, fmt.Errorf("invalid script process output: %w", err)
+	}
+
+	return result, nil
+}
+
+// RunScriptProcess runs the script read from stdin and writes its result to
+// stdout as JSON. It is the main function of the process started to run a
+// script, see ScriptRunnerEnv, and returns its exit code.
+func RunScriptProcess(stdin io.Reader, stdout io.Writer) int {
+	// The server's log is the parent's; the script's output goes to its result
+	log.SetOutput(io.Discard)
+
+	text, err := io.ReadAll(stdin)
+	if err != nil {
+		return 1
+	}
+
+	if err := json.NewEncoder(stdout).Encode(runScript(string(text))); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// runScript compiles and runs a script with a new engine, capturing its output.
+// A panic in the interpreter is reported as the error that stopped the script.
+func runScript(text string) (result scriptResult) {
+	var output strings.Builder
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic while running script: %v\n", r)
+			result = scriptResult{Output: output.String(), Error: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	engine, err := dwscript.New(dwscript.WithOutput(&output))
+	if err != nil {
+		return scriptResult{Error: err.Error()}
+	}
+
+	program, err := engine.Compile(text)
+	if err != nil {
+		return scriptResult{Error: err.Error()}
+	}
+
+	run, err := engine.Run(program)
+	if err != nil {
+		return scriptResult{Output: output.String(), Error: err.Error()}
+	}
+
+	return scriptResult{Output: output.String(), Success: run.Success}
+}
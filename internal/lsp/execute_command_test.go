@@ -0,0 +1,277 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// TestMain runs scripts when the test binary is started as the process
+// running a script, like the server binary does.
+func TestMain(m *testing.M) {
+	if os.Getenv(ScriptRunnerEnv) != "" {
+		os.Exit(RunScriptProcess(os.Stdin, os.Stdout))
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestExecuteCommand_Unknown(t *testing.T) {
+	SetServer(server.New())
+
+	if _, err := ExecuteCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{Command: "dws.unknown"}); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+}
+
+func TestExecuteCommand_RunScript(t *testing.T) {
+	SetServer(server.New())
+
+	tests := []struct {
+		name    string
+		text    string
+		output  string
+		success bool
+	}{
+		{"prints", "PrintLn('Hello');\nPrintLn(1 + 2);\n", "Hello\n3\n", true},
+		{"compile error", "var x: Integer;\nx := ;\n", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "file:///" + strings.ReplaceAll(tt.name, " ", "_") + ".dws"
+
+			err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+				TextDocument: protocol.TextDocumentItem{URI: uri, Text: tt.text},
+			})
+			if err != nil {
+				t.Fatalf("DidOpen failed: %v", err)
+			}
+
+			result, err := ExecuteCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{
+				Command:   runScriptCommand,
+				Arguments: []any{uri},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand failed: %v", err)
+			}
+
+			script, ok := result.(scriptResult)
+			if !ok {
+				t.Fatalf("Expected a script result, got %T", result)
+			}
+
+			if script.Success != tt.success || script.Output != tt.output {
+				t.Errorf("Expected output %q (success: %v), got %+v", tt.output, tt.success, script)
+			}
+
+			if !tt.success && script.Error == "" {
+				t.Error("Expected the error that stopped the script")
+			}
+		})
+	}
+
+	if _, err := ExecuteCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{Command: runScriptCommand}); err == nil {
+		t.Error("Expected an error without a script URI")
+	}
+
+}
+
+func TestExecuteCommand_RunScriptTimeout(t *testing.T) {
+	SetServer(server.New())
+
+	timeout := runScriptTimeout
+	runScriptTimeout = 500 * time.Millisecond
+
+	t.Cleanup(func() { runScriptTimeout = timeout })
+
+	uri := "file:///forever.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: "var i := 0;\nwhile True do\n  i := i + 1;\n"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	// The process running the endless loop is killed, so the command returns
+	start := time.Now()
+
+	_, err = ExecuteCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{
+		Command:   runScriptCommand,
+		Arguments: []any{uri},
+	})
+	if err == nil || !strings.Contains(err.Error(), "did not finish") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the script to be stopped after the timeout, took %v", elapsed)
+	}
+}
+
+func TestExecuteCommand_ShowServerStatus(t *testing.T) {
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{"/work"})
+	SetServer(srv)
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: "file:///work/broken.dws", Text: brokenContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	var message string
+
+	result, err := ExecuteCommand(&glsp.Context{
+		Notify: func(method string, params any) {
+			if method == protocol.ServerWindowShowMessage {
+				message = params.(protocol.ShowMessageParams).Message
+			}
+		},
+	}, &protocol.ExecuteCommandParams{Command: showServerStatusCommand})
+	if err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	status, ok := result.(serverStatus)
+	if !ok || status.Version != serverVersion || status.OpenDocuments != 1 || status.FilesWithProblems != 1 {
+		t.Errorf("Expected the status with 1 open document with problems, got %+v", result)
+	}
+
+	if !strings.Contains(message, "1 open documents") {
+		t.Errorf("Expected the status to be shown, got %q", message)
+	}
+}
+
+func TestExecuteCommand_ClearCaches(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "a.dws"), []byte("var Alpha: Integer;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{dir})
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexCacheDir = cacheDir
+	})
+	SetServer(srv)
+
+	workspace.IndexWorkspace(context.Background(), srv.WorkspaceIndex(),
+		[]protocol.WorkspaceFolder{{URI: pathToURI(dir), Name: "root"}}, indexOptions(srv))
+
+	if entries, _ := os.ReadDir(cacheDir); len(entries) == 0 {
+		t.Fatal("Expected an index cache to be written")
+	}
+
+	if _, err := ExecuteCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{Command: clearCachesCommand}); err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("Expected the index cache to be removed, got %d files", len(entries))
+	}
+}
+
+func TestExecuteCommand_OrganizeUnitsInWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	closedPath := filepath.Join(dir, "closed.dws")
+
+	if err := os.WriteFile(closedPath, []byte("uses Zeta, Alpha;\nvar x: Integer;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var capabilities protocol.ClientCapabilities
+	if err := json.Unmarshal([]byte(`{"workspace":{"applyEdit":true}}`), &capabilities); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New()
+	srv.SetClientCapabilities(&capabilities)
+	SetServer(srv)
+
+	closed := pathToURI(closedPath)
+	srv.Diagnostics().SetDiagnostics(closed, "1", nil)
+
+	open := "file:///open.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: open, Version: 3, Text: "uses Beta, Alpha;\nvar y: Integer;\n"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	var applied protocol.WorkspaceEdit
+
+	glspContext := &glsp.Context{
+		Call: func(method string, params any, result any) {
+			if method != protocol.ServerWorkspaceApplyEdit {
+				return
+			}
+
+			applied = params.(protocol.ApplyWorkspaceEditParams).Edit
+			result.(*protocol.ApplyWorkspaceEditResponse).Applied = true
+		},
+	}
+
+	result, err := ExecuteCommand(glspContext, &protocol.ExecuteCommandParams{Command: organizeUnitsInWorkspaceCommand})
+	if err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	if organized, ok := result.(organizeUnitsResult); !ok || organized.ChangedFiles != 2 || !organized.Applied {
+		t.Errorf("Expected 2 changed files to be applied, got %+v", result)
+	}
+
+	// The open document's edits are for its version, the closed file has none
+	version := int32(3)
+	expected := map[string]struct {
+		text    string
+		version *int32
+	}{
+		closed: {text: "uses Alpha, Zeta;"},
+		open:   {text: "uses Alpha, Beta;", version: &version},
+	}
+
+	if len(applied.DocumentChanges) != len(expected) {
+		t.Fatalf("Expected %d document changes, got %+v", len(expected), applied.DocumentChanges)
+	}
+
+	for _, change := range applied.DocumentChanges {
+		docEdit, ok := change.(protocol.TextDocumentEdit)
+		if !ok {
+			t.Fatalf("Expected a TextDocumentEdit, got %T", change)
+		}
+
+		uri := docEdit.TextDocument.URI
+		want := expected[uri]
+
+		if got := docEdit.TextDocument.Version; (got == nil) != (want.version == nil) || (got != nil && *got != *want.version) {
+			t.Errorf("Expected %s to be edited at version %v, got %v", uri, want.version, got)
+		}
+
+		if len(docEdit.Edits) != 1 || docEdit.Edits[0].(protocol.TextEdit).NewText != want.text {
+			t.Errorf("Expected %s to get %q, got %+v", uri, want.text, docEdit.Edits)
+		}
+	}
+
+	// Without applyEdit support the command can't do anything
+	SetServer(server.New())
+
+	if _, err := ExecuteCommand(glspContext, &protocol.ExecuteCommandParams{Command: organizeUnitsInWorkspaceCommand}); err == nil {
+		t.Error("Expected an error for a client without applyEdit support")
+	}
+}
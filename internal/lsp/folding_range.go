@@ -0,0 +1,70 @@
+package lsp
+
+import (
+	"log"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// FoldingRange handles the textDocument/foldingRange request.
+// It returns ranges for blocks and declarations from the syntax tree, and for
+// comments, regions and declaration sections from a scan of the text.
+func FoldingRange(context *glsp.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in FoldingRange")
+		return []protocol.FoldingRange{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("FoldingRange request for %s\n", uri)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for folding ranges: %s\n", uri)
+		return []protocol.FoldingRange{}, nil
+	}
+
+	// Comments and sections are found in the current text, which needn't compile
+	textRanges := analysis.TextFoldingRanges(doc.Text)
+
+	// Use the partial AST or the last good program for blocks
+	syntax, positions := doc.SyntaxView()
+	blockRanges := mapFoldingRangesToCurrent(analysis.BlockFoldingRanges(syntax.AST()), positions)
+
+	ranges := analysis.MergeFoldingRanges(blockRanges, textRanges)
+
+	log.Printf("Found %d folding ranges in %s\n", len(ranges), uri)
+
+	return ranges, nil
+}
+
+// mapFoldingRangesToCurrent translates folding ranges from the analyzed
+// snapshot to the current text, dropping those whose lines were edited.
+func mapFoldingRangesToCurrent(ranges []protocol.FoldingRange, positions *document.PositionMap) []protocol.FoldingRange {
+	if positions == nil {
+		return ranges
+	}
+
+	mapped := make([]protocol.FoldingRange, 0, len(ranges))
+
+	for _, foldingRange := range ranges {
+		rng, ok := positions.RangeToCurrent(protocol.Range{
+			Start: protocol.Position{Line: foldingRange.StartLine},
+			End:   protocol.Position{Line: foldingRange.EndLine},
+		})
+		if !ok || rng.End.Line <= rng.Start.Line {
+			continue
+		}
+
+		foldingRange.StartLine = rng.Start.Line
+		foldingRange.EndLine = rng.End.Line
+		mapped = append(mapped, foldingRange)
+	}
+
+	return mapped
+}
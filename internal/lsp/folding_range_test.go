@@ -0,0 +1,87 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestFoldingRange(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := "file:///folding.dws"
+	content := `{ header
+  comment }
+procedure Foo;
+begin
+  PrintLn('a');
+  PrintLn('b');
+end;`
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	ranges, err := FoldingRange(&glsp.Context{}, &protocol.FoldingRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("FoldingRange failed: %v", err)
+	}
+
+	expected := []struct {
+		start, end protocol.UInteger
+	}{
+		{0, 1}, // comment
+		{2, 5}, // procedure
+		{3, 5}, // begin
+	}
+
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %d folding ranges, got %+v", len(expected), ranges)
+	}
+
+	for i, foldingRange := range ranges {
+		if foldingRange.StartLine != expected[i].start || foldingRange.EndLine != expected[i].end {
+			t.Errorf("Range %d: got %d-%d, expected %d-%d", i,
+				foldingRange.StartLine, foldingRange.EndLine, expected[i].start, expected[i].end)
+		}
+	}
+
+	if ranges[0].Kind == nil || *ranges[0].Kind != string(protocol.FoldingRangeKindComment) {
+		t.Errorf("Expected the first range to be a comment, got %v", ranges[0].Kind)
+	}
+}
+
+func TestFoldingRange_SyntaxError(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := "file:///folding_broken.dws"
+	content := "// one\n// two\nbegin\n  x := ;\n"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	ranges, err := FoldingRange(&glsp.Context{}, &protocol.FoldingRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("FoldingRange failed: %v", err)
+	}
+
+	// Comments are still folded when the document doesn't compile
+	if len(ranges) == 0 || ranges[0].StartLine != 0 || ranges[0].EndLine != 1 {
+		t.Errorf("Expected the comment run to be folded, got %+v", ranges)
+	}
+}
@@ -0,0 +1,285 @@
+package lsp
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/format"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// DocumentFormatting handles the textDocument/formatting request.
+// It returns the edits that format the whole document.
+func DocumentFormatting(context *glsp.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentFormatting")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("DocumentFormatting request for %s\n", uri)
+
+	doc, exists := srv.Documents().Get(uri)
+	if !exists {
+		log.Printf("Document not found for formatting: %s\n", uri)
+		return nil, nil
+	}
+
+	edits, err := format.DocumentEdits(doc.Text, formatOptions(params.Options))
+	if err != nil {
+		logFormatError(uri, err)
+		return nil, nil
+	}
+
+	log.Printf("DocumentFormatting: %d edit(s) for %s\n", len(edits), uri)
+
+	return edits, nil
+}
+
+// DocumentRangeFormatting handles the textDocument/rangeFormatting request.
+// It returns the formatting edits of the lines in the requested range.
+func DocumentRangeFormatting(context *glsp.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentRangeFormatting")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("DocumentRangeFormatting request for %s lines %d-%d\n", uri, params.Range.Start.Line, params.Range.End.Line)
+
+	doc, exists := srv.Documents().Get(uri)
+	if !exists {
+		log.Printf("Document not found for range formatting: %s\n", uri)
+		return nil, nil
+	}
+
+	edits, err := format.RangeEdits(doc.Text, params.Range, formatOptions(params.Options))
+	if err != nil {
+		logFormatError(uri, err)
+		return nil, nil
+	}
+
+	log.Printf("DocumentRangeFormatting: %d edit(s) for %s\n", len(edits), uri)
+
+	return edits, nil
+}
+
+// closingKeywords are the keywords that line up with the construct they close,
+// so a line starting with one is re-indented when a new line is started after it.
+var closingKeywords = []string{"end", "else", "until", "except", "finally"}
+
+// OnTypeFormatting handles the textDocument/onTypeFormatting request.
+// It re-indents the line being typed to match the block structure: a new line
+// is indented for the block it is in, and a line is re-indented when it is
+// ended with a semicolon or when end is typed at its start.
+func OnTypeFormatting(context *glsp.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in OnTypeFormatting")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+
+	log.Printf("OnTypeFormatting request for %s at %d:%d, ch=%q\n", uri, position.Line, position.Character, params.Ch)
+
+	doc, exists := srv.Documents().Get(uri)
+	if !exists {
+		log.Printf("Document not found for on-type formatting: %s\n", uri)
+		return nil, nil
+	}
+
+	lines := strings.Split(doc.Text, "\n")
+
+	line := int(position.Line)
+	if line >= len(lines) {
+		return nil, nil
+	}
+
+	options := onTypeFormatOptions(params.Options, lines, line)
+
+	var reindent []int
+
+	switch params.Ch {
+	case "\n":
+		// The line that was ended may start with a keyword closing a block
+		if line > 0 && startsWithClosingKeyword(lines[line-1]) {
+			reindent = append(reindent, line-1)
+		}
+
+		reindent = append(reindent, line)
+
+	case ";":
+		reindent = append(reindent, line)
+
+	case "d":
+		if typedEnd(lines[line], int(position.Character)) {
+			reindent = append(reindent, line)
+		}
+	}
+
+	var edits []protocol.TextEdit
+
+	for _, l := range reindent {
+		if edit, ok := reindentLine(doc.Text, lines[l], l, options); ok {
+			edits = append(edits, edit)
+		}
+	}
+
+	return edits, nil
+}
+
+// indentContextLines is how many lines around the line being formatted on
+// type are used to detect the indentation unit.
+const indentContextLines = 10
+
+// onTypeFormatOptions returns the formatting options for on-type formatting.
+// Clients that don't send an indentation size get the one used around the
+// line, or the default if it can't be told.
+func onTypeFormatOptions(options protocol.FormattingOptions, lines []string, line int) format.Options {
+	opts := formatOptions(options)
+
+	if _, ok := options[protocol.FormattingOptionTabSize]; !ok {
+		if unit := indentUnit(lines, line); unit > 0 {
+			opts.TabSize = unit
+		}
+	}
+
+	return opts
+}
+
+// indentUnit returns the indentation unit of the lines around a line: the
+// greatest common divisor of the changes in leading width between
+// consecutive non-blank lines, ignoring the line itself. It returns 0 if the
+// width never changes, e.g. inside a deeply nested block.
+func indentUnit(lines []string, line int) int {
+	unit := 0
+	previous := -1
+
+	for i := max(0, line-indentContextLines); i < len(lines) && i <= line+indentContextLines; i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if i == line || strings.TrimSpace(trimmed) == "" || strings.HasPrefix(trimmed, "\t") {
+			continue
+		}
+
+		width := len(lines[i]) - len(trimmed)
+		if previous >= 0 && width > previous {
+			unit = gcd(unit, width-previous)
+		} else if previous >= 0 && width < previous {
+			unit = gcd(unit, previous-width)
+		}
+
+		previous = width
+	}
+
+	return unit
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// reindentLine returns the edit replacing the indentation of a line with the
+// one the formatter would use, or false if it is already indented that way.
+func reindentLine(text, lineText string, line int, options format.Options) (protocol.TextEdit, bool) {
+	indent, ok := format.Indentation(text, line, options)
+	if !ok {
+		return protocol.TextEdit{}, false
+	}
+
+	current := lineText[:len(lineText)-len(strings.TrimLeft(lineText, " \t"))]
+	if current == indent {
+		return protocol.TextEdit{}, false
+	}
+
+	return protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(line), Character: 0},
+			End:   protocol.Position{Line: uint32(line), Character: uint32(len(current))},
+		},
+		NewText: indent,
+	}, true
+}
+
+// startsWithClosingKeyword reports whether a line starts with one of closingKeywords.
+func startsWithClosingKeyword(line string) bool {
+	word := leadingWord(line)
+
+	for _, keyword := range closingKeywords {
+		if strings.EqualFold(word, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typedEnd reports whether the cursor at character is right after an end
+// that starts the line, i.e. the d just typed completed the keyword.
+func typedEnd(line string, character int) bool {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+	return strings.EqualFold(leadingWord(line), "end") && character == indent+len("end")
+}
+
+// leadingWord returns the identifier a line starts with, after its indentation.
+func leadingWord(line string) string {
+	trimmed := strings.TrimLeft(line, " \t")
+
+	end := 0
+	for end < len(trimmed) && isIdentifierChar(trimmed[end]) {
+		end++
+	}
+
+	return trimmed[:end]
+}
+
+// formatOptions converts the client's formatting options.
+func formatOptions(options protocol.FormattingOptions) format.Options {
+	opts := format.Options{TabSize: 2, InsertSpaces: true}
+
+	switch tabSize := options[protocol.FormattingOptionTabSize].(type) {
+	case float64:
+		opts.TabSize = int(tabSize)
+	case int:
+		opts.TabSize = tabSize
+	case protocol.UInteger:
+		opts.TabSize = int(tabSize)
+	}
+
+	if insertSpaces, ok := options[protocol.FormattingOptionInsertSpaces].(bool); ok {
+		opts.InsertSpaces = insertSpaces
+	}
+
+	return opts
+}
+
+// logFormatError logs why a document wasn't formatted. Documents with syntax
+// errors are left alone, since their structure is unknown.
+func logFormatError(uri string, err error) {
+	if errors.Is(err, format.ErrSyntax) {
+		log.Printf("Not formatting %s: %v\n", uri, err)
+		return
+	}
+
+	log.Printf("Error formatting %s: %v\n", uri, err)
+}
+
+// isIdentifierChar checks if a byte can be part of an identifier.
+func isIdentifierChar(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') ||
+		(ch >= 'A' && ch <= 'Z') ||
+		(ch >= '0' && ch <= '9') ||
+		ch == '_'
+}
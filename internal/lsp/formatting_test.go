@@ -0,0 +1,229 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func openFormattingDocument(t *testing.T, uri, content string) {
+	t.Helper()
+
+	srv := server.New()
+	SetServer(srv)
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+}
+
+// applyEdits applies non-overlapping edits to text, last edit first.
+func applyEdits(t *testing.T, text string, edits []protocol.TextEdit) string {
+	t.Helper()
+
+	for i := len(edits) - 1; i >= 0; i-- {
+		var err error
+
+		text, err = document.ApplyContentChange(text, protocol.TextDocumentContentChangeEvent{
+			Range: &edits[i].Range,
+			Text:  edits[i].NewText,
+		})
+		if err != nil {
+			t.Fatalf("Failed to apply edit %+v: %v", edits[i], err)
+		}
+	}
+
+	return text
+}
+
+func TestDocumentFormatting(t *testing.T) {
+	uri := "file:///format.dws"
+	content := "procedure Foo;\nbegin\nif True then\nPrintLn('x');\nend;"
+	openFormattingDocument(t, uri, content)
+
+	edits, err := DocumentFormatting(&glsp.Context{}, &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Options: protocol.FormattingOptions{
+			protocol.FormattingOptionTabSize:      float64(4),
+			protocol.FormattingOptionInsertSpaces: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DocumentFormatting failed: %v", err)
+	}
+
+	expected := "procedure Foo;\nbegin\n    if True then\n        PrintLn('x');\nend;"
+	if got := applyEdits(t, content, edits); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestDocumentRangeFormatting(t *testing.T) {
+	uri := "file:///range_format.dws"
+	content := "begin\nx:=1;\ny:=2;\nend;"
+	openFormattingDocument(t, uri, content)
+
+	edits, err := DocumentRangeFormatting(&glsp.Context{}, &protocol.DocumentRangeFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 2, Character: 0},
+			End:   protocol.Position{Line: 2, Character: 5},
+		},
+		Options: protocol.FormattingOptions{
+			protocol.FormattingOptionTabSize:      float64(2),
+			protocol.FormattingOptionInsertSpaces: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DocumentRangeFormatting failed: %v", err)
+	}
+
+	expected := "begin\nx:=1;\n  y := 2;\nend;"
+	if got := applyEdits(t, content, edits); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestDocumentFormatting_SyntaxError(t *testing.T) {
+	uri := "file:///broken_format.dws"
+	openFormattingDocument(t, uri, "begin\nx := ;\n")
+
+	edits, err := DocumentFormatting(&glsp.Context{}, &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DocumentFormatting failed: %v", err)
+	}
+
+	if len(edits) != 0 {
+		t.Errorf("Expected no edits for a document with syntax errors, got %+v", edits)
+	}
+}
+
+func TestOnTypeFormatting(t *testing.T) {
+	options := protocol.FormattingOptions{
+		protocol.FormattingOptionTabSize:      float64(2),
+		protocol.FormattingOptionInsertSpaces: true,
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		position protocol.Position
+		ch       string
+		expected string
+	}{
+		{
+			name:     "newline after begin",
+			content:  "begin\n",
+			position: protocol.Position{Line: 1, Character: 0},
+			ch:       "\n",
+			expected: "begin\n  ",
+		},
+		{
+			name:     "end aligns with begin",
+			content:  "begin\n  x := 1;\n  end",
+			position: protocol.Position{Line: 2, Character: 5},
+			ch:       "d",
+			expected: "begin\n  x := 1;\nend",
+		},
+		{
+			name:     "d of an identifier",
+			content:  "begin\n  x := 1;\n  Send",
+			position: protocol.Position{Line: 2, Character: 6},
+			ch:       "d",
+			expected: "begin\n  x := 1;\n  Send",
+		},
+		{
+			name:     "semicolon after then",
+			content:  "begin\n  if x then\n  Foo;",
+			position: protocol.Position{Line: 2, Character: 6},
+			ch:       ";",
+			expected: "begin\n  if x then\n    Foo;",
+		},
+		{
+			name:     "newline after else",
+			content:  "begin\n  if x then\n    Foo\n    else\n",
+			position: protocol.Position{Line: 4, Character: 0},
+			ch:       "\n",
+			expected: "begin\n  if x then\n    Foo\n  else\n    ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "file:///on_type.dws"
+			openFormattingDocument(t, uri, tt.content)
+
+			edits, err := OnTypeFormatting(&glsp.Context{}, &protocol.DocumentOnTypeFormattingParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+				Ch:      tt.ch,
+				Options: options,
+			})
+			if err != nil {
+				t.Fatalf("OnTypeFormatting failed: %v", err)
+			}
+
+			if got := applyEdits(t, tt.content, edits); got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOnTypeFormatting_DetectsIndentUnit(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		position protocol.Position
+		expected string
+	}{
+		{
+			name: "nested block",
+			content: "begin\n    x := 1;\n    if a then begin\n        y := 2;\n        if b then begin\n" +
+				"            z := 3;\n            w := 4;\n            if c then\n            Foo;",
+			position: protocol.Position{Line: 8, Character: 16},
+			expected: "begin\n    x := 1;\n    if a then begin\n        y := 2;\n        if b then begin\n" +
+				"            z := 3;\n            w := 4;\n            if c then\n                Foo;",
+		},
+		{
+			name:     "default without nearby indentation",
+			content:  "if a then\nFoo;",
+			position: protocol.Position{Line: 1, Character: 4},
+			expected: "if a then\n  Foo;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "file:///on_type_unit.dws"
+			openFormattingDocument(t, uri, tt.content)
+
+			// Without a tab size the unit comes from the surrounding lines
+			edits, err := OnTypeFormatting(&glsp.Context{}, &protocol.DocumentOnTypeFormattingParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+				Ch:      ";",
+				Options: protocol.FormattingOptions{protocol.FormattingOptionInsertSpaces: true},
+			})
+			if err != nil {
+				t.Fatalf("OnTypeFormatting failed: %v", err)
+			}
+
+			if got := applyEdits(t, tt.content, edits); got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
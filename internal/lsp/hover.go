@@ -31,18 +31,26 @@ func Hover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover
 		uri, position.Line, position.Character)
 
 	// Retrieve document from DocumentStore
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for hover: %s\n", uri)
 		return nil, nil //nolint:nilnil // nil is valid LSP response for no hover
 	}
 
+	// Use the last good program if the current text doesn't compile
+	doc, positions := doc.AnalysisView()
+
 	// Check if document and AST are available
 	if doc.Program == nil {
 		log.Printf("No AST available for hover (document has parse errors): %s\n", uri)
 		return nil, nil //nolint:nilnil // nil is valid LSP response for no hover
 	}
 
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return nil, nil //nolint:nilnil // nil is valid LSP response for no hover
+	}
+
 	// Get AST from Program
 	programAST := doc.Program.AST()
 	if programAST == nil {
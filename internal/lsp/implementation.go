@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"log"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Implementation handles the textDocument/implementation request.
+// On a method declaration or call it returns the implementations of the
+// method across the workspace: for a class method its own body and the
+// overriding methods of descendant classes, for an interface method the
+// methods of the classes implementing it.
+func Implementation(context *glsp.Context, params *protocol.ImplementationParams) (any, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in Implementation")
+		return []protocol.Location{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+	log.Printf("Implementation request at %s line %d, character %d\n", uri, position.Line, position.Character)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for implementation: %s\n", uri)
+		return []protocol.Location{}, nil
+	}
+
+	hierarchy := newTypeHierarchy(srv)
+
+	member := declaredMember(hierarchy, uri, position)
+	if member == nil {
+		member = calledMember(srv, doc, hierarchy, uri, position)
+	}
+
+	if member == nil {
+		log.Printf("No method at %s line %d, character %d\n", uri, position.Line, position.Character)
+		return []protocol.Location{}, nil
+	}
+
+	locations := hierarchy.routineLocations(hierarchy.types.Implementations(*member))
+
+	log.Printf("Found %d implementations of %s.%s\n", len(locations), member.Type.Name().Value, member.Name)
+
+	return locations, nil
+}
+
+// declaredMember returns the method declared at position in uri, looked at
+// through the document's SyntaxView like the rest of hierarchy.
+func declaredMember(hierarchy *typeHierarchy, uri string, position protocol.Position) *analysis.Member {
+	if positions := hierarchy.positions[uri]; positions != nil {
+		var ok bool
+		if position, ok = toSnapshotPosition(positions, position); !ok {
+			return nil
+		}
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	return hierarchy.types.MemberAt(uri, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+}
+
+// calledMember returns the method called at position in uri. Calls are
+// resolved in the document's AnalysisView, as they need the types of
+// variables.
+func calledMember(srv *server.Server, doc *server.Document, hierarchy *typeHierarchy, uri string, position protocol.Position) *analysis.Member {
+	view, positions := doc.AnalysisView()
+	if view.Program == nil {
+		return nil
+	}
+
+	position, ok := toSnapshotPosition(positions, position)
+	if !ok {
+		return nil
+	}
+
+	resolver := analysis.NewCallResolver(srv.Documents(), srv.WorkspaceIndex())
+	openAnalysisViews(srv, resolver.SetProgram)
+
+	// Convert LSP (0-based) to AST (1-based)
+	typeName, name := resolver.CalledMember(uri, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if typeName == "" {
+		return nil
+	}
+
+	typeDecl := hierarchy.types.FindType(uri, typeName)
+	if typeDecl == nil {
+		return nil
+	}
+
+	return &analysis.Member{Type: *typeDecl, Name: name}
+}
+
+// routineLocations returns the locations of the names of routines, dropping
+// those that have been edited since the document was last parsed.
+func (h *typeHierarchy) routineLocations(routines []analysis.Routine) []protocol.Location {
+	locations := []protocol.Location{}
+
+	for _, routine := range routines {
+		if location, ok := h.location(routine.URI, routine.Decl.Name); ok {
+			locations = append(locations, location)
+		}
+	}
+
+	return locations
+}
+
+// location returns the location of name in uri in the current text.
+func (h *typeHierarchy) location(uri string, name *ast.Identifier) (protocol.Location, bool) {
+	rng := nodeRange(name)
+
+	if positions := h.positions[uri]; positions != nil {
+		var ok bool
+		if rng, ok = positions.RangeToCurrentExact(rng); !ok {
+			return protocol.Location{}, false
+		}
+	}
+
+	return protocol.Location{URI: uri, Range: rng}, true
+}
@@ -0,0 +1,145 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func implementation(t *testing.T, uri string, line, character uint32) []protocol.Location {
+	t.Helper()
+
+	result, err := Implementation(&glsp.Context{}, &protocol.ImplementationParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Implementation failed: %v", err)
+	}
+
+	locations, ok := result.([]protocol.Location)
+	if !ok {
+		t.Fatalf("Expected []protocol.Location, got %T", result)
+	}
+
+	return locations
+}
+
+func TestImplementation(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	shapesURI := "file:///shapes.dws"
+	squareURI := "file:///square.dws"
+
+	documents := map[string]string{
+		shapesURI: `type IShape = interface
+  function Area: Float;
+end;
+
+type TShape = class(IShape)
+  function Area: Float; virtual;
+end;
+
+function TShape.Area: Float;
+begin
+  Result := 0;
+end;
+
+var s: IShape := TShape.Create;
+PrintLn(s.Area());`,
+		squareURI: `type TSquare = class(TShape)
+  function Area: Float; override;
+end;
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;`,
+	}
+
+	for uri, text := range documents {
+		err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: uri, Text: text},
+		})
+		if err != nil {
+			t.Fatalf("DidOpen failed: %v", err)
+		}
+	}
+
+	// An override in a workspace file that isn't open, found through the index
+	circlePath := filepath.Join(t.TempDir(), "circle.dws")
+	circleURI := pathToURI(circlePath)
+	circle := `type TCircle = class(TShape)
+  function Area: Float; override;
+end;
+
+function TCircle.Area: Float;
+begin
+  Result := 3;
+end;
+`
+
+	if err := os.WriteFile(circlePath, []byte(circle), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.WorkspaceIndex().AddTypeSymbol("TCircle", protocol.SymbolKindClass, circleURI,
+		protocol.Range{End: protocol.Position{Line: 2, Character: 4}}, "class(TShape)", []string{"TShape"})
+
+	at := func(uri string, line, character uint32) protocol.Location {
+		return protocol.Location{
+			URI: uri,
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: character},
+				End:   protocol.Position{Line: line, Character: character + 4},
+			},
+		}
+	}
+
+	all := []protocol.Location{at(shapesURI, 8, 16), at(squareURI, 4, 17), at(circleURI, 4, 17)}
+
+	tests := []struct {
+		name      string
+		uri       string
+		line      uint32
+		character uint32
+		expected  []protocol.Location
+	}{
+		{"interface method", shapesURI, 1, 11, all},
+		{"virtual method in the class body", shapesURI, 5, 11, all},
+		{"virtual method implementation", shapesURI, 8, 17, all},
+		{"call on an interface", shapesURI, 14, 10, all},
+		{"override without descendants", squareURI, 1, 11, []protocol.Location{at(squareURI, 4, 17)}},
+		{"variable", shapesURI, 13, 4, []protocol.Location{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locations := implementation(t, tt.uri, tt.line, tt.character)
+			if len(locations) != len(tt.expected) {
+				t.Fatalf("Expected %d implementations, got %d: %+v", len(tt.expected), len(locations), locations)
+			}
+
+			for i := range locations {
+				if locations[i] != tt.expected[i] {
+					t.Errorf("Expected implementation %+v, got %+v", tt.expected[i], locations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImplementationUnknownDocument(t *testing.T) {
+	SetServer(server.New())
+
+	if locations := implementation(t, "file:///missing.dws", 0, 0); len(locations) != 0 {
+		t.Errorf("Expected no implementations for an unknown document, got %+v", locations)
+	}
+}
@@ -2,23 +2,41 @@
 package lsp
 
 import (
+	contextpkg "context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
 
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
+// serverVersion is the version reported to clients.
+const serverVersion = "0.1.0"
+
 // serverInstance holds the global server instance
 // This is set by SetServer and accessed by handlers.
 var serverInstance any
 
 // SetServer sets the global server instance for handlers to access.
+// It also wires the document compiler into the server's analysis scheduler.
 func SetServer(srv any) {
 	serverInstance = srv
+
+	if s, ok := srv.(*server.Server); ok && s != nil {
+		s.Analysis().SetCompileFunc(compileDocument)
+	}
+}
+
+// requestContext returns the context of the request handled with context.
+// It is cancelled when the client cancels the request or it is superseded.
+func requestContext(srv *server.Server, context *glsp.Context) contextpkg.Context {
+	return srv.Requests().Context(context)
 }
 
 // Initialize handles the LSP initialize request.
@@ -31,6 +49,28 @@ func Initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 		srv.SetClientCapabilities(&params.Capabilities)
 		log.Printf("Client snippet support: %v\n", srv.SupportsSnippets())
 
+		// Pull diagnostics are a 3.17 capability, read from the raw parameters
+		if context != nil && context.Params != nil {
+			var raw struct {
+				Capabilities protocol317.ClientCapabilities `json:"capabilities"`
+			}
+
+			if err := json.Unmarshal(context.Params, &raw); err == nil {
+				srv.SetDiagnosticCapabilities(raw.Capabilities.SupportsPullDiagnostics(), raw.Capabilities.SupportsDiagnosticRefresh())
+				log.Printf("Client pulls diagnostics: %v\n", srv.SupportsPullDiagnostics())
+			}
+		}
+
+		// Apply settings passed as initialization options, either in the
+		// go-dws-lsp namespace or directly
+		if options, ok := params.InitializationOptions.(map[string]any); ok {
+			if dwsSettings, ok := options["go-dws-lsp"].(map[string]any); ok {
+				options = dwsSettings
+			}
+
+			applySettings(srv, options)
+		}
+
 		// Extract and store workspace folders from params
 		if len(params.WorkspaceFolders) > 0 {
 			folders := make([]string, 0, len(params.WorkspaceFolders))
@@ -93,8 +133,19 @@ func Initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 		// Go-to definition support
 		DefinitionProvider: &[]bool{true}[0],
 
-		// Find references support
-		ReferencesProvider: &[]bool{true}[0],
+		// Go-to declaration of routines, separate from their implementation
+		DeclarationProvider: &[]bool{true}[0],
+
+		// Go-to type definition of variables, fields, parameters and functions
+		TypeDefinitionProvider: &[]bool{true}[0],
+
+		// Go-to implementation of virtual and interface methods
+		ImplementationProvider: &[]bool{true}[0],
+
+		// Find references support (with progress for workspace-wide searches)
+		ReferencesProvider: &protocol.ReferenceOptions{
+			WorkDoneProgressOptions: protocol.WorkDoneProgressOptions{WorkDoneProgress: &trueVal},
+		},
 
 		// Document symbols (outline view)
 		DocumentSymbolProvider: &[]bool{true}[0],
@@ -116,7 +167,8 @@ func Initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 
 		// Rename support
 		RenameProvider: &protocol.RenameOptions{
-			PrepareProvider: &[]bool{true}[0],
+			WorkDoneProgressOptions: protocol.WorkDoneProgressOptions{WorkDoneProgress: &trueVal},
+			PrepareProvider:         &[]bool{true}[0],
 		},
 
 		// Semantic tokens (semantic highlighting)
@@ -136,18 +188,75 @@ func Initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 			ResolveProvider: &[]bool{false}[0], // Don't use lazy resolution for now
 		},
 
-		// Diagnostics (we'll push these, not pull)
-		// DiagnosticProvider is not set - we use publishDiagnostics
+		// Highlight occurrences of the symbol or block keyword under the cursor
+		DocumentHighlightProvider: &[]bool{true}[0],
+
+		// Folding of blocks, declarations, comments and regions
+		FoldingRangeProvider: &[]bool{true}[0],
+
+		// Expand selection along the syntax tree
+		SelectionRangeProvider: &[]bool{true}[0],
+
+		// Incoming and outgoing calls of routines
+		CallHierarchyProvider: &[]bool{true}[0],
+
+		// Reference and implementation counts, resolved lazily
+		CodeLensProvider: &protocol.CodeLensOptions{
+			ResolveProvider: &trueVal,
+		},
+
+		// Links of uses clauses, include directives and URLs, resolved lazily
+		DocumentLinkProvider: &protocol.DocumentLinkOptions{
+			ResolveProvider: &trueVal,
+		},
+
+		// Server commands run by code lenses, code actions or the user
+		ExecuteCommandProvider: &protocol.ExecuteCommandOptions{
+			WorkDoneProgressOptions: protocol.WorkDoneProgressOptions{WorkDoneProgress: &trueVal},
+			Commands:                serverCommandNames(),
+		},
+
+		// Document and range formatting
+		DocumentFormattingProvider:      &[]bool{true}[0],
+		DocumentRangeFormattingProvider: &[]bool{true}[0],
+
+		// On-type formatting re-indents after a new line, a semicolon or end
+		DocumentOnTypeFormattingProvider: &protocol.DocumentOnTypeFormattingOptions{
+			FirstTriggerCharacter: "\n",
+			MoreTriggerCharacter:  []string{";", "d"},
+		},
+
+		// Multi-root workspaces: index added folders, purge removed ones
+		Workspace: &protocol.ServerCapabilitiesWorkspace{
+			WorkspaceFolders: &protocol.WorkspaceFoldersServerCapabilities{
+				Supported:           &[]bool{true}[0],
+				ChangeNotifications: &protocol.BoolOrString{Value: true},
+			},
+		},
 	}
 
 	// Build and return InitializeResult
-	serverVersion := "0.1.0"
+	version := serverVersion
+
+	result := protocol317.InitializeResult{
+		Capabilities: protocol317.ServerCapabilities{
+			ServerCapabilities: capabilities,
+
+			// Parameter names at call arguments and inferred variable types
+			InlayHintProvider: &[]bool{true}[0],
 
-	result := protocol.InitializeResult{
-		Capabilities: capabilities,
+			// Supertypes and subtypes of classes and interfaces
+			TypeHierarchyProvider: &[]bool{true}[0],
+
+			// Pulled diagnostics of open documents and all workspace files;
+			// clients that don't pull get them published
+			DiagnosticProvider: &protocol317.DiagnosticOptions{
+				WorkspaceDiagnostics: true,
+			},
+		},
 		ServerInfo: &protocol.InitializeResultServerInfo{
 			Name:    "go-dws-lsp",
-			Version: &serverVersion,
+			Version: &version,
 		},
 	}
 
@@ -164,6 +273,12 @@ func Initialized(context *glsp.Context, params *protocol.InitializedParams) erro
 		return nil
 	}
 
+	// Keep the index in sync with changes made outside the editor, including
+	// the index of folders added later
+	if srv.SupportsWatchedFilesRegistration() {
+		registerFileWatchers(context, srv.Config().IndexFilter)
+	}
+
 	// Get workspace folders
 	folders := srv.GetWorkspaceFolders()
 	if len(folders) == 0 {
@@ -182,11 +297,54 @@ func Initialized(context *glsp.Context, params *protocol.InitializedParams) erro
 
 	// Start workspace indexing in background
 	log.Printf("Starting workspace indexing for %d folders\n", len(workspaceFolders))
-	workspace.IndexWorkspaceAsync(srv.WorkspaceIndex(), workspaceFolders)
+	startWorkspaceIndexing(context, srv, workspaceFolders)
 
 	return nil
 }
 
+// startWorkspaceIndexing indexes workspace folders in the background and
+// reports the progress to the client.
+func startWorkspaceIndexing(context *glsp.Context, srv *server.Server, folders []protocol.WorkspaceFolder) {
+	options := indexOptions(srv)
+
+	// The progress token is created on the indexing goroutine, since creating
+	// it waits for the client's response
+	var progress *workDoneProgress
+
+	options.Progress = func(p workspace.IndexProgress) {
+		switch {
+		case p.Done:
+			progress.end(fmt.Sprintf("Indexed %d files", p.Indexed))
+
+			// The diagnostics of workspace files are known now
+			publishWorkspaceDiagnostics(context, srv)
+			refreshDiagnostics(context, srv)
+		case p.Processed == 0:
+			progress = beginServerProgress(context, srv, "Indexing workspace")
+		default:
+			progress.report(fmt.Sprintf("%d/%d files", p.Processed, p.Found), p.Processed, p.Found)
+		}
+	}
+
+	workspace.IndexWorkspaceAsync(srv.IndexingContext(), srv.WorkspaceIndex(), folders, options)
+}
+
+// indexOptions returns the options for indexing workspace folders.
+func indexOptions(srv *server.Server) workspace.IndexOptions {
+	return workspace.IndexOptions{
+		References:   srv.Symbols(),
+		Diagnostics:  srv.Diagnostics(),
+		Dependencies: srv.Diagnostics(),
+		Compile:      compileWorkspaceFile,
+		CacheDir:     srv.Config().IndexCacheDir,
+		Workers:      srv.Config().IndexWorkers,
+		Filter:       srv.Config().IndexFilter,
+		InWorkspace: func(uri string) bool {
+			return inWorkspaceFolder(srv, uri)
+		},
+	}
+}
+
 // Shutdown handles the shutdown request.
 // The client sends this to ask the server to shut down gracefully.
 func Shutdown(context *glsp.Context) error {
@@ -202,6 +360,9 @@ func Shutdown(context *glsp.Context) error {
 	srv.SetShuttingDown()
 
 	// Clean up resources
+	log.Println("Stopping background analysis...")
+	srv.Analysis().Stop()
+
 	log.Println("Clearing completion cache...")
 	srv.CompletionCache().Clear()
 
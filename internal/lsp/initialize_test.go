@@ -1,9 +1,12 @@
 package lsp
 
 import (
+	"encoding/json"
 	"slices"
 	"testing"
+	"time"
 
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -46,7 +49,7 @@ func TestInitialize(t *testing.T) {
 	}
 
 	// Type assert to InitializeResult
-	initResult, ok := result.(protocol.InitializeResult)
+	initResult, ok := result.(protocol317.InitializeResult)
 	if !ok {
 		t.Fatalf("Initialize returned wrong type: %T", result)
 	}
@@ -92,6 +95,36 @@ func TestInitialize(t *testing.T) {
 		t.Error("DefinitionProvider should be set")
 	}
 
+	// Test DeclarationProvider
+	if caps.DeclarationProvider == nil {
+		t.Error("DeclarationProvider should be set")
+	}
+
+	// Test TypeDefinitionProvider
+	if caps.TypeDefinitionProvider == nil {
+		t.Error("TypeDefinitionProvider should be set")
+	}
+
+	// Test CodeLensProvider
+	if caps.CodeLensProvider == nil || caps.CodeLensProvider.ResolveProvider == nil || !*caps.CodeLensProvider.ResolveProvider {
+		t.Error("CodeLensProvider should be set with lazy resolution")
+	}
+
+	// Test DocumentLinkProvider
+	if caps.DocumentLinkProvider == nil || caps.DocumentLinkProvider.ResolveProvider == nil || !*caps.DocumentLinkProvider.ResolveProvider {
+		t.Error("DocumentLinkProvider should be set with lazy resolution")
+	}
+
+	// Test ExecuteCommandProvider
+	if caps.ExecuteCommandProvider == nil || !slices.Contains(caps.ExecuteCommandProvider.Commands, "dws.runScript") {
+		t.Error("ExecuteCommandProvider should list the server commands")
+	}
+
+	// Test ImplementationProvider
+	if caps.ImplementationProvider == nil {
+		t.Error("ImplementationProvider should be set")
+	}
+
 	// Test ReferencesProvider
 	if caps.ReferencesProvider == nil {
 		t.Error("ReferencesProvider should be set")
@@ -144,6 +177,56 @@ func TestInitialize(t *testing.T) {
 		t.Error("RenameProvider should be set")
 	}
 
+	// Test DocumentHighlightProvider
+	if caps.DocumentHighlightProvider == nil {
+		t.Error("DocumentHighlightProvider should be set")
+	}
+
+	// Test FoldingRangeProvider
+	if caps.FoldingRangeProvider == nil {
+		t.Error("FoldingRangeProvider should be set")
+	}
+
+	// Test InlayHintProvider
+	if caps.InlayHintProvider == nil {
+		t.Error("InlayHintProvider should be set")
+	}
+
+	// Test DiagnosticProvider
+	if caps.DiagnosticProvider == nil || !caps.DiagnosticProvider.WorkspaceDiagnostics {
+		t.Error("DiagnosticProvider should be set with workspace diagnostics")
+	}
+
+	// Test TypeHierarchyProvider
+	if caps.TypeHierarchyProvider == nil {
+		t.Error("TypeHierarchyProvider should be set")
+	}
+
+	// Test SelectionRangeProvider
+	if caps.SelectionRangeProvider == nil {
+		t.Error("SelectionRangeProvider should be set")
+	}
+
+	// Test CallHierarchyProvider
+	if caps.CallHierarchyProvider == nil {
+		t.Error("CallHierarchyProvider should be set")
+	}
+
+	// Test formatting providers
+	if caps.DocumentFormattingProvider == nil {
+		t.Error("DocumentFormattingProvider should be set")
+	}
+
+	if caps.DocumentRangeFormattingProvider == nil {
+		t.Error("DocumentRangeFormattingProvider should be set")
+	}
+
+	if caps.DocumentOnTypeFormattingProvider == nil {
+		t.Error("DocumentOnTypeFormattingProvider should be set")
+	} else if caps.DocumentOnTypeFormattingProvider.FirstTriggerCharacter != "\n" {
+		t.Errorf("Expected newline as first on-type trigger, got %q", caps.DocumentOnTypeFormattingProvider.FirstTriggerCharacter)
+	}
+
 	// Test SemanticTokensProvider
 	if caps.SemanticTokensProvider == nil {
 		t.Error("SemanticTokensProvider should be set")
@@ -186,6 +269,39 @@ func TestInitialized(t *testing.T) {
 	// Currently it's a no-op, so just verify it doesn't crash
 }
 
+func TestInitialized_RegistersFileWatchersWithoutFolders(t *testing.T) {
+	var capabilities protocol.ClientCapabilities
+	if err := json.Unmarshal([]byte(`{"workspace":{"didChangeWatchedFiles":{"dynamicRegistration":true}}}`), &capabilities); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New()
+	srv.SetClientCapabilities(&capabilities)
+	SetServer(srv)
+
+	registered := make(chan string, 1)
+
+	ctx := &glsp.Context{
+		Call: func(method string, params any, result any) {
+			registered <- method
+		},
+	}
+
+	if err := Initialized(ctx, &protocol.InitializedParams{}); err != nil {
+		t.Fatalf("Initialized returned error: %v", err)
+	}
+
+	// Folders added later are watched too
+	select {
+	case method := <-registered:
+		if method != protocol.ServerClientRegisterCapability {
+			t.Errorf("Expected the file watchers to be registered, got %s", method)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the file watchers to be registered without workspace folders")
+	}
+}
+
 func TestShutdown(t *testing.T) {
 	// Create mock context
 	ctx := &glsp.Context{}
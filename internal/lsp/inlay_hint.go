@@ -0,0 +1,514 @@
+package lsp
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/builtins"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// comparisonOperators are the binary operators yielding a Boolean.
+var comparisonOperators = map[string]bool{
+	"=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"in": true, "is": true, "implements": true,
+}
+
+// InlayHint handles the textDocument/inlayHint request.
+// It shows parameter names before call arguments and the inferred types of
+// var declarations without a type, as enabled in the settings.
+func InlayHint(context *glsp.Context, params *protocol317.InlayHintParams) ([]protocol317.InlayHint, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in InlayHint")
+		return []protocol317.InlayHint{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("InlayHint request for %s\n", uri)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for inlay hints: %s\n", uri)
+		return []protocol317.InlayHint{}, nil
+	}
+
+	// Use the last good program if the current text doesn't compile
+	doc, positions := doc.AnalysisView()
+
+	if doc.Program == nil || doc.Program.AST() == nil {
+		log.Printf("No AST available for inlay hints: %s\n", uri)
+		return []protocol317.InlayHint{}, nil
+	}
+
+	hints := computeInlayHints(srv, doc, positions, params.Range, srv.Config().InlayHints)
+
+	log.Printf("InlayHint: %d hint(s) in %s\n", len(hints), uri)
+
+	return hints, nil
+}
+
+// inlayHintCollector gathers the inlay hints of a document in a range of the
+// current text.
+type inlayHintCollector struct {
+	srv       *server.Server
+	doc       *server.Document
+	positions *document.PositionMap
+	rng       protocol.Range
+	options   server.InlayHintOptions
+	types     *typeInferrer
+	hints     []protocol317.InlayHint
+}
+
+// computeInlayHints returns the inlay hints of doc that lie in rng, which is a
+// range of the current text.
+func computeInlayHints(srv *server.Server, doc *server.Document, positions *document.PositionMap,
+	rng protocol.Range, options server.InlayHintOptions,
+) []protocol317.InlayHint {
+	collector := &inlayHintCollector{
+		srv:       srv,
+		doc:       doc,
+		positions: positions,
+		rng:       rng,
+		options:   options,
+		types:     newTypeInferrer(srv, doc),
+		hints:     []protocol317.InlayHint{},
+	}
+
+	ast.Inspect(doc.Program.AST(), func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.CallExpression:
+			if name := calleeName(n.Function); name != "" {
+				collector.addParameterHints(name, n.Pos(), n.Arguments)
+			}
+
+		case *ast.MethodCallExpression:
+			if n.Method != nil {
+				collector.addParameterHints(n.Method.Value, n.Method.Pos(), n.Arguments)
+			}
+
+		case *ast.VarDeclStatement:
+			collector.addTypeHint(n)
+		}
+
+		return true
+	})
+
+	sort.SliceStable(collector.hints, func(i, j int) bool {
+		a, b := collector.hints[i].Position, collector.hints[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Character < b.Character
+	})
+
+	return collector.hints
+}
+
+// calleeName returns the name of the function called through expr, such as
+// Foo in Foo(1) or Bar in Obj.Bar(1).
+func calleeName(expr ast.Expression) string {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return e.Value
+	case *ast.MemberAccessExpression:
+		if e.Member != nil {
+			return e.Member.Value
+		}
+	}
+
+	return ""
+}
+
+// visiblePosition maps an AST position in the analyzed snapshot to the
+// current text, reporting whether it is unedited and inside the range.
+func (c *inlayHintCollector) visiblePosition(pos token.Position) (protocol.Position, bool) {
+	if pos.Line < 1 || pos.Column < 1 {
+		return protocol.Position{}, false
+	}
+
+	// Convert AST (1-based) to LSP (0-based)
+	position := protocol.Position{Line: uint32(pos.Line - 1), Character: uint32(pos.Column - 1)}
+
+	if c.positions != nil {
+		var ok bool
+		if position, ok = c.positions.ToCurrent(position); !ok {
+			return position, false
+		}
+	}
+
+	return position, !positionLess(position, c.rng.Start) && !positionLess(c.rng.End, position)
+}
+
+// addParameterHints adds parameter name hints to the arguments of a call of
+// the function name at pos.
+func (c *inlayHintCollector) addParameterHints(name string, pos token.Position, args []ast.Expression) {
+	if !c.options.ParameterNames || len(args) == 0 {
+		return
+	}
+
+	// Only resolve the function if one of its arguments is visible
+	visible := make([]*protocol.Position, len(args))
+	anyVisible := false
+
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+
+		if position, ok := c.visiblePosition(arg.Pos()); ok {
+			visible[i] = &position
+			anyVisible = true
+		}
+	}
+
+	if !anyVisible {
+		return
+	}
+
+	signature := matchingSignature(c.types.signatures(name, pos), len(args))
+	if signature == nil {
+		return
+	}
+
+	kind := protocol317.InlayHintKindParameter
+	padding := true
+
+	for i, arg := range args {
+		if visible[i] == nil || i >= len(signature.Parameters) {
+			continue
+		}
+
+		parameter := signature.Parameters[i].Name
+		if parameter == "" || (c.options.SuppressMatchingNames && argumentMatchesName(arg, parameter)) {
+			continue
+		}
+
+		c.hints = append(c.hints, protocol317.InlayHint{
+			Position:     *visible[i],
+			Label:        parameter + ":",
+			Kind:         &kind,
+			PaddingRight: &padding,
+		})
+	}
+}
+
+// addTypeHint adds the inferred type after the name of a var declaration
+// without a type.
+func (c *inlayHintCollector) addTypeHint(decl *ast.VarDeclStatement) {
+	if !c.options.VariableTypes || decl.Type != nil || decl.Value == nil || len(decl.Names) == 0 {
+		return
+	}
+
+	name := decl.Names[len(decl.Names)-1]
+	if name == nil {
+		return
+	}
+
+	position, ok := c.visiblePosition(name.End())
+	if !ok {
+		return
+	}
+
+	typeName := c.types.declarationType(decl)
+	if typeName == "" {
+		return
+	}
+
+	kind := protocol317.InlayHintKindType
+
+	c.hints = append(c.hints, protocol317.InlayHint{
+		Position: position,
+		Label:    ": " + typeName,
+		Kind:     &kind,
+	})
+}
+
+// matchingSignature returns the overload accepting argCount arguments, or the
+// first signature if none does.
+func matchingSignature(signatures []*analysis.FunctionSignature, argCount int) *analysis.FunctionSignature {
+	for _, signature := range signatures {
+		required := 0
+
+		for _, parameter := range signature.Parameters {
+			if !parameter.IsOptional && parameter.DefaultValue == "" {
+				required++
+			}
+		}
+
+		if required <= argCount && argCount <= len(signature.Parameters) {
+			return signature
+		}
+	}
+
+	if len(signatures) > 0 {
+		return signatures[0]
+	}
+
+	return nil
+}
+
+// argumentMatchesName reports whether the argument is a variable or member
+// named like the parameter, allowing for the A prefix of parameter names as
+// in AValue.
+func argumentMatchesName(arg ast.Expression, parameter string) bool {
+	var name string
+
+	switch a := arg.(type) {
+	case *ast.Identifier:
+		name = a.Value
+	case *ast.MemberAccessExpression:
+		if a.Member != nil {
+			name = a.Member.Value
+		}
+	}
+
+	if name == "" {
+		return false
+	}
+
+	return strings.EqualFold(name, parameter) || strings.EqualFold("A"+name, parameter)
+}
+
+// positionLess reports whether a comes before b.
+func positionLess(a, b protocol.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+
+	return a.Character < b.Character
+}
+
+// typeInferrer infers the types of expressions of a document from literals,
+// declarations and function signatures.
+type typeInferrer struct {
+	srv *server.Server
+	doc *server.Document
+
+	// declarations caches the types of declarations; an entry that is being
+	// inferred is empty, which breaks cycles
+	declarations map[ast.Node]string
+}
+
+// newTypeInferrer creates a type inferrer for the analyzed document doc.
+func newTypeInferrer(srv *server.Server, doc *server.Document) *typeInferrer {
+	return &typeInferrer{
+		srv:          srv,
+		doc:          doc,
+		declarations: make(map[ast.Node]string),
+	}
+}
+
+// signatures returns the signatures of the function name called at pos,
+// falling back to the built-in functions.
+func (t *typeInferrer) signatures(name string, pos token.Position) []*analysis.FunctionSignature {
+	signatures, err := analysis.GetFunctionSignatures(t.doc, name, pos.Line-1, pos.Column-1, t.srv.WorkspaceIndex(), nil)
+	if err != nil {
+		log.Printf("Error getting signatures of %s for inlay hints: %v\n", name, err)
+	}
+
+	if len(signatures) == 0 {
+		if builtin := builtins.GetBuiltinSignature(name); builtin != nil {
+			signatures = []*analysis.FunctionSignature{builtin}
+		}
+	}
+
+	return signatures
+}
+
+// returnType returns the return type of the function name called at pos.
+func (t *typeInferrer) returnType(name string, pos token.Position) string {
+	for _, signature := range t.signatures(name, pos) {
+		if signature.ReturnType != "" {
+			return signature.ReturnType
+		}
+	}
+
+	return ""
+}
+
+// declarationType returns the declared or inferred type of a variable
+// declaration.
+func (t *typeInferrer) declarationType(decl *ast.VarDeclStatement) string {
+	if decl.Type != nil {
+		return decl.Type.Name
+	}
+
+	if typeName, ok := t.declarations[decl]; ok {
+		return typeName
+	}
+
+	t.declarations[decl] = ""
+	typeName := t.expressionType(decl.Value)
+	t.declarations[decl] = typeName
+
+	return typeName
+}
+
+// expressionType returns the type of expr, or "" if it can't be inferred.
+func (t *typeInferrer) expressionType(expr ast.Expression) string {
+	// Use the type found by the semantic analysis, if any
+	if typed, ok := expr.(interface{ GetType() *ast.TypeAnnotation }); ok {
+		if annotation := typed.GetType(); annotation != nil && annotation.Name != "" {
+			return annotation.Name
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return "Integer"
+	case *ast.FloatLiteral:
+		return "Float"
+	case *ast.StringLiteral, *ast.CharLiteral:
+		return "String"
+	case *ast.BooleanLiteral:
+		return "Boolean"
+
+	case *ast.GroupedExpression:
+		return t.expressionType(e.Expression)
+
+	case *ast.UnaryExpression:
+		return t.expressionType(e.Right)
+
+	case *ast.BinaryExpression:
+		return t.binaryExpressionType(e)
+
+	case *ast.NewExpression:
+		if e.ClassName != nil {
+			return e.ClassName.Value
+		}
+
+	case *ast.CallExpression:
+		if name := calleeName(e.Function); name != "" {
+			return t.returnType(name, e.Pos())
+		}
+
+	case *ast.MethodCallExpression:
+		if e.Method == nil {
+			return ""
+		}
+
+		if typeName := constructedType(e.Object, e.Method); typeName != "" {
+			return typeName
+		}
+
+		return t.returnType(e.Method.Value, e.Method.Pos())
+
+	case *ast.MemberAccessExpression:
+		if e.Member == nil {
+			return ""
+		}
+
+		if typeName := constructedType(e.Object, e.Member); typeName != "" {
+			return typeName
+		}
+
+		return t.returnType(e.Member.Value, e.Member.Pos())
+
+	case *ast.Identifier:
+		return t.identifierType(e)
+	}
+
+	return ""
+}
+
+// binaryExpressionType returns the type of a binary expression.
+func (t *typeInferrer) binaryExpressionType(expr *ast.BinaryExpression) string {
+	operator := strings.ToLower(expr.Operator)
+
+	switch {
+	case comparisonOperators[operator]:
+		return "Boolean"
+	case operator == "/":
+		return "Float"
+	case operator == "div" || operator == "mod" || operator == "shl" || operator == "shr":
+		return "Integer"
+	}
+
+	left := t.expressionType(expr.Left)
+	right := t.expressionType(expr.Right)
+
+	switch {
+	case left == "Float" || right == "Float":
+		// Integer operands are promoted
+		return "Float"
+	case left != "":
+		return left
+	default:
+		return right
+	}
+}
+
+// constructedType returns the class of a constructor call such as
+// TFoo.Create, or "" if member isn't a constructor called on a type.
+func constructedType(object ast.Expression, member *ast.Identifier) string {
+	class, ok := object.(*ast.Identifier)
+	if !ok || class == nil || !strings.EqualFold(member.Value, "Create") {
+		return ""
+	}
+
+	return class.Value
+}
+
+// identifierType returns the type of the variable, constant, parameter or
+// function named by ident.
+func (t *typeInferrer) identifierType(ident *ast.Identifier) string {
+	program := t.doc.Program.AST()
+
+	locations := analysis.NewSymbolResolver(t.doc.URI, program, ident.Pos()).ResolveSymbol(ident.Value)
+	if len(locations) == 0 || locations[0].URI != t.doc.URI {
+		return ""
+	}
+
+	start := locations[0].Range.Start
+
+	// Find the declaration enclosing the declared name, innermost first
+	path := analysis.FindNodePathAtPosition(program, int(start.Line)+1, int(start.Character)+1)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		switch decl := path[i].(type) {
+		case *ast.VarDeclStatement:
+			return t.declarationType(decl)
+
+		case *ast.ConstDecl:
+			if decl.Type != nil {
+				return decl.Type.Name
+			}
+
+			if decl.Value != nil {
+				return t.expressionType(decl.Value)
+			}
+
+			return ""
+
+		case *ast.FunctionDecl:
+			for _, parameter := range decl.Parameters {
+				if parameter == nil || parameter.Name == nil || parameter.Type == nil {
+					continue
+				}
+
+				if namePos := parameter.Name.Pos(); namePos.Line == int(start.Line)+1 && namePos.Column == int(start.Character)+1 {
+					return parameter.Type.Name
+				}
+			}
+
+			// A function called without parentheses
+			if decl.ReturnType != nil && decl.Name != nil && strings.EqualFold(decl.Name.Value, ident.Value) {
+				return decl.ReturnType.Name
+			}
+
+			return ""
+		}
+	}
+
+	return ""
+}
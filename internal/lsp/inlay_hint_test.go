@@ -0,0 +1,153 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const inlayHintContent = `function Area(width, height: Integer): Integer;
+begin
+  Result := width * height;
+end;
+
+var width := 3;
+var a := Area(width, 4);
+var s := IntToStr(a);
+var f := a / 2;
+var ok := a > 10;
+PrintLn(s);`
+
+func requestInlayHints(t *testing.T, srv *server.Server, uri, content string) []protocol317.InlayHint {
+	t.Helper()
+
+	SetServer(srv)
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	hints, err := InlayHint(&glsp.Context{}, &protocol317.InlayHintParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range: protocol.Range{
+			End: protocol.Position{Line: 100},
+		},
+	})
+	if err != nil {
+		t.Fatalf("InlayHint failed: %v", err)
+	}
+
+	return hints
+}
+
+type hintAt struct {
+	line, character uint32
+	label           string
+}
+
+func checkInlayHints(t *testing.T, hints []protocol317.InlayHint, expected []hintAt) {
+	t.Helper()
+
+	if len(hints) != len(expected) {
+		t.Fatalf("Expected %d hints, got %d: %+v", len(expected), len(hints), hints)
+	}
+
+	for i, hint := range hints {
+		got := hintAt{hint.Position.Line, hint.Position.Character, hint.Label}
+		if got != expected[i] {
+			t.Errorf("Hint %d: got %+v, expected %+v", i, got, expected[i])
+		}
+	}
+}
+
+func TestInlayHint(t *testing.T) {
+	hints := requestInlayHints(t, server.New(), "file:///hints.dws", inlayHintContent)
+
+	checkInlayHints(t, hints, []hintAt{
+		{5, 9, ": Integer"},
+		{6, 5, ": Integer"},
+		{6, 21, "height:"}, // width matches its parameter
+		{7, 5, ": String"},
+		{7, 18, "value:"},
+		{8, 5, ": Float"},
+		{9, 6, ": Boolean"},
+		{10, 8, "text:"},
+	})
+
+	for _, hint := range hints {
+		if hint.Kind == nil {
+			t.Fatalf("Hint %q has no kind", hint.Label)
+		}
+
+		wantKind := protocol317.InlayHintKindType
+		if hint.Label[0] != ':' {
+			wantKind = protocol317.InlayHintKindParameter
+		}
+
+		if *hint.Kind != wantKind {
+			t.Errorf("Hint %q: got kind %d, expected %d", hint.Label, *hint.Kind, wantKind)
+		}
+	}
+}
+
+func TestInlayHint_Settings(t *testing.T) {
+	srv := server.New()
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.InlayHints = server.InlayHintOptions{ParameterNames: true}
+	})
+
+	hints := requestInlayHints(t, srv, "file:///hints-settings.dws", inlayHintContent)
+
+	checkInlayHints(t, hints, []hintAt{
+		{6, 14, "width:"},
+		{6, 21, "height:"},
+		{7, 18, "value:"},
+		{10, 8, "text:"},
+	})
+}
+
+func TestInlayHint_Range(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := "file:///hints-range.dws"
+	requestInlayHints(t, srv, uri, inlayHintContent)
+
+	hints, err := InlayHint(&glsp.Context{}, &protocol317.InlayHintParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 7},
+			End:   protocol.Position{Line: 8},
+		},
+	})
+	if err != nil {
+		t.Fatalf("InlayHint failed: %v", err)
+	}
+
+	checkInlayHints(t, hints, []hintAt{
+		{7, 5, ": String"},
+		{7, 18, "value:"},
+	})
+}
+
+func TestApplySettings_InlayHints(t *testing.T) {
+	srv := server.New()
+
+	applySettings(srv, map[string]any{
+		"inlayHintsParameterNames":        false,
+		"inlayHintsSuppressMatchingNames": false,
+	})
+
+	got := srv.Config().InlayHints
+	want := server.InlayHintOptions{VariableTypes: true}
+
+	if got != want {
+		t.Errorf("Expected inlay hint options %+v, got %+v", want, got)
+	}
+}
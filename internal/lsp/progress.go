@@ -0,0 +1,134 @@
+// Package lsp implements LSP protocol handlers.
+package lsp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// progressTokenCounter numbers the progress tokens created by the server.
+var progressTokenCounter atomic.Int64
+
+// workDoneProgress reports the progress of a long-running operation to the
+// client through $/progress notifications (begin, report, end).
+//
+// A nil *workDoneProgress is valid and reports nothing, so handlers can use it
+// unconditionally; that is what clients without work done progress support get.
+type workDoneProgress struct {
+	notify glsp.NotifyFunc
+	token  protocol.ProgressToken
+
+	mu      sync.Mutex
+	percent uint32
+	ended   bool
+}
+
+// beginRequestProgress starts reporting progress on the token the client sent
+// with a request. It returns nil if the client didn't send a token.
+func beginRequestProgress(context *glsp.Context, srv *server.Server, token *protocol.ProgressToken, title string) *workDoneProgress {
+	if token == nil || context == nil || context.Notify == nil || !srv.SupportsWorkDoneProgress() {
+		return nil
+	}
+
+	return startProgress(context, *token, title)
+}
+
+// beginServerProgress asks the client to create a progress token with
+// window/workDoneProgress/create and starts reporting progress on it. It
+// returns nil if the client doesn't support work done progress.
+//
+// Creating the token waits for the client's response, so this must not be
+// called while handling a message, only from a background goroutine.
+func beginServerProgress(context *glsp.Context, srv *server.Server, title string) *workDoneProgress {
+	if context == nil || context.Call == nil || context.Notify == nil || !srv.SupportsWorkDoneProgress() {
+		return nil
+	}
+
+	token := protocol.ProgressToken{
+		Value: fmt.Sprintf("go-dws-lsp/progress/%d", progressTokenCounter.Add(1)),
+	}
+
+	context.Call(protocol.ServerWindowWorkDoneProgressCreate, protocol.WorkDoneProgressCreateParams{Token: token}, nil)
+
+	return startProgress(context, token, title)
+}
+
+// startProgress sends the begin notification for token.
+func startProgress(context *glsp.Context, token protocol.ProgressToken, title string) *workDoneProgress {
+	p := &workDoneProgress{notify: context.Notify, token: token}
+
+	percent := protocol.UInteger(0)
+	p.send(protocol.WorkDoneProgressBegin{
+		Kind:       "begin",
+		Title:      title,
+		Percentage: &percent,
+	})
+
+	log.Printf("Progress started: %s\n", title)
+
+	return p
+}
+
+// report updates the progress message and percentage, computed from done out
+// of total items. Only reports that advance the percentage are sent, which
+// bounds the number of notifications and keeps the percentage from going back
+// when total grows.
+func (p *workDoneProgress) report(message string, done, total int) {
+	if p == nil || total <= 0 {
+		return
+	}
+
+	percent := uint32(min(100, done*100/total))
+
+	p.mu.Lock()
+
+	if p.ended || percent <= p.percent {
+		p.mu.Unlock()
+		return
+	}
+
+	p.percent = percent
+	p.mu.Unlock()
+
+	p.send(protocol.WorkDoneProgressReport{
+		Kind:       "report",
+		Message:    &message,
+		Percentage: &percent,
+	})
+}
+
+// end finishes the progress with a final message. Further calls are ignored.
+func (p *workDoneProgress) end(message string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+
+	if p.ended {
+		p.mu.Unlock()
+		return
+	}
+
+	p.ended = true
+	p.mu.Unlock()
+
+	p.send(protocol.WorkDoneProgressEnd{
+		Kind:    "end",
+		Message: &message,
+	})
+}
+
+// send delivers a progress value to the client.
+func (p *workDoneProgress) send(value any) {
+	p.notify(protocol.MethodProgress, protocol.ProgressParams{
+		Token: p.token,
+		Value: value,
+	})
+}
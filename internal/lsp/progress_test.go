@@ -0,0 +1,117 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// progressRecorder captures the messages sent through a glsp.Context.
+type progressRecorder struct {
+	calls  []string
+	values []any
+}
+
+func (r *progressRecorder) context() *glsp.Context {
+	return &glsp.Context{
+		Notify: func(method string, params any) {
+			if progress, ok := params.(protocol.ProgressParams); ok && method == string(protocol.MethodProgress) {
+				r.values = append(r.values, progress.Value)
+			}
+		},
+		Call: func(method string, params any, result any) {
+			r.calls = append(r.calls, method)
+		},
+	}
+}
+
+func newProgressServer(supported bool) *server.Server {
+	srv := server.New()
+
+	var capabilities protocol.ClientCapabilities
+	if err := json.Unmarshal(fmt.Appendf(nil, `{"window": {"workDoneProgress": %t}}`, supported), &capabilities); err != nil {
+		panic(err)
+	}
+
+	srv.SetClientCapabilities(&capabilities)
+
+	return srv
+}
+
+func TestWorkDoneProgress_RequestToken(t *testing.T) {
+	recorder := &progressRecorder{}
+	srv := newProgressServer(true)
+	token := protocol.ProgressToken{Value: "client-token"}
+
+	progress := beginRequestProgress(recorder.context(), srv, &token, "Finding references")
+	if progress == nil {
+		t.Fatal("Expected progress for a client-provided token")
+	}
+
+	progress.report("1/4 files", 1, 4)
+	progress.report("1/4 files", 1, 4) // No advance, not sent
+	progress.report("3/4 files", 3, 4)
+	progress.end("Done")
+	progress.end("Done") // Already ended, not sent
+
+	if len(recorder.calls) != 0 {
+		t.Errorf("Expected no token creation for a client token, got %v", recorder.calls)
+	}
+
+	if len(recorder.values) != 4 {
+		t.Fatalf("Expected begin, 2 reports and end, got %d messages", len(recorder.values))
+	}
+
+	if _, ok := recorder.values[0].(protocol.WorkDoneProgressBegin); !ok {
+		t.Errorf("Expected begin first, got %T", recorder.values[0])
+	}
+
+	report, ok := recorder.values[2].(protocol.WorkDoneProgressReport)
+	if !ok || report.Percentage == nil || *report.Percentage != 75 {
+		t.Errorf("Expected report at 75%%, got %+v", recorder.values[2])
+	}
+
+	if _, ok := recorder.values[3].(protocol.WorkDoneProgressEnd); !ok {
+		t.Errorf("Expected end last, got %T", recorder.values[3])
+	}
+}
+
+func TestWorkDoneProgress_ServerToken(t *testing.T) {
+	recorder := &progressRecorder{}
+
+	progress := beginServerProgress(recorder.context(), newProgressServer(true), "Indexing workspace")
+	if progress == nil {
+		t.Fatal("Expected progress when the client supports it")
+	}
+
+	if len(recorder.calls) != 1 || recorder.calls[0] != string(protocol.ServerWindowWorkDoneProgressCreate) {
+		t.Errorf("Expected a token creation request, got %v", recorder.calls)
+	}
+}
+
+func TestWorkDoneProgress_Unsupported(t *testing.T) {
+	recorder := &progressRecorder{}
+	srv := newProgressServer(false)
+	token := protocol.ProgressToken{Value: 1}
+
+	if beginRequestProgress(recorder.context(), srv, &token, "Finding references") != nil {
+		t.Error("Expected no progress when the client doesn't support it")
+	}
+
+	progress := beginServerProgress(recorder.context(), srv, "Indexing workspace")
+	if progress != nil {
+		t.Error("Expected no progress when the client doesn't support it")
+	}
+
+	// A nil progress ignores all calls
+	progress.report("1/2 files", 1, 2)
+	progress.end("Done")
+
+	if len(recorder.calls) != 0 || len(recorder.values) != 0 {
+		t.Errorf("Expected no messages, got %v and %v", recorder.calls, recorder.values)
+	}
+}
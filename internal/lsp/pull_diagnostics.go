@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"log"
+	"slices"
+
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// workspaceDiagnosticBatchSize is the number of document reports sent per
+// partial result of a workspace/diagnostic request.
+const workspaceDiagnosticBatchSize = 100
+
+// workspaceDiagnosticPartialResult is the value of a $/progress notification
+// carrying a partial result of a workspace/diagnostic request.
+type workspaceDiagnosticPartialResult struct {
+	Items []any `json:"items"`
+}
+
+// DocumentDiagnostic handles the textDocument/diagnostic request.
+// It reports the diagnostics of an open document, or of a workspace file
+// compiled by the indexer, and an unchanged report if they are the ones the
+// client received with previousResultId.
+func DocumentDiagnostic(context *glsp.Context, params *protocol317.DocumentDiagnosticParams) (any, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DocumentDiagnostic")
+		return fullDiagnosticReport("", nil), nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("DocumentDiagnostic request for %s\n", uri)
+
+	var (
+		resultID    string
+		diagnostics []protocol.Diagnostic
+	)
+
+	if doc, open := getAnalyzedDocument(srv, uri); open {
+		resultID, diagnostics = doc.DiagnosticsResultID, doc.Diagnostics
+	} else if file, indexed := srv.Diagnostics().Get(uri); indexed {
+		resultID, diagnostics = file.ResultID, file.Diagnostics
+	} else {
+		log.Printf("No diagnostics known for %s\n", uri)
+	}
+
+	if resultID != "" && params.PreviousResultID != nil && *params.PreviousResultID == resultID {
+		return protocol317.UnchangedDocumentDiagnosticReport{
+			Kind:     protocol317.DocumentDiagnosticReportKindUnchanged,
+			ResultID: resultID,
+		}, nil
+	}
+
+	return fullDiagnosticReport(resultID, diagnostics), nil
+}
+
+// WorkspaceDiagnostic handles the workspace/diagnostic request.
+// It reports the diagnostics of all open documents and workspace files known
+// to the indexer, with unchanged reports for those the client already has. If
+// the client asked for partial results, the reports are streamed in batches
+// through $/progress notifications and the final result is empty.
+func WorkspaceDiagnostic(context *glsp.Context, params *protocol317.WorkspaceDiagnosticParams) (*protocol317.WorkspaceDiagnosticReport, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in WorkspaceDiagnostic")
+		return &protocol317.WorkspaceDiagnosticReport{Items: []any{}}, nil
+	}
+
+	ctx := requestContext(srv, context)
+
+	previous := make(map[string]string, len(params.PreviousResultIDs))
+	for _, resultID := range params.PreviousResultIDs {
+		previous[resultID.URI] = resultID.Value
+	}
+
+	uris := append(srv.Documents().List(), srv.Diagnostics().List()...)
+	slices.Sort(uris)
+	uris = slices.Compact(uris)
+
+	log.Printf("WorkspaceDiagnostic request for %d files (%d previous results)\n", len(uris), len(previous))
+
+	stream := params.PartialResultToken != nil && context != nil && context.Notify != nil
+	items := []any{}
+
+	for _, uri := range uris {
+		if ctx.Err() != nil {
+			log.Println("WorkspaceDiagnostic request cancelled")
+			return nil, ctx.Err()
+		}
+
+		item, ok := workspaceDocumentReport(srv, uri, previous[uri])
+		if !ok {
+			continue
+		}
+
+		items = append(items, item)
+
+		if stream && len(items) == workspaceDiagnosticBatchSize {
+			sendWorkspaceDiagnosticBatch(context, *params.PartialResultToken, items)
+			items = []any{}
+		}
+	}
+
+	if stream {
+		if len(items) > 0 {
+			sendWorkspaceDiagnosticBatch(context, *params.PartialResultToken, items)
+		}
+
+		items = []any{}
+	}
+
+	return &protocol317.WorkspaceDiagnosticReport{Items: items}, nil
+}
+
+// workspaceDocumentReport returns the report of uri in a workspace/diagnostic
+// response: an unchanged report if its result ID is previousResultID, a full
+// report otherwise. Open documents report the diagnostics of their text and
+// its version.
+func workspaceDocumentReport(srv *server.Server, uri string, previousResultID string) (any, bool) {
+	var (
+		resultID    string
+		diagnostics []protocol.Diagnostic
+		version     *protocol.Integer
+	)
+
+	if doc, open := srv.Documents().Get(uri); open {
+		docVersion := protocol.Integer(doc.Version)
+		resultID, diagnostics, version = doc.DiagnosticsResultID, doc.Diagnostics, &docVersion
+	} else if file, indexed := srv.Diagnostics().Get(uri); indexed {
+		resultID, diagnostics = file.ResultID, file.Diagnostics
+	} else {
+		// Closed or removed while the report was being built
+		return nil, false
+	}
+
+	if resultID != "" && resultID == previousResultID {
+		return protocol317.WorkspaceUnchangedDocumentDiagnosticReport{
+			UnchangedDocumentDiagnosticReport: protocol317.UnchangedDocumentDiagnosticReport{
+				Kind:     protocol317.DocumentDiagnosticReportKindUnchanged,
+				ResultID: resultID,
+			},
+			URI:     uri,
+			Version: version,
+		}, true
+	}
+
+	return protocol317.WorkspaceFullDocumentDiagnosticReport{
+		FullDocumentDiagnosticReport: fullDiagnosticReport(resultID, diagnostics),
+		URI:                          uri,
+		Version:                      version,
+	}, true
+}
+
+// fullDiagnosticReport returns a full report of diagnostics, sorted by
+// position. An empty resultID is left out, so the client always gets a full
+// report next time.
+func fullDiagnosticReport(resultID string, diagnostics []protocol.Diagnostic) protocol317.FullDocumentDiagnosticReport {
+	// Sort a copy, the diagnostics are shared with the document
+	items := append([]protocol.Diagnostic{}, diagnostics...)
+	sortDiagnostics(items)
+
+	report := protocol317.FullDocumentDiagnosticReport{
+		Kind:  protocol317.DocumentDiagnosticReportKindFull,
+		Items: items,
+	}
+
+	if resultID != "" {
+		report.ResultID = &resultID
+	}
+
+	return report
+}
+
+// sendWorkspaceDiagnosticBatch sends document reports as a partial result of
+// a workspace/diagnostic request.
+func sendWorkspaceDiagnosticBatch(context *glsp.Context, token protocol.ProgressToken, items []any) {
+	context.Notify(protocol.MethodProgress, protocol.ProgressParams{
+		Token: token,
+		Value: workspaceDiagnosticPartialResult{Items: items},
+	})
+}
@@ -0,0 +1,264 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const brokenContent = "var x: Integer;\nx := ;\n"
+
+func TestDocumentDiagnostic(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///broken.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: brokenContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	result, err := DocumentDiagnostic(&glsp.Context{}, &protocol317.DocumentDiagnosticParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DocumentDiagnostic failed: %v", err)
+	}
+
+	full, ok := result.(protocol317.FullDocumentDiagnosticReport)
+	if !ok || full.Kind != protocol317.DocumentDiagnosticReportKindFull || len(full.Items) == 0 || full.ResultID == nil {
+		t.Fatalf("Expected a full report with diagnostics and a result ID, got %+v", result)
+	}
+
+	// The client already has these diagnostics
+	result, err = DocumentDiagnostic(&glsp.Context{}, &protocol317.DocumentDiagnosticParams{
+		TextDocument:     protocol.TextDocumentIdentifier{URI: uri},
+		PreviousResultID: full.ResultID,
+	})
+	if err != nil {
+		t.Fatalf("DocumentDiagnostic failed: %v", err)
+	}
+
+	if unchanged, ok := result.(protocol317.UnchangedDocumentDiagnosticReport); !ok || unchanged.ResultID != *full.ResultID {
+		t.Errorf("Expected an unchanged report, got %+v", result)
+	}
+
+	// A stale result ID gets a full report
+	stale := "stale"
+
+	result, err = DocumentDiagnostic(&glsp.Context{}, &protocol317.DocumentDiagnosticParams{
+		TextDocument:     protocol.TextDocumentIdentifier{URI: uri},
+		PreviousResultID: &stale,
+	})
+	if err != nil {
+		t.Fatalf("DocumentDiagnostic failed: %v", err)
+	}
+
+	if _, ok := result.(protocol317.FullDocumentDiagnosticReport); !ok {
+		t.Errorf("Expected a full report for a stale result ID, got %+v", result)
+	}
+
+	// Unknown documents have no diagnostics
+	result, err = DocumentDiagnostic(&glsp.Context{}, &protocol317.DocumentDiagnosticParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///unknown.dws"},
+	})
+	if err != nil {
+		t.Fatalf("DocumentDiagnostic failed: %v", err)
+	}
+
+	if full, ok := result.(protocol317.FullDocumentDiagnosticReport); !ok || len(full.Items) != 0 || full.ResultID != nil {
+		t.Errorf("Expected an empty full report without result ID, got %+v", result)
+	}
+}
+
+func TestWorkspaceDiagnostic(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"good.dws":   "var Good: Integer;\n",
+		"broken.dws": brokenContent,
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{dir})
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexCacheDir = ""
+	})
+	SetServer(srv)
+
+	workspace.IndexWorkspace(context.Background(), srv.WorkspaceIndex(),
+		[]protocol.WorkspaceFolder{{URI: pathToURI(dir), Name: "root"}}, indexOptions(srv))
+
+	good := pathToURI(filepath.Join(dir, "good.dws"))
+	broken := pathToURI(filepath.Join(dir, "broken.dws"))
+	open := "file:///open.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: open, Text: brokenContent, Version: 3},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	report, err := WorkspaceDiagnostic(&glsp.Context{}, &protocol317.WorkspaceDiagnosticParams{})
+	if err != nil {
+		t.Fatalf("WorkspaceDiagnostic failed: %v", err)
+	}
+
+	reports := make(map[string]protocol317.WorkspaceFullDocumentDiagnosticReport)
+
+	for _, item := range report.Items {
+		full, ok := item.(protocol317.WorkspaceFullDocumentDiagnosticReport)
+		if !ok {
+			t.Fatalf("Expected full reports only, got %+v", item)
+		}
+
+		reports[full.URI] = full
+	}
+
+	if len(reports) != 3 {
+		t.Fatalf("Expected reports for 3 files, got %d: %+v", len(reports), report.Items)
+	}
+
+	if len(reports[good].Items) != 0 || reports[good].Version != nil {
+		t.Errorf("Expected no diagnostics and no version for good.dws, got %+v", reports[good])
+	}
+
+	// Files with errors that aren't open are compiled by the indexer
+	if len(reports[broken].Items) == 0 {
+		t.Error("Expected diagnostics for broken.dws")
+	}
+
+	if reports[open].Version == nil || *reports[open].Version != 3 || len(reports[open].Items) == 0 {
+		t.Errorf("Expected diagnostics of version 3 for the open document, got %+v", reports[open])
+	}
+
+	// The open document has the same contents as broken.dws, and the same result ID
+	if *reports[open].ResultID != *reports[broken].ResultID {
+		t.Errorf("Expected equal result IDs for equal contents, got %s and %s", *reports[open].ResultID, *reports[broken].ResultID)
+	}
+
+	// Results the client already has are reported unchanged
+	report, err = WorkspaceDiagnostic(&glsp.Context{}, &protocol317.WorkspaceDiagnosticParams{
+		PreviousResultIDs: []protocol317.PreviousResultID{
+			{URI: broken, Value: *reports[broken].ResultID},
+			{URI: good, Value: "stale"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WorkspaceDiagnostic failed: %v", err)
+	}
+
+	for _, item := range report.Items {
+		switch item := item.(type) {
+		case protocol317.WorkspaceUnchangedDocumentDiagnosticReport:
+			if item.URI != broken {
+				t.Errorf("Expected only broken.dws to be unchanged, got %s", item.URI)
+			}
+		case protocol317.WorkspaceFullDocumentDiagnosticReport:
+			if item.URI == broken {
+				t.Error("Expected an unchanged report for broken.dws")
+			}
+		}
+	}
+}
+
+func TestWorkspaceDiagnostic_StreamsPartialResults(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	for i := range workspaceDiagnosticBatchSize + 1 {
+		srv.Diagnostics().SetDiagnostics(fmt.Sprintf("file:///work/file%03d.dws", i), "1", nil)
+	}
+
+	var batches []int
+
+	glspContext := &glsp.Context{
+		Notify: func(method string, params any) {
+			if method != protocol.MethodProgress {
+				return
+			}
+
+			encoded, err := json.Marshal(params.(protocol.ProgressParams).Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var partial struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			if err := json.Unmarshal(encoded, &partial); err != nil {
+				t.Fatal(err)
+			}
+
+			batches = append(batches, len(partial.Items))
+		},
+	}
+
+	report, err := WorkspaceDiagnostic(glspContext, &protocol317.WorkspaceDiagnosticParams{
+		PartialResultParams: protocol.PartialResultParams{PartialResultToken: &protocol.ProgressToken{Value: "partial"}},
+	})
+	if err != nil {
+		t.Fatalf("WorkspaceDiagnostic failed: %v", err)
+	}
+
+	if len(report.Items) != 0 {
+		t.Errorf("Expected an empty final result, got %d items", len(report.Items))
+	}
+
+	if len(batches) != 2 || batches[0] != workspaceDiagnosticBatchSize || batches[1] != 1 {
+		t.Errorf("Expected batches of %d and 1 reports, got %v", workspaceDiagnosticBatchSize, batches)
+	}
+}
+
+func TestPullDiagnostics_DisablesPublishing(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	_, err := Initialize(&glsp.Context{
+		Params: json.RawMessage(`{"capabilities":{"textDocument":{"diagnostic":{}},"workspace":{"diagnostics":{"refreshSupport":true}}}}`),
+	}, &protocol.InitializeParams{})
+	if err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if !srv.SupportsPullDiagnostics() || !srv.SupportsDiagnosticRefresh() {
+		t.Fatal("Expected the client to pull diagnostics with refresh support")
+	}
+
+	published := 0
+
+	err = DidOpen(&glsp.Context{
+		Notify: func(method string, params any) {
+			if method == protocol.ServerTextDocumentPublishDiagnostics {
+				published++
+			}
+		},
+	}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: "file:///pulled.dws", Text: brokenContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	if published != 0 {
+		t.Errorf("Expected no published diagnostics for a pulling client, got %d", published)
+	}
+}
@@ -2,6 +2,8 @@
 package lsp
 
 import (
+	contextpkg "context"
+	"fmt"
 	"log"
 	"sort"
 
@@ -27,6 +29,18 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		return []protocol.Location{}, nil
 	}
 
+	progress := beginRequestProgress(context, srv, params.WorkDoneToken, "Finding references")
+
+	locations, err := findReferences(requestContext(srv, context), srv, params, progress)
+	progress.end(fmt.Sprintf("Found %d references", len(locations)))
+
+	return locations, err
+}
+
+// findReferences implements References. Progress of workspace-wide searches is
+// reported to progress, which may be nil. Workspace-wide searches stop early
+// and return ctx.Err() when ctx is cancelled.
+func findReferences(ctx contextpkg.Context, srv *server.Server, params *protocol.ReferenceParams, progress *workDoneProgress) ([]protocol.Location, error) {
 	// Extract request details
 	uri := params.TextDocument.URI
 	position := params.Position
@@ -36,18 +50,26 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		uri, position.Line, position.Character, includeDecl)
 
 	// Retrieve document from store
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for references: %s\n", uri)
 		return []protocol.Location{}, nil
 	}
 
+	// Use the last good program if the current text doesn't compile
+	doc, positions := doc.AnalysisView()
+
 	// Ensure we have a parsed program/AST
 	if doc.Program == nil || doc.Program.AST() == nil {
 		log.Printf("No AST available for references (document has parse errors): %s\n", uri)
 		return []protocol.Location{}, nil
 	}
 
+	position, ok := toSnapshotPosition(positions, position)
+	if !ok {
+		return []protocol.Location{}, nil
+	}
+
 	// Convert LSP (0-based) to AST (1-based)
 	astLine := int(position.Line) + 1
 	astColumn := int(position.Character) + 1
@@ -65,7 +87,8 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 	log.Printf("References target symbol: %s (kind=%s)", sym.Name, sym.Kind)
 
 	// Find the definition location (Task 6.11) to support includeDeclaration flag
-	defLocation := resolveSymbolDefinition(uri, targetName, astLine, astColumn, programAST)
+	defLocation := mapLocationToCurrent(
+		resolveSymbolDefinition(uri, targetName, astLine, astColumn, programAST), uri, positions)
 	if defLocation != nil {
 		log.Printf("Found definition at %s line %d, character %d",
 			defLocation.URI, defLocation.Range.Start.Line, defLocation.Range.Start.Character)
@@ -86,6 +109,8 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		for _, r := range ranges {
 			locations = append(locations, protocol.Location{URI: uri, Range: r})
 		}
+
+		locations = mapReferencesToCurrent(locations, uri, positions)
 		// Apply includeDeclaration flag (task 6.11)
 		locations = applyIncludeDeclaration(locations, defLocation, includeDecl)
 		// Sort by file then position (task 6.10)
@@ -111,6 +136,8 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		for _, r := range ranges {
 			locations = append(locations, protocol.Location{URI: uri, Range: r})
 		}
+
+		locations = mapReferencesToCurrent(locations, uri, positions)
 		// Apply includeDeclaration flag (task 6.11)
 		locations = applyIncludeDeclaration(locations, defLocation, includeDecl)
 		// Sort by file then position (task 6.10)
@@ -121,7 +148,7 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 
 	// For global symbols, search across all open documents
 	if scope != nil && scope.Type == analysis.ScopeGlobal {
-		openLocations := analysis.FindGlobalReferences(targetName, srv.Documents())
+		openLocations := analysis.FindGlobalReferences(ctx, targetName, srv.Documents())
 
 		indexLocations := []protocol.Location{}
 		if srv.Symbols() != nil {
@@ -131,7 +158,15 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		combined := append([]protocol.Location{}, openLocations...)
 		combined = append(combined, indexLocations...)
 
-		filtered := analysis.FilterByScope(combined, srv.Documents(), targetName, scope)
+		filtered := analysis.FilterByScopeWithProgress(ctx, combined, srv.Documents(), targetName, scope,
+			func(done, total int) {
+				progress.report(fmt.Sprintf("%d/%d files", done, total), done, total)
+			})
+		if ctx.Err() != nil {
+			log.Printf("References request for %s cancelled\n", targetName)
+			return nil, ctx.Err()
+		}
+
 		// Apply includeDeclaration flag (task 6.11)
 		filtered = applyIncludeDeclaration(filtered, defLocation, includeDecl)
 		// Sort by file then position (task 6.10)
@@ -177,7 +212,8 @@ func References(context *glsp.Context, params *protocol.ReferenceParams) ([]prot
 		return true
 	})
 
-	filtered := analysis.FilterByScope(locations, srv.Documents(), targetName, scope)
+	filtered := analysis.FilterByScope(ctx, locations, srv.Documents(), targetName, scope)
+	filtered = mapReferencesToCurrent(filtered, uri, positions)
 	// Apply includeDeclaration flag (task 6.11)
 	filtered = applyIncludeDeclaration(filtered, defLocation, includeDecl)
 	// Sort by file then position (task 6.10)
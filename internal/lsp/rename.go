@@ -89,13 +89,15 @@ func Rename(context *glsp.Context, params *protocol.RenameParams) (*protocol.Wor
 		uri, position.Line, position.Character, newName)
 
 	// Retrieve document from store
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for rename: %s\n", uri)
 		return nil, fmt.Errorf("document not found: %s", uri)
 	}
 
-	// Ensure we have a parsed program/AST
+	// Ensure we have a parsed program/AST. Unlike read-only features, rename
+	// doesn't fall back to the last good program: occurrences in edited text
+	// can't be located there, and a partial rename would corrupt the code.
 	if doc.Program == nil || doc.Program.AST() == nil {
 		log.Printf("No AST available for rename (document has parse errors): %s\n", uri)
 		return nil, errors.New("cannot rename in document with parse errors")
@@ -137,7 +139,16 @@ func Rename(context *glsp.Context, params *protocol.RenameParams) (*protocol.Wor
 		},
 	}
 
-	locations, err := References(context, refParams)
+	// Stamp the edits with the versions the references are found in. Documents
+	// may change while the references are searched; the client then rejects
+	// the edits rather than applying them to text they weren't computed on.
+	versions := documentVersions(srv.Documents())
+	versions[uri] = int32(doc.Version)
+
+	progress := beginRequestProgress(context, srv, params.WorkDoneToken, "Renaming "+oldName)
+	defer progress.end("Rename complete")
+
+	locations, err := findReferences(requestContext(srv, context), srv, refParams, progress)
 	if err != nil {
 		log.Printf("Error finding references for rename: %v\n", err)
 		return nil, fmt.Errorf("failed to find references: %w", err)
@@ -151,7 +162,7 @@ func Rename(context *glsp.Context, params *protocol.RenameParams) (*protocol.Wor
 	log.Printf("Found %d references for rename\n", len(locations))
 
 	// Build WorkspaceEdit with all the text edits
-	workspaceEdit := buildWorkspaceEdit(locations, newName, srv.Documents())
+	workspaceEdit := buildWorkspaceEdit(locations, newName, versions)
 
 	return workspaceEdit, nil
 }
@@ -262,7 +273,7 @@ func validateRenameRequest(uri string, position protocol.Position) (*ast.Program
 		return nil, 0, 0, errors.New("server instance not available")
 	}
 
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found for prepareRename: %s\n", uri)
 		return nil, 0, 0, fmt.Errorf("document not found: %s", uri)
@@ -304,9 +315,23 @@ func canRenameSymbol(symbolName string) (bool, string) {
 	return true, ""
 }
 
+// documentVersions returns the versions of the open documents, by URI.
+func documentVersions(docs *server.DocumentStore) map[string]int32 {
+	versions := make(map[string]int32)
+
+	for _, uri := range docs.List() {
+		if doc, exists := docs.Get(uri); exists {
+			versions[uri] = int32(doc.Version)
+		}
+	}
+
+	return versions
+}
+
 // buildWorkspaceEdit creates a WorkspaceEdit from a list of locations.
-// It groups edits by document URI and creates TextDocumentEdit entries.
-func buildWorkspaceEdit(locations []protocol.Location, newName string, docs *server.DocumentStore) *protocol.WorkspaceEdit {
+// It groups edits by document URI and creates TextDocumentEdit entries,
+// versioned for the open documents in versions.
+func buildWorkspaceEdit(locations []protocol.Location, newName string, versions map[string]int32) *protocol.WorkspaceEdit {
 	// Group locations by document URI
 	editsByURI := make(map[protocol.DocumentUri][]protocol.TextEdit)
 
@@ -324,11 +349,10 @@ func buildWorkspaceEdit(locations []protocol.Location, newName string, docs *ser
 	documentChanges := make([]any, 0, len(editsByURI))
 
 	for uri, edits := range editsByURI {
-		// Get document version from DocumentStore
+		// Files that aren't open have no version
 		var version *int32
 
-		if doc, exists := docs.Get(uri); exists {
-			v := int32(doc.Version)
+		if v, open := versions[uri]; open {
 			version = &v
 		}
 
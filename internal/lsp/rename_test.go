@@ -352,7 +352,7 @@ func TestBuildWorkspaceEdit(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			edit := buildWorkspaceEdit(tt.locations, tt.newName, docStore)
+			edit := buildWorkspaceEdit(tt.locations, tt.newName, documentVersions(docStore))
 
 			if edit == nil {
 				t.Fatal("expected WorkspaceEdit, got nil")
@@ -408,7 +408,7 @@ func TestBuildWorkspaceEdit_EmptyLocations(t *testing.T) {
 	locations := []protocol.Location{}
 	newName := "newName"
 
-	edit := buildWorkspaceEdit(locations, newName, docStore)
+	edit := buildWorkspaceEdit(locations, newName, documentVersions(docStore))
 
 	if edit == nil {
 		t.Fatal("expected WorkspaceEdit, got nil")
@@ -420,6 +420,37 @@ func TestBuildWorkspaceEdit_EmptyLocations(t *testing.T) {
 	}
 }
 
+// TestBuildWorkspaceEdit_Versions tests that open documents get the versions
+// the references were found in, and other files none.
+func TestBuildWorkspaceEdit_Versions(t *testing.T) {
+	locations := []protocol.Location{
+		{URI: "file:///open.dws", Range: protocol.Range{End: protocol.Position{Character: 1}}},
+		{URI: "file:///closed.dws", Range: protocol.Range{End: protocol.Position{Character: 1}}},
+	}
+
+	edit := buildWorkspaceEdit(locations, "y", map[string]int32{"file:///open.dws": 3})
+
+	for _, change := range edit.DocumentChanges {
+		textDocEdit, ok := change.(protocol.TextDocumentEdit)
+		if !ok {
+			t.Fatalf("expected TextDocumentEdit, got %T", change)
+		}
+
+		version := textDocEdit.TextDocument.Version
+
+		switch textDocEdit.TextDocument.URI {
+		case "file:///open.dws":
+			if version == nil || *version != 3 {
+				t.Errorf("expected version 3 for the open document, got %v", version)
+			}
+		default:
+			if version != nil {
+				t.Errorf("expected no version for a closed file, got %d", *version)
+			}
+		}
+	}
+}
+
 // TestConvertToEdits tests that TextEdits are converted to interface{} correctly.
 func TestConvertToEdits(t *testing.T) {
 	textEdits := []protocol.TextEdit{
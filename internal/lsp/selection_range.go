@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"log"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// SelectionRange handles the textDocument/selectionRange request.
+// For each position it returns the ranges of the enclosing syntax nodes, so
+// that expanding the selection walks from the identifier through expressions,
+// statements and blocks out to the enclosing routine, type and unit.
+func SelectionRange(context *glsp.Context, params *protocol.SelectionRangeParams) ([]protocol.SelectionRange, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in SelectionRange")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	log.Printf("SelectionRange request for %s at %d position(s)\n", uri, len(params.Positions))
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for selection range: %s\n", uri)
+		return nil, nil
+	}
+
+	// Use the partial AST or the last good program if the current text doesn't compile
+	syntax, positions := doc.SyntaxView()
+
+	var program *ast.Program
+	if syntax != nil {
+		program = syntax.AST()
+	}
+
+	// The result must have one entry per requested position
+	result := make([]protocol.SelectionRange, 0, len(params.Positions))
+
+	for _, position := range params.Positions {
+		result = append(result, selectionRangeAt(program, positions, doc.Text, position))
+	}
+
+	return result, nil
+}
+
+// selectionRangeAt returns the chain of selection ranges enclosing position in
+// the current text, ending with the whole document.
+func selectionRangeAt(program *ast.Program, positions *document.PositionMap, text string, position protocol.Position) protocol.SelectionRange {
+	var nodeRanges []protocol.Range
+
+	if program != nil {
+		if snapshotPosition, ok := toSnapshotPosition(positions, position); ok {
+			nodeRanges = analysis.SelectionRanges(program, snapshotPosition)
+		}
+	}
+
+	// The unit is the outermost selection
+	lines := strings.Split(text, "\n")
+	nodeRanges = append(nodeRanges, protocol.Range{
+		End: protocol.Position{
+			Line:      uint32(len(lines) - 1),
+			Character: uint32(len(utf16.Encode([]rune(lines[len(lines)-1])))),
+		},
+	})
+
+	// Map the ranges to the current text, keeping each enclosing the previous one
+	var ranges []protocol.Range
+
+	for i, rng := range nodeRanges {
+		if positions != nil && i < len(nodeRanges)-1 {
+			var ok bool
+			if rng, ok = positions.RangeToCurrent(rng); !ok {
+				continue
+			}
+		}
+
+		if len(ranges) > 0 {
+			inner := ranges[len(ranges)-1]
+			if rng == inner || !analysis.EnclosesRange(rng, inner) {
+				continue
+			}
+		} else if !analysis.EnclosesRange(rng, protocol.Range{Start: position, End: position}) {
+			continue
+		}
+
+		ranges = append(ranges, rng)
+	}
+
+	if len(ranges) == 0 {
+		return protocol.SelectionRange{Range: protocol.Range{Start: position, End: position}}
+	}
+
+	// Link the ranges from the outermost inwards
+	var parent *protocol.SelectionRange
+
+	for i := len(ranges) - 1; i >= 0; i-- {
+		parent = &protocol.SelectionRange{Range: ranges[i], Parent: parent}
+	}
+
+	return *parent
+}
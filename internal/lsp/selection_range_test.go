@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestSelectionRange(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := "file:///selection.dws"
+	content := `procedure Foo;
+var x: Integer;
+begin
+  x := x + 1;
+end;
+
+Foo;`
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	positions := []protocol.Position{
+		{Line: 3, Character: 7}, // second x
+		{Line: 6, Character: 1}, // Foo call
+	}
+
+	result, err := SelectionRange(&glsp.Context{}, &protocol.SelectionRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Positions:    positions,
+	})
+	if err != nil {
+		t.Fatalf("SelectionRange failed: %v", err)
+	}
+
+	if len(result) != len(positions) {
+		t.Fatalf("Expected %d selection ranges, got %d", len(positions), len(result))
+	}
+
+	first := result[0]
+
+	identifier := protocol.Range{Start: protocol.Position{Line: 3, Character: 7}, End: protocol.Position{Line: 3, Character: 8}}
+	if first.Range != identifier {
+		t.Errorf("Expected the innermost range %+v, got %+v", identifier, first.Range)
+	}
+
+	document := protocol.Range{End: protocol.Position{Line: 6, Character: 4}}
+
+	var chain []protocol.Range
+	for sel := &first; sel != nil; sel = sel.Parent {
+		chain = append(chain, sel.Range)
+	}
+
+	if chain[len(chain)-1] != document {
+		t.Errorf("Expected the outermost range to be the document %+v, got %+v", document, chain[len(chain)-1])
+	}
+
+	for i := 1; i < len(chain); i++ {
+		if chain[i] == chain[i-1] {
+			t.Errorf("Range %d repeats its child: %+v", i, chain[i])
+		}
+	}
+
+	// identifier, expression, assignment, block, procedure, document
+	if len(chain) < 5 {
+		t.Errorf("Expected at least 5 nested ranges, got %+v", chain)
+	}
+
+	if result[1].Parent == nil {
+		t.Errorf("Expected the call to have enclosing ranges, got %+v", result[1])
+	}
+}
+
+func TestSelectionRangeUnknownDocument(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	result, err := SelectionRange(&glsp.Context{}, &protocol.SelectionRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///missing.dws"},
+		Positions:    []protocol.Position{{Line: 0, Character: 0}},
+	})
+	if err != nil {
+		t.Fatalf("SelectionRange failed: %v", err)
+	}
+
+	if result != nil {
+		t.Errorf("Expected no result for an unknown document, got %+v", result)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -23,21 +24,17 @@ func SemanticTokensFull(context *glsp.Context, params *protocol.SemanticTokensPa
 	}
 
 	// Get document from store
-	doc, ok := srv.Documents().Get(string(params.TextDocument.URI))
+	doc, ok := getAnalyzedDocument(srv, string(params.TextDocument.URI))
 	if !ok || doc == nil {
 		log.Printf("Document not found: %s\n", params.TextDocument.URI)
 		return nil, nil //nolint:nilnil // nil is valid LSP response
 	}
 
-	// Check if document has a valid program
-	program := doc.Program
-	if program == nil {
-		log.Printf("Document has no program: %s\n", params.TextDocument.URI)
-		return nil, nil //nolint:nilnil // nil is valid LSP response
-	}
+	// Use the partial AST or the last good program if the current text doesn't compile
+	view, positions := doc.SyntaxView()
 
 	// Get the AST
-	ast := program.AST()
+	ast := view.AST()
 	if ast == nil {
 		log.Printf("Document AST is nil: %s\n", params.TextDocument.URI)
 		return nil, nil //nolint:nilnil // nil is valid LSP response
@@ -57,6 +54,8 @@ func SemanticTokensFull(context *glsp.Context, params *protocol.SemanticTokensPa
 		return nil, nil //nolint:nilnil // nil is valid LSP response
 	}
 
+	tokens = mapSemanticTokensToCurrent(tokens, positions)
+
 	// Generate a resultId for delta support
 	resultID := server.GenerateResultID(params.TextDocument.URI, doc.Version)
 
@@ -92,21 +91,17 @@ func SemanticTokensFullDelta(context *glsp.Context, params *protocol.SemanticTok
 	}
 
 	// Get document from store
-	doc, ok := srv.Documents().Get(string(params.TextDocument.URI))
+	doc, ok := getAnalyzedDocument(srv, string(params.TextDocument.URI))
 	if !ok || doc == nil {
 		log.Printf("Document not found: %s\n", params.TextDocument.URI)
 		return nil, nil //nolint:nilnil // nil is valid LSP response
 	}
 
-	// Check if document has a valid program
-	program := doc.Program
-	if program == nil {
-		log.Printf("Document has no program: %s\n", params.TextDocument.URI)
-		return nil, nil //nolint:nilnil // nil is valid LSP response
-	}
+	// Use the partial AST or the last good program if the current text doesn't compile
+	view, positions := doc.SyntaxView()
 
 	// Get the AST
-	ast := program.AST()
+	ast := view.AST()
 	if ast == nil {
 		log.Printf("Document AST is nil: %s\n", params.TextDocument.URI)
 		return nil, nil //nolint:nilnil // nil is valid LSP response
@@ -126,6 +121,8 @@ func SemanticTokensFullDelta(context *glsp.Context, params *protocol.SemanticTok
 		return nil, nil //nolint:nilnil // nil is valid LSP response
 	}
 
+	newTokens = mapSemanticTokensToCurrent(newTokens, positions)
+
 	// Generate new resultId
 	newResultID := server.GenerateResultID(params.TextDocument.URI, doc.Version)
 
@@ -161,3 +158,32 @@ func SemanticTokensFullDelta(context *glsp.Context, params *protocol.SemanticTok
 		return result.Full, nil
 	}
 }
+
+// mapSemanticTokensToCurrent translates tokens collected from the analyzed
+// snapshot to the current text. Tokens whose text has been edited since are
+// dropped rather than highlighted in the wrong place.
+func mapSemanticTokensToCurrent(tokens []server.SemanticToken, positions *document.PositionMap) []server.SemanticToken {
+	if positions == nil {
+		return tokens
+	}
+
+	mapped := make([]server.SemanticToken, 0, len(tokens))
+
+	for _, tok := range tokens {
+		tokenRange := protocol.Range{
+			Start: protocol.Position{Line: tok.Line, Character: tok.StartChar},
+			End:   protocol.Position{Line: tok.Line, Character: tok.StartChar + tok.Length},
+		}
+
+		current, ok := positions.RangeToCurrentExact(tokenRange)
+		if !ok {
+			continue
+		}
+
+		tok.Line = current.Start.Line
+		tok.StartChar = current.Start.Character
+		mapped = append(mapped, tok)
+	}
+
+	return mapped
+}
@@ -122,7 +122,7 @@ func validateSignatureHelpRequest(uri string) (*server.Server, *server.Document)
 		return nil, nil
 	}
 
-	doc, exists := srv.Documents().Get(uri)
+	doc, exists := getAnalyzedDocument(srv, uri)
 	if !exists {
 		log.Printf("Document not found: %s\n", uri)
 		return nil, nil
@@ -2,15 +2,22 @@
 package lsp
 
 import (
+	contextpkg "context"
 	"log"
+	"time"
 
 	"github.com/CWBudde/go-dws-lsp/internal/analysis"
 	"github.com/CWBudde/go-dws-lsp/internal/document"
 	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
+// analysisWaitTimeout bounds how long request handlers wait for a pending
+// background analysis before falling back to the last analyzed program.
+const analysisWaitTimeout = 250 * time.Millisecond
+
 // DidOpen handles the textDocument/didOpen notification.
 // This is sent when a document is opened in the editor.
 func DidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
@@ -30,8 +37,11 @@ func DidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams)
 	log.Printf("Document opened: %s (version %d, language %s, %d bytes)\n",
 		uri, version, languageID, len(text))
 
+	// The document is compiled synchronously below; drop any stale queued analysis
+	srv.Analysis().Cancel(uri)
+
 	// Parse document and get diagnostics
-	program, diagnostics, err := analysis.ParseDocument(text, uri)
+	program, partialAST, diagnostics, err := analysis.ParseDocumentWithRecovery(text, uri)
 	if err != nil {
 		log.Printf("Error parsing document %s: %v", uri, err)
 		// Still store the document even if parsing failed
@@ -41,9 +51,18 @@ func DidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams)
 			Version:    version,
 			LanguageID: languageID,
 			Program:    nil,
+
+			Diagnostics:         diagnostics,
+			DiagnosticsResultID: diagnosticsResultID(text),
 		}
 		srv.Documents().Set(uri, doc)
 
+		// Clear the diagnostics published for the file on disk, the document
+		// owns them now
+		if publishesWorkspaceDiagnostics(srv) {
+			PublishDiagnostics(context, uri, []protocol.Diagnostic{})
+		}
+
 		return nil
 	}
 
@@ -54,6 +73,16 @@ func DidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams)
 		Version:    version,
 		LanguageID: languageID,
 		Program:    program,
+		PartialAST: partialAST,
+
+		Diagnostics:         diagnostics,
+		DiagnosticsResultID: diagnosticsResultID(text),
+	}
+
+	if program != nil {
+		doc.LastGoodProgram = program
+		doc.LastGoodText = text
+		doc.LastGoodVersion = version
 	}
 
 	// Store document in DocumentStore
@@ -63,8 +92,9 @@ func DidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams)
 		srv.Symbols().UpdateDocument(doc)
 	}
 
-	// Publish diagnostics to the client
-	PublishDiagnostics(context, uri, diagnostics)
+	// Publish diagnostics to the client, replacing those published for the
+	// file on disk
+	publishDocumentDiagnostics(context, srv, uri, diagnostics)
 
 	return nil
 }
@@ -82,7 +112,8 @@ func DidClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams
 	// Extract URI
 	uri := params.TextDocument.URI
 
-	// Remove document from store
+	// Stop any background analysis and remove document from store
+	srv.Analysis().Cancel(uri)
 	srv.Documents().Delete(uri)
 
 	// Invalidate completion cache for this document (task 9.17)
@@ -99,9 +130,22 @@ func DidClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams
 
 	log.Printf("Document closed: %s\n", uri)
 
-	// Send empty diagnostics to clear error markers in the editor
+	// Workspace files go back to the diagnostics of their contents on disk,
+	// which may differ from the closed document's text
+	if srv.Config().WorkspaceDiagnostics &&
+		workspace.IsIndexedPath(uriToPath(uri), srv.GetWorkspaceFolders(), srv.Config().IndexFilter) {
+		reindexWatchedFile(srv, uri)
+
+		if !srv.SupportsPullDiagnostics() {
+			publishFileDiagnostics(context, srv, uri)
+			return nil
+		}
+	}
+
+	// Send empty diagnostics to clear error markers in the editor; clients
+	// pulling diagnostics drop those of closed documents themselves.
 	// Only send notification if context is properly initialized (not in tests)
-	if context != nil && context.Notify != nil {
+	if context != nil && context.Notify != nil && !srv.SupportsPullDiagnostics() {
 		diagnosticsParams := &protocol.PublishDiagnosticsParams{
 			URI:         uri,
 			Diagnostics: []protocol.Diagnostic{},
@@ -127,17 +171,49 @@ func DidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentPara
 	uri := params.TextDocument.URI
 	version := int(params.TextDocument.Version)
 
-	// Retrieve document from store
-	doc, exists := srv.Documents().Get(uri)
+	// Apply the changes to the stored document. Update replaces the document
+	// atomically, so an analysis result applied in the meantime isn't lost and
+	// concurrent requests keep reading the snapshot they already have.
+	updatedDoc, exists := srv.Documents().Update(uri, func(doc *server.Document) bool {
+		*doc = applyContentChanges(doc, version, params.ContentChanges)
+		return true
+	})
 	if !exists {
 		log.Printf("Warning: Document not found for didChange: %s\n", uri)
 		return nil
 	}
 
-	// Apply all content changes
+	// Invalidate completion cache for this document (task 9.17)
+	if srv.CompletionCache() != nil {
+		srv.CompletionCache().InvalidateDocument(uri)
+		log.Printf("Invalidated completion cache for %s", uri)
+	}
+
+	// Invalidate semantic tokens cache for this document (task 12.20)
+	if srv.SemanticTokensCache() != nil {
+		srv.SemanticTokensCache().InvalidateDocument(uri)
+		log.Printf("Invalidated semantic tokens cache for %s", uri)
+	}
+
+	// Recompile in the background; rapid edits are coalesced by the scheduler
+	scheduleAnalysis(context, srv, uri, version, updatedDoc.Text)
+
+	return nil
+}
+
+// applyContentChanges returns the document doc becomes with the given content
+// changes applied. Its program no longer matches the text until the background
+// analysis of the new version completes; requests arriving in between use the
+// last good program through the recorded edits.
+func applyContentChanges(doc *server.Document, version int, changes []any) server.Document {
+	uri := doc.URI
+
+	// Apply all content changes, recording them so that positions in the last
+	// successfully compiled text can be translated to the new text
 	newText := doc.Text
+	edits := doc.Edits
 
-	for i, changeInterface := range params.ContentChanges {
+	for i, changeInterface := range changes {
 		// Type assert to TextDocumentContentChangeEvent
 		change, ok := changeInterface.(protocol.TextDocumentContentChangeEvent)
 		if !ok {
@@ -147,10 +223,11 @@ func DidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentPara
 
 		if change.Range == nil {
 			// Full sync mode: replace entire document text
+			edits = edits.WithTextChange(newText, change.Text)
 			newText = change.Text
 
 			log.Printf("Document changed (full sync): %s (version %d, change %d/%d)\n",
-				uri, version, i+1, len(params.ContentChanges))
+				uri, version, i+1, len(changes))
 		} else {
 			// Incremental sync mode: apply diff
 			updatedText, err := document.ApplyContentChange(newText, change)
@@ -160,49 +237,129 @@ func DidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentPara
 				continue
 			}
 
+			edits = edits.WithEdit(*change.Range, change.Text)
 			newText = updatedText
 
 			log.Printf("Document changed (incremental): %s (version %d, change %d/%d)\n",
-				uri, version, i+1, len(params.ContentChanges))
+				uri, version, i+1, len(changes))
 		}
 	}
 
-	// Parse the updated document and get diagnostics
-	program, diagnostics, err := analysis.ParseDocument(newText, uri)
-	if err != nil {
-		log.Printf("Error parsing document %s after change: %v", uri, err)
-		// Still update the document even if parsing failed
-		program = nil
+	updatedDoc := server.Document{
+		URI:             uri,
+		Text:            newText,
+		Version:         version,
+		LanguageID:      doc.LanguageID,
+		LastGoodProgram: doc.LastGoodProgram,
+		LastGoodText:    doc.LastGoodText,
+		LastGoodVersion: doc.LastGoodVersion,
+
+		// Keep reporting the last diagnostics until the new version is analyzed
+		Diagnostics:         doc.Diagnostics,
+		DiagnosticsResultID: doc.DiagnosticsResultID,
 	}
 
-	// Update document in store with new text and program
-	updatedDoc := &server.Document{
-		URI:        uri,
-		Text:       newText,
-		Version:    version,
-		LanguageID: doc.LanguageID,
-		Program:    program,
+	if doc.LastGoodProgram != nil {
+		updatedDoc.Edits = edits
 	}
-	srv.Documents().Set(uri, updatedDoc)
 
-	if srv.Symbols() != nil {
+	return updatedDoc
+}
+
+// scheduleAnalysis queues a debounced compile of the given document version.
+// Diagnostics are published once the compile finishes, but only if no newer
+// version of the document has been received in the meantime.
+func scheduleAnalysis(context *glsp.Context, srv *server.Server, uri string, version int, text string) {
+	srv.Analysis().Schedule(uri, version, text, func(result *server.AnalysisResult) {
+		applyAnalysisResult(context, srv, result)
+	})
+}
+
+// applyAnalysisResult stores a finished compile in the document store and
+// publishes its diagnostics. Results for outdated versions are dropped.
+func applyAnalysisResult(context *glsp.Context, srv *server.Server, result *server.AnalysisResult) {
+	if result.Err != nil {
+		log.Printf("Error parsing document %s (version %d): %v", result.URI, result.Version, result.Err)
+	}
+
+	updatedDoc, applied := srv.Documents().Update(result.URI, func(doc *server.Document) bool {
+		if doc.Version != result.Version {
+			return false
+		}
+
+		doc.Program = result.Program
+		doc.PartialAST = result.PartialAST
+		doc.Diagnostics = result.Diagnostics
+		doc.DiagnosticsResultID = diagnosticsResultID(result.Text)
+
+		// Keep the last good program when this version doesn't compile
+		if result.Program != nil {
+			doc.LastGoodProgram = result.Program
+			doc.LastGoodText = result.Text
+			doc.LastGoodVersion = result.Version
+			doc.Edits = nil
+		}
+
+		return true
+	})
+	if !applied {
+		log.Printf("Dropping analysis of %s version %d (document changed or closed)", result.URI, result.Version)
+		return
+	}
+
+	// Without a program the references of the last good program are kept
+	if srv.Symbols() != nil && (updatedDoc.Program != nil || updatedDoc.LastGoodProgram == nil) {
 		srv.Symbols().UpdateDocument(updatedDoc)
 	}
 
-	// Invalidate completion cache for this document (task 9.17)
+	// Cached entries may have been computed against the previous program
 	if srv.CompletionCache() != nil {
-		srv.CompletionCache().InvalidateDocument(uri)
-		log.Printf("Invalidated completion cache for %s", uri)
+		srv.CompletionCache().InvalidateDocument(result.URI)
 	}
 
-	// Invalidate semantic tokens cache for this document (task 12.20)
 	if srv.SemanticTokensCache() != nil {
-		srv.SemanticTokensCache().InvalidateDocument(uri)
-		log.Printf("Invalidated semantic tokens cache for %s", uri)
+		srv.SemanticTokensCache().InvalidateDocument(result.URI)
 	}
 
-	// Publish updated diagnostics to the client
-	PublishDiagnostics(context, uri, diagnostics)
+	// Publish updated diagnostics to the client, or have it pull them again
+	publishDocumentDiagnostics(context, srv, result.URI, result.Diagnostics)
+	refreshDiagnostics(context, srv)
+}
 
-	return nil
+// compileDocument is the CompileFunc used by the analysis scheduler.
+func compileDocument(ctx contextpkg.Context, uri string, text string) (*server.AnalysisResult, error) {
+	// Skip the compile entirely if the version was superseded while queued
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	program, partialAST, diagnostics, err := analysis.ParseDocumentWithRecovery(text, uri)
+
+	return &server.AnalysisResult{
+		Program:     program,
+		PartialAST:  partialAST,
+		Diagnostics: diagnostics,
+	}, err
+}
+
+// getAnalyzedDocument returns the document for uri after giving a pending
+// background analysis a brief chance to complete, so handlers see a Program
+// that matches the current text. If the wait times out, Program is nil and
+// handlers fall back to the last good program via AnalysisView.
+func getAnalyzedDocument(srv *server.Server, uri string) (*server.Document, bool) {
+	doc, exists := srv.Documents().Get(uri)
+	if !exists {
+		return nil, false
+	}
+
+	if !srv.Analysis().Pending(uri) {
+		return doc, true
+	}
+
+	if !srv.Analysis().Wait(uri, doc.Version, analysisWaitTimeout) {
+		log.Printf("Analysis of %s still running, using last good program", uri)
+		return doc, true
+	}
+
+	return srv.Documents().Get(uri)
 }
@@ -1,7 +1,10 @@
 package lsp
 
 import (
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/CWBudde/go-dws-lsp/internal/server"
 	"github.com/tliron/glsp"
@@ -537,3 +540,260 @@ func TestDidChange_NonexistentDocument(t *testing.T) {
 		t.Error("Nonexistent document should not be created by DidChange")
 	}
 }
+
+func TestDidChange_KeepsLastGoodProgram(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := testDocumentURI
+	ctx := &glsp.Context{}
+
+	err := DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        uri,
+			LanguageID: "dwscript",
+			Version:    1,
+			Text:       "var x: Integer;\nx := 42;",
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen returned error: %v", err)
+	}
+
+	// Insert an incomplete line at the top of the document
+	err = DidChange(ctx, &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+		ContentChanges: []any{
+			protocol.TextDocumentContentChangeEvent{
+				Range: &protocol.Range{
+					Start: protocol.Position{Line: 0, Character: 0},
+					End:   protocol.Position{Line: 0, Character: 0},
+				},
+				Text: "var y := ;\n",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChange returned error: %v", err)
+	}
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		t.Fatal("Document should still exist after DidChange")
+	}
+
+	if doc.Program != nil {
+		t.Fatal("Expected no current program for a document that doesn't compile")
+	}
+
+	if doc.LastGoodProgram == nil || doc.LastGoodVersion != 1 {
+		t.Fatalf("Expected last good program from version 1, got %v (version %d)",
+			doc.LastGoodProgram, doc.LastGoodVersion)
+	}
+
+	if doc.Edits.Len() != 1 {
+		t.Errorf("Expected 1 recorded edit, got %d", doc.Edits.Len())
+	}
+
+	// The indexed references of the last good program are kept
+	if len(srv.Symbols().FindReferences("x", nil)) == 0 {
+		t.Error("Expected the indexed references of x to be kept")
+	}
+
+	// References still work and are reported at their current positions
+	locations, err := References(ctx, &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 4}, // "var x", moved down one line
+		},
+		Context: protocol.ReferenceContext{IncludeDeclaration: true},
+	})
+	if err != nil {
+		t.Fatalf("References returned error: %v", err)
+	}
+
+	if len(locations) != 2 {
+		t.Fatalf("Expected 2 references to x, got %d: %v", len(locations), locations)
+	}
+
+	for _, loc := range locations {
+		if loc.Range.Start.Line != 1 && loc.Range.Start.Line != 2 {
+			t.Errorf("Reference at line %d was not shifted past the inserted line", loc.Range.Start.Line)
+		}
+	}
+
+	// Positions inside the newly typed text have no counterpart in the old AST
+	hover, err := Hover(ctx, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 0, Character: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Hover returned error: %v", err)
+	}
+
+	if hover != nil {
+		t.Errorf("Expected no hover inside edited text, got %v", hover.Contents)
+	}
+}
+
+func TestDidChange_SuccessfulCompileReplacesLastGoodProgram(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	uri := testDocumentURI
+	ctx := &glsp.Context{}
+
+	err := DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        uri,
+			LanguageID: "dwscript",
+			Version:    1,
+			Text:       testVarDeclaration,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen returned error: %v", err)
+	}
+
+	newText := "var x: Integer;\nvar y: String;"
+
+	err = DidChange(ctx, &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+		ContentChanges: []any{
+			protocol.TextDocumentContentChangeEvent{Text: newText},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChange returned error: %v", err)
+	}
+
+	doc, _ := getAnalyzedDocument(srv, uri)
+	if doc.Program == nil {
+		t.Fatal("Expected the new version to compile")
+	}
+
+	if doc.LastGoodProgram != doc.Program || doc.LastGoodVersion != 2 || doc.LastGoodText != newText {
+		t.Error("Expected the last good program to be the current program")
+	}
+
+	if doc.Edits != nil {
+		t.Errorf("Expected no pending edits, got %d", doc.Edits.Len())
+	}
+}
+
+func TestDidChange_ConcurrentRequests(t *testing.T) {
+	srv := server.New()
+	srv.Analysis().SetDelay(time.Millisecond)
+	SetServer(srv)
+
+	uri := testDocumentURI
+	ctx := &glsp.Context{}
+	text := "var x: Integer;\nx := 42;"
+
+	err := DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        uri,
+			LanguageID: "dwscript",
+			Version:    1,
+			Text:       text,
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen returned error: %v", err)
+	}
+
+	position := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 0, Character: 4},
+	}
+
+	// Requests run on their own goroutines, like the concurrent methods of the
+	// transport, while edits arrive and background analyses complete
+	requests := []func(){
+		func() {
+			_, _ = References(ctx, &protocol.ReferenceParams{
+				TextDocumentPositionParams: position,
+				Context:                    protocol.ReferenceContext{IncludeDeclaration: true},
+			})
+		},
+		func() {
+			_, _ = Rename(ctx, &protocol.RenameParams{TextDocumentPositionParams: position, NewName: "y"})
+		},
+		func() { _, _ = Hover(ctx, &protocol.HoverParams{TextDocumentPositionParams: position}) },
+		func() {
+			_, _ = DocumentSymbol(ctx, &protocol.DocumentSymbolParams{TextDocument: position.TextDocument})
+		},
+		func() {
+			_, _ = DocumentFormatting(ctx, &protocol.DocumentFormattingParams{TextDocument: position.TextDocument})
+		},
+		func() { _, _ = WorkspaceSymbol(ctx, &protocol.WorkspaceSymbolParams{Query: "x"}) },
+	}
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for _, request := range requests {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					request()
+				}
+			}
+		}()
+	}
+
+	for version := 2; version <= 50; version++ {
+		// Every other version doesn't compile
+		text = "var x: Integer;\n" + strings.Repeat("x := x + 1;\n", version)
+		if version%2 == 1 {
+			text += "x := ;\n"
+		}
+
+		err = DidChange(ctx, &protocol.DidChangeTextDocumentParams{
+			TextDocument: protocol.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				Version:                protocol.Integer(version),
+			},
+			ContentChanges: []any{
+				protocol.TextDocumentContentChangeEvent{Text: text},
+			},
+		})
+		if err != nil {
+			t.Fatalf("DidChange returned error: %v", err)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	close(done)
+	wg.Wait()
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		t.Fatal("Document should still exist after the edits")
+	}
+
+	if doc.Text != text || doc.Version != 50 {
+		t.Errorf("Expected version 50 with all edits applied, got version %d:\n%s", doc.Version, doc.Text)
+	}
+
+	if doc.Program == nil {
+		t.Error("Expected the last version to be compiled")
+	}
+}
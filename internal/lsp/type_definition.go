@@ -0,0 +1,87 @@
+package lsp
+
+import (
+	"log"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// TypeDefinition handles the textDocument/typeDefinition request.
+// It navigates from a variable, field, parameter or function to the
+// declaration of its type, such as the class TConnection for a variable
+// declared as "var conn: TConnection". Built-in types have no declaration.
+func TypeDefinition(context *glsp.Context, params *protocol.TypeDefinitionParams) (any, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in TypeDefinition")
+		return []protocol.Location{}, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+	log.Printf("TypeDefinition request at %s line %d, character %d\n", uri, position.Line, position.Character)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for type definition: %s\n", uri)
+		return []protocol.Location{}, nil
+	}
+
+	// Use the last good program if the current text doesn't compile
+	view, positions := doc.AnalysisView()
+	if view.Program == nil {
+		return []protocol.Location{}, nil
+	}
+
+	programAST := view.Program.AST()
+
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return []protocol.Location{}, nil
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	pos := token.Position{Line: int(position.Line) + 1, Column: int(position.Character) + 1}
+
+	var name string
+
+	if path := analysis.FindNodePathAtPosition(programAST, pos.Line, pos.Column); len(path) > 0 {
+		switch node := path[len(path)-1].(type) {
+		case *ast.Identifier:
+			name = node.Value
+		case *ast.TypeAnnotation:
+			name = node.Name
+		}
+	}
+
+	if name == "" {
+		log.Printf("Position %d:%d is not on a symbol\n", pos.Line, pos.Column)
+		return []protocol.Location{}, nil
+	}
+
+	typeInfo := analysis.ResolveSymbolType(view, srv.WorkspaceIndex(), name, int(position.Line), int(position.Character))
+	if typeInfo == nil || typeInfo.IsBuiltIn {
+		log.Printf("No type declaration found for symbol %s\n", name)
+		return []protocol.Location{}, nil
+	}
+
+	resolver := analysis.NewSymbolResolverWithIndex(uri, programAST, pos, srv.WorkspaceIndex())
+
+	// Locations in this document refer to the analyzed snapshot
+	locations := mapLocationsToCurrent(resolver.ResolveSymbol(typeInfo.TypeName), uri, positions)
+	if len(locations) == 0 {
+		log.Printf("Declaration of type %s not found\n", typeInfo.TypeName)
+		return []protocol.Location{}, nil
+	}
+
+	if len(locations) == 1 {
+		return &locations[0], nil
+	}
+
+	return locations, nil
+}
@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const typeDefinitionContent = `type TConnection = class
+  Port: Integer;
+end;
+
+type TPool = class
+  Conn: TConnection;
+end;
+
+function Connect(port: Integer): TConnection;
+begin
+  Result := TConnection.Create;
+end;
+
+procedure Use(c: TConnection);
+begin
+end;
+
+var conn: TConnection;
+var pool := TPool.Create;
+conn := Connect(80);
+Use(conn);
+pool.Conn := conn;
+PrintLn(conn.Port);`
+
+func TestTypeDefinition(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///connections.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: typeDefinitionContent},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	connection := protocol.Range{
+		Start: protocol.Position{Line: 0, Character: 5},
+		End:   protocol.Position{Line: 0, Character: 16},
+	}
+	pool := protocol.Range{
+		Start: protocol.Position{Line: 4, Character: 5},
+		End:   protocol.Position{Line: 4, Character: 10},
+	}
+
+	tests := []struct {
+		name      string
+		line      uint32
+		character uint32
+		expected  *protocol.Range
+	}{
+		{"variable", 19, 1, &connection},
+		{"variable declaration", 17, 5, &connection},
+		{"inferred variable type", 18, 5, &pool},
+		{"function result", 19, 9, &connection},
+		{"parameter", 13, 14, &connection},
+		{"field accessed on an object", 21, 6, &connection},
+		{"type annotation", 17, 12, &connection},
+		{"class itself", 0, 6, &connection},
+		{"built-in type", 22, 14, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TypeDefinition(&glsp.Context{}, &protocol.TypeDefinitionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tt.line, Character: tt.character},
+				},
+			})
+			if err != nil {
+				t.Fatalf("TypeDefinition failed: %v", err)
+			}
+
+			if tt.expected == nil {
+				if locations, ok := result.([]protocol.Location); !ok || len(locations) != 0 {
+					t.Errorf("Expected no type definition, got %+v", result)
+				}
+
+				return
+			}
+
+			loc, ok := result.(*protocol.Location)
+			if !ok {
+				t.Fatalf("Expected a single location, got %+v", result)
+			}
+
+			if loc.URI != uri || loc.Range != *tt.expected {
+				t.Errorf("Expected %+v, got %+v", *tt.expected, *loc)
+			}
+		})
+	}
+}
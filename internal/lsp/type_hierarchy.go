@@ -0,0 +1,216 @@
+package lsp
+
+import (
+	"log"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/analysis"
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// PrepareTypeHierarchy handles the textDocument/prepareTypeHierarchy request.
+// It returns the class or interface declared or referenced at the position.
+func PrepareTypeHierarchy(context *glsp.Context, params *protocol317.TypeHierarchyPrepareParams) ([]protocol317.TypeHierarchyItem, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in PrepareTypeHierarchy")
+		return nil, nil
+	}
+
+	uri := params.TextDocument.URI
+	position := params.Position
+	log.Printf("PrepareTypeHierarchy request at %s line %d, character %d\n", uri, position.Line, position.Character)
+
+	doc, exists := getAnalyzedDocument(srv, uri)
+	if !exists {
+		log.Printf("Document not found for type hierarchy: %s\n", uri)
+		return nil, nil
+	}
+
+	// Use the partial AST or the last good program if the current text doesn't compile
+	view, positions := doc.SyntaxView()
+	if view.AST() == nil {
+		return nil, nil
+	}
+
+	position, ok = toSnapshotPosition(positions, position)
+	if !ok {
+		return nil, nil
+	}
+
+	hierarchy := newTypeHierarchy(srv)
+
+	// Convert LSP (0-based) to AST (1-based)
+	typeDecl := hierarchy.types.TypeAt(uri, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if typeDecl == nil {
+		log.Printf("No class or interface at %s line %d, character %d\n", uri, position.Line, position.Character)
+		return nil, nil
+	}
+
+	item, ok := hierarchy.item(*typeDecl)
+	if !ok {
+		return nil, nil
+	}
+
+	return []protocol317.TypeHierarchyItem{item}, nil
+}
+
+// TypeHierarchySupertypes handles the typeHierarchy/supertypes request.
+// It returns the parent class and the implemented interfaces of a class, or
+// the parent of an interface, wherever in the workspace they are declared.
+func TypeHierarchySupertypes(context *glsp.Context, params *protocol317.TypeHierarchySupertypesParams) ([]protocol317.TypeHierarchyItem, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in TypeHierarchySupertypes")
+		return nil, nil
+	}
+
+	log.Printf("TypeHierarchySupertypes request for %s in %s\n", params.Item.Name, params.Item.URI)
+
+	hierarchy := newTypeHierarchy(srv)
+
+	typeDecl := hierarchy.typeDecl(params.Item)
+	if typeDecl == nil {
+		return nil, nil
+	}
+
+	return hierarchy.items(hierarchy.types.Supertypes(*typeDecl)), nil
+}
+
+// TypeHierarchySubtypes handles the typeHierarchy/subtypes request.
+// It returns the classes and interfaces deriving directly from the item, found
+// in the open documents and, through the index of subtypes, in the workspace.
+func TypeHierarchySubtypes(context *glsp.Context, params *protocol317.TypeHierarchySubtypesParams) ([]protocol317.TypeHierarchyItem, error) {
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in TypeHierarchySubtypes")
+		return nil, nil
+	}
+
+	log.Printf("TypeHierarchySubtypes request for %s in %s\n", params.Item.Name, params.Item.URI)
+
+	hierarchy := newTypeHierarchy(srv)
+
+	typeDecl := hierarchy.typeDecl(params.Item)
+	if typeDecl == nil {
+		return nil, nil
+	}
+
+	return hierarchy.items(hierarchy.types.Subtypes(*typeDecl)), nil
+}
+
+// typeHierarchy finds types for one type hierarchy request. Open documents
+// are looked at through their SyntaxView, so positions in them must be
+// translated like in callHierarchy.
+type typeHierarchy struct {
+	types     *analysis.TypeHierarchy
+	positions map[string]*document.PositionMap
+}
+
+// newTypeHierarchy creates a typeHierarchy over the open documents of srv and
+// its workspace index.
+func newTypeHierarchy(srv *server.Server) *typeHierarchy {
+	types := analysis.NewTypeHierarchy(srv.Documents(), srv.WorkspaceIndex())
+
+	return &typeHierarchy{
+		types:     types,
+		positions: openSyntaxViews(srv, types.SetProgram),
+	}
+}
+
+// typeDecl returns the type an item returned earlier stands for, or nil if
+// it can no longer be found.
+func (h *typeHierarchy) typeDecl(item protocol317.TypeHierarchyItem) *analysis.TypeDecl {
+	position := item.SelectionRange.Start
+	if positions := h.positions[item.URI]; positions != nil {
+		var ok bool
+		if position, ok = positions.ToSnapshot(position); !ok {
+			return nil
+		}
+	}
+
+	// Convert LSP (0-based) to AST (1-based)
+	typeDecl := h.types.TypeAt(item.URI, token.Position{
+		Line:   int(position.Line) + 1,
+		Column: int(position.Character) + 1,
+	})
+	if typeDecl == nil {
+		log.Printf("Type hierarchy item %s not found in %s\n", item.Name, item.URI)
+	}
+
+	return typeDecl
+}
+
+// items returns the type hierarchy items of types, dropping those whose
+// declaration has been edited since the last successful compile.
+func (h *typeHierarchy) items(types []analysis.TypeDecl) []protocol317.TypeHierarchyItem {
+	items := make([]protocol317.TypeHierarchyItem, 0, len(types))
+
+	for _, typeDecl := range types {
+		if item, ok := h.item(typeDecl); ok {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// item returns the type hierarchy item for typeDecl. Its detail lists the
+// supertypes, as in "class(TBase, IShape)".
+func (h *typeHierarchy) item(typeDecl analysis.TypeDecl) (protocol317.TypeHierarchyItem, bool) {
+	name := typeDecl.Name()
+	if name == nil {
+		return protocol317.TypeHierarchyItem{}, false
+	}
+
+	kind := protocol.SymbolKindClass
+	detail := "class"
+
+	if _, ok := typeDecl.Decl.(*ast.InterfaceDecl); ok {
+		kind = protocol.SymbolKindInterface
+		detail = "interface"
+	}
+
+	if supertypes := typeDecl.Supertypes(); len(supertypes) > 0 {
+		names := make([]string, len(supertypes))
+		for i, supertype := range supertypes {
+			names[i] = supertype.Value
+		}
+
+		detail += "(" + strings.Join(names, ", ") + ")"
+	}
+
+	// The declaration starts at the class or interface keyword, after the name
+	rng := nodeRange(typeDecl.Decl)
+	selection := nodeRange(name)
+	rng.Start = selection.Start
+
+	if positions := h.positions[typeDecl.URI]; positions != nil {
+		var ok bool
+		if rng, ok = positions.RangeToCurrent(rng); !ok {
+			return protocol317.TypeHierarchyItem{}, false
+		}
+
+		if selection, ok = positions.RangeToCurrentExact(selection); !ok {
+			return protocol317.TypeHierarchyItem{}, false
+		}
+	}
+
+	return protocol317.TypeHierarchyItem{
+		Name:           name.Value,
+		Kind:           kind,
+		Detail:         &detail,
+		URI:            typeDecl.URI,
+		Range:          rng,
+		SelectionRange: selection,
+	}, true
+}
@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func prepareTypeHierarchy(t *testing.T, uri string, line, character uint32) []protocol317.TypeHierarchyItem {
+	t.Helper()
+
+	items, err := PrepareTypeHierarchy(&glsp.Context{}, &protocol317.TypeHierarchyPrepareParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: character},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PrepareTypeHierarchy failed: %v", err)
+	}
+
+	return items
+}
+
+func itemNames(items []protocol317.TypeHierarchyItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+
+	return names
+}
+
+func TestTypeHierarchy(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	shapesURI := "file:///shapes.dws"
+	squareURI := "file:///square.dws"
+
+	documents := map[string]string{
+		shapesURI: `type IShape = interface
+  function Area: Float;
+end;
+
+type TShape = class(IShape)
+  function Area: Float; virtual;
+end;
+
+function TShape.Area: Float;
+begin
+  Result := 0;
+end;`,
+		squareURI: `type TSquare = class(TShape)
+end;`,
+	}
+
+	for uri, text := range documents {
+		err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: uri, Text: text},
+		})
+		if err != nil {
+			t.Fatalf("DidOpen failed: %v", err)
+		}
+	}
+
+	// A class derived in a workspace file that isn't open, found through the index
+	circlePath := filepath.Join(t.TempDir(), "circle.dws")
+
+	if err := os.WriteFile(circlePath, []byte("type TCircle = class(TShape)\nend;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.WorkspaceIndex().AddTypeSymbol("TCircle", protocol.SymbolKindClass, pathToURI(circlePath),
+		protocol.Range{End: protocol.Position{Line: 1, Character: 4}}, "class(TShape)", []string{"TShape"})
+
+	// "TShape" in its declaration
+	items := prepareTypeHierarchy(t, shapesURI, 4, 6)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+
+	shape := items[0]
+	if shape.Name != "TShape" || shape.Kind != protocol.SymbolKindClass || shape.Detail == nil || *shape.Detail != "class(IShape)" {
+		t.Errorf("Unexpected item %+v", shape)
+	}
+
+	selection := protocol.Range{
+		Start: protocol.Position{Line: 4, Character: 5},
+		End:   protocol.Position{Line: 4, Character: 11},
+	}
+	if shape.SelectionRange != selection || shape.Range.Start != selection.Start {
+		t.Errorf("Expected the item to start at its name %+v, got %+v and %+v", selection, shape.Range, shape.SelectionRange)
+	}
+
+	supertypes, err := TypeHierarchySupertypes(&glsp.Context{}, &protocol317.TypeHierarchySupertypesParams{Item: shape})
+	if err != nil {
+		t.Fatalf("TypeHierarchySupertypes failed: %v", err)
+	}
+
+	if len(supertypes) != 1 || supertypes[0].Name != "IShape" || supertypes[0].Kind != protocol.SymbolKindInterface {
+		t.Errorf("Expected the supertype IShape, got %v", itemNames(supertypes))
+	}
+
+	subtypes, err := TypeHierarchySubtypes(&glsp.Context{}, &protocol317.TypeHierarchySubtypesParams{Item: shape})
+	if err != nil {
+		t.Fatalf("TypeHierarchySubtypes failed: %v", err)
+	}
+
+	names := itemNames(subtypes)
+	if len(names) != 2 || names[0] != "TSquare" || names[1] != "TCircle" {
+		t.Errorf("Expected the subtypes [TSquare TCircle], got %v", names)
+	}
+
+	// The parent reference in another document leads to the same class
+	items = prepareTypeHierarchy(t, squareURI, 0, 23)
+	if len(items) != 1 || items[0].URI != shapesURI || items[0].SelectionRange != selection {
+		t.Errorf("Expected TShape in %s, got %+v", shapesURI, items)
+	}
+}
+
+func TestPrepareTypeHierarchyNoType(t *testing.T) {
+	SetServer(server.New())
+
+	uri := "file:///notype.dws"
+
+	err := DidOpen(&glsp.Context{}, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: "var x: Integer;\nx := 1;"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	if items := prepareTypeHierarchy(t, uri, 1, 0); items != nil {
+		t.Errorf("Expected no items for a variable, got %+v", items)
+	}
+
+	if items := prepareTypeHierarchy(t, "file:///missing.dws", 0, 0); items != nil {
+		t.Errorf("Expected no items for an unknown document, got %+v", items)
+	}
+}
@@ -3,8 +3,14 @@ package lsp
 
 import (
 	"log"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -25,7 +31,17 @@ func DidChangeConfiguration(context *glsp.Context, params *protocol.DidChangeCon
 	// {
 	//   "go-dws-lsp": {
 	//     "maxProblems": 100,
-	//     "trace": "off"
+	//     "trace": "off",
+	//     "analysisDelay": 300,
+	//     "indexWorkers": 4,
+	//     "indexInclude": ["src/**"],
+	//     "indexExclude": ["generated", "**/*.gen.pas"],
+	//     "indexExtensions": [".dws", ".pas", ".inc"],
+	//     "indexMaxDepth": 10,
+	//     "indexMaxFiles": 10000,
+	//     "indexUseGitignore": true,
+	//     "libraryPaths": ["../shared", "/opt/dwscript/lib"],
+	//     "workspaceDiagnostics": true
 	//   }
 	// }
 
@@ -34,20 +50,22 @@ func DidChangeConfiguration(context *glsp.Context, params *protocol.DidChangeCon
 		if settingsMap, ok := params.Settings.(map[string]any); ok {
 			// Look for our namespace
 			if dwsSettings, ok := settingsMap["go-dws-lsp"].(map[string]any); ok {
-				// Update maxProblems if present
-				if maxProblems, ok := dwsSettings["maxProblems"].(float64); ok {
-					srv.UpdateConfig(func(cfg *server.Config) {
-						cfg.MaxProblems = int(maxProblems)
-					})
-					log.Printf("Configuration updated: maxProblems = %d\n", int(maxProblems))
+				before := srv.Config().IndexFilter
+				wasCheckingWorkspace := srv.Config().WorkspaceDiagnostics
+
+				applySettings(srv, dwsSettings)
+
+				// Index the workspace again if the set of indexed files changed
+				if after := srv.Config().IndexFilter; !reflect.DeepEqual(before, after) {
+					reindexWorkspace(context, srv, !slices.Equal(before.WatcherGlobs(), after.WatcherGlobs()))
 				}
 
-				// Update trace level if present
-				if trace, ok := dwsSettings["trace"].(string); ok {
-					srv.UpdateConfig(func(cfg *server.Config) {
-						cfg.Trace = trace
-					})
-					log.Printf("Configuration updated: trace = %s\n", trace)
+				// Show or hide the diagnostics of closed files
+				switch checkingWorkspace := srv.Config().WorkspaceDiagnostics; {
+				case checkingWorkspace && !wasCheckingWorkspace:
+					publishWorkspaceDiagnostics(context, srv)
+				case !checkingWorkspace && wasCheckingWorkspace:
+					clearWorkspaceDiagnostics(context, srv, filesWithProblems(srv))
 				}
 			}
 		}
@@ -56,6 +74,170 @@ func DidChangeConfiguration(context *glsp.Context, params *protocol.DidChangeCon
 	return nil
 }
 
+// applySettings applies the settings of the go-dws-lsp namespace, received
+// through workspace/didChangeConfiguration or as initialization options.
+func applySettings(srv *server.Server, dwsSettings map[string]any) {
+	// Update maxProblems if present
+	if maxProblems, ok := dwsSettings["maxProblems"].(float64); ok {
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.MaxProblems = int(maxProblems)
+		})
+		log.Printf("Configuration updated: maxProblems = %d\n", int(maxProblems))
+	}
+
+	// Update trace level if present
+	if trace, ok := dwsSettings["trace"].(string); ok {
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.Trace = trace
+		})
+		log.Printf("Configuration updated: trace = %s\n", trace)
+	}
+
+	// Update analysis debounce delay (milliseconds) if present
+	if delayMs, ok := dwsSettings["analysisDelay"].(float64); ok && delayMs >= 0 {
+		delay := time.Duration(delayMs) * time.Millisecond
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.AnalysisDelay = delay
+		})
+		srv.Analysis().SetDelay(delay)
+		log.Printf("Configuration updated: analysisDelay = %v\n", delay)
+	}
+
+	// Update number of parallel indexing workers if present (0 = all CPUs)
+	if workers, ok := dwsSettings["indexWorkers"].(float64); ok && workers >= 0 {
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.IndexWorkers = int(workers)
+		})
+		log.Printf("Configuration updated: indexWorkers = %d\n", int(workers))
+	}
+
+	// Update which inlay hints are shown
+	inlayHints := srv.Config().InlayHints
+
+	if enabled, ok := dwsSettings["inlayHintsParameterNames"].(bool); ok {
+		inlayHints.ParameterNames = enabled
+	}
+
+	if enabled, ok := dwsSettings["inlayHintsVariableTypes"].(bool); ok {
+		inlayHints.VariableTypes = enabled
+	}
+
+	if enabled, ok := dwsSettings["inlayHintsSuppressMatchingNames"].(bool); ok {
+		inlayHints.SuppressMatchingNames = enabled
+	}
+
+	if inlayHints != srv.Config().InlayHints {
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.InlayHints = inlayHints
+		})
+		log.Printf("Configuration updated: inlayHints = %+v\n", inlayHints)
+	}
+
+	// Update the directories searched for units and include files
+	if value, ok := dwsSettings["libraryPaths"]; ok {
+		libraryPaths := stringSetting(value, false)
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.LibraryPaths = libraryPaths
+		})
+		log.Printf("Configuration updated: libraryPaths = %v\n", libraryPaths)
+	}
+
+	// Update whether the diagnostics of closed workspace files are published
+	if enabled, ok := dwsSettings["workspaceDiagnostics"].(bool); ok {
+		srv.UpdateConfig(func(cfg *server.Config) {
+			cfg.WorkspaceDiagnostics = enabled
+		})
+		log.Printf("Configuration updated: workspaceDiagnostics = %v\n", enabled)
+	}
+
+	// Update the files to index; a setting that is present but null restores its default
+	filter := srv.Config().IndexFilter
+
+	if value, ok := dwsSettings["indexInclude"]; ok {
+		filter.Include = stringSetting(value, false)
+	}
+
+	if value, ok := dwsSettings["indexExclude"]; ok {
+		// An empty list excludes nothing, while null restores the default excludes
+		filter.Exclude = stringSetting(value, true)
+	}
+
+	if value, ok := dwsSettings["indexExtensions"]; ok {
+		filter.Extensions = stringSetting(value, false)
+	}
+
+	if maxDepth, ok := dwsSettings["indexMaxDepth"].(float64); ok && maxDepth >= 0 {
+		filter.MaxDepth = int(maxDepth)
+	}
+
+	if maxFiles, ok := dwsSettings["indexMaxFiles"].(float64); ok && maxFiles >= 0 {
+		filter.MaxFiles = int(maxFiles)
+	}
+
+	if useGitignore, ok := dwsSettings["indexUseGitignore"].(bool); ok {
+		filter.UseGitignore = useGitignore
+	}
+
+	if reflect.DeepEqual(filter, srv.Config().IndexFilter) {
+		return
+	}
+
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexFilter = filter
+	})
+	log.Printf("Configuration updated: indexFilter = %+v\n", filter)
+}
+
+// stringSetting converts a JSON array of strings to a slice. Other values,
+// such as null, yield nil. An empty array yields nil too, unless keepEmpty is set.
+func stringSetting(value any, keepEmpty bool) []string {
+	items, ok := value.([]any)
+	if !ok || (len(items) == 0 && !keepEmpty) {
+		return nil
+	}
+
+	result := make([]string, 0, len(items))
+
+	for _, item := range items {
+		if str, ok := item.(string); ok && str != "" {
+			result = append(result, str)
+		}
+	}
+
+	return result
+}
+
+// reindexWorkspace discards the indexed workspace files and indexes all
+// workspace folders again, e.g. after the files to index were reconfigured.
+// The file watchers are registered again if reregister is set.
+func reindexWorkspace(context *glsp.Context, srv *server.Server, reregister bool) {
+	folders := srv.GetWorkspaceFolders()
+	if len(folders) == 0 {
+		return
+	}
+
+	// Stop indexing runs that still use the old settings
+	srv.RestartIndexing()
+
+	workspaceFolders := make([]protocol.WorkspaceFolder, 0, len(folders))
+
+	for _, folder := range folders {
+		purgeWorkspaceFolder(context, srv, pathToURI(folder))
+
+		workspaceFolders = append(workspaceFolders, protocol.WorkspaceFolder{
+			URI:  pathToURI(folder),
+			Name: folder,
+		})
+	}
+
+	if reregister && srv.SupportsWatchedFilesRegistration() {
+		reregisterFileWatchers(context, srv.Config().IndexFilter)
+	}
+
+	log.Printf("Re-indexing %d workspace folders\n", len(workspaceFolders))
+	startWorkspaceIndexing(context, srv, workspaceFolders)
+}
+
 // DidChangeWorkspaceFolders handles changes to workspace folders.
 // This notification is sent when workspace folders are added or removed.
 func DidChangeWorkspaceFolders(context *glsp.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
@@ -66,19 +248,255 @@ func DidChangeWorkspaceFolders(context *glsp.Context, params *protocol.DidChange
 		return nil
 	}
 
+	// Handle removed workspace folders first, so that a folder that is removed
+	// and re-added in the same event ends up indexed
+	for _, folder := range params.Event.Removed {
+		log.Printf("Workspace folder removed: %s (%s)\n", folder.Name, folder.URI)
+
+		path := uriToPath(folder.URI)
+		if path == "" || !srv.RemoveWorkspaceFolder(path) {
+			continue
+		}
+
+		purgeWorkspaceFolder(context, srv, pathToURI(path))
+	}
+
 	// Handle added workspace folders
+	var added []protocol.WorkspaceFolder
+
 	for _, folder := range params.Event.Added {
 		log.Printf("Workspace folder added: %s (%s)\n", folder.Name, folder.URI)
-		// TODO: Trigger indexing for new workspace folder
+
+		path := uriToPath(folder.URI)
+		if path == "" || !srv.AddWorkspaceFolder(path) {
+			continue
+		}
+
+		added = append(added, folder)
 	}
 
-	// Handle removed workspace folders
-	for _, folder := range params.Event.Removed {
-		log.Printf("Workspace folder removed: %s (%s)\n", folder.Name, folder.URI)
-		// TODO: Clear index entries for removed workspace folder
+	if len(added) > 0 {
+		log.Printf("Starting workspace indexing for %d added folders\n", len(added))
+		startWorkspaceIndexing(context, srv, added)
+	}
+
+	return nil
+}
+
+// purgeWorkspaceFolder removes all files below a workspace folder from the
+// indexes and caches, and clears their published diagnostics. Open documents
+// keep their entries, since the editor still owns them.
+func purgeWorkspaceFolder(context *glsp.Context, srv *server.Server, folderURI string) {
+	var problems []string
+	if publishesWorkspaceDiagnostics(srv) {
+		problems = filesWithProblems(srv)
 	}
 
-	_ = srv // Placeholder to avoid unused variable error
+	removed := srv.WorkspaceIndex().RemoveDirectory(folderURI)
+	srv.Diagnostics().RemoveUnder(folderURI)
+
+	clearWorkspaceDiagnostics(context, srv, slices.DeleteFunc(problems, func(uri string) bool {
+		_, indexed := srv.Diagnostics().Get(uri)
+		return indexed
+	}))
+
+	if srv.Symbols() != nil {
+		removed = append(removed, srv.Symbols().RemoveDocumentsUnder(folderURI)...)
+	}
+
+	slices.Sort(removed)
+	removed = slices.Compact(removed)
+
+	for _, uri := range removed {
+		// Restore the references of documents that are still open
+		if doc, open := srv.Documents().Get(uri); open {
+			if srv.Symbols() != nil {
+				srv.Symbols().UpdateDocument(doc)
+			}
+
+			continue
+		}
+
+		if srv.CompletionCache() != nil {
+			srv.CompletionCache().InvalidateDocument(uri)
+		}
+
+		if srv.SemanticTokensCache() != nil {
+			srv.SemanticTokensCache().InvalidateDocument(protocol.DocumentUri(uri))
+		}
+	}
+
+	log.Printf("Purged %d files of removed workspace folder %s\n", len(removed), folderURI)
+}
+
+// inWorkspaceFolder reports whether the file uri is inside one of the
+// workspace folders.
+func inWorkspaceFolder(srv *server.Server, uri string) bool {
+	path := uriToPath(uri)
+	if path == "" {
+		return false
+	}
+
+	for _, folder := range srv.GetWorkspaceFolders() {
+		rel, err := filepath.Rel(folder, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchedFilesRegistrationID identifies the dynamic file watcher registration.
+const watchedFilesRegistrationID = "go-dws-lsp-watched-files"
+
+// registerFileWatchers asks the client to watch the files indexed according to
+// filter and report changes through workspace/didChangeWatchedFiles.
+func registerFileWatchers(context *glsp.Context, filter workspace.IndexFilter) {
+	if context == nil || context.Call == nil {
+		return
+	}
+
+	// The call blocks until the client responds, which can't happen while the
+	// current notification is still being handled
+	go context.Call(protocol.ServerClientRegisterCapability, fileWatcherRegistration(filter), nil)
+
+	log.Println("Registering file watchers for DWScript files")
+}
+
+// reregisterFileWatchers replaces the file watchers registered by
+// registerFileWatchers with watchers for the files indexed according to filter.
+func reregisterFileWatchers(context *glsp.Context, filter workspace.IndexFilter) {
+	if context == nil || context.Call == nil {
+		return
+	}
+
+	params := protocol.UnregistrationParams{
+		Unregisterations: []protocol.Unregistration{
+			{
+				ID:     watchedFilesRegistrationID,
+				Method: string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+			},
+		},
+	}
+
+	// Both registrations use the same ID, so the calls must not overlap
+	go func() {
+		context.Call(protocol.ServerClientUnregisterCapability, params, nil)
+		context.Call(protocol.ServerClientRegisterCapability, fileWatcherRegistration(filter), nil)
+	}()
+
+	log.Println("Re-registering file watchers for DWScript files")
+}
+
+// fileWatcherRegistration returns the registration of file watchers for the
+// files indexed according to filter.
+func fileWatcherRegistration(filter workspace.IndexFilter) protocol.RegistrationParams {
+	var watchers []protocol.FileSystemWatcher
+	for _, glob := range filter.WatcherGlobs() {
+		watchers = append(watchers, protocol.FileSystemWatcher{GlobPattern: glob})
+	}
+
+	return protocol.RegistrationParams{
+		Registrations: []protocol.Registration{
+			{
+				ID:     watchedFilesRegistrationID,
+				Method: string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+				RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+					Watchers: watchers,
+				},
+			},
+		},
+	}
+}
+
+// DidChangeWatchedFiles handles files that were created, changed or deleted
+// outside the editor, e.g. by a git checkout or a code generator.
+// Only the affected files are re-indexed or removed from the indexes.
+func DidChangeWatchedFiles(context *glsp.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	// Get server instance
+	srv, ok := serverInstance.(*server.Server)
+	if !ok || srv == nil {
+		log.Println("Warning: server instance not available in DidChangeWatchedFiles")
+		return nil
+	}
+
+	folders := srv.GetWorkspaceFolders()
+
+	var changed []string
+
+	for _, change := range params.Changes {
+		uri := change.URI
+
+		switch change.Type {
+		case protocol.FileChangeTypeCreated, protocol.FileChangeTypeChanged:
+			if !workspace.IsIndexedPath(uriToPath(uri), folders, srv.Config().IndexFilter) {
+				continue
+			}
+
+			log.Printf("Watched file changed: %s\n", uri)
+			reindexWatchedFile(srv, uri)
+			changed = append(changed, uri)
+
+		case protocol.FileChangeTypeDeleted:
+			log.Printf("Watched file deleted: %s\n", uri)
+			changed = append(changed, removeWatchedFile(srv, uri)...)
+		}
+	}
+
+	updateWorkspaceDiagnostics(context, srv, changed)
+
+	// The diagnostics of the changed files are up to date now
+	if len(params.Changes) > 0 {
+		refreshDiagnostics(context, srv)
+	}
 
 	return nil
 }
+
+// reindexWatchedFile updates the workspace and reference indexes and the
+// diagnostics of a file from its contents on disk.
+func reindexWatchedFile(srv *server.Server, uri string) {
+	program := workspace.UpdateFileWithOptions(srv.WorkspaceIndex(), uri, indexOptions(srv))
+
+	// Open documents are kept up to date from the editor's text
+	if _, open := srv.Documents().Get(uri); open {
+		return
+	}
+
+	if srv.Symbols() != nil {
+		srv.Symbols().UpdateDocument(&server.Document{URI: uri, Program: program})
+	}
+}
+
+// removeWatchedFile removes a deleted file from the indexes. Deleting a
+// directory removes all indexed files below it. It returns the URIs of the
+// removed files.
+func removeWatchedFile(srv *server.Server, uri string) []string {
+	removed := []string{uri}
+
+	srv.WorkspaceIndex().RemoveFile(uri)
+	srv.Diagnostics().Remove(uri)
+
+	if !srv.Config().IndexFilter.HasIndexedExtension(uri) {
+		removed = append(removed, srv.WorkspaceIndex().RemoveDirectory(uri)...)
+		removed = append(removed, srv.Diagnostics().RemoveUnder(uri)...)
+
+		slices.Sort(removed)
+		removed = slices.Compact(removed)
+	}
+
+	if srv.Symbols() == nil {
+		return removed
+	}
+
+	for _, fileURI := range removed {
+		if _, open := srv.Documents().Get(fileURI); open {
+			continue
+		}
+
+		srv.Symbols().RemoveDocument(fileURI)
+	}
+
+	return removed
+}
@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// publishesWorkspaceDiagnostics reports whether the diagnostics of workspace
+// files that aren't open are published. Clients pulling diagnostics get them
+// through WorkspaceDiagnostic instead.
+func publishesWorkspaceDiagnostics(srv *server.Server) bool {
+	return srv.Config().WorkspaceDiagnostics && !srv.SupportsPullDiagnostics()
+}
+
+// publishWorkspaceDiagnostics publishes the diagnostics the indexer recorded
+// for the workspace files with problems that aren't open.
+func publishWorkspaceDiagnostics(context *glsp.Context, srv *server.Server) {
+	if !publishesWorkspaceDiagnostics(srv) {
+		return
+	}
+
+	problems := filesWithProblems(srv)
+
+	log.Printf("Publishing the diagnostics of %d closed workspace files\n", len(problems))
+
+	for _, uri := range problems {
+		publishFileDiagnostics(context, srv, uri)
+	}
+}
+
+// publishFileDiagnostics publishes the diagnostics recorded for the workspace
+// file uri, or none if it has no recorded diagnostics, e.g. because it was
+// deleted. Open documents publish the diagnostics of their text instead.
+func publishFileDiagnostics(context *glsp.Context, srv *server.Server, uri string) {
+	if !publishesWorkspaceDiagnostics(srv) {
+		return
+	}
+
+	if _, open := srv.Documents().Get(uri); open {
+		return
+	}
+
+	file, _ := srv.Diagnostics().Get(uri)
+
+	// Publish a copy, PublishDiagnostics sorts the diagnostics shared with the store
+	PublishDiagnostics(context, uri, append([]protocol.Diagnostic{}, file.Diagnostics...))
+}
+
+// clearWorkspaceDiagnostics clears the published diagnostics of the workspace
+// files uris that aren't open, e.g. after publishing them was turned off.
+func clearWorkspaceDiagnostics(context *glsp.Context, srv *server.Server, uris []string) {
+	if srv.SupportsPullDiagnostics() {
+		return
+	}
+
+	for _, uri := range uris {
+		if _, open := srv.Documents().Get(uri); open {
+			continue
+		}
+
+		PublishDiagnostics(context, uri, []protocol.Diagnostic{})
+	}
+}
+
+// filesWithProblems returns the URIs of the workspace files that aren't open
+// and have recorded diagnostics, sorted.
+func filesWithProblems(srv *server.Server) []string {
+	var problems []string
+
+	for _, uri := range srv.Diagnostics().List() {
+		if _, open := srv.Documents().Get(uri); open {
+			continue
+		}
+
+		if file, ok := srv.Diagnostics().Get(uri); ok && len(file.Diagnostics) > 0 {
+			problems = append(problems, uri)
+		}
+	}
+
+	return problems
+}
+
+// updateWorkspaceDiagnostics publishes the diagnostics of workspace files that
+// were re-indexed or removed after changing on disk. The files using the units
+// declared by the changed files are compiled again, since their diagnostics
+// may have changed too.
+func updateWorkspaceDiagnostics(context *glsp.Context, srv *server.Server, changed []string) {
+	if !srv.Config().WorkspaceDiagnostics || len(changed) == 0 {
+		return
+	}
+
+	var dependents []string
+
+	for _, uri := range changed {
+		publishFileDiagnostics(context, srv, uri)
+		dependents = append(dependents, srv.Diagnostics().Dependents(unitName(uri))...)
+	}
+
+	slices.Sort(dependents)
+	dependents = slices.Compact(dependents)
+
+	for _, uri := range dependents {
+		// Changed files are up to date, and open documents are checked as they are edited
+		if slices.Contains(changed, uri) {
+			continue
+		}
+
+		if _, open := srv.Documents().Get(uri); open {
+			continue
+		}
+
+		log.Printf("Checking %s again, a unit it uses changed\n", uri)
+		reindexWatchedFile(srv, uri)
+		publishFileDiagnostics(context, srv, uri)
+	}
+}
+
+// unitName returns the name of the unit declared by the file uri, which is
+// named after the unit.
+func unitName(uri string) string {
+	base := path.Base(uri)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
@@ -0,0 +1,189 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// publishRecorder records the diagnostics published for each file.
+type publishRecorder struct {
+	published map[string][]protocol.Diagnostic
+}
+
+func (r *publishRecorder) context() *glsp.Context {
+	r.published = make(map[string][]protocol.Diagnostic)
+
+	return &glsp.Context{
+		Notify: func(method string, params any) {
+			if method == protocol.ServerTextDocumentPublishDiagnostics {
+				diagnostics := params.(*protocol.PublishDiagnosticsParams)
+				r.published[diagnostics.URI] = diagnostics.Diagnostics
+			}
+		},
+	}
+}
+
+// indexWorkspaceDiagnostics writes files to a new workspace folder and indexes
+// it with workspace diagnostics enabled. It returns the folder.
+func indexWorkspaceDiagnostics(t *testing.T, srv *server.Server, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.SetWorkspaceFolders([]string{dir})
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexCacheDir = ""
+		cfg.WorkspaceDiagnostics = true
+	})
+	SetServer(srv)
+
+	workspace.IndexWorkspace(context.Background(), srv.WorkspaceIndex(),
+		[]protocol.WorkspaceFolder{{URI: pathToURI(dir), Name: "root"}}, indexOptions(srv))
+
+	return dir
+}
+
+func TestWorkspaceDiagnostics_ClosedFiles(t *testing.T) {
+	srv := server.New()
+	dir := indexWorkspaceDiagnostics(t, srv, map[string]string{
+		"good.dws":   "var Good: Integer;\n",
+		"broken.dws": brokenContent,
+	})
+
+	broken := pathToURI(filepath.Join(dir, "broken.dws"))
+
+	recorder := &publishRecorder{}
+	publishWorkspaceDiagnostics(recorder.context(), srv)
+
+	if len(recorder.published) != 1 || len(recorder.published[broken]) == 0 {
+		t.Fatalf("Expected diagnostics for broken.dws only, got %+v", recorder.published)
+	}
+
+	// The open document owns the file's diagnostics
+	err := DidOpen(recorder.context(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: broken, Text: "var Fixed: Integer;\n"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	if diagnostics, ok := recorder.published[broken]; !ok || len(diagnostics) != 0 {
+		t.Errorf("Expected the open document to clear the diagnostics, got %+v", diagnostics)
+	}
+
+	// Closing it without saving restores the diagnostics of the file on disk
+	err = DidClose(recorder.context(), &protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: broken},
+	})
+	if err != nil {
+		t.Fatalf("DidClose failed: %v", err)
+	}
+
+	if len(recorder.published[broken]) == 0 {
+		t.Error("Expected the diagnostics of broken.dws on disk after closing it")
+	}
+
+	// Turning workspace diagnostics off clears them
+	err = DidChangeConfiguration(recorder.context(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{"go-dws-lsp": map[string]any{"workspaceDiagnostics": false}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeConfiguration failed: %v", err)
+	}
+
+	if diagnostics, ok := recorder.published[broken]; !ok || len(diagnostics) != 0 {
+		t.Errorf("Expected the diagnostics of broken.dws to be cleared, got %+v", diagnostics)
+	}
+}
+
+func TestCompileWorkspaceFile_Units(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "uses clause",
+			content:  "uses Utils, Shapes;\n// uses Commented;\nvar x: Integer;\n",
+			expected: []string{"Utils", "Shapes"},
+		},
+		{
+			name:     "file with errors",
+			content:  "uses Utils;\n" + brokenContent,
+			expected: []string{"Utils"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compileWorkspaceFile("file:///work/main.dws", []byte(tt.content))
+			if !slices.Equal(result.Units, tt.expected) {
+				t.Errorf("got units %v, expected %v", result.Units, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWorkspaceDiagnostics_RevalidatesDependents(t *testing.T) {
+	srv := server.New()
+	dir := indexWorkspaceDiagnostics(t, srv, map[string]string{
+		"utils.dws": "unit Utils;\ninterface\nimplementation\nend.\n",
+		"main.dws":  "uses Utils;\nvar x: Integer;\n",
+		"other.dws": "var y: Integer;\n",
+	})
+
+	mainURI := pathToURI(filepath.Join(dir, "main.dws"))
+	utilsURI := pathToURI(filepath.Join(dir, "utils.dws"))
+
+	if dependents := srv.Diagnostics().Dependents("utils"); len(dependents) != 1 || dependents[0] != mainURI {
+		t.Fatalf("Expected main.dws to depend on Utils, got %v", dependents)
+	}
+
+	// main.dws is only compiled again because the unit it uses changed
+	if err := os.WriteFile(filepath.Join(dir, "main.dws"), []byte("uses Utils;\n"+brokenContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &publishRecorder{}
+
+	err := DidChangeWatchedFiles(recorder.context(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: utilsURI, Type: protocol.FileChangeTypeChanged}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles failed: %v", err)
+	}
+
+	if len(recorder.published[mainURI]) == 0 {
+		t.Errorf("Expected the new diagnostics of main.dws, got %+v", recorder.published)
+	}
+
+	if _, ok := recorder.published[pathToURI(filepath.Join(dir, "other.dws"))]; ok {
+		t.Error("Expected other.dws not to be checked again")
+	}
+
+	// Deleting the file clears its diagnostics
+	err = DidChangeWatchedFiles(recorder.context(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: mainURI, Type: protocol.FileChangeTypeDeleted}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles failed: %v", err)
+	}
+
+	if diagnostics, ok := recorder.published[mainURI]; !ok || len(diagnostics) != 0 {
+		t.Errorf("Expected the diagnostics of the deleted main.dws to be cleared, got %+v", diagnostics)
+	}
+}
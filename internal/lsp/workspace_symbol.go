@@ -49,7 +49,13 @@ func WorkspaceSymbol(context *glsp.Context, params *protocol.WorkspaceSymbolPara
 		}
 
 		// Perform fallback search
-		symbolLocations = workspace.FallbackSearch(workspaceFolders, query, maxResults)
+		ctx := requestContext(srv, context)
+
+		symbolLocations = workspace.FallbackSearch(ctx, workspaceFolders, srv.Config().IndexFilter, query, maxResults)
+		if ctx.Err() != nil {
+			log.Printf("WorkspaceSymbol request for %q cancelled\n", query)
+			return nil, ctx.Err()
+		}
 	} else {
 		// Use the index for searching
 		symbolLocations = index.Search(query, maxResults)
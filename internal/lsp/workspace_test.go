@@ -0,0 +1,232 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestDidChangeWatchedFiles_ReindexesAndRemoves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helpers.dws")
+	uri := pathToURI(path)
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{dir})
+	SetServer(srv)
+
+	if err := os.WriteFile(path, []byte("function Helper(): Integer;\nbegin\n  Result := 42;\nend;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := DidChangeWatchedFiles(nil, &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: uri, Type: protocol.FileChangeTypeCreated}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles returned error: %v", err)
+	}
+
+	if len(srv.WorkspaceIndex().FindSymbol("Helper")) != 1 {
+		t.Fatal("Expected Helper in the workspace index after creation")
+	}
+
+	if len(srv.Symbols().FindReferences("Helper", srv.Documents())) == 0 {
+		t.Fatal("Expected Helper in the reference index after creation")
+	}
+
+	err = DidChangeWatchedFiles(nil, &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: uri, Type: protocol.FileChangeTypeDeleted}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles returned error: %v", err)
+	}
+
+	if len(srv.WorkspaceIndex().FindSymbol("Helper")) != 0 {
+		t.Error("Expected Helper to be removed from the workspace index")
+	}
+
+	if len(srv.Symbols().FindReferences("Helper", srv.Documents())) != 0 {
+		t.Error("Expected Helper to be removed from the reference index")
+	}
+}
+
+func TestDidChangeWatchedFiles_IgnoresFilesOutsideWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "outside.dws")
+
+	if err := os.WriteFile(path, []byte("var Outside: Integer;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{filepath.Join(dir, "project")})
+	SetServer(srv)
+
+	err := DidChangeWatchedFiles(nil, &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: pathToURI(path), Type: protocol.FileChangeTypeChanged}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles returned error: %v", err)
+	}
+
+	if srv.WorkspaceIndex().GetFileCount() != 0 {
+		t.Errorf("Expected no indexed files, got %d", srv.WorkspaceIndex().GetFileCount())
+	}
+}
+
+func TestDidChangeWorkspaceFolders_IndexesAddedAndPurgesRemoved(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(second, "lib.dws"), []byte("function LibFunc(): Integer;\nbegin\n  Result := 1;\nend;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{first})
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexCacheDir = t.TempDir()
+	})
+	SetServer(srv)
+
+	secondFolder := protocol.WorkspaceFolder{URI: pathToURI(second), Name: "second"}
+
+	err := DidChangeWorkspaceFolders(nil, &protocol.DidChangeWorkspaceFoldersParams{
+		Event: protocol.WorkspaceFoldersChangeEvent{Added: []protocol.WorkspaceFolder{secondFolder}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWorkspaceFolders returned error: %v", err)
+	}
+
+	if folders := srv.GetWorkspaceFolders(); len(folders) != 2 {
+		t.Fatalf("Expected 2 workspace folders, got %v", folders)
+	}
+
+	// Indexing of added folders runs in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.WorkspaceIndex().FindSymbol("LibFunc")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the added folder to be indexed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = DidChangeWorkspaceFolders(nil, &protocol.DidChangeWorkspaceFoldersParams{
+		Event: protocol.WorkspaceFoldersChangeEvent{Removed: []protocol.WorkspaceFolder{secondFolder}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWorkspaceFolders returned error: %v", err)
+	}
+
+	if folders := srv.GetWorkspaceFolders(); len(folders) != 1 || folders[0] != first {
+		t.Errorf("Expected only %s to remain, got %v", first, folders)
+	}
+
+	if len(srv.WorkspaceIndex().FindSymbol("LibFunc")) != 0 {
+		t.Error("Expected symbols of the removed folder to be purged")
+	}
+}
+
+func TestDidChangeConfiguration_ReindexesWithNewFilter(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.dws":             "var MainVar: Integer;\n",
+		"src/Utils.pas":        "function UtilFunc(): Integer;\nbegin\n  Result := 1;\nend;\n",
+		"generated/Proxy.pas":  "var ProxyVar: Integer;\n",
+		"ignored/Scratch.pas":  "var ScratchVar: Integer;\n",
+		".gitignore":           "ignored/\n",
+		"src/deep/a/b/Far.pas": "var FarVar: Integer;\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := server.New()
+	srv.SetWorkspaceFolders([]string{dir})
+	srv.UpdateConfig(func(cfg *server.Config) {
+		cfg.IndexCacheDir = t.TempDir()
+	})
+	SetServer(srv)
+
+	err := DidChangeConfiguration(nil, &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{
+			"go-dws-lsp": map[string]any{
+				"indexExtensions": []any{"pas", ".dws"},
+				"indexExclude":    []any{"generated"},
+				"indexMaxDepth":   float64(2),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeConfiguration returned error: %v", err)
+	}
+
+	// Re-indexing runs in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.WorkspaceIndex().FindSymbol("UtilFunc")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for .pas files to be indexed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, name := range []string{"ProxyVar", "ScratchVar", "FarVar"} {
+		if len(srv.WorkspaceIndex().FindSymbol(name)) != 0 {
+			t.Errorf("Expected %s to be excluded from the index", name)
+		}
+	}
+
+	if len(srv.WorkspaceIndex().FindSymbol("MainVar")) != 1 {
+		t.Error("Expected MainVar to be indexed")
+	}
+
+	// Watched file events follow the new settings too
+	proxy := pathToURI(filepath.Join(dir, "generated", "Proxy.pas"))
+
+	err = DidChangeWatchedFiles(nil, &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: proxy, Type: protocol.FileChangeTypeChanged}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles returned error: %v", err)
+	}
+
+	if len(srv.WorkspaceIndex().FindSymbol("ProxyVar")) != 0 {
+		t.Error("Expected excluded file to stay out of the index")
+	}
+}
+
+func TestInitialize_AppliesInitializationOptions(t *testing.T) {
+	srv := server.New()
+	SetServer(srv)
+
+	_, err := Initialize(nil, &protocol.InitializeParams{
+		InitializationOptions: map[string]any{
+			"indexExtensions":   []any{".pas", ".inc"},
+			"indexInclude":      []any{"src/**"},
+			"indexUseGitignore": false,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Initialize returned error: %v", err)
+	}
+
+	filter := srv.Config().IndexFilter
+	if len(filter.Extensions) != 2 || len(filter.Include) != 1 || filter.UseGitignore {
+		t.Errorf("Expected initialization options to configure the index filter, got %+v", filter)
+	}
+}
@@ -0,0 +1,333 @@
+// Package protocol317 provides the parts of LSP 3.17 used by the server, which
+// glsp's protocol_3_16 package doesn't provide, and a handler that serves them
+// alongside the 3.16 methods.
+package protocol317
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// ServerCapabilities extends the 3.16 server capabilities with 3.17 ones.
+type ServerCapabilities struct {
+	protocol.ServerCapabilities
+
+	// InlayHintProvider is a bool or InlayHintOptions
+	InlayHintProvider any `json:"inlayHintProvider,omitempty"`
+
+	// TypeHierarchyProvider is a bool or TypeHierarchyOptions
+	TypeHierarchyProvider any `json:"typeHierarchyProvider,omitempty"`
+
+	// DiagnosticProvider is a DiagnosticOptions
+	DiagnosticProvider *DiagnosticOptions `json:"diagnosticProvider,omitempty"`
+}
+
+// ClientCapabilities holds the 3.17 client capabilities used by the server.
+// Decode it from the raw parameters of the initialize request, since glsp's
+// 3.16 capabilities drop them.
+type ClientCapabilities struct {
+	TextDocument *struct {
+		// Diagnostic is set if the client pulls diagnostics
+		Diagnostic *struct{} `json:"diagnostic,omitempty"`
+	} `json:"textDocument,omitempty"`
+
+	Workspace *struct {
+		Diagnostics *struct {
+			// RefreshSupport is set if the client handles workspace/diagnostic/refresh
+			RefreshSupport *bool `json:"refreshSupport,omitempty"`
+		} `json:"diagnostics,omitempty"`
+	} `json:"workspace,omitempty"`
+}
+
+// SupportsPullDiagnostics returns true if the client pulls diagnostics.
+func (c *ClientCapabilities) SupportsPullDiagnostics() bool {
+	return c != nil && c.TextDocument != nil && c.TextDocument.Diagnostic != nil
+}
+
+// SupportsDiagnosticRefresh returns true if the client re-pulls diagnostics
+// when asked to through workspace/diagnostic/refresh.
+func (c *ClientCapabilities) SupportsDiagnosticRefresh() bool {
+	if c == nil || c.Workspace == nil || c.Workspace.Diagnostics == nil {
+		return false
+	}
+
+	refresh := c.Workspace.Diagnostics.RefreshSupport
+
+	return refresh != nil && *refresh
+}
+
+// InitializeResult is the result of the initialize request, with the
+// capabilities extended for 3.17.
+type InitializeResult struct {
+	Capabilities ServerCapabilities                   `json:"capabilities"`
+	ServerInfo   *protocol.InitializeResultServerInfo `json:"serverInfo,omitempty"`
+}
+
+// MethodTextDocumentInlayHint is the textDocument/inlayHint request.
+const MethodTextDocumentInlayHint = protocol.Method("textDocument/inlayHint")
+
+// InlayHintKind is the kind of an inlay hint.
+type InlayHintKind protocol.UInteger
+
+const (
+	// InlayHintKindType is a hint that annotates a type.
+	InlayHintKindType InlayHintKind = 1
+
+	// InlayHintKindParameter is a hint that annotates a parameter.
+	InlayHintKindParameter InlayHintKind = 2
+)
+
+// InlayHintParams are the parameters of the textDocument/inlayHint request.
+type InlayHintParams struct {
+	protocol.WorkDoneProgressParams
+
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+
+	// Range is the visible part of the document to compute hints for
+	Range protocol.Range `json:"range"`
+}
+
+// InlayHint is a hint shown inline in the source.
+type InlayHint struct {
+	Position     protocol.Position `json:"position"`
+	Label        string            `json:"label"`
+	Kind         *InlayHintKind    `json:"kind,omitempty"`
+	Tooltip      *string           `json:"tooltip,omitempty"`
+	PaddingLeft  *bool             `json:"paddingLeft,omitempty"`
+	PaddingRight *bool             `json:"paddingRight,omitempty"`
+}
+
+// TextDocumentInlayHintFunc handles the textDocument/inlayHint request.
+type TextDocumentInlayHintFunc func(context *glsp.Context, params *InlayHintParams) ([]InlayHint, error)
+
+const (
+	// MethodTextDocumentPrepareTypeHierarchy is the textDocument/prepareTypeHierarchy request.
+	MethodTextDocumentPrepareTypeHierarchy = protocol.Method("textDocument/prepareTypeHierarchy")
+
+	// MethodTypeHierarchySupertypes is the typeHierarchy/supertypes request.
+	MethodTypeHierarchySupertypes = protocol.Method("typeHierarchy/supertypes")
+
+	// MethodTypeHierarchySubtypes is the typeHierarchy/subtypes request.
+	MethodTypeHierarchySubtypes = protocol.Method("typeHierarchy/subtypes")
+)
+
+// TypeHierarchyPrepareParams are the parameters of the
+// textDocument/prepareTypeHierarchy request.
+type TypeHierarchyPrepareParams struct {
+	protocol.TextDocumentPositionParams
+	protocol.WorkDoneProgressParams
+}
+
+// TypeHierarchyItem is a type in the type hierarchy.
+type TypeHierarchyItem struct {
+	Name   string               `json:"name"`
+	Kind   protocol.SymbolKind  `json:"kind"`
+	Tags   []protocol.SymbolTag `json:"tags,omitempty"`
+	Detail *string              `json:"detail,omitempty"`
+	URI    protocol.DocumentUri `json:"uri"`
+
+	// Range encloses the whole declaration, SelectionRange the type's name
+	Range          protocol.Range `json:"range"`
+	SelectionRange protocol.Range `json:"selectionRange"`
+
+	// Data is passed back unchanged in supertypes and subtypes requests
+	Data any `json:"data,omitempty"`
+}
+
+// TypeHierarchySupertypesParams are the parameters of the
+// typeHierarchy/supertypes request.
+type TypeHierarchySupertypesParams struct {
+	protocol.WorkDoneProgressParams
+	protocol.PartialResultParams
+
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// TypeHierarchySubtypesParams are the parameters of the typeHierarchy/subtypes
+// request.
+type TypeHierarchySubtypesParams struct {
+	protocol.WorkDoneProgressParams
+	protocol.PartialResultParams
+
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// TextDocumentPrepareTypeHierarchyFunc handles the
+// textDocument/prepareTypeHierarchy request.
+type TextDocumentPrepareTypeHierarchyFunc func(context *glsp.Context, params *TypeHierarchyPrepareParams) ([]TypeHierarchyItem, error)
+
+// TypeHierarchySupertypesFunc handles the typeHierarchy/supertypes request.
+type TypeHierarchySupertypesFunc func(context *glsp.Context, params *TypeHierarchySupertypesParams) ([]TypeHierarchyItem, error)
+
+// TypeHierarchySubtypesFunc handles the typeHierarchy/subtypes request.
+type TypeHierarchySubtypesFunc func(context *glsp.Context, params *TypeHierarchySubtypesParams) ([]TypeHierarchyItem, error)
+
+const (
+	// MethodTextDocumentDiagnostic is the textDocument/diagnostic request.
+	MethodTextDocumentDiagnostic = protocol.Method("textDocument/diagnostic")
+
+	// MethodWorkspaceDiagnostic is the workspace/diagnostic request.
+	MethodWorkspaceDiagnostic = protocol.Method("workspace/diagnostic")
+
+	// MethodWorkspaceDiagnosticRefresh is the workspace/diagnostic/refresh
+	// request sent by the server.
+	MethodWorkspaceDiagnosticRefresh = protocol.Method("workspace/diagnostic/refresh")
+)
+
+// DiagnosticOptions are the options of the pull diagnostics capability.
+type DiagnosticOptions struct {
+	protocol.WorkDoneProgressOptions
+
+	// Identifier distinguishes the diagnostics of this server from others
+	Identifier *string `json:"identifier,omitempty"`
+
+	// InterFileDependencies is set if editing a file changes the diagnostics of others
+	InterFileDependencies bool `json:"interFileDependencies"`
+
+	// WorkspaceDiagnostics is set if the server answers workspace/diagnostic requests
+	WorkspaceDiagnostics bool `json:"workspaceDiagnostics"`
+}
+
+// DocumentDiagnosticParams are the parameters of the textDocument/diagnostic request.
+type DocumentDiagnosticParams struct {
+	protocol.WorkDoneProgressParams
+	protocol.PartialResultParams
+
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Identifier   *string                         `json:"identifier,omitempty"`
+
+	// PreviousResultID is the result ID of the last report the client received
+	PreviousResultID *string `json:"previousResultId,omitempty"`
+}
+
+// DocumentDiagnosticReportKind is the kind of a diagnostic report.
+type DocumentDiagnosticReportKind string
+
+const (
+	// DocumentDiagnosticReportKindFull is a report listing all diagnostics.
+	DocumentDiagnosticReportKindFull DocumentDiagnosticReportKind = "full"
+
+	// DocumentDiagnosticReportKindUnchanged is a report telling the client to
+	// keep the diagnostics of its previous report.
+	DocumentDiagnosticReportKindUnchanged DocumentDiagnosticReportKind = "unchanged"
+)
+
+// FullDocumentDiagnosticReport lists all diagnostics of a document.
+type FullDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultID *string                      `json:"resultId,omitempty"`
+	Items    []protocol.Diagnostic        `json:"items"`
+}
+
+// UnchangedDocumentDiagnosticReport tells the client that the diagnostics
+// of the report with ResultID are still current.
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultID string                       `json:"resultId"`
+}
+
+// PreviousResultID is the result ID of the last report received for a document.
+type PreviousResultID struct {
+	URI   protocol.DocumentUri `json:"uri"`
+	Value string               `json:"value"`
+}
+
+// WorkspaceDiagnosticParams are the parameters of the workspace/diagnostic request.
+type WorkspaceDiagnosticParams struct {
+	protocol.WorkDoneProgressParams
+	protocol.PartialResultParams
+
+	Identifier        *string            `json:"identifier,omitempty"`
+	PreviousResultIDs []PreviousResultID `json:"previousResultIds"`
+}
+
+// WorkspaceFullDocumentDiagnosticReport is a full report of a document in
+// the workspace. Version is the version of an open document, nil otherwise.
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *protocol.Integer    `json:"version"`
+}
+
+// WorkspaceUnchangedDocumentDiagnosticReport is an unchanged report of a
+// document in the workspace. Version is the version of an open document, nil
+// otherwise.
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *protocol.Integer    `json:"version"`
+}
+
+// WorkspaceDiagnosticReport is the result of the workspace/diagnostic request.
+// Items are WorkspaceFullDocumentDiagnosticReport or
+// WorkspaceUnchangedDocumentDiagnosticReport values.
+type WorkspaceDiagnosticReport struct {
+	Items []any `json:"items"`
+}
+
+// TextDocumentDiagnosticFunc handles the textDocument/diagnostic request. It
+// returns a FullDocumentDiagnosticReport or an UnchangedDocumentDiagnosticReport.
+type TextDocumentDiagnosticFunc func(context *glsp.Context, params *DocumentDiagnosticParams) (any, error)
+
+// WorkspaceDiagnosticFunc handles the workspace/diagnostic request.
+type WorkspaceDiagnosticFunc func(context *glsp.Context, params *WorkspaceDiagnosticParams) (*WorkspaceDiagnosticReport, error)
+
+// Handler dispatches the 3.17 requests it knows and leaves the others to
+// the embedded 3.16 handler.
+type Handler struct {
+	protocol.Handler
+
+	TextDocumentInlayHint            TextDocumentInlayHintFunc
+	TextDocumentPrepareTypeHierarchy TextDocumentPrepareTypeHierarchyFunc
+	TypeHierarchySupertypes          TypeHierarchySupertypesFunc
+	TypeHierarchySubtypes            TypeHierarchySubtypesFunc
+	TextDocumentDiagnostic           TextDocumentDiagnosticFunc
+	WorkspaceDiagnostic              WorkspaceDiagnosticFunc
+}
+
+// Handle implements glsp.Handler.
+func (h *Handler) Handle(context *glsp.Context) (r any, validMethod bool, validParams bool, err error) {
+	switch context.Method {
+	case MethodTextDocumentInlayHint:
+		return handleRequest(h, context, h.TextDocumentInlayHint)
+	case MethodTextDocumentPrepareTypeHierarchy:
+		return handleRequest(h, context, h.TextDocumentPrepareTypeHierarchy)
+	case MethodTypeHierarchySupertypes:
+		return handleRequest(h, context, h.TypeHierarchySupertypes)
+	case MethodTypeHierarchySubtypes:
+		return handleRequest(h, context, h.TypeHierarchySubtypes)
+	case MethodTextDocumentDiagnostic:
+		return handleRequest(h, context, h.TextDocumentDiagnostic)
+	case MethodWorkspaceDiagnostic:
+		return handleRequest(h, context, h.WorkspaceDiagnostic)
+	default:
+		return h.Handler.Handle(context)
+	}
+}
+
+// handleRequest decodes the parameters of a request and calls handler. A nil
+// handler reports the method as unknown, like unset 3.16 handlers do.
+func handleRequest[P any, R any](h *Handler, context *glsp.Context, handler func(*glsp.Context, *P) (R, error)) (r any, validMethod bool, validParams bool, err error) {
+	if handler == nil {
+		return nil, false, false, nil
+	}
+
+	if !h.IsInitialized() {
+		return nil, true, true, errors.New("server not initialized")
+	}
+
+	validMethod = true
+
+	var params P
+	if err = json.Unmarshal(context.Params, &params); err == nil {
+		validParams = true
+		r, err = handler(context, &params)
+	}
+
+	return r, validMethod, validParams, err
+}
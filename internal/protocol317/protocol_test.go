@@ -0,0 +1,192 @@
+package protocol317
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func newTestHandler(called *bool) *Handler {
+	return &Handler{
+		Handler: protocol.Handler{
+			Initialize: func(context *glsp.Context, params *protocol.InitializeParams) (any, error) {
+				return "initialized", nil
+			},
+		},
+		TextDocumentInlayHint: func(context *glsp.Context, params *InlayHintParams) ([]InlayHint, error) {
+			*called = true
+			return []InlayHint{{Position: params.Range.Start, Label: params.TextDocument.URI}}, nil
+		},
+	}
+}
+
+func TestHandler_InlayHint(t *testing.T) {
+	var called bool
+
+	handler := newTestHandler(&called)
+
+	// 3.16 methods are passed to the embedded handler
+	result, validMethod, _, err := handler.Handle(&glsp.Context{
+		Method: protocol.MethodInitialize,
+		Params: json.RawMessage(`{}`),
+	})
+	if err != nil || !validMethod || result != "initialized" {
+		t.Fatalf("Initialize: got %v, %v, %v", result, validMethod, err)
+	}
+
+	result, validMethod, validParams, err := handler.Handle(&glsp.Context{
+		Method: MethodTextDocumentInlayHint,
+		Params: json.RawMessage(`{"textDocument":{"uri":"file:///a.dws"},"range":{"start":{"line":1,"character":2},"end":{"line":3,"character":0}}}`),
+	})
+	if err != nil || !validMethod || !validParams {
+		t.Fatalf("InlayHint: got %v, %v, %v", validMethod, validParams, err)
+	}
+
+	hints, ok := result.([]InlayHint)
+	if !called || !ok || len(hints) != 1 {
+		t.Fatalf("Expected the inlay hint handler to be called, got %v", result)
+	}
+
+	if hints[0].Label != "file:///a.dws" || hints[0].Position != (protocol.Position{Line: 1, Character: 2}) {
+		t.Errorf("Unexpected hint %+v", hints[0])
+	}
+}
+
+func TestHandler_NotInitialized(t *testing.T) {
+	var called bool
+
+	handler := newTestHandler(&called)
+
+	_, _, _, err := handler.Handle(&glsp.Context{
+		Method: MethodTextDocumentInlayHint,
+		Params: json.RawMessage(`{}`),
+	})
+	if err == nil || called {
+		t.Errorf("Expected an error before initialization, got %v (called: %v)", err, called)
+	}
+}
+
+func TestHandler_UnsetMethod(t *testing.T) {
+	handler := &Handler{}
+	handler.SetInitialized(true)
+
+	_, validMethod, _, _ := handler.Handle(&glsp.Context{
+		Method: MethodTextDocumentInlayHint,
+		Params: json.RawMessage(`{}`),
+	})
+	if validMethod {
+		t.Error("Expected an unset handler to be reported as an unknown method")
+	}
+}
+
+func TestHandler_TypeHierarchy(t *testing.T) {
+	var prepared, supertypes, subtypes string
+
+	handler := &Handler{
+		TextDocumentPrepareTypeHierarchy: func(context *glsp.Context, params *TypeHierarchyPrepareParams) ([]TypeHierarchyItem, error) {
+			prepared = params.TextDocument.URI
+			return []TypeHierarchyItem{{Name: "TFoo", Kind: protocol.SymbolKindClass, URI: prepared}}, nil
+		},
+		TypeHierarchySupertypes: func(context *glsp.Context, params *TypeHierarchySupertypesParams) ([]TypeHierarchyItem, error) {
+			supertypes = params.Item.Name
+			return nil, nil
+		},
+		TypeHierarchySubtypes: func(context *glsp.Context, params *TypeHierarchySubtypesParams) ([]TypeHierarchyItem, error) {
+			subtypes = params.Item.Name
+			return nil, nil
+		},
+	}
+	handler.SetInitialized(true)
+
+	result, validMethod, validParams, err := handler.Handle(&glsp.Context{
+		Method: MethodTextDocumentPrepareTypeHierarchy,
+		Params: json.RawMessage(`{"textDocument":{"uri":"file:///a.dws"},"position":{"line":0,"character":6}}`),
+	})
+	if err != nil || !validMethod || !validParams {
+		t.Fatalf("PrepareTypeHierarchy: got %v, %v, %v", validMethod, validParams, err)
+	}
+
+	if items, ok := result.([]TypeHierarchyItem); !ok || len(items) != 1 || prepared != "file:///a.dws" {
+		t.Errorf("Expected the prepare handler to be called, got %v", result)
+	}
+
+	item := `{"item":{"name":"TFoo","kind":5,"uri":"file:///a.dws","range":{"start":{"line":0,"character":0},"end":{"line":1,"character":4}},"selectionRange":{"start":{"line":0,"character":5},"end":{"line":0,"character":9}}}}`
+
+	for _, method := range []string{MethodTypeHierarchySupertypes, MethodTypeHierarchySubtypes} {
+		if _, validMethod, validParams, err := handler.Handle(&glsp.Context{
+			Method: method,
+			Params: json.RawMessage(item),
+		}); err != nil || !validMethod || !validParams {
+			t.Fatalf("%s: got %v, %v, %v", method, validMethod, validParams, err)
+		}
+	}
+
+	if supertypes != "TFoo" || subtypes != "TFoo" {
+		t.Errorf("Expected the supertypes and subtypes handlers to get TFoo, got %q and %q", supertypes, subtypes)
+	}
+}
+
+func TestHandler_Diagnostic(t *testing.T) {
+	var previous string
+
+	handler := &Handler{
+		TextDocumentDiagnostic: func(context *glsp.Context, params *DocumentDiagnosticParams) (any, error) {
+			previous = *params.PreviousResultID
+			return UnchangedDocumentDiagnosticReport{Kind: DocumentDiagnosticReportKindUnchanged, ResultID: previous}, nil
+		},
+		WorkspaceDiagnostic: func(context *glsp.Context, params *WorkspaceDiagnosticParams) (*WorkspaceDiagnosticReport, error) {
+			return &WorkspaceDiagnosticReport{Items: []any{}}, nil
+		},
+	}
+	handler.SetInitialized(true)
+
+	result, validMethod, validParams, err := handler.Handle(&glsp.Context{
+		Method: MethodTextDocumentDiagnostic,
+		Params: json.RawMessage(`{"textDocument":{"uri":"file:///a.dws"},"previousResultId":"1"}`),
+	})
+	if err != nil || !validMethod || !validParams {
+		t.Fatalf("Diagnostic: got %v, %v, %v", validMethod, validParams, err)
+	}
+
+	if report, ok := result.(UnchangedDocumentDiagnosticReport); !ok || report.ResultID != "1" || previous != "1" {
+		t.Errorf("Expected an unchanged report for result 1, got %v", result)
+	}
+
+	result, validMethod, validParams, err = handler.Handle(&glsp.Context{
+		Method: MethodWorkspaceDiagnostic,
+		Params: json.RawMessage(`{"previousResultIds":[{"uri":"file:///a.dws","value":"1"}]}`),
+	})
+	if err != nil || !validMethod || !validParams {
+		t.Fatalf("WorkspaceDiagnostic: got %v, %v, %v", validMethod, validParams, err)
+	}
+
+	if _, ok := result.(*WorkspaceDiagnosticReport); !ok {
+		t.Errorf("Expected a workspace report, got %v", result)
+	}
+
+	// A full report always lists its items, even if there are none
+	encoded, err := json.Marshal(FullDocumentDiagnosticReport{Kind: DocumentDiagnosticReportKindFull, Items: []protocol.Diagnostic{}})
+	if err != nil || string(encoded) != `{"kind":"full","items":[]}` {
+		t.Errorf("Unexpected encoding of an empty full report: %s, %v", encoded, err)
+	}
+}
+
+func TestClientCapabilities(t *testing.T) {
+	var capabilities ClientCapabilities
+
+	err := json.Unmarshal([]byte(`{"textDocument":{"diagnostic":{"dynamicRegistration":false}},"workspace":{"diagnostics":{"refreshSupport":true}}}`), &capabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !capabilities.SupportsPullDiagnostics() || !capabilities.SupportsDiagnosticRefresh() {
+		t.Errorf("Expected pull diagnostics with refresh support, got %+v", capabilities)
+	}
+
+	var none *ClientCapabilities
+	if none.SupportsPullDiagnostics() || none.SupportsDiagnosticRefresh() {
+		t.Error("Expected no support without capabilities")
+	}
+}
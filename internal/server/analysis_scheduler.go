@@ -0,0 +1,309 @@
+// Package server provides background document analysis scheduling.
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// DefaultAnalysisDelay is the debounce interval between the last edit of a
+// document and the start of its recompilation.
+const DefaultAnalysisDelay = 300 * time.Millisecond
+
+// CompileFunc compiles the text of a document. It fills in the Program,
+// PartialAST and Diagnostics of the returned result; the scheduler sets the rest.
+// The context is cancelled when a newer version of the document supersedes the compile.
+type CompileFunc func(ctx context.Context, uri string, text string) (*AnalysisResult, error)
+
+// ResultFunc receives the outcome of an analysis that was not superseded.
+type ResultFunc func(result *AnalysisResult)
+
+// AnalysisResult holds the outcome of compiling one version of a document.
+type AnalysisResult struct {
+	URI         string
+	Version     int
+	Text        string
+	Program     *dwscript.Program
+	Diagnostics []protocol.Diagnostic
+	Err         error
+
+	// PartialAST is the syntax tree recovered from a text that doesn't compile
+	PartialAST *ast.Program
+}
+
+// AnalysisScheduler runs document compilation in the background.
+// Rapid edits to the same document are coalesced: every Schedule call restarts
+// the debounce timer and cancels the compile of the previous version, so only
+// the most recent version of a document is ever reported.
+type AnalysisScheduler struct {
+	// jobs maps document URIs to their pending or running analysis
+	jobs map[string]*analysisJob
+
+	// compile performs the actual compilation
+	compile CompileFunc
+
+	// delay is the debounce interval
+	delay time.Duration
+
+	// stopped is set once the scheduler has been shut down
+	stopped bool
+
+	// mu protects the fields above
+	mu sync.Mutex
+}
+
+// analysisJob is a single scheduled analysis of one document version.
+type analysisJob struct {
+	uri      string
+	version  int
+	text     string
+	onResult ResultFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+
+	// started is set once the compile goroutine has picked up the job
+	started bool
+
+	// done is closed when the job has finished or was superseded
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// NewAnalysisScheduler creates a new scheduler with the given debounce delay.
+func NewAnalysisScheduler(delay time.Duration) *AnalysisScheduler {
+	return &AnalysisScheduler{
+		jobs:  make(map[string]*analysisJob),
+		delay: delay,
+	}
+}
+
+// SetCompileFunc sets the function used to compile documents.
+func (s *AnalysisScheduler) SetCompileFunc(compile CompileFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compile = compile
+}
+
+// SetDelay changes the debounce delay for analyses scheduled afterwards.
+func (s *AnalysisScheduler) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	s.delay = delay
+}
+
+// Delay returns the current debounce delay.
+func (s *AnalysisScheduler) Delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delay
+}
+
+// Schedule queues an analysis of the given document version.
+// Any pending or running analysis of an older version of the same document is
+// cancelled and its result discarded. onResult is called from a background
+// goroutine once the compile finishes, unless the job was superseded meanwhile.
+func (s *AnalysisScheduler) Schedule(uri string, version int, text string, onResult ResultFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+
+	if previous, ok := s.jobs[uri]; ok {
+		s.supersedeLocked(previous)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &analysisJob{
+		uri:      uri,
+		version:  version,
+		text:     text,
+		onResult: onResult,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	s.jobs[uri] = job
+	job.timer = time.AfterFunc(s.delay, func() { s.run(job) })
+}
+
+// Wait blocks until the analysis of the given version (or a newer one) of a
+// document has completed, or until the timeout expires. A job still waiting
+// for its debounce timer is started immediately, so callers that need a fresh
+// Program don't pay the debounce delay.
+// It returns true if no analysis is pending for that version anymore.
+func (s *AnalysisScheduler) Wait(uri string, version int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		s.mu.Lock()
+
+		job, ok := s.jobs[uri]
+		if !ok || job.version < version {
+			s.mu.Unlock()
+			return true
+		}
+
+		s.flushLocked(job)
+		s.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-job.done:
+			timer.Stop()
+			// The job either finished or was superseded by a newer version;
+			// loop to check whether something is still pending.
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// Pending reports whether an analysis for the document is queued or running.
+func (s *AnalysisScheduler) Pending(uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.jobs[uri]
+
+	return ok
+}
+
+// Cancel cancels any pending or running analysis of the document.
+// This should be called when a document is closed.
+func (s *AnalysisScheduler) Cancel(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[uri]; ok {
+		s.supersedeLocked(job)
+		delete(s.jobs, uri)
+	}
+}
+
+// Stop cancels all analyses and rejects further scheduling.
+func (s *AnalysisScheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+
+	for uri, job := range s.jobs {
+		s.supersedeLocked(job)
+		delete(s.jobs, uri)
+	}
+}
+
+// run compiles the job's text and reports the result if the job is still current.
+func (s *AnalysisScheduler) run(job *analysisJob) {
+	s.mu.Lock()
+
+	if job.started || job.ctx.Err() != nil {
+		s.mu.Unlock()
+		job.finish()
+
+		return
+	}
+
+	job.started = true
+	compile := s.compile
+	s.mu.Unlock()
+
+	defer job.finish()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic while analyzing %s (version %d): %v\n", job.uri, job.version, r)
+			s.release(job)
+		}
+	}()
+
+	if compile == nil {
+		log.Printf("Warning: no compile function configured, skipping analysis of %s\n", job.uri)
+		s.release(job)
+
+		return
+	}
+
+	result, err := compile(job.ctx, job.uri, job.text)
+
+	if job.ctx.Err() != nil {
+		log.Printf("Discarding superseded analysis of %s (version %d)\n", job.uri, job.version)
+		return
+	}
+
+	if result == nil {
+		result = &AnalysisResult{}
+	}
+
+	result.URI = job.uri
+	result.Version = job.version
+	result.Text = job.text
+	result.Err = err
+
+	if job.onResult != nil {
+		job.onResult(result)
+	}
+
+	s.release(job)
+}
+
+// release removes the job from the pending set if it is still the current one.
+func (s *AnalysisScheduler) release(job *analysisJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[job.uri] == job {
+		delete(s.jobs, job.uri)
+	}
+}
+
+// flushLocked starts a job that is still waiting for its debounce timer.
+// The caller must hold s.mu.
+func (s *AnalysisScheduler) flushLocked(job *analysisJob) {
+	if job.started {
+		return
+	}
+
+	if job.timer.Stop() {
+		go s.run(job)
+	}
+}
+
+// supersedeLocked cancels a job that has been replaced by a newer one.
+// The caller must hold s.mu.
+func (s *AnalysisScheduler) supersedeLocked(job *analysisJob) {
+	job.cancel()
+
+	// If the timer never fired the job will never run, so wake up waiters here.
+	if job.timer.Stop() {
+		job.finish()
+	}
+}
+
+// finish marks the job as done exactly once.
+func (job *analysisJob) finish() {
+	job.doneOnce.Do(func() { close(job.done) })
+}
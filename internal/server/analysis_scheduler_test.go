@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const testAnalysisURI = "file:///test.dws"
+
+// recordingCompiler is a CompileFunc that records which texts were compiled.
+type recordingCompiler struct {
+	mu       sync.Mutex
+	compiled []string
+	delay    time.Duration
+}
+
+func (rc *recordingCompiler) compile(ctx context.Context, _ string, text string) (*AnalysisResult, error) {
+	if rc.delay > 0 {
+		select {
+		case <-time.After(rc.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.compiled = append(rc.compiled, text)
+
+	return &AnalysisResult{Diagnostics: []protocol.Diagnostic{}}, nil
+}
+
+func (rc *recordingCompiler) texts() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]string(nil), rc.compiled...)
+}
+
+// resultCollector gathers results delivered by the scheduler.
+type resultCollector struct {
+	mu      sync.Mutex
+	results []*AnalysisResult
+}
+
+func (c *resultCollector) onResult(result *AnalysisResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results = append(c.results, result)
+}
+
+func (c *resultCollector) versions() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := make([]int, 0, len(c.results))
+	for _, r := range c.results {
+		versions = append(versions, r.Version)
+	}
+
+	return versions
+}
+
+func TestAnalysisScheduler_CoalescesRapidEdits(t *testing.T) {
+	compiler := &recordingCompiler{}
+	collector := &resultCollector{}
+
+	scheduler := NewAnalysisScheduler(50 * time.Millisecond)
+	scheduler.SetCompileFunc(compiler.compile)
+
+	for version := 1; version <= 5; version++ {
+		scheduler.Schedule(testAnalysisURI, version, "text", collector.onResult)
+	}
+
+	require.True(t, scheduler.Wait(testAnalysisURI, 5, time.Second))
+
+	assert.Equal(t, []int{5}, collector.versions())
+	assert.Len(t, compiler.texts(), 1)
+	assert.False(t, scheduler.Pending(testAnalysisURI))
+}
+
+func TestAnalysisScheduler_WaitFlushesDebounce(t *testing.T) {
+	compiler := &recordingCompiler{}
+	collector := &resultCollector{}
+
+	// A debounce delay far longer than the wait timeout
+	scheduler := NewAnalysisScheduler(time.Hour)
+	scheduler.SetCompileFunc(compiler.compile)
+
+	scheduler.Schedule(testAnalysisURI, 1, "var x: Integer;", collector.onResult)
+
+	require.True(t, scheduler.Wait(testAnalysisURI, 1, time.Second))
+	assert.Equal(t, []int{1}, collector.versions())
+	assert.Equal(t, []string{"var x: Integer;"}, compiler.texts())
+
+	result := collector.results[0]
+	assert.Equal(t, testAnalysisURI, result.URI)
+	assert.Equal(t, "var x: Integer;", result.Text)
+	assert.NotNil(t, result.Diagnostics)
+}
+
+func TestAnalysisScheduler_SupersededCompileIsDiscarded(t *testing.T) {
+	compiler := &recordingCompiler{delay: 100 * time.Millisecond}
+	collector := &resultCollector{}
+
+	scheduler := NewAnalysisScheduler(0)
+	scheduler.SetCompileFunc(compiler.compile)
+
+	scheduler.Schedule(testAnalysisURI, 1, "old", collector.onResult)
+
+	// Let the first compile start, then supersede it
+	time.Sleep(20 * time.Millisecond)
+	scheduler.Schedule(testAnalysisURI, 2, "new", collector.onResult)
+
+	require.True(t, scheduler.Wait(testAnalysisURI, 2, time.Second))
+
+	assert.Equal(t, []int{2}, collector.versions())
+	assert.Equal(t, []string{"new"}, compiler.texts())
+}
+
+func TestAnalysisScheduler_WaitWithoutPendingJob(t *testing.T) {
+	scheduler := NewAnalysisScheduler(DefaultAnalysisDelay)
+
+	assert.True(t, scheduler.Wait(testAnalysisURI, 1, 10*time.Millisecond))
+}
+
+func TestAnalysisScheduler_WaitTimesOut(t *testing.T) {
+	compiler := &recordingCompiler{delay: 200 * time.Millisecond}
+
+	scheduler := NewAnalysisScheduler(0)
+	scheduler.SetCompileFunc(compiler.compile)
+
+	scheduler.Schedule(testAnalysisURI, 1, "text", nil)
+
+	assert.False(t, scheduler.Wait(testAnalysisURI, 1, 20*time.Millisecond))
+	assert.True(t, scheduler.Wait(testAnalysisURI, 1, time.Second))
+}
+
+func TestAnalysisScheduler_Cancel(t *testing.T) {
+	compiler := &recordingCompiler{}
+	collector := &resultCollector{}
+
+	scheduler := NewAnalysisScheduler(30 * time.Millisecond)
+	scheduler.SetCompileFunc(compiler.compile)
+
+	scheduler.Schedule(testAnalysisURI, 1, "text", collector.onResult)
+	scheduler.Cancel(testAnalysisURI)
+
+	assert.False(t, scheduler.Pending(testAnalysisURI))
+
+	time.Sleep(80 * time.Millisecond)
+
+	assert.Empty(t, collector.versions())
+	assert.Empty(t, compiler.texts())
+}
+
+func TestAnalysisScheduler_StopRejectsNewJobs(t *testing.T) {
+	compiler := &recordingCompiler{}
+
+	scheduler := NewAnalysisScheduler(0)
+	scheduler.SetCompileFunc(compiler.compile)
+	scheduler.Stop()
+
+	scheduler.Schedule(testAnalysisURI, 1, "text", nil)
+
+	assert.False(t, scheduler.Pending(testAnalysisURI))
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// FileDiagnostics are the diagnostics of a workspace file.
+type FileDiagnostics struct {
+	// ResultID identifies the contents the diagnostics were computed from
+	ResultID string
+
+	Diagnostics []protocol.Diagnostic
+}
+
+// DiagnosticStore holds the diagnostics of workspace files, which the indexer
+// records while compiling them, and the units each file uses, so that the
+// files can be checked again when one of those units changes. Open documents
+// keep their own diagnostics, computed from the editor's text.
+type DiagnosticStore struct {
+	files map[string]FileDiagnostics
+	units map[string][]string
+	mu    sync.RWMutex
+}
+
+// NewDiagnosticStore creates an empty diagnostic store.
+func NewDiagnosticStore() *DiagnosticStore {
+	return &DiagnosticStore{
+		files: make(map[string]FileDiagnostics),
+		units: make(map[string][]string),
+	}
+}
+
+// SetDiagnostics replaces the diagnostics of uri. It implements
+// workspace.DiagnosticIndex.
+func (ds *DiagnosticStore) SetDiagnostics(uri string, resultID string, diagnostics []protocol.Diagnostic) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.files[uri] = FileDiagnostics{ResultID: resultID, Diagnostics: diagnostics}
+}
+
+// SetUnits replaces the names of the units used by uri. It implements
+// workspace.DependencyIndex.
+func (ds *DiagnosticStore) SetUnits(uri string, units []string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if len(units) == 0 {
+		delete(ds.units, uri)
+		return
+	}
+
+	ds.units[uri] = units
+}
+
+// Dependents returns the URIs of the files using the unit name, sorted. Unit
+// names are compared ignoring case.
+func (ds *DiagnosticStore) Dependents(name string) []string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	var dependents []string
+
+	for uri, units := range ds.units {
+		if slices.ContainsFunc(units, func(unit string) bool { return strings.EqualFold(unit, name) }) {
+			dependents = append(dependents, uri)
+		}
+	}
+
+	slices.Sort(dependents)
+
+	return dependents
+}
+
+// Get returns the diagnostics of uri.
+func (ds *DiagnosticStore) Get(uri string) (FileDiagnostics, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	file, exists := ds.files[uri]
+
+	return file, exists
+}
+
+// Remove removes the diagnostics and units of uri.
+func (ds *DiagnosticStore) Remove(uri string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	delete(ds.files, uri)
+	delete(ds.units, uri)
+}
+
+// RemoveUnder removes the diagnostics and units of all files below the
+// directory dirURI and returns the URIs of the files that had diagnostics.
+func (ds *DiagnosticStore) RemoveUnder(dirURI string) []string {
+	prefix := strings.TrimSuffix(dirURI, "/") + "/"
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var removed []string
+
+	for uri := range ds.files {
+		if strings.HasPrefix(uri, prefix) {
+			delete(ds.files, uri)
+			removed = append(removed, uri)
+		}
+	}
+
+	for uri := range ds.units {
+		if strings.HasPrefix(uri, prefix) {
+			delete(ds.units, uri)
+		}
+	}
+
+	slices.Sort(removed)
+
+	return removed
+}
+
+// List returns the URIs of all files with recorded diagnostics, sorted.
+func (ds *DiagnosticStore) List() []string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	uris := make([]string, 0, len(ds.files))
+	for uri := range ds.files {
+		uris = append(uris, uri)
+	}
+
+	slices.Sort(uris)
+
+	return uris
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestDiagnosticStore(t *testing.T) {
+	store := NewDiagnosticStore()
+	diagnostics := []protocol.Diagnostic{{Message: "Unknown name"}}
+
+	store.SetDiagnostics("file:///work/src/b.dws", "2", diagnostics)
+	store.SetDiagnostics("file:///work/src/a.dws", "1", nil)
+	store.SetDiagnostics("file:///work/other.dws", "3", nil)
+
+	file, ok := store.Get("file:///work/src/b.dws")
+	assert.True(t, ok)
+	assert.Equal(t, FileDiagnostics{ResultID: "2", Diagnostics: diagnostics}, file)
+
+	assert.Equal(t, []string{"file:///work/other.dws", "file:///work/src/a.dws", "file:///work/src/b.dws"}, store.List())
+
+	assert.Equal(t, []string{"file:///work/src/a.dws", "file:///work/src/b.dws"}, store.RemoveUnder("file:///work/src"))
+
+	store.Remove("file:///work/other.dws")
+
+	_, ok = store.Get("file:///work/other.dws")
+	assert.False(t, ok)
+	assert.Empty(t, store.List())
+}
+
+func TestDiagnosticStore_Dependents(t *testing.T) {
+	store := NewDiagnosticStore()
+
+	store.SetUnits("file:///work/main.dws", []string{"Utils", "Shapes"})
+	store.SetUnits("file:///work/lib/draw.dws", []string{"shapes"})
+	store.SetUnits("file:///work/lib/utils.dws", nil)
+
+	assert.Equal(t, []string{"file:///work/lib/draw.dws", "file:///work/main.dws"}, store.Dependents("SHAPES"))
+	assert.Equal(t, []string{"file:///work/main.dws"}, store.Dependents("Utils"))
+	assert.Empty(t, store.Dependents("Missing"))
+
+	store.RemoveUnder("file:///work/lib")
+	assert.Equal(t, []string{"file:///work/main.dws"}, store.Dependents("Shapes"))
+
+	store.Remove("file:///work/main.dws")
+	assert.Empty(t, store.Dependents("Shapes"))
+}
@@ -3,10 +3,17 @@ package server
 import (
 	"sync"
 
+	"github.com/CWBudde/go-dws-lsp/internal/document"
+	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/dwscript"
+	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
 // Document represents an open document in the workspace.
+//
+// Documents in the store are immutable snapshots: handlers running
+// concurrently with edits read them without locking. Never modify a document
+// returned by the store; copy it, or replace it through Set or Update.
 type Document struct {
 	URI        string
 	Text       string
@@ -16,6 +23,74 @@ type Document struct {
 	// Program is the compiled DWScript program (nil if compilation failed).
 	// This is stored after successful compilation and provides access to the AST.
 	Program *dwscript.Program
+
+	// PartialAST is the syntax tree recovered from Text when it doesn't compile.
+	// Statements the parser couldn't make sense of are missing from it; the
+	// diagnostics published for the document describe them. It has not been
+	// type-checked. Nil when Program is set.
+	PartialAST *ast.Program
+
+	// LastGoodProgram is the most recent program that compiled successfully.
+	// It is kept while the document doesn't compile, so that IDE features keep
+	// working on slightly stale data instead of disappearing mid-edit.
+	LastGoodProgram *dwscript.Program
+
+	// LastGoodText and LastGoodVersion identify the text LastGoodProgram was compiled from.
+	LastGoodText    string
+	LastGoodVersion int
+
+	// Edits maps positions in LastGoodText to positions in Text.
+	// It is nil while Program is up to date.
+	Edits *document.PositionMap
+
+	// Diagnostics are the diagnostics of the most recently analyzed text, and
+	// DiagnosticsResultID identifies that text for pull diagnostics. They lag
+	// behind Text while a background analysis is pending.
+	Diagnostics         []protocol.Diagnostic
+	DiagnosticsResultID string
+}
+
+// AST returns the syntax tree of the document's text: the AST of the compiled
+// program, or the partial AST if the text doesn't compile. Returns nil if
+// neither is available.
+func (d *Document) AST() *ast.Program {
+	if d.Program != nil {
+		return d.Program.AST()
+	}
+
+	return d.PartialAST
+}
+
+// SyntaxView is like AnalysisView, but prefers the partial AST of the current
+// text over the last good program. Use it for features that only need the
+// syntax tree, like the outline or highlighting, and benefit from seeing code
+// that is still being written. Access the tree through AST().
+func (d *Document) SyntaxView() (*Document, *document.PositionMap) {
+	if d.Program == nil && d.PartialAST != nil {
+		return d, nil
+	}
+
+	return d.AnalysisView()
+}
+
+// AnalysisView returns a document whose Program and Text belong together.
+// If the current text compiled, that is the document itself. Otherwise it is a
+// view of the last successfully compiled version, together with the map that
+// translates its positions to the current text. The map is nil when no
+// translation is needed.
+func (d *Document) AnalysisView() (*Document, *document.PositionMap) {
+	if d.Program != nil || d.LastGoodProgram == nil {
+		return d, nil
+	}
+
+	view := *d
+	view.Text = d.LastGoodText
+	view.Version = d.LastGoodVersion
+	view.Program = d.LastGoodProgram
+	view.PartialAST = nil
+	view.Edits = nil
+
+	return &view, d.Edits
 }
 
 // DocumentStore manages all open documents.
@@ -31,7 +106,7 @@ func NewDocumentStore() *DocumentStore {
 	}
 }
 
-// Set stores or updates a document.
+// Set stores or replaces a document. The document must not be modified afterwards.
 func (ds *DocumentStore) Set(uri string, doc *Document) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
@@ -40,6 +115,7 @@ func (ds *DocumentStore) Set(uri string, doc *Document) {
 }
 
 // Get retrieves a document by URI.
+// The returned document is a snapshot that later changes to the store don't affect.
 func (ds *DocumentStore) Get(uri string) (*Document, bool) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
@@ -49,6 +125,30 @@ func (ds *DocumentStore) Get(uri string) (*Document, bool) {
 	return doc, ok
 }
 
+// Update atomically modifies a stored document.
+// The update function receives a copy of the current document and returns false
+// to leave the store unchanged. Documents previously returned by Get are never
+// mutated, so readers holding them keep a consistent snapshot.
+// Returns the stored document and whether the update was applied.
+func (ds *DocumentStore) Update(uri string, update func(doc *Document) bool) (*Document, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	current, ok := ds.documents[uri]
+	if !ok {
+		return nil, false
+	}
+
+	updated := *current
+	if !update(&updated) {
+		return current, false
+	}
+
+	ds.documents[uri] = &updated
+
+	return &updated, true
+}
+
 // Delete removes a document from the store.
 func (ds *DocumentStore) Delete(uri string) {
 	ds.mu.Lock()
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tliron/glsp"
+)
+
+// RequestTracker keeps track of requests that are being handled, so that they
+// can be cancelled by $/cancelRequest or superseded by a newer request.
+//
+// Handlers don't see request IDs; they find their request's context through
+// the glsp.Context they were called with.
+type RequestTracker struct {
+	mu         sync.Mutex
+	byID       map[string]*trackedRequest
+	byContext  map[*glsp.Context]*trackedRequest
+	supersedes map[string]bool
+}
+
+// trackedRequest is a request that is being handled.
+type trackedRequest struct {
+	id     string
+	method string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRequestTracker creates a request tracker.
+// A new request for one of supersedingMethods cancels any request for the same
+// method that is still being handled, since its result is no longer wanted.
+func NewRequestTracker(supersedingMethods ...string) *RequestTracker {
+	supersedes := make(map[string]bool, len(supersedingMethods))
+	for _, method := range supersedingMethods {
+		supersedes[method] = true
+	}
+
+	return &RequestTracker{
+		byID:       make(map[string]*trackedRequest),
+		byContext:  make(map[*glsp.Context]*trackedRequest),
+		supersedes: supersedes,
+	}
+}
+
+// Begin registers a request with the given ID and method, handled with the
+// glsp.Context key. It returns the request's context, which is cancelled when
+// the request is cancelled or superseded, and a function that must be called
+// once the request has been handled.
+func (t *RequestTracker) Begin(id, method string, key *glsp.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	request := &trackedRequest{id: id, method: method, ctx: ctx, cancel: cancel}
+
+	t.mu.Lock()
+
+	if t.supersedes[method] {
+		for _, other := range t.byID {
+			if other.method == method {
+				other.cancel()
+			}
+		}
+	}
+
+	t.byID[id] = request
+	t.byContext[key] = request
+
+	t.mu.Unlock()
+
+	done := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.byID[id] == request {
+			delete(t.byID, id)
+		}
+
+		delete(t.byContext, key)
+		cancel()
+	}
+
+	return ctx, done
+}
+
+// Cancel cancels the request with the given ID.
+// It returns false if no such request is being handled.
+func (t *RequestTracker) Cancel(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	request, ok := t.byID[id]
+	if !ok {
+		return false
+	}
+
+	request.cancel()
+
+	return true
+}
+
+// CancelAll cancels all requests that are being handled.
+func (t *RequestTracker) CancelAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, request := range t.byID {
+		request.cancel()
+	}
+}
+
+// Context returns the context of the request handled with key.
+// Requests that aren't tracked, such as those handled synchronously or
+// handlers called directly in tests, get a context that is never cancelled.
+func (t *RequestTracker) Context(key *glsp.Context) context.Context {
+	if t == nil || key == nil {
+		return context.Background()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if request, ok := t.byContext[key]; ok {
+		return request.ctx
+	}
+
+	return context.Background()
+}
+
+// Pending returns the number of requests that are being handled.
+func (t *RequestTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.byID)
+}
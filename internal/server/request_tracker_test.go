@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tliron/glsp"
+)
+
+func TestRequestTracker_Cancel(t *testing.T) {
+	tracker := NewRequestTracker()
+	key := &glsp.Context{Method: "textDocument/references"}
+
+	ctx, done := tracker.Begin("1", key.Method, key)
+	defer done()
+
+	assert.Equal(t, ctx, tracker.Context(key))
+	assert.Equal(t, 1, tracker.Pending())
+
+	assert.False(t, tracker.Cancel("2"))
+	assert.NoError(t, ctx.Err())
+
+	assert.True(t, tracker.Cancel("1"))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestRequestTracker_DoneForgetsRequest(t *testing.T) {
+	tracker := NewRequestTracker()
+	key := &glsp.Context{Method: "textDocument/rename"}
+
+	ctx, done := tracker.Begin("1", key.Method, key)
+	done()
+
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.Equal(t, 0, tracker.Pending())
+	assert.False(t, tracker.Cancel("1"))
+	assert.NoError(t, tracker.Context(key).Err())
+}
+
+func TestRequestTracker_SupersedesSameMethod(t *testing.T) {
+	tracker := NewRequestTracker("workspace/symbol")
+
+	first, doneFirst := tracker.Begin("1", "workspace/symbol", &glsp.Context{})
+	defer doneFirst()
+
+	other, doneOther := tracker.Begin("2", "textDocument/references", &glsp.Context{})
+	defer doneOther()
+
+	second, doneSecond := tracker.Begin("3", "workspace/symbol", &glsp.Context{})
+	defer doneSecond()
+
+	assert.ErrorIs(t, first.Err(), context.Canceled)
+	assert.NoError(t, other.Err())
+	assert.NoError(t, second.Err())
+}
+
+func TestRequestTracker_UntrackedContext(t *testing.T) {
+	var tracker *RequestTracker
+
+	assert.NoError(t, tracker.Context(&glsp.Context{}).Err())
+	assert.NoError(t, NewRequestTracker().Context(nil).Err())
+}
+
+func TestServer_ShutdownCancelsRequests(t *testing.T) {
+	srv := New()
+	key := &glsp.Context{}
+
+	ctx, done := srv.Requests().Begin("1", "textDocument/references", key)
+	defer done()
+
+	srv.SetShuttingDown()
+
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.ErrorIs(t, srv.Context().Err(), context.Canceled)
+}
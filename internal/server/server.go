@@ -2,7 +2,10 @@
 package server
 
 import (
+	"context"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -19,12 +22,20 @@ type Server struct {
 	// workspaceIndex stores workspace-wide symbol definitions for global symbol search
 	workspaceIndex *workspace.SymbolIndex
 
+	// diagnostics stores the diagnostics of workspace files found by the indexer
+	diagnostics *DiagnosticStore
+
 	// workspaceFolders stores the workspace folders from the client
 	workspaceFolders []string
 
 	// clientCapabilities stores the client's capabilities from the initialize request
 	clientCapabilities *protocol.ClientCapabilities
 
+	// pullDiagnostics and diagnosticRefresh are set if the client pulls
+	// diagnostics and can be asked to pull them again
+	pullDiagnostics   bool
+	diagnosticRefresh bool
+
 	// completionCache caches completion items for performance (task 9.17)
 	completionCache *CompletionCache
 
@@ -37,6 +48,21 @@ type Server struct {
 	// semanticTokensCache stores previous semantic tokens for delta computation (task 12.20)
 	semanticTokensCache *SemanticTokensCache
 
+	// analysis schedules debounced background compilation of open documents
+	analysis *AnalysisScheduler
+
+	// requests tracks requests being handled so they can be cancelled
+	requests *RequestTracker
+
+	// ctx is cancelled on shutdown and stops background work such as indexing
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// indexing is the context of workspace indexing runs; it is replaced when
+	// the workspace is re-indexed from scratch
+	indexing       context.Context
+	cancelIndexing context.CancelFunc
+
 	// mutex protects server state
 	mu sync.RWMutex
 
@@ -51,20 +77,73 @@ type Config struct {
 
 	// Trace controls logging verbosity
 	Trace string
+
+	// AnalysisDelay is the debounce interval before an edited document is recompiled
+	AnalysisDelay time.Duration
+
+	// IndexCacheDir is where workspace index caches are stored; empty disables caching
+	IndexCacheDir string
+
+	// IndexWorkers is the number of files indexed in parallel; 0 uses all CPUs
+	IndexWorkers int
+
+	// IndexFilter decides which workspace files are indexed
+	IndexFilter workspace.IndexFilter
+
+	// InlayHints decides which inlay hints are shown
+	InlayHints InlayHintOptions
+
+	// LibraryPaths are directories searched for units and include files;
+	// relative paths are resolved against the workspace folders
+	LibraryPaths []string
+
+	// WorkspaceDiagnostics publishes the diagnostics of workspace files that
+	// aren't open, to clients that don't pull diagnostics
+	WorkspaceDiagnostics bool
+}
+
+// InlayHintOptions decides which inlay hints are shown.
+type InlayHintOptions struct {
+	// ParameterNames shows the parameter names before call arguments
+	ParameterNames bool
+
+	// VariableTypes shows the inferred types of var declarations without a type
+	VariableTypes bool
+
+	// SuppressMatchingNames hides parameter names for arguments named like the parameter
+	SuppressMatchingNames bool
 }
 
 // New creates a new LSP server instance.
 func New() *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	indexing, cancelIndexing := context.WithCancel(ctx)
+
 	return &Server{
 		documents:            NewDocumentStore(),
 		symbolIndex:          NewSymbolIndex(),
 		workspaceIndex:       workspace.NewSymbolIndex(),
+		diagnostics:          NewDiagnosticStore(),
 		completionCache:      NewCompletionCache(),
 		semanticTokensLegend: NewSemanticTokensLegend(),
 		semanticTokensCache:  NewSemanticTokensCache(),
+		analysis:             NewAnalysisScheduler(DefaultAnalysisDelay),
+		requests:             NewRequestTracker(string(protocol.MethodWorkspaceSymbol)),
+		ctx:                  ctx,
+		cancel:               cancel,
+		indexing:             indexing,
+		cancelIndexing:       cancelIndexing,
 		config: &Config{
-			MaxProblems: 100,
-			Trace:       "off",
+			MaxProblems:   100,
+			Trace:         "off",
+			AnalysisDelay: DefaultAnalysisDelay,
+			IndexCacheDir: workspace.DefaultIndexCacheDir(),
+			IndexFilter:   workspace.DefaultIndexFilter(),
+			InlayHints: InlayHintOptions{
+				ParameterNames:        true,
+				VariableTypes:         true,
+				SuppressMatchingNames: true,
+			},
 		},
 	}
 }
@@ -78,11 +157,46 @@ func (s *Server) IsShuttingDown() bool {
 }
 
 // SetShuttingDown marks the server as shutting down.
+// Background work and requests being handled are cancelled.
 func (s *Server) SetShuttingDown() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.shuttingDown = true
+	s.cancel()
+	s.requests.CancelAll()
+}
+
+// Context returns a context that is cancelled when the server shuts down.
+// Background work that outlives a single request runs under it.
+func (s *Server) Context() context.Context {
+	return s.ctx
+}
+
+// IndexingContext returns the context workspace indexing runs under.
+// It is cancelled on shutdown and when indexing is restarted.
+func (s *Server) IndexingContext() context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.indexing
+}
+
+// RestartIndexing cancels all running workspace indexing and returns the
+// context for indexing the workspace again.
+func (s *Server) RestartIndexing() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelIndexing()
+	s.indexing, s.cancelIndexing = context.WithCancel(s.ctx)
+
+	return s.indexing
+}
+
+// Requests returns the tracker of requests being handled.
+func (s *Server) Requests() *RequestTracker {
+	return s.requests
 }
 
 // Documents returns the document store.
@@ -100,6 +214,11 @@ func (s *Server) WorkspaceIndex() *workspace.SymbolIndex {
 	return s.workspaceIndex
 }
 
+// Diagnostics returns the diagnostics of workspace files.
+func (s *Server) Diagnostics() *DiagnosticStore {
+	return s.diagnostics
+}
+
 // Config returns the server configuration.
 func (s *Server) Config() *Config {
 	s.mu.RLock()
@@ -133,6 +252,38 @@ func (s *Server) GetWorkspaceFolders() []string {
 	return s.workspaceFolders
 }
 
+// AddWorkspaceFolder adds a workspace folder.
+// It returns false if the folder is already part of the workspace.
+func (s *Server) AddWorkspaceFolder(folder string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.Contains(s.workspaceFolders, folder) {
+		return false
+	}
+
+	s.workspaceFolders = append(slices.Clip(s.workspaceFolders), folder)
+
+	return true
+}
+
+// RemoveWorkspaceFolder removes a workspace folder.
+// It returns false if the folder is not part of the workspace.
+func (s *Server) RemoveWorkspaceFolder(folder string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.Index(s.workspaceFolders, folder)
+	if i < 0 {
+		return false
+	}
+
+	// Build a new slice, callers may still hold the old one
+	s.workspaceFolders = slices.Concat(s.workspaceFolders[:i], s.workspaceFolders[i+1:])
+
+	return true
+}
+
 // SetClientCapabilities sets the client's capabilities.
 func (s *Server) SetClientCapabilities(capabilities *protocol.ClientCapabilities) {
 	s.mu.Lock()
@@ -149,6 +300,35 @@ func (s *Server) GetClientCapabilities() *protocol.ClientCapabilities {
 	return s.clientCapabilities
 }
 
+// SetDiagnosticCapabilities records whether the client pulls diagnostics and
+// whether it can be asked to pull them again. These are LSP 3.17
+// capabilities, which aren't part of the stored client capabilities.
+func (s *Server) SetDiagnosticCapabilities(pull, refresh bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pullDiagnostics = pull
+	s.diagnosticRefresh = refresh
+}
+
+// SupportsPullDiagnostics returns true if the client pulls diagnostics
+// instead of waiting for them to be published.
+func (s *Server) SupportsPullDiagnostics() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pullDiagnostics
+}
+
+// SupportsDiagnosticRefresh returns true if the client pulls diagnostics again
+// when the server sends workspace/diagnostic/refresh.
+func (s *Server) SupportsDiagnosticRefresh() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pullDiagnostics && s.diagnosticRefresh
+}
+
 // SupportsSnippets returns true if the client supports snippet completions.
 func (s *Server) SupportsSnippets() bool {
 	s.mu.RLock()
@@ -177,6 +357,54 @@ func (s *Server) SupportsSnippets() bool {
 	return *s.clientCapabilities.TextDocument.Completion.CompletionItem.SnippetSupport
 }
 
+// SupportsWatchedFilesRegistration returns true if the client allows the server
+// to register file watchers dynamically.
+func (s *Server) SupportsWatchedFilesRegistration() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.clientCapabilities == nil || s.clientCapabilities.Workspace == nil {
+		return false
+	}
+
+	watched := s.clientCapabilities.Workspace.DidChangeWatchedFiles
+	if watched == nil || watched.DynamicRegistration == nil {
+		return false
+	}
+
+	return *watched.DynamicRegistration
+}
+
+// SupportsApplyEdit returns true if the client applies workspace edits sent
+// with workspace/applyEdit.
+func (s *Server) SupportsApplyEdit() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.clientCapabilities == nil || s.clientCapabilities.Workspace == nil {
+		return false
+	}
+
+	return s.clientCapabilities.Workspace.ApplyEdit != nil && *s.clientCapabilities.Workspace.ApplyEdit
+}
+
+// SupportsWorkDoneProgress returns true if the client can show progress reported
+// through $/progress notifications.
+func (s *Server) SupportsWorkDoneProgress() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.clientCapabilities == nil || s.clientCapabilities.Window == nil {
+		return false
+	}
+
+	if s.clientCapabilities.Window.WorkDoneProgress == nil {
+		return false
+	}
+
+	return *s.clientCapabilities.Window.WorkDoneProgress
+}
+
 // CompletionCache returns the completion cache.
 func (s *Server) CompletionCache() *CompletionCache {
 	return s.completionCache
@@ -192,3 +420,8 @@ func (s *Server) SemanticTokensLegend() *SemanticTokensLegend {
 func (s *Server) SemanticTokensCache() *SemanticTokensCache {
 	return s.semanticTokensCache
 }
+
+// Analysis returns the background analysis scheduler.
+func (s *Server) Analysis() *AnalysisScheduler {
+	return s.analysis
+}
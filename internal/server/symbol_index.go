@@ -1,9 +1,10 @@
 package server
 
 import (
+	"strings"
 	"sync"
 
-	"github.com/cwbudde/go-dws/pkg/ast"
+	"github.com/CWBudde/go-dws-lsp/internal/workspace"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
@@ -28,15 +29,19 @@ func (si *SymbolIndex) UpdateDocument(doc *Document) {
 		return
 	}
 
-	ranges := collectReferences(doc.Program.AST())
+	si.SetReferences(doc.URI, workspace.CollectReferences(doc.Program.AST()))
+}
 
+// SetReferences replaces all references recorded for uri.
+// It implements workspace.ReferenceIndex.
+func (si *SymbolIndex) SetReferences(uri string, references map[string][]protocol.Range) {
 	si.mu.Lock()
 	defer si.mu.Unlock()
 
 	// remove existing entries for doc
 	for symbol, uris := range si.references {
-		if _, ok := uris[doc.URI]; ok {
-			delete(uris, doc.URI)
+		if _, ok := uris[uri]; ok {
+			delete(uris, uri)
 
 			if len(uris) == 0 {
 				delete(si.references, symbol)
@@ -44,7 +49,7 @@ func (si *SymbolIndex) UpdateDocument(doc *Document) {
 		}
 	}
 
-	for symbol, list := range ranges {
+	for symbol, list := range references {
 		if len(list) == 0 {
 			continue
 		}
@@ -53,7 +58,7 @@ func (si *SymbolIndex) UpdateDocument(doc *Document) {
 			si.references[symbol] = make(map[string][]protocol.Range)
 		}
 
-		si.references[symbol][doc.URI] = list
+		si.references[symbol][uri] = list
 	}
 }
 
@@ -76,6 +81,37 @@ func (si *SymbolIndex) RemoveDocument(uri string) {
 	}
 }
 
+// RemoveDocumentsUnder removes all documents located under the directory with
+// the given URI and returns their URIs.
+func (si *SymbolIndex) RemoveDocumentsUnder(dirURI string) []string {
+	prefix := strings.TrimSuffix(dirURI, "/") + "/"
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	removed := make(map[string]struct{})
+
+	for symbol, uris := range si.references {
+		for uri := range uris {
+			if strings.HasPrefix(uri, prefix) {
+				delete(uris, uri)
+				removed[uri] = struct{}{}
+			}
+		}
+
+		if len(uris) == 0 {
+			delete(si.references, symbol)
+		}
+	}
+
+	result := make([]string, 0, len(removed))
+	for uri := range removed {
+		result = append(result, uri)
+	}
+
+	return result
+}
+
 func (si *SymbolIndex) FindReferences(symbolName string, docStore *DocumentStore) []protocol.Location {
 	if symbolName == "" {
 		return nil
@@ -121,40 +157,6 @@ func (si *SymbolIndex) FindReferences(symbolName string, docStore *DocumentStore
 	return locations
 }
 
-func collectReferences(root ast.Node) map[string][]protocol.Range {
-	result := make(map[string][]protocol.Range)
-	if root == nil {
-		return result
-	}
-
-	ast.Inspect(root, func(node ast.Node) bool {
-		ident, ok := node.(*ast.Identifier)
-		if !ok || ident == nil {
-			return true
-		}
-
-		start := ident.Pos()
-		end := ident.End()
-		rng := protocol.Range{
-			Start: protocol.Position{Line: uint32(maxZero(start.Line - 1)), Character: uint32(maxZero(start.Column - 1))},
-			End:   protocol.Position{Line: uint32(maxZero(end.Line - 1)), Character: uint32(maxZero(end.Column - 1))},
-		}
-		result[ident.Value] = append(result[ident.Value], rng)
-
-		return true
-	})
-
-	return result
-}
-
-func maxZero(val int) int {
-	if val < 0 {
-		return 0
-	}
-
-	return val
-}
-
 // Clear removes all cached references from the index.
 func (si *SymbolIndex) Clear() {
 	si.mu.Lock()
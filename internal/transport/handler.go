@@ -0,0 +1,196 @@
+// Package transport connects the LSP handlers to a JSON-RPC connection.
+//
+// It replaces the stream handling of glsp's server, which handles every message
+// on the connection's read loop. Here, selected requests run in their own
+// goroutine, so that $/cancelRequest notifications reach them while they are
+// running and a cancelled request can stop early.
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// CodeRequestCancelled is the LSP error code for cancelled requests.
+const CodeRequestCancelled = -32800
+
+// Handler is a jsonrpc2.Handler that dispatches messages to a glsp.Handler.
+//
+// Notifications and most requests are handled in the order they arrive, which
+// keeps document synchronization consistent. Requests for concurrent methods
+// run in the background and can be cancelled through the request tracker.
+type Handler struct {
+	handler    glsp.Handler
+	requests   *server.RequestTracker
+	concurrent map[string]bool
+}
+
+// NewHandler creates a handler that dispatches to handler and runs requests for
+// concurrentMethods in the background, tracked by requests.
+func NewHandler(handler glsp.Handler, requests *server.RequestTracker, concurrentMethods ...string) *Handler {
+	concurrent := make(map[string]bool, len(concurrentMethods))
+	for _, method := range concurrentMethods {
+		concurrent[method] = true
+	}
+
+	return &Handler{
+		handler:    handler,
+		requests:   requests,
+		concurrent: concurrent,
+	}
+}
+
+// cancelParams are the parameters of $/cancelRequest.
+type cancelParams struct {
+	ID jsonrpc2.ID `json:"id"`
+}
+
+// Handle implements jsonrpc2.Handler.
+func (h *Handler) Handle(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) {
+	switch {
+	case request.Method == string(protocol.MethodCancelRequest):
+		h.cancel(request)
+
+	case request.Method == string(protocol.MethodExit):
+		// Give the handler a chance to handle it, but ignore any result
+		h.dispatch(ctx, conn, request)
+
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing connection: %v\n", err)
+		}
+
+	case request.Notif:
+		h.dispatch(ctx, conn, request)
+
+	case h.concurrent[request.Method]:
+		glspContext := newContext(ctx, conn, request)
+		requestCtx, done := h.requests.Begin(request.ID.String(), request.Method, glspContext)
+
+		go func() {
+			result, err := h.handle(glspContext)
+			err = cancelledError(requestCtx, err)
+
+			done()
+			h.reply(ctx, conn, request, result, err)
+		}()
+
+	default:
+		result, err := h.dispatch(ctx, conn, request)
+		h.reply(ctx, conn, request, result, err)
+	}
+}
+
+// cancel cancels the request named by a $/cancelRequest notification.
+func (h *Handler) cancel(request *jsonrpc2.Request) {
+	if request.Params == nil {
+		return
+	}
+
+	var params cancelParams
+	if err := json.Unmarshal(*request.Params, &params); err != nil {
+		log.Printf("Invalid $/cancelRequest params: %v\n", err)
+		return
+	}
+
+	if h.requests.Cancel(params.ID.String()) {
+		log.Printf("Cancelled request %s\n", params.ID.String())
+	}
+}
+
+// dispatch handles a message on the read loop.
+func (h *Handler) dispatch(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) (any, error) {
+	return h.handle(newContext(ctx, conn, request))
+}
+
+// handle calls the glsp handler and converts its outcome to a JSON-RPC error,
+// like glsp's own server does.
+func (h *Handler) handle(glspContext *glsp.Context) (any, error) {
+	result, validMethod, validParams, err := h.handler.Handle(glspContext)
+
+	switch {
+	case !validMethod:
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeMethodNotFound,
+			Message: fmt.Sprintf("method not supported: %s", glspContext.Method),
+		}
+
+	case !validParams:
+		rpcErr := &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		if err != nil {
+			rpcErr.Message = err.Error()
+		}
+
+		return nil, rpcErr
+
+	case err != nil:
+		return nil, err
+
+	default:
+		return result, nil
+	}
+}
+
+// reply sends the response to a request.
+func (h *Handler) reply(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request, result any, err error) {
+	if request.Notif {
+		return
+	}
+
+	var sendErr error
+
+	if err != nil {
+		var rpcErr *jsonrpc2.Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: err.Error()}
+		}
+
+		sendErr = conn.ReplyWithError(ctx, request.ID, rpcErr)
+	} else {
+		sendErr = conn.Reply(ctx, request.ID, result)
+	}
+
+	if sendErr != nil {
+		log.Printf("Error replying to %s: %v\n", request.Method, sendErr)
+	}
+}
+
+// cancelledError returns the RequestCancelled error if the request's context
+// was cancelled, whatever the handler returned, and err otherwise.
+func cancelledError(requestCtx context.Context, err error) error {
+	if requestCtx.Err() == nil {
+		return err
+	}
+
+	return &jsonrpc2.Error{Code: CodeRequestCancelled, Message: "request cancelled"}
+}
+
+// newContext creates the glsp.Context for a message.
+func newContext(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) *glsp.Context {
+	glspContext := &glsp.Context{
+		Method: request.Method,
+		Notify: func(method string, params any) {
+			if err := conn.Notify(ctx, method, params); err != nil {
+				log.Printf("Error sending %s: %v\n", method, err)
+			}
+		},
+		Call: func(method string, params any, result any) {
+			if err := conn.Call(ctx, method, params, result); err != nil {
+				log.Printf("Error calling %s: %v\n", method, err)
+			}
+		},
+	}
+
+	if request.Params != nil {
+		glspContext.Params = *request.Params
+	}
+
+	return glspContext
+}
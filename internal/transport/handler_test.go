@@ -0,0 +1,133 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CWBudde/go-dws-lsp/internal/server"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+)
+
+const (
+	slowMethod = "test/slow"
+	fastMethod = "test/fast"
+)
+
+// blockingHandler is a glsp.Handler whose slow method blocks until its request
+// is cancelled.
+type blockingHandler struct {
+	requests *server.RequestTracker
+	started  chan struct{}
+}
+
+func (h *blockingHandler) Handle(context *glsp.Context) (any, bool, bool, error) {
+	switch context.Method {
+	case slowMethod:
+		ctx := h.requests.Context(context)
+		close(h.started)
+
+		select {
+		case <-ctx.Done():
+			return nil, true, true, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return "finished", true, true, nil
+		}
+
+	case fastMethod:
+		var params string
+		if err := json.Unmarshal(context.Params, &params); err != nil {
+			return nil, true, false, err
+		}
+
+		return "fast " + params, true, true, nil
+
+	default:
+		return nil, false, false, nil
+	}
+}
+
+// connect serves handler on one end of a pipe and returns a client connection
+// on the other.
+func connect(t *testing.T, handler *Handler) *jsonrpc2.Conn {
+	t.Helper()
+
+	serverSide, clientSide := net.Pipe()
+
+	go ServeStream(context.Background(), serverSide, handler)
+
+	client := jsonrpc2.NewConn(context.Background(),
+		jsonrpc2.NewBufferedStream(clientSide, jsonrpc2.VSCodeObjectCodec{}),
+		jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (any, error) {
+			return nil, nil
+		}))
+
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestHandler_CancelRequest(t *testing.T) {
+	requests := server.NewRequestTracker()
+	glspHandler := &blockingHandler{requests: requests, started: make(chan struct{})}
+	client := connect(t, NewHandler(glspHandler, requests, slowMethod))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	call, err := client.DispatchCall(ctx, slowMethod, nil, jsonrpc2.PickID(jsonrpc2.ID{Num: 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-glspHandler.started:
+	case <-ctx.Done():
+		t.Fatal("Slow request was not started")
+	}
+
+	// Other requests are handled while the slow request is running
+	var result string
+	if err := client.Call(ctx, fastMethod, "reply", &result); err != nil || result != "fast reply" {
+		t.Fatalf("Expected fast reply while slow request runs, got %q, %v", result, err)
+	}
+
+	if err := client.Notify(ctx, "$/cancelRequest", map[string]any{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = call.Wait(ctx, &result)
+
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeRequestCancelled {
+		t.Fatalf("Expected RequestCancelled error, got %v", err)
+	}
+
+	if pending := requests.Pending(); pending != 0 {
+		t.Errorf("Expected no pending requests, got %d", pending)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	requests := server.NewRequestTracker()
+	client := connect(t, NewHandler(&blockingHandler{requests: requests}, requests))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var rpcErr *jsonrpc2.Error
+
+	err := client.Call(ctx, "test/unknown", nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.CodeMethodNotFound {
+		t.Errorf("Expected MethodNotFound error, got %v", err)
+	}
+
+	err = client.Call(ctx, fastMethod, 42, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("Expected InvalidParams error, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// ServeStream handles messages on stream until the connection is closed.
+func ServeStream(ctx context.Context, stream io.ReadWriteCloser, handler jsonrpc2.Handler) {
+	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(stream, jsonrpc2.VSCodeObjectCodec{}), handler)
+	<-conn.DisconnectNotify()
+}
+
+// RunStdio serves a single connection on stdin and stdout.
+func RunStdio(ctx context.Context, handler jsonrpc2.Handler) error {
+	log.Println("Reading from stdin, writing to stdout")
+	ServeStream(ctx, stdio{}, handler)
+	log.Println("STDIO connection closed")
+
+	return nil
+}
+
+// RunTCP accepts TCP connections on address and serves each of them.
+func RunTCP(ctx context.Context, address string, handler jsonrpc2.Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	log.Printf("Listening for TCP connections on %s\n", address)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Accepted TCP connection from %s\n", conn.RemoteAddr())
+
+		go ServeStream(ctx, conn, handler)
+	}
+}
+
+// stdio is an io.ReadWriteCloser on stdin and stdout.
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdio) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdio) Close() error {
+	if err := os.Stdin.Close(); err != nil {
+		return err
+	}
+
+	return os.Stdout.Close()
+}
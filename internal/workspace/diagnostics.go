@@ -0,0 +1,36 @@
+package workspace
+
+import (
+	"github.com/cwbudde/go-dws/pkg/dwscript"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// DiagnosticIndex receives the diagnostics of workspace files.
+// The server's diagnostic store implements it, so that the diagnostics of files
+// that aren't open can be reported without compiling them again.
+type DiagnosticIndex interface {
+	// SetDiagnostics replaces the diagnostics recorded for uri. resultID is the
+	// HashContent of the contents they were computed from.
+	SetDiagnostics(uri string, resultID string, diagnostics []protocol.Diagnostic)
+}
+
+// DependencyIndex receives the units used by workspace files, so that their
+// diagnostics can be updated when one of those units changes.
+type DependencyIndex interface {
+	// SetUnits replaces the names of the units recorded as used by uri.
+	SetUnits(uri string, units []string)
+}
+
+// CompileResult is the outcome of compiling a workspace file.
+type CompileResult struct {
+	// Program is nil if the file has errors
+	Program *dwscript.Program
+
+	Diagnostics []protocol.Diagnostic
+
+	// Units are the names of the units in the file's uses clauses
+	Units []string
+}
+
+// CompileFunc compiles the contents of the file uri.
+type CompileFunc func(uri string, content []byte) CompileResult
@@ -0,0 +1,121 @@
+package workspace
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreRule is a pattern from a .gitignore file.
+type gitignoreRule struct {
+	// base is the relative path of the directory containing the .gitignore file
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// appendGitignore appends the rules of the .gitignore file in dir, at the
+// relative path rel, to rules. The slice isn't modified in place, since rules
+// of a parent directory are shared by its subdirectories.
+func appendGitignore(rules []gitignoreRule, dir, rel string) []gitignoreRule {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return rules
+	}
+	defer file.Close()
+
+	var own []gitignoreRule
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text(), rel); ok {
+			own = append(own, rule)
+		}
+	}
+
+	if len(own) == 0 {
+		return rules
+	}
+
+	return append(rules[:len(rules):len(rules)], own...)
+}
+
+// parseGitignoreLine parses a line of a .gitignore file in the directory at the
+// relative path base. It returns false for blank lines and comments.
+func parseGitignoreLine(line, base string) (gitignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	rule := gitignoreRule{base: base}
+
+	if after, ok := strings.CutPrefix(line, "!"); ok {
+		rule.negate = true
+		line = after
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+
+	if after, ok := strings.CutSuffix(line, "/"); ok {
+		rule.dirOnly = true
+		line = after
+	}
+
+	// A slash at the start or in the middle anchors the pattern to base
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+
+	rule.pattern = line
+
+	return rule, true
+}
+
+// matches reports whether the rule matches the file or directory at the
+// relative path rel.
+func (r gitignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "" {
+		after, ok := strings.CutPrefix(rel, r.base+"/")
+		if !ok {
+			return false
+		}
+
+		rel = after
+	}
+
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+
+	ok, _ := path.Match(r.pattern, path.Base(rel))
+
+	return ok
+}
+
+// gitignored reports whether rules ignore the file or directory at the relative
+// path rel. As in git, the last matching rule decides.
+func gitignored(rules []gitignoreRule, rel string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range rules {
+		if rule.matches(rel, isDir) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
@@ -0,0 +1,233 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// indexCacheVersion is the format version of index cache files.
+// Increment it whenever the cached data or the way it is extracted changes,
+// so that caches written by older versions are discarded.
+const indexCacheVersion = 5
+
+// IndexCache persists the indexing results of one workspace folder, so that
+// files that haven't changed since the last run don't have to be parsed again.
+//
+// Files are validated by modification time and size first; if those differ,
+// the content hash decides whether the cached entry can still be used.
+// A nil IndexCache is valid and caches nothing.
+type IndexCache struct {
+	path string
+	root string
+
+	mutex   sync.Mutex
+	entries map[string]*indexCacheEntry
+	used    map[string]bool
+}
+
+// indexCacheFile is the on-disk format of an index cache.
+type indexCacheFile struct {
+	Version int                         `json:"version"`
+	Root    string                      `json:"root"`
+	Files   map[string]*indexCacheEntry `json:"files"`
+}
+
+// indexCacheEntry holds the indexing results of a single file.
+type indexCacheEntry struct {
+	ModTime    int64                       `json:"modTime"`
+	Size       int64                       `json:"size"`
+	Hash       string                      `json:"hash"`
+	Failed     bool                        `json:"failed,omitempty"`
+	Symbols    []SymbolLocation            `json:"symbols,omitempty"`
+	References map[string][]protocol.Range `json:"references,omitempty"`
+
+	// Diagnostics are reported for files with errors too
+	Diagnostics []protocol.Diagnostic `json:"diagnostics,omitempty"`
+	Units       []string              `json:"units,omitempty"`
+}
+
+// DefaultIndexCacheDir returns the directory for index caches below the user's
+// cache directory, or an empty string if there is none.
+func DefaultIndexCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "go-dws-lsp", "index")
+}
+
+// LoadIndexCache loads the index cache of the workspace folder root from
+// cacheDir. A missing, unreadable or outdated cache file yields an empty cache.
+// It returns nil if cacheDir is empty, which disables caching.
+func LoadIndexCache(cacheDir, root string) *IndexCache {
+	if cacheDir == "" {
+		return nil
+	}
+
+	cache := &IndexCache{
+		path:    indexCachePath(cacheDir, root),
+		root:    root,
+		entries: make(map[string]*indexCacheEntry),
+		used:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+
+	var file indexCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Printf("Warning: Discarding corrupt index cache %s: %v\n", cache.path, err)
+		return cache
+	}
+
+	if file.Version != indexCacheVersion || file.Root != root || file.Files == nil {
+		log.Printf("Discarding outdated index cache %s\n", cache.path)
+		return cache
+	}
+
+	cache.entries = file.Files
+	log.Printf("Loaded index cache for %s with %d files\n", root, len(cache.entries))
+
+	return cache
+}
+
+// RemoveIndexCache deletes the index cache of the workspace folder root from
+// cacheDir, so that the next indexing run compiles every file. A missing cache
+// isn't an error.
+func RemoveIndexCache(cacheDir, root string) error {
+	if cacheDir == "" {
+		return nil
+	}
+
+	if err := os.Remove(indexCachePath(cacheDir, root)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// indexCachePath returns the path of the index cache of the workspace folder root.
+func indexCachePath(cacheDir, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Save writes the cache to disk. Only files that were looked up or stored since
+// the cache was loaded are kept, which drops files deleted in the meantime.
+func (c *IndexCache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+
+	file := indexCacheFile{
+		Version: indexCacheVersion,
+		Root:    c.root,
+		Files:   make(map[string]*indexCacheEntry, len(c.used)),
+	}
+
+	for path := range c.used {
+		if entry, ok := c.entries[path]; ok {
+			file.Files[path] = entry
+		}
+	}
+
+	c.mutex.Unlock()
+
+	data, err := json.Marshal(&file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that readers never see a partial cache
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// lookup returns the cached entry of a file if its modification time and size
+// are unchanged.
+func (c *IndexCache) lookup(path string, info os.FileInfo) *indexCacheEntry {
+	if c == nil || info == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+		return nil
+	}
+
+	c.used[path] = true
+
+	return entry
+}
+
+// lookupContent returns the cached entry of a file if its content hash is
+// unchanged, e.g. after a checkout touched the file without modifying it.
+// The entry's modification time is refreshed.
+func (c *IndexCache) lookupContent(path string, info os.FileInfo, hash string) *indexCacheEntry {
+	if c == nil || info == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.Hash != hash {
+		return nil
+	}
+
+	entry.ModTime = info.ModTime().UnixNano()
+	entry.Size = info.Size()
+	c.used[path] = true
+
+	return entry
+}
+
+// store records the indexing results of a file.
+func (c *IndexCache) store(path string, info os.FileInfo, hash string, entry *indexCacheEntry) {
+	if c == nil || info == nil {
+		return
+	}
+
+	entry.ModTime = info.ModTime().UnixNano()
+	entry.Size = info.Size()
+	entry.Hash = hash
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[path] = entry
+	c.used[path] = true
+}
+
+// HashContent returns the hash used to validate cached files. It also
+// identifies the diagnostics computed from the contents.
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,295 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// recordingReferences is a ReferenceIndex that records the files it receives.
+type recordingReferences struct {
+	files map[string]map[string][]protocol.Range
+}
+
+func (r *recordingReferences) SetReferences(uri string, references map[string][]protocol.Range) {
+	if r.files == nil {
+		r.files = make(map[string]map[string][]protocol.Range)
+	}
+
+	r.files[uri] = references
+}
+
+// recordingDiagnostics is a DiagnosticIndex and DependencyIndex that records
+// the files it receives.
+type recordingDiagnostics struct {
+	resultIDs   map[string]string
+	diagnostics map[string][]protocol.Diagnostic
+	units       map[string][]string
+}
+
+func (r *recordingDiagnostics) SetDiagnostics(uri string, resultID string, diagnostics []protocol.Diagnostic) {
+	if r.resultIDs == nil {
+		r.resultIDs = make(map[string]string)
+		r.diagnostics = make(map[string][]protocol.Diagnostic)
+	}
+
+	r.resultIDs[uri] = resultID
+	r.diagnostics[uri] = diagnostics
+}
+
+func (r *recordingDiagnostics) SetUnits(uri string, units []string) {
+	if r.units == nil {
+		r.units = make(map[string][]string)
+	}
+
+	r.units[uri] = units
+}
+
+// errorCompiler is a CompileFunc that reports an error for files containing
+// "error" and counts its calls. Units are read from a leading "uses" line.
+func errorCompiler(calls *int) CompileFunc {
+	return func(uri string, content []byte) CompileResult {
+		*calls++
+
+		var units []string
+		if clause, ok := strings.CutPrefix(string(content), "uses "); ok {
+			clause, _, _ = strings.Cut(clause, ";")
+			units = strings.Split(clause, ", ")
+		}
+
+		if strings.Contains(string(content), "error") {
+			return CompileResult{
+				Diagnostics: []protocol.Diagnostic{{Message: "error in " + filepath.Base(uriToPath(uri))}},
+				Units:       units,
+			}
+		}
+
+		return CompileResult{Program: compileSource(content), Diagnostics: []protocol.Diagnostic{}, Units: units}
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexWithCache indexes root using the cache in cacheDir and returns the indexer.
+func indexWithCache(root, cacheDir string, refs ReferenceIndex) (*Indexer, *SymbolIndex) {
+	index := NewSymbolIndex()
+	indexer := NewIndexerWithOptions(index, IndexOptions{References: refs, CacheDir: cacheDir})
+	indexer.BuildWorkspaceIndex(context.Background(), []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+	return indexer, index
+}
+
+func TestIndexCache_ReusesUnchangedFiles(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(root, "a.dws"), "function Alpha(): Integer;\nbegin\n  Result := 1;\nend;\n")
+	writeTestFile(t, filepath.Join(root, "b.dws"), "var Beta: Integer;\n")
+
+	first, _ := indexWithCache(root, cacheDir, nil)
+	if first.fileCount != 2 || first.reused != 0 {
+		t.Fatalf("First run: indexed %d files, %d from cache; want 2, 0", first.fileCount, first.reused)
+	}
+
+	refs := &recordingReferences{}
+
+	second, index := indexWithCache(root, cacheDir, refs)
+	if second.fileCount != 2 || second.reused != 2 {
+		t.Fatalf("Second run: indexed %d files, %d from cache; want 2, 2", second.fileCount, second.reused)
+	}
+
+	alpha := index.FindSymbol("Alpha")
+	if len(alpha) != 1 || alpha[0].Kind != protocol.SymbolKindFunction {
+		t.Errorf("Expected Alpha restored as function, got %v", alpha)
+	}
+
+	if len(index.FindSymbol("Beta")) != 1 {
+		t.Error("Expected Beta to be restored from the cache")
+	}
+
+	if len(refs.files[pathToURI(filepath.Join(root, "a.dws"))]["Alpha"]) == 0 {
+		t.Error("Expected references of a.dws to be restored from the cache")
+	}
+}
+
+func TestIndexCache_ReparsesChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	path := filepath.Join(root, "a.dws")
+
+	writeTestFile(t, path, "var OldName: Integer;\n")
+	indexWithCache(root, cacheDir, nil)
+
+	writeTestFile(t, path, "var NewName: Integer;\n")
+	// Make sure the change is visible even on file systems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, index := indexWithCache(root, cacheDir, nil)
+	if indexer.reused != 0 {
+		t.Errorf("Expected changed file to be parsed again, %d reused", indexer.reused)
+	}
+
+	if len(index.FindSymbol("OldName")) != 0 || len(index.FindSymbol("NewName")) != 1 {
+		t.Error("Expected the index to reflect the changed file")
+	}
+}
+
+func TestIndexCache_TouchedFileMatchesByHash(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	path := filepath.Join(root, "a.dws")
+
+	writeTestFile(t, path, "var Counter: Integer;\n")
+	indexWithCache(root, cacheDir, nil)
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, _ := indexWithCache(root, cacheDir, nil)
+	if indexer.reused != 1 {
+		t.Errorf("Expected touched but unchanged file to be reused, %d reused", indexer.reused)
+	}
+}
+
+func TestIndexCache_DropsDeletedFiles(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	path := filepath.Join(root, "gone.dws")
+
+	writeTestFile(t, path, "var Gone: Integer;\n")
+	indexWithCache(root, cacheDir, nil)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	indexWithCache(root, cacheDir, nil)
+
+	cache := LoadIndexCache(cacheDir, root)
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected deleted file to be dropped from the cache, got %d entries", len(cache.entries))
+	}
+}
+
+func TestLoadIndexCache_DiscardsOutdatedVersion(t *testing.T) {
+	cacheDir := t.TempDir()
+	root := filepath.FromSlash("/work/project")
+
+	cache := LoadIndexCache(cacheDir, root)
+	writeTestFile(t, cache.path, `{"version": 0, "root": "/work/project", "files": {"/work/project/a.dws": {}}}`)
+
+	if entries := LoadIndexCache(cacheDir, root).entries; len(entries) != 0 {
+		t.Errorf("Expected outdated cache to be discarded, got %d entries", len(entries))
+	}
+
+	writeTestFile(t, cache.path, "not json")
+
+	if entries := LoadIndexCache(cacheDir, root).entries; len(entries) != 0 {
+		t.Errorf("Expected corrupt cache to be discarded, got %d entries", len(entries))
+	}
+}
+
+func TestLoadIndexCache_DisabledWithoutDirectory(t *testing.T) {
+	cache := LoadIndexCache("", "/work/project")
+	if cache != nil {
+		t.Fatal("Expected nil cache without a cache directory")
+	}
+
+	if err := cache.Save(); err != nil {
+		t.Errorf("Save on nil cache returned error: %v", err)
+	}
+}
+
+func TestRemoveIndexCache(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(root, "a.dws"), "var Alpha: Integer;\n")
+	indexWithCache(root, cacheDir, nil)
+
+	if len(LoadIndexCache(cacheDir, root).entries) != 1 {
+		t.Fatal("Expected the indexed file to be cached")
+	}
+
+	if err := RemoveIndexCache(cacheDir, root); err != nil {
+		t.Fatalf("RemoveIndexCache failed: %v", err)
+	}
+
+	if entries := LoadIndexCache(cacheDir, root).entries; len(entries) != 0 {
+		t.Errorf("Expected the cache to be removed, got %d entries", len(entries))
+	}
+
+	// Removing it again is fine
+	if err := RemoveIndexCache(cacheDir, root); err != nil {
+		t.Errorf("RemoveIndexCache of a missing cache failed: %v", err)
+	}
+}
+
+func TestIndexCache_ReusesDiagnostics(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+
+	good := "var Good: Integer;\n"
+	bad := "uses Utils, Shapes;\nvar Bad: Integer := error;\n"
+
+	writeTestFile(t, filepath.Join(root, "good.dws"), good)
+	writeTestFile(t, filepath.Join(root, "bad.dws"), bad)
+
+	for run, wantCalls := range []int{2, 0} {
+		calls := 0
+		diagnostics := &recordingDiagnostics{}
+
+		index := NewSymbolIndex()
+		indexer := NewIndexerWithOptions(index, IndexOptions{
+			CacheDir:     cacheDir,
+			Diagnostics:  diagnostics,
+			Dependencies: diagnostics,
+			Compile:      errorCompiler(&calls),
+		})
+		indexer.BuildWorkspaceIndex(context.Background(), []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+		if calls != wantCalls {
+			t.Errorf("Run %d: compiled %d files, want %d", run, calls, wantCalls)
+		}
+
+		// Files with errors aren't indexed, but their diagnostics are reported
+		badURI := pathToURI(filepath.Join(root, "bad.dws"))
+		if got := diagnostics.diagnostics[badURI]; len(got) != 1 || got[0].Message != "error in bad.dws" {
+			t.Errorf("Run %d: expected the error of bad.dws, got %+v", run, got)
+		}
+
+		if diagnostics.resultIDs[badURI] != HashContent([]byte(bad)) {
+			t.Errorf("Run %d: expected the content hash as result ID, got %q", run, diagnostics.resultIDs[badURI])
+		}
+
+		if got := diagnostics.units[badURI]; !slices.Equal(got, []string{"Utils", "Shapes"}) {
+			t.Errorf("Run %d: expected the units used by bad.dws, got %v", run, got)
+		}
+
+		goodURI := pathToURI(filepath.Join(root, "good.dws"))
+		if got, ok := diagnostics.diagnostics[goodURI]; !ok || len(got) != 0 {
+			t.Errorf("Run %d: expected no diagnostics for good.dws, got %+v (reported: %v)", run, got, ok)
+		}
+
+		if index.GetFileCount() != 1 {
+			t.Errorf("Run %d: expected 1 indexed file, got %d", run, index.GetFileCount())
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package workspace
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults for the limits of an IndexFilter.
+const (
+	DefaultIndexMaxDepth = 10
+	DefaultIndexMaxFiles = 10000
+)
+
+// DefaultIndexExtensions are the extensions of the files indexed by default.
+var DefaultIndexExtensions = []string{".dws"}
+
+// DefaultIndexExclude are the patterns excluded from indexing by default:
+// dependency and build output directories.
+var DefaultIndexExclude = []string{
+	"node_modules", "vendor", "bin", "obj", "dist", "build", "out", "__pycache__",
+}
+
+// IndexFilter decides which files below a workspace folder are indexed.
+//
+// Patterns are matched against slash-separated paths relative to the workspace
+// folder. A pattern without a slash matches a single file or directory name at
+// any depth, such as "generated" or "*.gen.pas"; other patterns match the whole
+// relative path, where "**" matches any number of directories, such as
+// "src/**/*.pas". The zero value indexes .dws files with the default limits.
+type IndexFilter struct {
+	// Include restricts indexing to files matching one of the patterns, or inside
+	// a directory matching one, such as "src"; empty includes all files
+	Include []string
+
+	// Exclude skips files and directories matching one of the patterns.
+	// nil uses DefaultIndexExclude; an empty slice excludes nothing.
+	Exclude []string
+
+	// Extensions are the extensions of indexed files, such as ".pas"; empty uses DefaultIndexExtensions
+	Extensions []string
+
+	// MaxDepth is the maximum directory depth below a workspace folder; 0 uses DefaultIndexMaxDepth
+	MaxDepth int
+
+	// MaxFiles is the maximum number of indexed files; 0 uses DefaultIndexMaxFiles
+	MaxFiles int
+
+	// UseGitignore skips files and directories ignored by .gitignore files
+	UseGitignore bool
+}
+
+// DefaultIndexFilter returns the filter used unless configured otherwise.
+func DefaultIndexFilter() IndexFilter {
+	return IndexFilter{UseGitignore: true}
+}
+
+// extensions returns the extensions of indexed files.
+func (f IndexFilter) extensions() []string {
+	if len(f.Extensions) == 0 {
+		return DefaultIndexExtensions
+	}
+
+	return f.Extensions
+}
+
+// exclude returns the exclude patterns.
+func (f IndexFilter) exclude() []string {
+	if f.Exclude == nil {
+		return DefaultIndexExclude
+	}
+
+	return f.Exclude
+}
+
+// maxDepth returns the maximum directory depth.
+func (f IndexFilter) maxDepth() int {
+	if f.MaxDepth <= 0 {
+		return DefaultIndexMaxDepth
+	}
+
+	return f.MaxDepth
+}
+
+// maxFiles returns the maximum number of indexed files.
+func (f IndexFilter) maxFiles() int {
+	if f.MaxFiles <= 0 {
+		return DefaultIndexMaxFiles
+	}
+
+	return f.MaxFiles
+}
+
+// HasIndexedExtension reports whether name has one of the indexed extensions.
+func (f IndexFilter) HasIndexedExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+
+	for _, indexed := range f.extensions() {
+		if ext == normalizeExtension(indexed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeExtension returns ext in lower case with a leading dot.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return ext
+}
+
+// WatcherGlobs returns glob patterns for the client to watch indexed files with.
+func (f IndexFilter) WatcherGlobs() []string {
+	extensions := f.extensions()
+	globs := make([]string, 0, len(extensions))
+
+	for _, ext := range extensions {
+		globs = append(globs, "**/*"+normalizeExtension(ext))
+	}
+
+	return globs
+}
+
+// skipsDirectory reports whether the directory at the relative path rel is
+// skipped, along with everything below it.
+func (f IndexFilter) skipsDirectory(rel string) bool {
+	return strings.HasPrefix(path.Base(rel), ".") || matchesAny(f.exclude(), rel)
+}
+
+// includesFile reports whether the file at the relative path rel is indexed.
+// The directories containing it aren't checked.
+func (f IndexFilter) includesFile(rel string) bool {
+	if strings.HasPrefix(path.Base(rel), ".") || !f.HasIndexedExtension(rel) {
+		return false
+	}
+
+	if matchesAny(f.exclude(), rel) {
+		return false
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	// Like in .gitignore files, a pattern matching a directory covers its contents
+	for dir := rel; dir != "."; dir = path.Dir(dir) {
+		if matchesAny(f.Include, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walk passes the path of every file below root that is indexed to visit, in
+// a deterministic order. It returns false if visit asked to stop the walk.
+func (f IndexFilter) walk(root string, visit func(path string) bool) bool {
+	return f.walkDirectory(root, "", 0, nil, visit)
+}
+
+// walkDirectory walks the directory dir at the relative path rel. ignore holds
+// the .gitignore rules of the directories above it.
+func (f IndexFilter) walkDirectory(dir, rel string, depth int, ignore []gitignoreRule, visit func(path string) bool) bool {
+	// Check depth limit
+	if depth > f.maxDepth() {
+		return true
+	}
+
+	// Read directory entries
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Silently skip directories we can't read (permissions, etc.)
+		return true
+	}
+
+	if f.UseGitignore {
+		ignore = appendGitignore(ignore, dir, rel)
+	}
+
+	for _, entry := range entries {
+		fullPath := filepath.Join(dir, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+
+		if entry.IsDir() {
+			if f.skipsDirectory(entryRel) || gitignored(ignore, entryRel, true) {
+				continue
+			}
+
+			// Recursively walk subdirectory
+			if !f.walkDirectory(fullPath, entryRel, depth+1, ignore, visit) {
+				return false
+			}
+
+			continue
+		}
+
+		if !f.includesFile(entryRel) || gitignored(ignore, entryRel, false) {
+			continue
+		}
+
+		if !visit(fullPath) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Includes reports whether the indexer would index the file at filePath inside
+// the workspace folder root, applying the same rules as the directory walk.
+func (f IndexFilter) Includes(root, filePath string) bool {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+	segments := strings.Split(rel, "/")
+
+	// Files in the folder itself are at depth 0
+	if len(segments)-1 > f.maxDepth() {
+		return false
+	}
+
+	var ignore []gitignoreRule
+
+	dir := root
+
+	for i, segment := range segments[:len(segments)-1] {
+		if f.UseGitignore {
+			ignore = appendGitignore(ignore, dir, path.Join(segments[:i]...))
+		}
+
+		dirRel := path.Join(segments[:i+1]...)
+		if f.skipsDirectory(dirRel) || gitignored(ignore, dirRel, true) {
+			return false
+		}
+
+		dir = filepath.Join(dir, segment)
+	}
+
+	if f.UseGitignore {
+		ignore = appendGitignore(ignore, dir, path.Join(segments[:len(segments)-1]...))
+	}
+
+	return f.includesFile(rel) && !gitignored(ignore, rel, false)
+}
+
+// matchesAny reports whether one of patterns matches the relative path rel.
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern matches an include or exclude pattern against the relative path rel.
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if pattern == "" {
+		return false
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+
+	return matchGlob(pattern, rel)
+}
+
+// matchGlob matches a slash-separated glob pattern against a slash-separated
+// path. "**" matches zero or more path segments; other segments are matched
+// with path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
@@ -0,0 +1,190 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"generated", "generated", true},
+		{"generated", "src/generated", true},
+		{"*.gen.pas", "src/deep/Api.gen.pas", true},
+		{"src/**", "src/a/b.pas", true},
+		{"src/**/*.pas", "src/b.pas", true},
+		{"src/**/*.pas", "src/a/b/c.pas", true},
+		{"src/**/*.pas", "lib/src/b.pas", false},
+		{"/src/*.pas", "src/b.pas", true},
+		{"src/*.pas", "src/a/b.pas", false},
+		{"**/test", "a/b/test", true},
+		{"", "a.pas", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestGitignored(t *testing.T) {
+	var rules []gitignoreRule
+
+	for _, line := range []string{"# comment", "", "*.log", "build/", "/tmp", "!keep.log"} {
+		if rule, ok := parseGitignoreLine(line, ""); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	if rule, ok := parseGitignoreLine("docs/*.pas", "sub"); ok {
+		rules = append(rules, rule)
+	}
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a/debug.log", false, true},
+		{"a/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"tmp", true, true},
+		{"a/tmp", true, false},
+		{"sub/docs/x.pas", false, true},
+		{"docs/x.pas", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := gitignored(rules, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("gitignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// writeFilterWorkspace creates files for the filter tests and returns the root.
+func writeFilterWorkspace(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, name := range []string{
+		"main.dws",
+		"src/Unit.pas",
+		"src/Defs.INC",
+		"src/notes.txt",
+		"src/gen/Api.pas",
+		"node_modules/lib.dws",
+		"tools/Tool.pas",
+		"tools/out.log.pas",
+		".hidden/Secret.pas",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		writeTestFile(t, path, "var X: Integer;\n")
+	}
+
+	writeTestFile(t, filepath.Join(root, ".gitignore"), "gen/\n")
+	writeTestFile(t, filepath.Join(root, "tools", ".gitignore"), "*.log.pas\n")
+
+	return root
+}
+
+// walkedFiles returns the relative paths of the files filter walks below root.
+func walkedFiles(filter IndexFilter, root string) []string {
+	var files []string
+
+	filter.walk(root, func(path string) bool {
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+
+		return true
+	})
+
+	return files
+}
+
+func TestIndexFilter_Walk(t *testing.T) {
+	root := writeFilterWorkspace(t)
+
+	tests := []struct {
+		name   string
+		filter IndexFilter
+		want   []string
+	}{
+		{
+			name:   "zero value",
+			filter: IndexFilter{},
+			want:   []string{"main.dws"},
+		},
+		{
+			name:   "extensions and gitignore",
+			filter: IndexFilter{Extensions: []string{".dws", "pas", ".inc"}, UseGitignore: true},
+			want:   []string{"main.dws", "src/Defs.INC", "src/Unit.pas", "tools/Tool.pas"},
+		},
+		{
+			name:   "without gitignore",
+			filter: IndexFilter{Extensions: []string{".pas"}},
+			want:   []string{"src/Unit.pas", "src/gen/Api.pas", "tools/Tool.pas", "tools/out.log.pas"},
+		},
+		{
+			name:   "include and exclude",
+			filter: IndexFilter{Extensions: []string{".pas", ".dws"}, Include: []string{"src/**", "*.dws"}, Exclude: []string{"gen"}},
+			want:   []string{"main.dws", "node_modules/lib.dws", "src/Unit.pas"},
+		},
+		{
+			name:   "directory include",
+			filter: IndexFilter{Extensions: []string{".pas"}, Include: []string{"gen", "tools/*.log.pas"}},
+			want:   []string{"src/gen/Api.pas", "tools/out.log.pas"},
+		},
+		{
+			name:   "nested directory include",
+			filter: IndexFilter{Extensions: []string{".pas"}, Include: []string{"src"}, Exclude: []string{"gen"}},
+			want:   []string{"src/Unit.pas"},
+		},
+		{
+			name:   "depth limit",
+			filter: IndexFilter{Extensions: []string{".pas"}, MaxDepth: 1, UseGitignore: true},
+			want:   []string{"src/Unit.pas", "tools/Tool.pas"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := walkedFiles(tt.filter, root)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walked %v, want %v", got, tt.want)
+			}
+
+			// Includes must agree with the walk for every file
+			for _, name := range []string{"main.dws", "src/Unit.pas", "src/Defs.INC", "src/gen/Api.pas",
+				"node_modules/lib.dws", "tools/Tool.pas", "tools/out.log.pas", ".hidden/Secret.pas"} {
+				want := false
+
+				for _, walked := range tt.want {
+					want = want || walked == name
+				}
+
+				if got := tt.filter.Includes(root, filepath.Join(root, filepath.FromSlash(name))); got != want {
+					t.Errorf("Includes(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexFilter_WatcherGlobs(t *testing.T) {
+	got := IndexFilter{Extensions: []string{"PAS", ".inc"}}.WatcherGlobs()
+	if want := []string{"**/*.pas", "**/*.inc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatcherGlobs() = %v, want %v", got, want)
+	}
+}
@@ -2,45 +2,116 @@
 package workspace
 
 import (
+	"context"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cwbudde/go-dws/pkg/ast"
 	"github.com/cwbudde/go-dws/pkg/dwscript"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
+// IndexOptions configures workspace indexing.
+type IndexOptions struct {
+	// References receives the identifier references of every indexed file (optional)
+	References ReferenceIndex
+
+	// Diagnostics receives the diagnostics of every compiled file, including
+	// files that aren't indexed because of errors (optional)
+	Diagnostics DiagnosticIndex
+
+	// Dependencies receives the units used by every compiled file (optional)
+	Dependencies DependencyIndex
+
+	// Compile compiles the files; nil compiles them without diagnostics
+	Compile CompileFunc
+
+	// CacheDir is the directory for persistent index caches; empty disables caching
+	CacheDir string
+
+	// Workers is the number of files compiled in parallel; 0 uses all CPUs
+	Workers int
+
+	// Filter decides which files are indexed
+	Filter IndexFilter
+
+	// InWorkspace reports whether a file still belongs to the workspace (optional).
+	// The results of other files, e.g. of a folder removed while it was being
+	// indexed, are dropped.
+	InWorkspace func(uri string) bool
+
+	// Progress is called as indexing advances (optional). It is called from a
+	// single goroutine, once before the first file and once with Done set at the end.
+	Progress func(IndexProgress)
+}
+
+// IndexProgress describes how far workspace indexing has come.
+type IndexProgress struct {
+	// Processed is the number of files compiled or taken from the cache so far
+	Processed int
+
+	// Found is the number of files found so far; it grows while directories are walked
+	Found int
+
+	// Indexed is the number of files added to the index so far
+	Indexed int
+
+	// Done is set when indexing has finished
+	Done bool
+}
+
 // Indexer handles workspace file indexing.
 type Indexer struct {
 	index     *SymbolIndex
-	maxDepth  int
+	options   IndexOptions
+	cache     *IndexCache
 	maxFiles  int
 	fileCount int
+	reused    int
+	processed int
+	found     atomic.Int64
 }
 
 // NewIndexer creates a new workspace indexer.
 func NewIndexer(index *SymbolIndex) *Indexer {
+	return NewIndexerWithOptions(index, IndexOptions{})
+}
+
+// NewIndexerWithOptions creates a new workspace indexer with the given options.
+func NewIndexerWithOptions(index *SymbolIndex, options IndexOptions) *Indexer {
 	return &Indexer{
 		index:    index,
-		maxDepth: 10,    // Maximum directory depth
-		maxFiles: 10000, // Maximum files to index
+		options:  options,
+		maxFiles: options.Filter.maxFiles(),
 	}
 }
 
 // BuildWorkspaceIndex scans workspace folders and indexes all .dws files.
-// This runs in the background and doesn't block the caller.
-func (idx *Indexer) BuildWorkspaceIndex(workspaceFolders []protocol.WorkspaceFolder) {
+// Indexing stops early when ctx is cancelled, leaving the index incomplete.
+func (idx *Indexer) BuildWorkspaceIndex(ctx context.Context, workspaceFolders []protocol.WorkspaceFolder) {
 	if len(workspaceFolders) == 0 {
 		log.Println("No workspace folders to index")
 		return
 	}
 
-	log.Printf("Starting workspace indexing for %d folders\n", len(workspaceFolders))
+	log.Printf("Starting workspace indexing for %d folders with %d workers\n",
+		len(workspaceFolders), idx.workers())
+
+	idx.reportProgress(false)
+	defer idx.reportProgress(true)
 
 	for _, folder := range workspaceFolders {
+		if ctx.Err() != nil {
+			log.Println("Workspace indexing cancelled")
+			break
+		}
+
 		// Convert URI to file path
 		path := uriToPath(folder.URI)
 		if path == "" {
@@ -48,106 +119,325 @@ func (idx *Indexer) BuildWorkspaceIndex(workspaceFolders []protocol.WorkspaceFol
 			continue
 		}
 
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			log.Printf("Warning: Workspace folder is not a directory: %s\n", path)
+			continue
+		}
+
 		log.Printf("Indexing workspace folder: %s\n", path)
-		idx.indexDirectory(path, 0)
+
+		idx.cache = LoadIndexCache(idx.options.CacheDir, path)
+		idx.indexFolder(ctx, path)
+
+		// A cancelled run didn't visit every file, and saving would drop the
+		// others from the cache
+		if ctx.Err() == nil {
+			if err := idx.cache.Save(); err != nil {
+				log.Printf("Warning: Could not save index cache for %s: %v\n", path, err)
+			}
+		}
+
+		idx.cache = nil
 	}
 
-	log.Printf("Workspace indexing complete. Indexed %d files, %d symbols\n",
-		idx.fileCount, idx.index.GetTotalLocationCount())
+	log.Printf("Workspace indexing complete. Indexed %d files (%d from cache), %d symbols\n",
+		idx.fileCount, idx.reused, idx.index.GetTotalLocationCount())
 }
 
-// indexDirectory recursively indexes a directory.
-func (idx *Indexer) indexDirectory(dirPath string, depth int) {
-	// Check depth limit
-	if depth > idx.maxDepth {
+// reportProgress passes the current progress to the Progress option.
+func (idx *Indexer) reportProgress(done bool) {
+	if idx.options.Progress == nil {
 		return
 	}
 
-	// Check file count limit
+	idx.options.Progress(IndexProgress{
+		Processed: idx.processed,
+		Found:     int(idx.found.Load()),
+		Indexed:   idx.fileCount,
+		Done:      done,
+	})
+}
+
+// workers returns the number of files compiled in parallel.
+func (idx *Indexer) workers() int {
+	if idx.options.Workers > 0 {
+		return idx.options.Workers
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// indexJob is a file found by the directory walk. seq is its position in walk order.
+type indexJob struct {
+	seq  int
+	path string
+}
+
+// indexResult holds the outcome of indexing one file. A nil entry means the
+// file couldn't be read.
+type indexResult struct {
+	seq    int
+	uri    string
+	entry  *indexCacheEntry
+	reused bool
+}
+
+// indexFolder indexes all files below a workspace folder.
+//
+// Indexing is a pipeline: the directory walk produces files in a deterministic
+// order, a pool of workers compiles them in parallel, and the results are
+// applied to the indexes in walk order. The final index contents, including
+// which files are dropped by the file limit, don't depend on scheduling.
+func (idx *Indexer) indexFolder(ctx context.Context, root string) {
+	// The file limit applies across all workspace folders
 	if idx.fileCount >= idx.maxFiles {
 		return
 	}
 
-	// Read directory entries
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		// Silently skip directories we can't read (permissions, etc.)
-		return
+	jobs := make(chan indexJob)
+	results := make(chan indexResult)
+	stop := make(chan struct{})
+
+	// Producer: walk the directory tree
+	go func() {
+		defer close(jobs)
+
+		seq := 0
+		idx.options.Filter.walk(root, func(path string) bool {
+			idx.found.Add(1)
+
+			select {
+			case jobs <- indexJob{seq: seq, path: path}:
+				seq++
+				return true
+			case <-stop:
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	// Consumers: compile files in parallel
+	var wg sync.WaitGroup
+
+	for range idx.workers() {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				results <- idx.processFile(job)
+			}
+		}()
 	}
 
-	for _, entry := range entries {
-		fullPath := filepath.Join(dirPath, entry.Name())
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Apply results in walk order
+	pending := make(map[int]indexResult)
+	next := 0
+	stopped := false
 
-		// Skip hidden files and directories
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
+	for result := range results {
+		pending[result.seq] = result
+
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			next++
 
-		// Skip common directories to ignore
-		if entry.IsDir() {
-			switch entry.Name() {
-			case "node_modules", "vendor", "bin", "obj", "dist", "build", "out", "__pycache__":
+			if stopped {
 				continue
 			}
 
-			// Recursively index subdirectory
-			idx.indexDirectory(fullPath, depth+1)
+			idx.applyResult(res)
+			idx.processed++
+			idx.reportProgress(false)
 
-			continue
-		}
+			// Stop walking once the file limit is reached; files already being
+			// compiled are drained and discarded
+			if idx.fileCount >= idx.maxFiles {
+				log.Printf("Reached the limit of %d indexed files\n", idx.maxFiles)
+				close(stop)
 
-		// Check if it's a .dws file
-		if !strings.HasSuffix(strings.ToLower(entry.Name()), ".dws") {
-			continue
+				stopped = true
+			}
 		}
+	}
+}
+
+// processFile compiles a file, or takes its results from the cache, without
+// touching the indexes. It is called concurrently by the workers.
+func (idx *Indexer) processFile(job indexJob) indexResult {
+	// Convert file path to URI
+	result := indexResult{seq: job.seq, uri: pathToURI(job.path)}
+
+	info, err := os.Stat(job.path)
+	if err != nil {
+		log.Printf("Warning: Could not stat file %s: %v\n", job.path, err)
+		return result
+	}
+
+	// Reuse the results of the last run if the file is unchanged
+	if entry := idx.cache.lookup(job.path, info); entry != nil {
+		result.entry, result.reused = entry, true
+		return result
+	}
+
+	// Read file contents
+	content, err := os.ReadFile(job.path)
+	if err != nil {
+		log.Printf("Warning: Could not read file %s: %v\n", job.path, err)
+		return result
+	}
+
+	hash := HashContent(content)
+	if entry := idx.cache.lookupContent(job.path, info, hash); entry != nil {
+		result.entry, result.reused = entry, true
+		return result
+	}
+
+	compiled := idx.compile(result.uri, content)
+
+	result.entry = &indexCacheEntry{Hash: hash, Failed: true, Diagnostics: compiled.Diagnostics, Units: compiled.Units}
 
-		// Index the file
-		idx.indexFile(fullPath)
+	if compiled.Program != nil {
+		result.entry = &indexCacheEntry{
+			Hash:        hash,
+			Symbols:     extractFileSymbols(result.uri, compiled.Program.AST()),
+			References:  CollectReferences(compiled.Program.AST()),
+			Diagnostics: compiled.Diagnostics,
+			Units:       compiled.Units,
+		}
 	}
+
+	idx.cache.store(job.path, info, hash, result.entry)
+
+	return result
 }
 
-// indexFile parses a file and adds its symbols to the index.
-func (idx *Indexer) indexFile(filePath string) {
-	// Check file count limit
-	if idx.fileCount >= idx.maxFiles {
+// applyResult adds the results of a processed file to the indexes.
+func (idx *Indexer) applyResult(result indexResult) {
+	if idx.options.InWorkspace != nil && !idx.options.InWorkspace(result.uri) {
+		return
+	}
+
+	if result.entry != nil && idx.options.Diagnostics != nil {
+		idx.options.Diagnostics.SetDiagnostics(result.uri, result.entry.Hash, result.entry.Diagnostics)
+	}
+
+	if result.entry != nil && idx.options.Dependencies != nil {
+		idx.options.Dependencies.SetUnits(result.uri, result.entry.Units)
+	}
+
+	// Files with errors aren't indexed, see compileSource
+	if result.entry == nil || result.entry.Failed {
 		return
 	}
 
+	idx.index.addFileSymbols(result.uri, result.entry.Symbols)
+
+	if idx.options.References != nil {
+		idx.options.References.SetReferences(result.uri, result.entry.References)
+	}
+
+	if result.reused {
+		idx.reused++
+	}
+
+	idx.fileCount++
+	if idx.fileCount%100 == 0 {
+		log.Printf("Indexed %d files so far...\n", idx.fileCount)
+	}
+}
+
+// extractFileSymbols extracts the top-level symbols of a file into a list,
+// without adding them to an index.
+func extractFileSymbols(uri string, programAST *ast.Program) []SymbolLocation {
+	scratch := &Indexer{index: NewSymbolIndex()}
+	scratch.extractSymbols(uri, programAST)
+
+	return scratch.index.fileSymbols(uri)
+}
+
+// ReindexFile replaces the index entries of a single file with its current
+// contents on disk. It returns the compiled program, or nil if the file can't
+// be read or doesn't compile, in which case the file is no longer indexed.
+func (idx *Indexer) ReindexFile(uri string) *dwscript.Program {
+	idx.index.RemoveFile(uri)
+
+	path := uriToPath(uri)
+	if path == "" {
+		return nil
+	}
+
 	// Read file contents
-	content, err := os.ReadFile(filePath)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("Warning: Could not read file %s: %v\n", filePath, err)
-		return
+		log.Printf("Warning: Could not read file %s: %v\n", path, err)
+		return nil
+	}
+
+	compiled := idx.compile(uri, content)
+
+	if idx.options.Diagnostics != nil {
+		idx.options.Diagnostics.SetDiagnostics(uri, HashContent(content), compiled.Diagnostics)
+	}
+
+	if idx.options.Dependencies != nil {
+		idx.options.Dependencies.SetUnits(uri, compiled.Units)
+	}
+
+	if compiled.Program == nil {
+		return nil
+	}
+
+	idx.extractSymbols(uri, compiled.Program.AST())
+
+	return compiled.Program
+}
+
+// compile compiles the contents of the file uri with the Compile option, or
+// without diagnostics and units if it isn't set.
+func (idx *Indexer) compile(uri string, content []byte) CompileResult {
+	if idx.options.Compile != nil {
+		return idx.options.Compile(uri, content)
 	}
 
+	return CompileResult{Program: compileSource(content)}
+}
+
+// compileSource compiles the contents of a file.
+// It returns nil if the source has errors.
+func compileSource(content []byte) *dwscript.Program {
 	// Create DWScript engine and compile the file
 	engine, err := dwscript.New()
 	if err != nil {
 		log.Printf("Warning: Could not create engine: %v\n", err)
-		return
+		return nil
 	}
 
 	prog, err := engine.Compile(string(content))
 	if err != nil {
 		// Log parse errors but don't fail the indexing
 		// (many files may have errors during development)
-		return
+		return nil
 	}
 
 	if prog == nil || prog.AST() == nil {
-		return
+		return nil
 	}
 
-	// Convert file path to URI
-	uri := pathToURI(filePath)
-
-	// Extract and index symbols
-	idx.extractSymbols(uri, prog.AST())
-
-	idx.fileCount++
-	if idx.fileCount%100 == 0 {
-		log.Printf("Indexed %d files so far...\n", idx.fileCount)
-	}
+	return prog
 }
 
 // extractSymbols extracts top-level symbols from an AST.
@@ -175,6 +465,9 @@ func (idx *Indexer) extractSymbols(uri string, programAST *ast.Program) {
 		case *ast.ClassDecl:
 			idx.addClassSymbol(uri, node)
 
+		case *ast.InterfaceDecl:
+			idx.addInterfaceSymbol(uri, node)
+
 		case *ast.RecordDecl:
 			idx.addRecordSymbol(uri, node)
 
@@ -308,8 +601,20 @@ func (idx *Indexer) addClassSymbol(uri string, classDecl *ast.ClassDecl) {
 		},
 	}
 
+	// The parent class and implemented interfaces link the class into the type hierarchy
+	var supertypes []string
+	if classDecl.Parent != nil {
+		supertypes = append(supertypes, classDecl.Parent.Value)
+	}
+
+	for _, iface := range classDecl.Interfaces {
+		if iface != nil {
+			supertypes = append(supertypes, iface.Value)
+		}
+	}
+
 	className := classDecl.Name.Value
-	idx.index.AddSymbol(className, protocol.SymbolKindClass, uri, symbolRange, "", detail)
+	idx.index.AddTypeSymbol(className, protocol.SymbolKindClass, uri, symbolRange, detail, supertypes)
 
 	// Add class methods with class name as container
 	for _, method := range classDecl.Methods {
@@ -378,6 +683,37 @@ func (idx *Indexer) addClassSymbol(uri string, classDecl *ast.ClassDecl) {
 	}
 }
 
+// addInterfaceSymbol adds an interface symbol to the index.
+func (idx *Indexer) addInterfaceSymbol(uri string, interfaceDecl *ast.InterfaceDecl) {
+	if interfaceDecl == nil || interfaceDecl.Name == nil {
+		return
+	}
+
+	detail := "interface"
+
+	var supertypes []string
+	if interfaceDecl.Parent != nil {
+		detail += "(" + interfaceDecl.Parent.Value + ")"
+		supertypes = append(supertypes, interfaceDecl.Parent.Value)
+	}
+
+	start := interfaceDecl.Pos()
+	end := interfaceDecl.End()
+
+	symbolRange := protocol.Range{
+		Start: protocol.Position{
+			Line:      uint32(max(0, start.Line-1)),
+			Character: uint32(max(0, start.Column-1)),
+		},
+		End: protocol.Position{
+			Line:      uint32(max(0, end.Line-1)),
+			Character: uint32(max(0, end.Column-1)),
+		},
+	}
+
+	idx.index.AddTypeSymbol(interfaceDecl.Name.Value, protocol.SymbolKindInterface, uri, symbolRange, detail, supertypes)
+}
+
 // addRecordSymbol adds a record symbol to the index.
 func (idx *Indexer) addRecordSymbol(uri string, recordDecl *ast.RecordDecl) {
 	if recordDecl == nil || recordDecl.Name == nil {
@@ -526,6 +862,18 @@ func buildFunctionSignature(fn *ast.FunctionDecl) string {
 	return sig
 }
 
+// IsIndexedPath reports whether the workspace indexer would index the file at
+// path inside one of the workspace folders, according to filter.
+func IsIndexedPath(path string, workspaceFolders []string, filter IndexFilter) bool {
+	for _, folder := range workspaceFolders {
+		if filter.Includes(folder, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // uriToPath converts a URI to a file system path.
 func uriToPath(uri string) string {
 	// Handle file:// URIs
@@ -556,13 +904,13 @@ func pathToURI(path string) string {
 }
 
 // IndexWorkspace is a helper function that creates an indexer and builds the workspace index.
-func IndexWorkspace(index *SymbolIndex, workspaceFolders []protocol.WorkspaceFolder) {
-	indexer := NewIndexer(index)
-	indexer.BuildWorkspaceIndex(workspaceFolders)
+func IndexWorkspace(ctx context.Context, index *SymbolIndex, workspaceFolders []protocol.WorkspaceFolder, options IndexOptions) {
+	indexer := NewIndexerWithOptions(index, options)
+	indexer.BuildWorkspaceIndex(ctx, workspaceFolders)
 }
 
 // IndexWorkspaceAsync runs workspace indexing in a background goroutine.
-func IndexWorkspaceAsync(index *SymbolIndex, workspaceFolders []protocol.WorkspaceFolder) {
+func IndexWorkspaceAsync(ctx context.Context, index *SymbolIndex, workspaceFolders []protocol.WorkspaceFolder, options IndexOptions) {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -570,14 +918,29 @@ func IndexWorkspaceAsync(index *SymbolIndex, workspaceFolders []protocol.Workspa
 			}
 		}()
 
-		IndexWorkspace(index, workspaceFolders)
+		IndexWorkspace(ctx, index, workspaceFolders, options)
 	}()
 }
 
+// UpdateFile re-indexes a single file after it was created or changed on disk.
+// It returns the compiled program, or nil if the file couldn't be indexed.
+func UpdateFile(index *SymbolIndex, uri string) *dwscript.Program {
+	return UpdateFileWithOptions(index, uri, IndexOptions{})
+}
+
+// UpdateFileWithOptions is like UpdateFile, but compiles the file with the
+// Compile option and passes its diagnostics and units to the Diagnostics and
+// Dependencies options.
+func UpdateFileWithOptions(index *SymbolIndex, uri string, options IndexOptions) *dwscript.Program {
+	return NewIndexerWithOptions(index, options).ReindexFile(uri)
+}
+
 // FallbackSearch performs on-demand symbol search when the index is not available.
 // It walks through workspace folders, parses .dws files, and searches for symbols matching the query.
 // This provides basic functionality while the index is being built.
-func FallbackSearch(workspaceFolders []string, query string, maxResults int) []SymbolLocation {
+// Only files accepted by filter are searched, and the search stops early when
+// ctx is cancelled.
+func FallbackSearch(ctx context.Context, workspaceFolders []string, filter IndexFilter, query string, maxResults int) []SymbolLocation {
 	log.Printf("Warning: Symbol index not ready, using fallback search for query %q\n", query)
 
 	if maxResults <= 0 {
@@ -596,39 +959,10 @@ func FallbackSearch(workspaceFolders []string, query string, maxResults int) []S
 		}
 
 		// Walk through the folder
-		err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err // Return walk errors
-			}
-
-			// Skip directories
-			if info.IsDir() {
-				// Skip hidden directories and common build directories
-				name := filepath.Base(path)
-				if strings.HasPrefix(name, ".") {
-					return filepath.SkipDir
-				}
-
-				switch name {
-				case "node_modules", "vendor", "bin", "obj", "dist", "build", "out", "__pycache__":
-					return filepath.SkipDir
-				}
-
-				return nil
-			}
-
-			// Only process .dws files
-			if !strings.HasSuffix(strings.ToLower(path), ".dws") {
-				return nil
-			}
-
+		filter.walk(folder, func(path string) bool {
 			// Check limits
-			if filesSearched >= maxFilesToSearch {
-				return filepath.SkipAll
-			}
-
-			if len(results) >= maxResults {
-				return filepath.SkipAll
+			if ctx.Err() != nil || filesSearched >= maxFilesToSearch || len(results) >= maxResults {
+				return false
 			}
 
 			filesSearched++
@@ -637,11 +971,8 @@ func FallbackSearch(workspaceFolders []string, query string, maxResults int) []S
 			fileResults := searchFileForSymbols(path, queryLower)
 			results = append(results, fileResults...)
 
-			return nil
+			return true
 		})
-		if err != nil {
-			log.Printf("Warning: Error walking workspace folder %s: %v\n", folder, err)
-		}
 	}
 
 	log.Printf("Fallback search found %d results from %d files\n", len(results), filesSearched)
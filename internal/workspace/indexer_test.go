@@ -0,0 +1,335 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestUpdateFile_ReplacesSymbols(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "unit.dws")
+	uri := pathToURI(path)
+
+	if err := os.WriteFile(path, []byte("function OldName(): Integer;\nbegin\n  Result := 1;\nend;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewSymbolIndex()
+	if UpdateFile(index, uri) == nil {
+		t.Fatal("UpdateFile returned nil program for valid file")
+	}
+
+	if len(index.FindSymbol("OldName")) != 1 {
+		t.Fatalf("Expected OldName to be indexed")
+	}
+
+	if err := os.WriteFile(path, []byte("function NewName(): Integer;\nbegin\n  Result := 2;\nend;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	UpdateFile(index, uri)
+
+	if len(index.FindSymbol("OldName")) != 0 {
+		t.Error("Expected OldName to be removed after re-indexing")
+	}
+
+	if len(index.FindSymbol("NewName")) != 1 {
+		t.Error("Expected NewName to be indexed after re-indexing")
+	}
+}
+
+func TestUpdateFile_IndexesSupertypes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shapes.dws")
+	uri := pathToURI(path)
+
+	content := `type IShape = interface
+  function Area: Float;
+end;
+
+type IPolygon = interface(IShape)
+end;
+
+type TBase = class
+end;
+
+type TSquare = class(TBase, IShape)
+  function Area: Float;
+end;
+
+function TSquare.Area: Float;
+begin
+  Result := 1;
+end;
+`
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewSymbolIndex()
+	if UpdateFile(index, uri) == nil {
+		t.Fatal("UpdateFile returned nil program for valid file")
+	}
+
+	if interfaces := index.FindSymbol("IShape"); len(interfaces) != 1 || interfaces[0].Kind != protocol.SymbolKindInterface {
+		t.Errorf("Expected IShape to be indexed as an interface, got %+v", interfaces)
+	}
+
+	var names []string
+	for _, subtype := range index.FindSubtypes("IShape") {
+		names = append(names, subtype.Name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"IPolygon", "TSquare"}) {
+		t.Errorf("Expected IPolygon and TSquare to derive from IShape, got %v", names)
+	}
+
+	if subtypes := index.FindSubtypes("TBase"); len(subtypes) != 1 || subtypes[0].Name != "TSquare" {
+		t.Errorf("Expected TSquare to derive from TBase, got %+v", subtypes)
+	}
+}
+
+func TestUpdateFile_MissingFileRemovesSymbols(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gone.dws")
+	uri := pathToURI(path)
+
+	if err := os.WriteFile(path, []byte("var Counter: Integer;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewSymbolIndex()
+	UpdateFile(index, uri)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if UpdateFile(index, uri) != nil {
+		t.Error("Expected nil program for missing file")
+	}
+
+	if index.GetFileCount() != 0 {
+		t.Errorf("Expected 0 files, got %d", index.GetFileCount())
+	}
+}
+
+func TestUpdateFileWithOptions_ReportsDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.dws")
+	uri := pathToURI(path)
+
+	if err := os.WriteFile(path, []byte("var Counter: Integer := error;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	diagnostics := &recordingDiagnostics{}
+
+	index := NewSymbolIndex()
+
+	program := UpdateFileWithOptions(index, uri, IndexOptions{Diagnostics: diagnostics, Compile: errorCompiler(&calls)})
+	if program != nil || index.GetFileCount() != 0 {
+		t.Errorf("Expected a file with errors not to be indexed, got %d files", index.GetFileCount())
+	}
+
+	if calls != 1 || len(diagnostics.diagnostics[uri]) != 1 {
+		t.Errorf("Expected the file's error to be reported, got %+v", diagnostics.diagnostics)
+	}
+}
+
+func TestIsIndexedPath(t *testing.T) {
+	root := filepath.FromSlash("/work/project")
+	folders := []string{root}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(root, "main.dws"), true},
+		{filepath.Join(root, "src", "Unit.DWS"), true},
+		{filepath.Join(root, "readme.md"), false},
+		{filepath.Join(root, ".git", "main.dws"), false},
+		{filepath.Join(root, "node_modules", "lib", "a.dws"), false},
+		{filepath.Join(root, "src", "build.dws"), true},
+		{filepath.FromSlash("/work/other/main.dws"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsIndexedPath(tt.path, folders, DefaultIndexFilter()); got != tt.want {
+			t.Errorf("IsIndexedPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// writeWorkspace creates a workspace with n files spread over a few directories.
+func writeWorkspace(t *testing.T, n int) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for i := range n {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", i%3))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every file also declares Shared, so the order of its locations shows
+		content := fmt.Sprintf("var Shared%d: Integer;\nfunction Func%d(): Integer;\nbegin\n  Result := %d;\nend;\n", i%2, i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d.dws", i)), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func buildIndex(root string, workers, maxFiles int) *SymbolIndex {
+	index := NewSymbolIndex()
+
+	indexer := NewIndexerWithOptions(index, IndexOptions{Workers: workers})
+	if maxFiles > 0 {
+		indexer.maxFiles = maxFiles
+	}
+
+	indexer.BuildWorkspaceIndex(context.Background(), []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+	return index
+}
+
+func TestBuildWorkspaceIndex_DeterministicAcrossWorkers(t *testing.T) {
+	root := writeWorkspace(t, 24)
+
+	sequential := buildIndex(root, 1, 0)
+	if sequential.GetFileCount() != 24 {
+		t.Fatalf("Expected 24 indexed files, got %d", sequential.GetFileCount())
+	}
+
+	for _, workers := range []int{2, 8} {
+		parallel := buildIndex(root, workers, 0)
+
+		for _, name := range []string{"Shared0", "Shared1", "Func7"} {
+			if got, want := parallel.FindSymbol(name), sequential.FindSymbol(name); !reflect.DeepEqual(got, want) {
+				t.Errorf("workers=%d: FindSymbol(%q) differs from sequential indexing", workers, name)
+			}
+		}
+	}
+}
+
+func TestBuildWorkspaceIndex_FileLimitIsDeterministic(t *testing.T) {
+	root := writeWorkspace(t, 12)
+
+	want := buildIndex(root, 1, 5)
+	if want.GetFileCount() != 5 {
+		t.Fatalf("Expected 5 indexed files, got %d", want.GetFileCount())
+	}
+
+	got := buildIndex(root, 4, 5)
+	if !reflect.DeepEqual(got.FindSymbol("Shared0"), want.FindSymbol("Shared0")) ||
+		!reflect.DeepEqual(got.FindSymbol("Shared1"), want.FindSymbol("Shared1")) {
+		t.Error("Expected the same files to be indexed regardless of the number of workers")
+	}
+}
+
+func TestBuildWorkspaceIndex_ReportsProgress(t *testing.T) {
+	root := writeWorkspace(t, 6)
+
+	var reports []IndexProgress
+
+	indexer := NewIndexerWithOptions(NewSymbolIndex(), IndexOptions{
+		Workers: 3,
+		Progress: func(p IndexProgress) {
+			reports = append(reports, p)
+		},
+	})
+	indexer.BuildWorkspaceIndex(context.Background(), []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+	if len(reports) != 8 {
+		t.Fatalf("Expected start, 6 file reports and done, got %d reports", len(reports))
+	}
+
+	if first := reports[0]; first.Processed != 0 || first.Done {
+		t.Errorf("Expected initial report, got %+v", first)
+	}
+
+	last := reports[len(reports)-1]
+	if !last.Done || last.Processed != 6 || last.Found != 6 || last.Indexed != 6 {
+		t.Errorf("Expected final report with 6 files, got %+v", last)
+	}
+}
+
+func TestBuildWorkspaceIndex_StopsWhenCancelled(t *testing.T) {
+	root := writeWorkspace(t, 24)
+	cacheDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	index := NewSymbolIndex()
+	indexer := NewIndexerWithOptions(index, IndexOptions{
+		Workers:  1,
+		CacheDir: cacheDir,
+		Progress: func(p IndexProgress) {
+			if p.Processed == 2 {
+				cancel()
+			}
+		},
+	})
+	indexer.BuildWorkspaceIndex(ctx, []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+	if count := index.GetFileCount(); count < 2 || count >= 24 {
+		t.Errorf("Expected indexing to stop early, indexed %d files", count)
+	}
+
+	// The cache of an incomplete run would lose the files that weren't visited
+	if _, err := os.Stat(LoadIndexCache(cacheDir, root).path); !os.IsNotExist(err) {
+		t.Errorf("Expected no cache to be saved for a cancelled run, got %v", err)
+	}
+}
+
+func TestBuildWorkspaceIndex_DropsFilesLeavingTheWorkspace(t *testing.T) {
+	root := writeWorkspace(t, 6)
+
+	// The folder is removed from the workspace after two files were indexed
+	removed, indexedBefore := false, 0
+
+	index := NewSymbolIndex()
+	indexer := NewIndexerWithOptions(index, IndexOptions{
+		Workers: 1,
+		InWorkspace: func(uri string) bool {
+			return !removed
+		},
+		Progress: func(p IndexProgress) {
+			if p.Processed == 2 {
+				removed, indexedBefore = true, p.Indexed
+			}
+		},
+	})
+	indexer.BuildWorkspaceIndex(context.Background(), []protocol.WorkspaceFolder{{URI: pathToURI(root), Name: "root"}})
+
+	if count := index.GetFileCount(); indexedBefore != 2 || count != 2 {
+		t.Errorf("Expected only the 2 files indexed before the folder was removed, got %d", count)
+	}
+}
+
+func TestFallbackSearch_StopsWhenCancelled(t *testing.T) {
+	root := writeWorkspace(t, 3)
+
+	if results := FallbackSearch(context.Background(), []string{root}, IndexFilter{}, "Func", 10); len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if results := FallbackSearch(ctx, []string{root}, IndexFilter{}, "Func", 10); len(results) != 0 {
+		t.Errorf("Expected no results from a cancelled search, got %d", len(results))
+	}
+}
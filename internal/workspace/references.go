@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"github.com/cwbudde/go-dws/pkg/ast"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// ReferenceIndex receives the identifier references of indexed files.
+// The server's reference index implements it, so that references in files that
+// aren't open can be found without parsing them again.
+type ReferenceIndex interface {
+	// SetReferences replaces all references recorded for uri.
+	SetReferences(uri string, references map[string][]protocol.Range)
+}
+
+// CollectReferences returns the ranges of all identifiers in an AST, grouped by
+// identifier name.
+func CollectReferences(root ast.Node) map[string][]protocol.Range {
+	result := make(map[string][]protocol.Range)
+	if root == nil {
+		return result
+	}
+
+	ast.Inspect(root, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || ident == nil {
+			return true
+		}
+
+		start := ident.Pos()
+		end := ident.End()
+		rng := protocol.Range{
+			Start: protocol.Position{Line: uint32(max(0, start.Line-1)), Character: uint32(max(0, start.Column-1))},
+			End:   protocol.Position{Line: uint32(max(0, end.Line-1)), Character: uint32(max(0, end.Column-1))},
+		}
+		result[ident.Value] = append(result[ident.Value], rng)
+
+		return true
+	})
+
+	return result
+}
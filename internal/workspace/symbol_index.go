@@ -3,6 +3,8 @@ package workspace
 
 import (
 	"log"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 
@@ -16,6 +18,7 @@ type SymbolLocation struct {
 	Location      protocol.Location   // Full location with URI and range
 	ContainerName string              // Name of containing scope (e.g., class name for methods)
 	Detail        string              // Additional detail (e.g., signature)
+	Supertypes    []string            // Parent class and implemented interfaces of a class or interface
 }
 
 // FileInfo stores metadata about an indexed file.
@@ -35,6 +38,10 @@ type SymbolIndex struct {
 	// files maps document URIs to file metadata
 	files map[string]*FileInfo
 
+	// subtypes maps lower-case type names to the classes and interfaces
+	// deriving from them directly
+	subtypes map[string][]SymbolLocation
+
 	// mutex protects concurrent access to the index
 	mutex sync.RWMutex
 }
@@ -42,18 +49,16 @@ type SymbolIndex struct {
 // NewSymbolIndex creates a new empty symbol index.
 func NewSymbolIndex() *SymbolIndex {
 	return &SymbolIndex{
-		symbols: make(map[string][]SymbolLocation),
-		files:   make(map[string]*FileInfo),
+		symbols:  make(map[string][]SymbolLocation),
+		files:    make(map[string]*FileInfo),
+		subtypes: make(map[string][]SymbolLocation),
 	}
 }
 
 // AddSymbol adds a symbol to the index.
 // If the symbol already exists from the same file, it will be updated.
 func (si *SymbolIndex) AddSymbol(name string, kind protocol.SymbolKind, uri string, symbolRange protocol.Range, containerName string, detail string) {
-	si.mutex.Lock()
-	defer si.mutex.Unlock()
-
-	location := SymbolLocation{
+	si.add(SymbolLocation{
 		Name: name,
 		Kind: kind,
 		Location: protocol.Location{
@@ -62,7 +67,31 @@ func (si *SymbolIndex) AddSymbol(name string, kind protocol.SymbolKind, uri stri
 		},
 		ContainerName: containerName,
 		Detail:        detail,
-	}
+	})
+}
+
+// AddTypeSymbol adds a class or interface to the index, recording it as a
+// subtype of its supertypes: the parent class and implemented interfaces.
+func (si *SymbolIndex) AddTypeSymbol(name string, kind protocol.SymbolKind, uri string, symbolRange protocol.Range, detail string, supertypes []string) {
+	si.add(SymbolLocation{
+		Name: name,
+		Kind: kind,
+		Location: protocol.Location{
+			URI:   uri,
+			Range: symbolRange,
+		},
+		Detail:     detail,
+		Supertypes: supertypes,
+	})
+}
+
+// add adds a symbol location to the index.
+func (si *SymbolIndex) add(location SymbolLocation) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	name := location.Name
+	uri := location.Location.URI
 
 	// Add to symbols map
 	si.symbols[name] = append(si.symbols[name], location)
@@ -80,7 +109,76 @@ func (si *SymbolIndex) AddSymbol(name string, kind protocol.SymbolKind, uri stri
 	// Track that this file defines this symbol
 	fileInfo.Symbols = append(fileInfo.Symbols, name)
 
-	log.Printf("Indexed symbol '%s' (%v) in %s", name, kind, uri)
+	si.addSubtype(location)
+
+	log.Printf("Indexed symbol '%s' (%v) in %s", name, location.Kind, uri)
+}
+
+// addSubtype records location as a subtype of each of its supertypes.
+// The caller must hold the write lock.
+func (si *SymbolIndex) addSubtype(location SymbolLocation) {
+	for _, supertype := range location.Supertypes {
+		key := strings.ToLower(supertype)
+		si.subtypes[key] = append(si.subtypes[key], location)
+	}
+}
+
+// addFileSymbols adds previously extracted symbols of a file to the index.
+// Unlike AddSymbol it doesn't log each symbol, as it restores whole files from
+// the index cache.
+func (si *SymbolIndex) addFileSymbols(uri string, symbols []SymbolLocation) {
+	if len(symbols) == 0 {
+		return
+	}
+
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	fileInfo, exists := si.files[uri]
+	if !exists {
+		fileInfo = &FileInfo{
+			URI:     uri,
+			Symbols: make([]string, 0, len(symbols)),
+		}
+		si.files[uri] = fileInfo
+	}
+
+	for _, sym := range symbols {
+		si.symbols[sym.Name] = append(si.symbols[sym.Name], sym)
+		fileInfo.Symbols = append(fileInfo.Symbols, sym.Name)
+		si.addSubtype(sym)
+	}
+}
+
+// fileSymbols returns the symbols defined in a file, each exactly once.
+func (si *SymbolIndex) fileSymbols(uri string) []SymbolLocation {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	fileInfo, exists := si.files[uri]
+	if !exists {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(fileInfo.Symbols))
+
+	var result []SymbolLocation
+
+	for _, symbolName := range fileInfo.Symbols {
+		if seen[symbolName] {
+			continue
+		}
+
+		seen[symbolName] = true
+
+		for _, loc := range si.symbols[symbolName] {
+			if loc.Location.URI == uri {
+				result = append(result, loc)
+			}
+		}
+	}
+
+	return result
 }
 
 // FindSymbol searches for all locations where a symbol is defined.
@@ -101,6 +199,21 @@ func (si *SymbolIndex) FindSymbol(name string) []SymbolLocation {
 	return result
 }
 
+// FindSubtypes returns the classes and interfaces deriving directly from the
+// type name, which is matched case-insensitively.
+func (si *SymbolIndex) FindSubtypes(name string) []SymbolLocation {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	locations := si.subtypes[strings.ToLower(name)]
+
+	// Return a copy to avoid external modifications
+	result := make([]SymbolLocation, len(locations))
+	copy(result, locations)
+
+	return result
+}
+
 // FindSymbolsByKind searches for symbols of a specific kind.
 func (si *SymbolIndex) FindSymbolsByKind(kind protocol.SymbolKind) []SymbolLocation {
 	si.mutex.RLock()
@@ -143,6 +256,27 @@ func (si *SymbolIndex) FindSymbolsInFile(uri string) []SymbolLocation {
 	return result
 }
 
+// FindFilesByName returns the URIs of the indexed files whose base name
+// without extension is name, matched case-insensitively, such as the file
+// Utils.pas for the unit name "utils". The URIs are sorted.
+func (si *SymbolIndex) FindFilesByName(name string) []string {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+
+	var result []string
+
+	for uri := range si.files {
+		base := path.Base(uri)
+		if strings.EqualFold(strings.TrimSuffix(base, path.Ext(base)), name) {
+			result = append(result, uri)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
 // RemoveFile removes all symbols from a file.
 // This should be called when a file is deleted or before re-indexing.
 func (si *SymbolIndex) RemoveFile(uri string) {
@@ -175,12 +309,53 @@ func (si *SymbolIndex) RemoveFile(uri string) {
 		}
 	}
 
+	// Remove the file's types from the subtypes of their supertypes
+	for supertype, subtypes := range si.subtypes {
+		var remaining []SymbolLocation
+
+		for _, loc := range subtypes {
+			if loc.Location.URI != uri {
+				remaining = append(remaining, loc)
+			}
+		}
+
+		if len(remaining) > 0 {
+			si.subtypes[supertype] = remaining
+		} else {
+			delete(si.subtypes, supertype)
+		}
+	}
+
 	// Remove file info
 	delete(si.files, uri)
 
 	log.Printf("Removed all symbols from file: %s", uri)
 }
 
+// RemoveDirectory removes all symbols from files located under the directory
+// with the given URI and returns the URIs of the removed files.
+func (si *SymbolIndex) RemoveDirectory(uri string) []string {
+	prefix := strings.TrimSuffix(uri, "/") + "/"
+
+	si.mutex.RLock()
+
+	var removed []string
+
+	for fileURI := range si.files {
+		if strings.HasPrefix(fileURI, prefix) {
+			removed = append(removed, fileURI)
+		}
+	}
+
+	si.mutex.RUnlock()
+
+	for _, fileURI := range removed {
+		si.RemoveFile(fileURI)
+	}
+
+	return removed
+}
+
 // UpdateFileVersion updates the version number for a file.
 func (si *SymbolIndex) UpdateFileVersion(uri string, version int32) {
 	si.mutex.Lock()
@@ -227,6 +402,7 @@ func (si *SymbolIndex) Clear() {
 
 	si.symbols = make(map[string][]SymbolLocation)
 	si.files = make(map[string]*FileInfo)
+	si.subtypes = make(map[string][]SymbolLocation)
 
 	log.Println("Symbol index cleared")
 }
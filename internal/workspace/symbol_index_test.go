@@ -241,6 +241,81 @@ func TestSymbolIndex_RemoveFile_WithSharedSymbolNames(t *testing.T) {
 	}
 }
 
+func TestSymbolIndex_RemoveDirectory(t *testing.T) {
+	index := NewSymbolIndex()
+
+	symbolRange := protocol.Range{
+		Start: protocol.Position{Line: 0, Character: 0},
+		End:   protocol.Position{Line: 0, Character: 5},
+	}
+
+	index.AddSymbol("a", protocol.SymbolKindFunction, "file:///src/lib/a.dws", symbolRange, "", "")
+	index.AddSymbol("b", protocol.SymbolKindFunction, "file:///src/lib/sub/b.dws", symbolRange, "", "")
+	index.AddSymbol("c", protocol.SymbolKindFunction, "file:///src/library.dws", symbolRange, "", "")
+
+	removed := index.RemoveDirectory("file:///src/lib")
+
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 removed files, got %d", len(removed))
+	}
+
+	if index.GetFileCount() != 1 {
+		t.Errorf("Expected 1 remaining file, got %d", index.GetFileCount())
+	}
+
+	if len(index.FindSymbol("c")) != 1 {
+		t.Error("Expected symbol from sibling file to remain")
+	}
+}
+
+func TestSymbolIndex_FindSubtypes(t *testing.T) {
+	index := NewSymbolIndex()
+
+	symbolRange := protocol.Range{
+		Start: protocol.Position{Line: 0, Character: 0},
+		End:   protocol.Position{Line: 2, Character: 4},
+	}
+
+	index.AddTypeSymbol("TBase", protocol.SymbolKindClass, testURI1, symbolRange, "class", nil)
+	index.AddTypeSymbol("TCircle", protocol.SymbolKindClass, testURI1, symbolRange, "class(TBase)", []string{"TBase", "IShape"})
+	index.AddTypeSymbol("TSquare", protocol.SymbolKindClass, testURI2, symbolRange, "class(TBase)", []string{"TBase"})
+
+	// Type names are matched case-insensitively
+	subtypes := index.FindSubtypes("tbase")
+	if len(subtypes) != 2 || subtypes[0].Name != "TCircle" || subtypes[1].Name != "TSquare" {
+		t.Fatalf("Expected TCircle and TSquare to derive from TBase, got %+v", subtypes)
+	}
+
+	if shapes := index.FindSubtypes("IShape"); len(shapes) != 1 || shapes[0].Name != "TCircle" {
+		t.Errorf("Expected TCircle to implement IShape, got %+v", shapes)
+	}
+
+	// Removing a file removes its types from the subtypes
+	index.RemoveFile(testURI1)
+
+	if subtypes := index.FindSubtypes("TBase"); len(subtypes) != 1 || subtypes[0].Name != "TSquare" {
+		t.Errorf("Expected only TSquare after removing %s, got %+v", testURI1, subtypes)
+	}
+
+	if shapes := index.FindSubtypes("IShape"); len(shapes) != 0 {
+		t.Errorf("Expected no subtypes of IShape after removing %s, got %+v", testURI1, shapes)
+	}
+
+	// Symbols restored from the index cache keep their supertypes
+	restored := NewSymbolIndex()
+	restored.addFileSymbols(testURI2, index.fileSymbols(testURI2))
+
+	if subtypes := restored.FindSubtypes("TBase"); len(subtypes) != 1 || subtypes[0].Name != "TSquare" {
+		t.Errorf("Expected TSquare to derive from TBase after restoring, got %+v", subtypes)
+	}
+
+	index.Clear()
+
+	if subtypes := index.FindSubtypes("TBase"); len(subtypes) != 0 {
+		t.Errorf("Expected no subtypes after Clear, got %+v", subtypes)
+	}
+}
+
 func TestSymbolIndex_FindSymbolsByKind(t *testing.T) {
 	index := NewSymbolIndex()
 
@@ -302,6 +377,30 @@ func TestSymbolIndex_FindSymbolsInFile(t *testing.T) {
 	}
 }
 
+func TestSymbolIndex_FindFilesByName(t *testing.T) {
+	index := NewSymbolIndex()
+
+	symbolRange := protocol.Range{
+		Start: protocol.Position{Line: 0, Character: 0},
+		End:   protocol.Position{Line: 0, Character: 10},
+	}
+
+	index.AddSymbol("Clamp", protocol.SymbolKindFunction, "file:///lib/Utils.pas", symbolRange, "", "")
+	index.AddSymbol("Clamp", protocol.SymbolKindFunction, "file:///src/utils.dws", symbolRange, "", "")
+	index.AddSymbol("Main", protocol.SymbolKindFunction, "file:///src/UtilsTest.dws", symbolRange, "", "")
+
+	files := index.FindFilesByName("UTILS")
+
+	expected := []string{"file:///lib/Utils.pas", "file:///src/utils.dws"}
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	if files := index.FindFilesByName("Missing"); len(files) != 0 {
+		t.Errorf("Expected no files, got %v", files)
+	}
+}
+
 func TestSymbolIndex_ContainerName(t *testing.T) {
 	index := NewSymbolIndex()
 
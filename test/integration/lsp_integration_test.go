@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/CWBudde/go-dws-lsp/internal/lsp"
+	"github.com/CWBudde/go-dws-lsp/internal/protocol317"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -33,7 +34,7 @@ func TestInitializeWorkflow(t *testing.T) {
 		t.Fatal("Initialize returned nil result")
 	}
 
-	initResult, ok := result.(protocol.InitializeResult)
+	initResult, ok := result.(protocol317.InitializeResult)
 	if !ok {
 		t.Fatalf("Initialize returned wrong type: %T", result)
 	}